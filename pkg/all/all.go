@@ -5,6 +5,7 @@ import (
 	"github.com/digitnxt/digit/pkg/discovery"
 	"github.com/digitnxt/digit/pkg/docs"
 	"github.com/digitnxt/digit/pkg/observability"
+	"github.com/digitnxt/digit/pkg/service"
 )
 
 // Observability functions.
@@ -13,16 +14,27 @@ var (
 	StartMetricsServer        = observability.StartMetricsServer
 	InitTracer                = observability.InitTracer
 	InstrumentHandler         = observability.InstrumentHandler
+	InstrumentationMiddleware = observability.InstrumentationMiddleware
 	RecordBusinessMetric      = observability.RecordBusinessMetric
+	RecordBusinessEvent       = observability.RecordBusinessEvent
+	StartSpan                 = observability.StartSpan
+	TracingMiddleware         = observability.TracingMiddleware
 )
 
 // Discovery functions.
 var (
-	RegisterService   = discovery.RegisterService
-	DeregisterService = discovery.DeregisterService
+	NewDiscoveryClient = discovery.NewClient
+	RegisterService    = discovery.RegisterService
+	DeregisterService  = discovery.DeregisterService
 )
 
 // Documentation functions.
 var (
 	SetupDocumentation = docs.SetupDocumentation
+	SetupSwaggerUI     = docs.SetupSwaggerUI
+)
+
+// Service runner.
+var (
+	RunService = service.Run
 )
@@ -0,0 +1,205 @@
+// Package apikey resolves account API keys issued by the account service to
+// the account and scopes they grant, and provides middleware that enforces
+// them on any Go service.
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is the request header carrying an API key. Keys are also accepted
+// as "Authorization: ApiKey <key>".
+const Header = "X-API-Key"
+
+// ErrInvalidKey is returned for keys that are unknown, revoked or expired.
+var ErrInvalidKey = errors.New("invalid API key")
+
+// Principal is the account an API key acts for.
+type Principal struct {
+	AccountID int        `json:"account_id"`
+	KeyID     int        `json:"key_id"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// HasScope reports whether the key was granted scope. A granted scope ending
+// in ":*" covers every scope with that prefix, e.g. "accounts:*" covers
+// "accounts:read"; a "*" anywhere else matches only itself.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(s, ":*"); ok && strings.HasPrefix(scope, prefix+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier resolves an API key to its principal.
+type Verifier interface {
+	Verify(ctx context.Context, key string) (*Principal, error)
+}
+
+// Client verifies keys against the account service's /api-keys/verify
+// endpoint. Successful verifications are cached for CacheTTL, which bounds
+// how long a revoked key keeps working.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	CacheTTL   time.Duration
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedPrincipal
+}
+
+type cachedPrincipal struct {
+	principal *Principal
+	expires   time.Time
+}
+
+// NewClient returns a Client for the account service at baseURL, e.g.
+// "http://account:8080", caching verifications for 30 seconds.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+		CacheTTL:   30 * time.Second,
+	}
+}
+
+// Verify resolves key, returning ErrInvalidKey when the account service
+// rejects it.
+func (c *Client) Verify(ctx context.Context, key string) (*Principal, error) {
+	id := sha256.Sum256([]byte(key))
+	now := time.Now()
+	if p := c.cached(id, now); p != nil {
+		return p, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"key": key})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api-keys/verify", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("verify API key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusBadRequest:
+		return nil, ErrInvalidKey
+	default:
+		return nil, fmt.Errorf("verify API key: account service returned %s", resp.Status)
+	}
+	var principal Principal
+	if err := json.NewDecoder(resp.Body).Decode(&principal); err != nil {
+		return nil, fmt.Errorf("decode API key verification: %w", err)
+	}
+
+	expires := now.Add(c.CacheTTL)
+	if principal.ExpiresAt != nil && principal.ExpiresAt.Before(expires) {
+		expires = *principal.ExpiresAt
+	}
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[[sha256.Size]byte]cachedPrincipal)
+	}
+	c.cache[id] = cachedPrincipal{principal: &principal, expires: expires}
+	c.mu.Unlock()
+	return &principal, nil
+}
+
+func (c *Client) cached(id [sha256.Size]byte, now time.Time) *Principal {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache[id]
+	if !ok {
+		return nil
+	}
+	if !entry.expires.After(now) {
+		delete(c.cache, id)
+		return nil
+	}
+	return entry.principal
+}
+
+// FromRequest extracts the API key from r, or returns "".
+func FromRequest(r *http.Request) string {
+	if key := r.Header.Get(Header); key != "" {
+		return key
+	}
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal stored by the middleware, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	return p, ok
+}
+
+// authenticate verifies the key on r and checks it grants every scope. It
+// returns the HTTP status to answer with when the request is refused.
+func authenticate(v Verifier, r *http.Request, scopes []string) (*Principal, int, error) {
+	key := FromRequest(r)
+	if key == "" {
+		return nil, http.StatusUnauthorized, errors.New("missing API key")
+	}
+	principal, err := v.Verify(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, ErrInvalidKey) {
+			return nil, http.StatusUnauthorized, err
+		}
+		return nil, http.StatusServiceUnavailable, err
+	}
+	for _, scope := range scopes {
+		if !principal.HasScope(scope) {
+			return nil, http.StatusForbidden, fmt.Errorf("API key lacks scope %q", scope)
+		}
+	}
+	return principal, 0, nil
+}
+
+// Middleware rejects requests without a valid API key granting all of
+// scopes, and stores the key's principal in the request context.
+func Middleware(v Verifier, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, status, err := authenticate(v, r, scopes)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), principal)))
+		})
+	}
+}
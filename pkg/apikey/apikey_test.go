@@ -0,0 +1,98 @@
+package apikey
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeAccountService accepts only "good-key" and counts verifications.
+func fakeAccountService(t *testing.T, calls *int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		var body struct{ Key string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/api-keys/verify" || body.Key != "good-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"valid": true, "account_id": 7, "key_id": 3, "scopes": []string{"accounts:*", "reports:read"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls int32
+	client := NewClient(fakeAccountService(t, &calls).URL)
+
+	handler := Middleware(client, "accounts:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := FromContext(r.Context())
+		if !ok || p.AccountID != 7 {
+			t.Errorf("principal = %+v, %v", p, ok)
+		}
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"missing", "", "", http.StatusUnauthorized},
+		{"invalid", Header, "bad-key", http.StatusUnauthorized},
+		{"header", Header, "good-key", http.StatusOK},
+		{"authorization", "Authorization", "ApiKey good-key", http.StatusOK},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+
+	// The valid key was verified once and then served from the cache.
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("account service called %d times, want 2", got)
+	}
+
+	forbidden := Middleware(client, "billing:read")(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("handler called without the required scope")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(Header, "good-key")
+	rec := httptest.NewRecorder()
+	forbidden.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	p := &Principal{Scopes: []string{"accounts:*", "reports:re*", "billing:read"}}
+	for scope, want := range map[string]bool{
+		"accounts:read":     true,
+		"accounts:keys:new": true,
+		"accounts":          false,
+		"accountsx:read":    false,
+		"billing:read":      true,
+		"billing:write":     false,
+		"reports:re*":       true,
+		"reports:read":      false,
+		"reports:revoke":    false,
+	} {
+		if got := p.HasScope(scope); got != want {
+			t.Errorf("HasScope(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
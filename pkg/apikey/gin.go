@@ -0,0 +1,24 @@
+package apikey
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// PrincipalKey is the gin.Context key under which GinMiddleware stores the
+// API key's principal.
+const PrincipalKey = "apikey.principal"
+
+// GinMiddleware is Middleware for Gin routers. The principal is available
+// from both the request context and c.Get(PrincipalKey).
+func GinMiddleware(v Verifier, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, status, err := authenticate(v, c.Request, scopes)
+		if err != nil {
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(PrincipalKey, principal)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), principal))
+		c.Next()
+	}
+}
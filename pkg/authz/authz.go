@@ -0,0 +1,86 @@
+// Package authz decides whether a subject may perform an action on a
+// resource. Decisions come from role- and attribute-based rules scoped to
+// accounts, evaluated locally by an Engine or remotely by the identity
+// service's POST /authorize endpoint, and are enforced on routes by Gin,
+// Echo and net/http middleware.
+package authz
+
+import (
+	"context"
+	"errors"
+)
+
+// Errors returned while authorizing a request.
+var (
+	// ErrUnauthenticated is returned when the request carries no valid
+	// access token.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrDenied is returned by middleware when the decision denies the
+	// request.
+	ErrDenied = errors.New("permission denied")
+)
+
+// Subject is the caller a decision is made for.
+type Subject struct {
+	ID        string   `json:"id"`
+	Roles     []string `json:"roles,omitempty"`
+	AccountID string   `json:"account_id,omitempty"`
+	// Attributes are further facts about the subject usable in rule
+	// conditions, e.g. "department".
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// HasRole reports whether the subject holds role.
+func (s *Subject) HasRole(role string) bool {
+	for _, r := range s.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Resource is what an action is performed on.
+type Resource struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+	// AccountID is the account owning the resource; rules scoped to the
+	// subject's account or subtree only match when it is set.
+	AccountID  string            `json:"account_id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Request asks whether Subject may perform Action on Resource. Actions are
+// written "<resource type>:<verb>", e.g. "accounts:update".
+type Request struct {
+	Subject  Subject  `json:"subject"`
+	Action   string   `json:"action"`
+	Resource Resource `json:"resource"`
+}
+
+// Decision is the outcome of a Request.
+type Decision struct {
+	Allowed bool `json:"allowed"`
+	// Rule names the rule that allowed or denied the request, empty when
+	// no rule matched.
+	Rule   string `json:"rule,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Decider makes authorization decisions.
+type Decider interface {
+	Decide(ctx context.Context, req Request) (Decision, error)
+}
+
+type subjectKey struct{}
+
+// NewContext returns a copy of ctx carrying s.
+func NewContext(ctx context.Context, s *Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, s)
+}
+
+// FromContext returns the subject stored by the middleware, if any.
+func FromContext(ctx context.Context) (*Subject, bool) {
+	s, ok := ctx.Value(subjectKey{}).(*Subject)
+	return s, ok
+}
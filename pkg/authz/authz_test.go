@@ -0,0 +1,184 @@
+package authz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/oidc"
+	"github.com/digitnxt/digit/pkg/oidc/oidctest"
+)
+
+var testPolicy = Policy{Rules: []Rule{
+	{Name: "admin", Roles: []string{"admin"}, Actions: []string{"*"}},
+	{Name: "district-admin", Roles: []string{"district-admin"}, Actions: []string{"accounts:read", "accounts:update"}, Scope: ScopeSubtree},
+	{Name: "read-own", Roles: []string{"user"}, Actions: []string{"accounts:read"}, Scope: ScopeOwn},
+	{Name: "no-closed", Effect: Deny, Actions: []string{"accounts:update"}, Conditions: []Condition{
+		{Attribute: "resource.status", Equals: "closed"},
+	}},
+	{Name: "owner", Actions: []string{"documents:*"}, Conditions: []Condition{
+		{Attribute: "resource.owner", EqualsAttribute: "subject.id"},
+	}},
+}}
+
+func TestEngine(t *testing.T) {
+	engine := NewEngine(testPolicy)
+	district := Subject{ID: "u1", Roles: []string{"district-admin"}, AccountID: "pb.amritsar"}
+	user := Subject{ID: "u2", Roles: []string{"user"}, AccountID: "pb.amritsar"}
+	admin := Subject{ID: "u3", Roles: []string{"admin"}}
+
+	tests := []struct {
+		name     string
+		subject  Subject
+		action   string
+		resource Resource
+		want     bool
+		rule     string
+	}{
+		{"admin anything", admin, "accounts:delete", Resource{Type: "account", AccountID: "ka"}, true, "admin"},
+		{"subtree self", district, "accounts:update", Resource{AccountID: "pb.amritsar"}, true, "district-admin"},
+		{"subtree child", district, "accounts:update", Resource{AccountID: "pb.amritsar.ward1"}, true, "district-admin"},
+		{"subtree sibling prefix", district, "accounts:update", Resource{AccountID: "pb.amritsarx"}, false, ""},
+		{"subtree parent", district, "accounts:update", Resource{AccountID: "pb"}, false, ""},
+		{"subtree other action", district, "accounts:delete", Resource{AccountID: "pb.amritsar"}, false, ""},
+		{"no account", district, "accounts:read", Resource{}, false, ""},
+		{"own", user, "accounts:read", Resource{AccountID: "pb.amritsar"}, true, "read-own"},
+		{"not own child", user, "accounts:read", Resource{AccountID: "pb.amritsar.ward1"}, false, ""},
+		{"deny overrides", district, "accounts:update", Resource{AccountID: "pb.amritsar", Attributes: map[string]string{"status": "closed"}}, false, "no-closed"},
+		{"deny overrides admin", admin, "accounts:update", Resource{Attributes: map[string]string{"status": "closed"}}, false, "no-closed"},
+		{"attribute match", user, "documents:read", Resource{Attributes: map[string]string{"owner": "u2"}}, true, "owner"},
+		{"attribute mismatch", user, "documents:read", Resource{Attributes: map[string]string{"owner": "u1"}}, false, ""},
+		{"attribute missing", user, "documents:read", Resource{}, false, ""},
+	}
+	for _, tc := range tests {
+		d, err := engine.Decide(context.Background(), Request{Subject: tc.subject, Action: tc.action, Resource: tc.resource})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if d.Allowed != tc.want || d.Rule != tc.rule {
+			t.Errorf("%s: decision = %+v, want allowed %v by %q", tc.name, d, tc.want, tc.rule)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	if err := DefaultPolicy().Validate(); err != nil {
+		t.Fatalf("default policy: %v", err)
+	}
+	bad := []Rule{
+		{Name: "no-actions"},
+		{Name: "effect", Actions: []string{"*"}, Effect: "maybe"},
+		{Name: "scope", Actions: []string{"*"}, Scope: "world"},
+		{Name: "attr", Actions: []string{"*"}, Conditions: []Condition{{Attribute: "status"}}},
+	}
+	for _, r := range bad {
+		if err := (Policy{Rules: []Rule{r}}).Validate(); err == nil {
+			t.Errorf("rule %s: expected validation error", r.Name)
+		}
+	}
+}
+
+// countingDecider counts decisions made by the wrapped Decider.
+type countingDecider struct {
+	Decider
+	calls int32
+}
+
+func (d *countingDecider) Decide(ctx context.Context, req Request) (Decision, error) {
+	atomic.AddInt32(&d.calls, 1)
+	return d.Decider.Decide(ctx, req)
+}
+
+func TestCache(t *testing.T) {
+	counter := &countingDecider{Decider: NewEngine(testPolicy)}
+	cache := NewCache(counter, time.Minute)
+	req := Request{Subject: Subject{ID: "u3", Roles: []string{"admin"}}, Action: "accounts:read"}
+	for i := 0; i < 3; i++ {
+		if d, err := cache.Decide(context.Background(), req); err != nil || !d.Allowed {
+			t.Fatalf("decision = %+v, %v", d, err)
+		}
+	}
+	req.Subject.Roles = nil
+	if d, _ := cache.Decide(context.Background(), req); d.Allowed {
+		t.Fatal("decision for a different subject served from cache")
+	}
+	if counter.calls != 2 {
+		t.Fatalf("decider called %d times, want 2", counter.calls)
+	}
+
+	cache.TTL = -time.Second
+	cache.entries = nil
+	cache.Decide(context.Background(), req)
+	cache.Decide(context.Background(), req)
+	if counter.calls != 4 {
+		t.Fatalf("expired decisions served from cache: %d calls", counter.calls)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+
+	verifier := oidc.NewVerifier(oidc.Config{Issuer: idp.URL, Audience: "digit"})
+
+	// The fake identity service allows every request carrying a token and
+	// counts the decisions it makes.
+	var remote int32
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/authorize" || r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		atomic.AddInt32(&remote, 1)
+		w.Write([]byte(`{"allowed":true,"rule":"remote","reason":"ok"}`))
+	}))
+	defer pdp.Close()
+
+	enforcer := NewEnforcer(verifier, NewCache(NewClient(pdp.URL), time.Minute))
+	handler := enforcer.Middleware("accounts:update", func(r *http.Request) Resource {
+		return Resource{Type: "account", AccountID: r.URL.Query().Get("account")}
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s, ok := FromContext(r.Context()); !ok || s.ID == "" {
+			t.Errorf("subject = %+v, %v", s, ok)
+		}
+	}))
+
+	local := NewEnforcer(verifier, NewEngine(testPolicy)).Middleware("accounts:update", func(r *http.Request) Resource {
+		return Resource{Type: "account", AccountID: r.URL.Query().Get("account")}
+	})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	district := idp.Sign(map[string]interface{}{"sub": "u1", "aud": "digit", "roles": []string{"district-admin"}, "account_id": "pb"})
+	other := idp.Sign(map[string]interface{}{"sub": "u2", "aud": "other", "roles": []string{"admin"}})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		token   string
+		account string
+		want    int
+	}{
+		{"missing token", local, "", "pb", http.StatusUnauthorized},
+		{"wrong audience", local, other, "pb", http.StatusUnauthorized},
+		{"local subtree", local, district, "pb.amritsar", http.StatusOK},
+		{"local outside subtree", local, district, "ka", http.StatusForbidden},
+		{"remote", handler, district, "ka", http.StatusOK},
+		{"remote cached", handler, district, "ka", http.StatusOK},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/?account="+tc.account, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d: %s", tc.name, rec.Code, tc.want, rec.Body)
+		}
+	}
+	if remote != 1 {
+		t.Errorf("remote decisions = %d, want 1", remote)
+	}
+}
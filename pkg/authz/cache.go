@@ -0,0 +1,88 @@
+package authz
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cache remembers the decisions of another Decider for TTL. Entries are
+// keyed by the whole request, so a change of the subject's roles or
+// account, which arrives with a new token, is never served a stale
+// decision; TTL bounds how long a policy change takes to apply.
+type Cache struct {
+	Decider Decider
+	TTL     time.Duration
+	// MaxEntries bounds the cache size. Zero means 10000.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]cachedDecision
+}
+
+type cachedDecision struct {
+	decision Decision
+	expires  time.Time
+}
+
+// NewCache returns a Cache over d.
+func NewCache(d Decider, ttl time.Duration) *Cache {
+	return &Cache{Decider: d, TTL: ttl}
+}
+
+// Decide returns the cached decision for req or asks the wrapped Decider.
+// Errors are not cached. The active span records whether the decision came
+// from the cache.
+func (c *Cache) Decide(ctx context.Context, req Request) (Decision, error) {
+	span := trace.SpanFromContext(ctx)
+	data, err := json.Marshal(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	id := sha256.Sum256(data)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[id]
+	c.mu.Unlock()
+	if ok && entry.expires.After(now) {
+		span.SetAttributes(attribute.Bool("authz.cached", true))
+		return entry.decision, nil
+	}
+	span.SetAttributes(attribute.Bool("authz.cached", false))
+
+	d, err := c.Decider.Decide(ctx, req)
+	if err != nil {
+		return d, err
+	}
+
+	max := c.MaxEntries
+	if max == 0 {
+		max = 10000
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[[sha256.Size]byte]cachedDecision)
+	}
+	if len(c.entries) >= max {
+		for k, e := range c.entries {
+			if !e.expires.After(now) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < max {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[id] = cachedDecision{decision: d, expires: now.Add(c.TTL)}
+	return d, nil
+}
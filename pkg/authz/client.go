@@ -0,0 +1,76 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type tokenKey struct{}
+
+// WithToken returns a copy of ctx carrying the caller's bearer token, which
+// Client forwards to the identity service.
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// Client asks the identity service's POST /authorize endpoint for
+// decisions. The service derives the subject from the caller's access
+// token, taken from the context (see WithToken), so Request.Subject is not
+// sent.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client for the identity service at baseURL, e.g.
+// "http://identity:8080".
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Decide asks the identity service for a decision on req.
+func (c *Client) Decide(ctx context.Context, req Request) (Decision, error) {
+	token, _ := ctx.Value(tokenKey{}).(string)
+	if token == "" {
+		return Decision{}, ErrUnauthenticated
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"action":   req.Action,
+		"resource": req.Resource,
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/authorize", bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return Decision{}, fmt.Errorf("authorize: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return Decision{}, ErrUnauthenticated
+	default:
+		return Decision{}, fmt.Errorf("authorize: identity service returned %s", resp.Status)
+	}
+	var d Decision
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return Decision{}, fmt.Errorf("decode authorization decision: %w", err)
+	}
+	return d, nil
+}
@@ -0,0 +1,31 @@
+package authz
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Echo is Middleware for Echo routers. The subject is available from both
+// the request context and c.Get(SubjectKey).
+func (e *Enforcer) Echo(action string, resource func(echo.Context) Resource) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var res Resource
+			if resource != nil {
+				res = resource(c)
+			}
+			r := c.Request()
+			subject, status, err := e.authorize(r, action, res)
+			if err != nil {
+				if status == http.StatusUnauthorized {
+					c.Response().Header().Set("WWW-Authenticate", "Bearer")
+				}
+				return c.JSON(status, echo.Map{"error": err.Error()})
+			}
+			c.Set(SubjectKey, subject)
+			c.SetRequest(r.WithContext(NewContext(r.Context(), subject)))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/digitnxt/digit/pkg/oidc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/digitnxt/digit/pkg/authz")
+
+// Enforcer authenticates bearer tokens issued by the identity service and
+// checks each request against a Decider.
+type Enforcer struct {
+	Verifier *oidc.Verifier
+	Decider  Decider
+}
+
+// NewEnforcer returns an Enforcer verifying tokens with v and deciding with
+// d, typically a Cache over a Client or Engine.
+func NewEnforcer(v *oidc.Verifier, d Decider) *Enforcer {
+	return &Enforcer{Verifier: v, Decider: d}
+}
+
+// tokenClaims are the identity service's access token claims relevant to
+// authorization.
+type tokenClaims struct {
+	AccountID string   `json:"account_id"`
+	Roles     []string `json:"roles"`
+	Scope     string   `json:"scope"`
+	ClientID  string   `json:"client_id"`
+}
+
+// Authenticate verifies the bearer token on r and returns its subject.
+func (e *Enforcer) Authenticate(ctx context.Context, r *http.Request) (*Subject, string, error) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(raw) == "" {
+		return nil, "", ErrUnauthenticated
+	}
+	raw = strings.TrimSpace(raw)
+	tok, err := e.Verifier.Verify(ctx, raw)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidToken) {
+			return nil, "", fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+		}
+		return nil, "", err
+	}
+	var claims tokenClaims
+	if err := tok.Claims(&claims); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	s := &Subject{ID: tok.Subject, Roles: claims.Roles, AccountID: claims.AccountID}
+	if claims.ClientID != "" || claims.Scope != "" {
+		s.Attributes = map[string]string{}
+		if claims.ClientID != "" {
+			s.Attributes["client_id"] = claims.ClientID
+		}
+		if claims.Scope != "" {
+			s.Attributes["scope"] = claims.Scope
+		}
+	}
+	return s, raw, nil
+}
+
+// authorize authenticates r and decides whether its subject may perform
+// action on res, tracing the decision. It returns the HTTP status to
+// answer with when the request is refused.
+func (e *Enforcer) authorize(r *http.Request, action string, res Resource) (*Subject, int, error) {
+	ctx, span := tracer.Start(r.Context(), "authz.Authorize", trace.WithAttributes(
+		attribute.String("authz.action", action),
+		attribute.String("authz.resource.type", res.Type),
+		attribute.String("authz.resource.id", res.ID),
+	))
+	defer span.End()
+
+	subject, raw, err := e.Authenticate(ctx, r)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, ErrUnauthenticated) {
+			return nil, http.StatusUnauthorized, err
+		}
+		return nil, http.StatusServiceUnavailable, err
+	}
+	span.SetAttributes(attribute.String("authz.subject", subject.ID))
+
+	d, err := e.Decider.Decide(WithToken(ctx, raw), Request{Subject: *subject, Action: action, Resource: res})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, ErrUnauthenticated) {
+			return nil, http.StatusUnauthorized, err
+		}
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("authorization unavailable: %w", err)
+	}
+	span.SetAttributes(
+		attribute.Bool("authz.allowed", d.Allowed),
+		attribute.String("authz.rule", d.Rule),
+	)
+	if !d.Allowed {
+		return nil, http.StatusForbidden, fmt.Errorf("%w: %s", ErrDenied, d.Reason)
+	}
+	return subject, 0, nil
+}
+
+// Middleware rejects requests whose bearer token's subject may not perform
+// action on the resource returned by resource, and stores the subject in
+// the request context. A nil resource means Resource{}.
+func (e *Enforcer) Middleware(action string, resource func(*http.Request) Resource) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var res Resource
+			if resource != nil {
+				res = resource(r)
+			}
+			subject, status, err := e.authorize(r, action, res)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				if status == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", "Bearer")
+				}
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), subject)))
+		})
+	}
+}
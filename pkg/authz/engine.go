@@ -0,0 +1,119 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Tree answers questions about the account hierarchy.
+type Tree interface {
+	// Contains reports whether account is ancestor or below it.
+	Contains(ctx context.Context, ancestor, account string) (bool, error)
+}
+
+// PathTree derives the hierarchy from account IDs that are paths, as with
+// DIGIT tenant IDs: "pb.amritsar" is below "pb".
+type PathTree struct {
+	// Separator between path segments; empty means ".".
+	Separator string
+}
+
+// Contains reports whether account equals ancestor or starts with ancestor
+// followed by the separator.
+func (t PathTree) Contains(_ context.Context, ancestor, account string) (bool, error) {
+	sep := t.Separator
+	if sep == "" {
+		sep = "."
+	}
+	return account == ancestor || strings.HasPrefix(account, ancestor+sep), nil
+}
+
+// Engine evaluates a Policy. Deny rules override allow rules and requests
+// no rule allows are denied.
+type Engine struct {
+	Policy Policy
+	Tree   Tree
+}
+
+// NewEngine returns an Engine for policy over the DIGIT tenant hierarchy.
+func NewEngine(policy Policy) *Engine {
+	return &Engine{Policy: policy, Tree: PathTree{}}
+}
+
+// Decide evaluates req against the policy.
+func (e *Engine) Decide(ctx context.Context, req Request) (Decision, error) {
+	var allowedBy string
+	for _, rule := range e.Policy.Rules {
+		ok, err := e.matches(ctx, &rule, &req)
+		if err != nil {
+			return Decision{}, err
+		}
+		if !ok {
+			continue
+		}
+		if rule.Effect == Deny {
+			return Decision{Rule: rule.Name, Reason: fmt.Sprintf("denied by rule %q", rule.Name)}, nil
+		}
+		if allowedBy == "" {
+			allowedBy = rule.Name
+		}
+	}
+	if allowedBy != "" {
+		return Decision{Allowed: true, Rule: allowedBy, Reason: fmt.Sprintf("allowed by rule %q", allowedBy)}, nil
+	}
+	return Decision{Reason: fmt.Sprintf("no rule allows %s", req.Action)}, nil
+}
+
+func (e *Engine) matches(ctx context.Context, rule *Rule, req *Request) (bool, error) {
+	if len(rule.Roles) > 0 {
+		found := false
+		for _, role := range rule.Roles {
+			if req.Subject.HasRole(role) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	found := false
+	for _, pattern := range rule.Actions {
+		if matchAction(pattern, req.Action) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	subject, resource := req.Subject.AccountID, req.Resource.AccountID
+	switch rule.Scope {
+	case ScopeOwn:
+		if subject == "" || resource != subject {
+			return false, nil
+		}
+	case ScopeSubtree:
+		if subject == "" || resource == "" {
+			return false, nil
+		}
+		tree := e.Tree
+		if tree == nil {
+			tree = PathTree{}
+		}
+		ok, err := tree.Contains(ctx, subject, resource)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	for _, c := range rule.Conditions {
+		if !c.holds(req) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,33 @@
+package authz
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubjectKey is the gin.Context and echo.Context key under which the
+// middleware stores the authorized subject.
+const SubjectKey = "authz.subject"
+
+// Gin is Middleware for Gin routers. The subject is available from both
+// the request context and c.Get(SubjectKey).
+func (e *Enforcer) Gin(action string, resource func(*gin.Context) Resource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var res Resource
+		if resource != nil {
+			res = resource(c)
+		}
+		subject, status, err := e.authorize(c.Request, action, res)
+		if err != nil {
+			if status == http.StatusUnauthorized {
+				c.Header("WWW-Authenticate", "Bearer")
+			}
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(SubjectKey, subject)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), subject))
+		c.Next()
+	}
+}
@@ -0,0 +1,191 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Effect is what a matching rule does.
+type Effect string
+
+// Rule effects. Deny rules override allow rules.
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Scope limits a rule to resources in some relation to the subject's
+// account.
+type Scope string
+
+// Rule scopes.
+const (
+	// ScopeAny matches resources of every account.
+	ScopeAny Scope = "any"
+	// ScopeOwn matches resources of the subject's account.
+	ScopeOwn Scope = "own"
+	// ScopeSubtree matches resources of the subject's account and of the
+	// accounts below it, e.g. "pb.amritsar" for a subject in "pb".
+	ScopeSubtree Scope = "subtree"
+)
+
+// Rule grants or denies actions.
+type Rule struct {
+	Name string `json:"name"`
+	// Effect defaults to Allow.
+	Effect Effect `json:"effect,omitempty"`
+	// Roles the rule applies to; empty means every authenticated subject.
+	Roles []string `json:"roles,omitempty"`
+	// Actions matched by the rule. A trailing "*" matches any suffix, so
+	// "accounts:*" covers "accounts:update" and "*" covers everything.
+	Actions []string `json:"actions"`
+	// Scope defaults to ScopeAny.
+	Scope Scope `json:"scope,omitempty"`
+	// Conditions must all hold for the rule to match.
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// Condition tests an attribute of the subject or resource. Attributes are
+// named "subject.<name>" or "resource.<name>"; besides custom attributes,
+// subject.id, subject.account_id, resource.type, resource.id and
+// resource.account_id are defined. Every comparison that is set must hold,
+// and a missing attribute never matches.
+type Condition struct {
+	Attribute string `json:"attribute"`
+	// Equals requires the attribute to have this value.
+	Equals string `json:"equals,omitempty"`
+	// In requires the attribute to be one of these values.
+	In []string `json:"in,omitempty"`
+	// EqualsAttribute requires the attribute to equal another attribute,
+	// e.g. resource.owner equal to subject.id.
+	EqualsAttribute string `json:"equals_attribute,omitempty"`
+}
+
+// Policy is an ordered set of rules.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// DefaultPolicy lets admins do anything and other users read their own
+// account.
+func DefaultPolicy() Policy {
+	return Policy{Rules: []Rule{
+		{Name: "admin", Roles: []string{"admin"}, Actions: []string{"*"}},
+		{Name: "read-own-account", Roles: []string{"user"}, Actions: []string{"accounts:read"}, Scope: ScopeOwn},
+	}}
+}
+
+// LoadPolicy reads a JSON policy from path and validates it.
+func LoadPolicy(path string) (Policy, error) {
+	var p Policy
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return p, fmt.Errorf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+// Validate reports rules with unknown effects, scopes or attributes.
+func (p Policy) Validate() error {
+	for i, r := range p.Rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		if len(r.Actions) == 0 {
+			return fmt.Errorf("rule %s: no actions", name)
+		}
+		switch r.Effect {
+		case "", Allow, Deny:
+		default:
+			return fmt.Errorf("rule %s: unknown effect %q", name, r.Effect)
+		}
+		switch r.Scope {
+		case "", ScopeAny, ScopeOwn, ScopeSubtree:
+		default:
+			return fmt.Errorf("rule %s: unknown scope %q", name, r.Scope)
+		}
+		for _, c := range r.Conditions {
+			for _, attr := range []string{c.Attribute, c.EqualsAttribute} {
+				if attr != "" && !strings.HasPrefix(attr, "subject.") && !strings.HasPrefix(attr, "resource.") {
+					return fmt.Errorf("rule %s: attribute %q must start with subject. or resource.", name, attr)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchAction reports whether pattern covers action.
+func matchAction(pattern, action string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(action, prefix)
+	}
+	return pattern == action
+}
+
+// lookup resolves a condition attribute against req.
+func lookup(req *Request, name string) (string, bool) {
+	kind, key, _ := strings.Cut(name, ".")
+	var v string
+	switch kind {
+	case "subject":
+		switch key {
+		case "id":
+			v = req.Subject.ID
+		case "account_id":
+			v = req.Subject.AccountID
+		default:
+			v = req.Subject.Attributes[key]
+		}
+	case "resource":
+		switch key {
+		case "type":
+			v = req.Resource.Type
+		case "id":
+			v = req.Resource.ID
+		case "account_id":
+			v = req.Resource.AccountID
+		default:
+			v = req.Resource.Attributes[key]
+		}
+	}
+	return v, v != ""
+}
+
+func (c Condition) holds(req *Request) bool {
+	v, ok := lookup(req, c.Attribute)
+	if !ok {
+		return false
+	}
+	if c.Equals != "" && v != c.Equals {
+		return false
+	}
+	if len(c.In) > 0 {
+		found := false
+		for _, want := range c.In {
+			if v == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if c.EqualsAttribute != "" {
+		other, ok := lookup(req, c.EqualsAttribute)
+		if !ok || other != v {
+			return false
+		}
+	}
+	return true
+}
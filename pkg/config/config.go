@@ -0,0 +1,261 @@
+// Package config loads typed service configuration. Fields of a struct are
+// filled from, in increasing order of precedence, their default, a
+// KEY=VALUE configuration file, environment variables and command-line
+// flags, as declared by struct tags:
+//
+//	type Config struct {
+//		Port    int           `env:"PORT" flag:"port" default:"8080" usage:"port to listen on"`
+//		Timeout time.Duration `env:"TIMEOUT" default:"5s"`
+//	}
+//
+// Keys in the file are the fields' env names, so a file can be shared with
+// docker-compose's env_file. Nested structs, including embedded ones, are
+// loaded field by field.
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileEnv and FileFlag name the configuration file. The flag takes
+// precedence.
+const (
+	FileEnv  = "CONFIG_FILE"
+	FileFlag = "config"
+)
+
+// field is a configurable struct field.
+type field struct {
+	value reflect.Value
+	name  string
+	env   string
+	flag  string
+	def   string
+	usage string
+}
+
+// Load fills cfg, a pointer to a struct, from its defaults, the
+// configuration file, the environment and args, the command-line
+// arguments without the program name. Defaults apply only to fields that
+// are still zero, so callers may preset values. Load returns flag.ErrHelp
+// when args ask for usage, which has then been printed.
+func Load(cfg interface{}, args []string) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load needs a pointer to a struct, not %T", cfg)
+	}
+	fields, err := collect(v.Elem(), "")
+	if err != nil {
+		return err
+	}
+
+	// Flags are parsed first, to find the file, but applied last.
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	file := fs.String(FileFlag, os.Getenv(FileEnv), "KEY=VALUE configuration file (env "+FileEnv+")")
+	flags := map[string]string{}
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+		name, usage := f.flag, f.usage
+		if f.env != "" {
+			usage = strings.TrimSpace(usage + " (env " + f.env + ")")
+		}
+		if f.def != "" {
+			usage += " (default " + f.def + ")"
+		}
+		fs.Func(name, usage, func(s string) error {
+			flags[name] = s
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if f.def != "" && f.value.IsZero() {
+			if err := set(f, f.def); err != nil {
+				return fmt.Errorf("config: default of %s: %w", f.name, err)
+			}
+		}
+	}
+	if *file != "" {
+		values, err := ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if s, ok := values[f.env]; ok && f.env != "" {
+				if err := set(f, s); err != nil {
+					return fmt.Errorf("config: %s in %s: %w", f.env, *file, err)
+				}
+			}
+		}
+	}
+	for _, f := range fields {
+		if s := os.Getenv(f.env); s != "" && f.env != "" {
+			if err := set(f, s); err != nil {
+				return fmt.Errorf("config: %s: %w", f.env, err)
+			}
+		}
+	}
+	for _, f := range fields {
+		if s, ok := flags[f.flag]; ok {
+			if err := set(f, s); err != nil {
+				return fmt.Errorf("config: -%s: %w", f.flag, err)
+			}
+		}
+	}
+	return nil
+}
+
+// collect returns the configurable fields of the struct v.
+func collect(v reflect.Value, prefix string) ([]field, error) {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		_, tagged := sf.Tag.Lookup("env")
+		if _, ok := sf.Tag.Lookup("flag"); ok {
+			tagged = true
+		}
+		if fv.Kind() == reflect.Struct && !tagged {
+			nested, err := collect(fv, prefix+sf.Name+".")
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nested...)
+			continue
+		}
+		if !tagged {
+			continue
+		}
+		f := field{
+			value: fv,
+			name:  prefix + sf.Name,
+			env:   sf.Tag.Get("env"),
+			flag:  sf.Tag.Get("flag"),
+			def:   sf.Tag.Get("default"),
+			usage: sf.Tag.Get("usage"),
+		}
+		if !supported(fv) {
+			return nil, fmt.Errorf("config: field %s has unsupported type %s", f.name, fv.Type())
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func supported(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return v.Type().Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// set parses s into f. Durations use time.ParseDuration and string slices
+// are comma-separated.
+func set(f field, s string) error {
+	v := f.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int, v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	}
+	return nil
+}
+
+// ReadFile reads a configuration file of KEY=VALUE lines. Blank lines and
+// lines starting with # are skipped, and values may be quoted.
+func ReadFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	defer f.Close()
+	values := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("config: %s:%d: expected KEY=VALUE", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// MustLoad is Load for main functions: it exits after printing usage, or
+// with an error when the configuration is invalid.
+func MustLoad(cfg interface{}) {
+	err := Load(cfg, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Service
+	Timeout time.Duration `env:"TEST_TIMEOUT" default:"5s"`
+	Roles   []string      `env:"TEST_ROLES" flag:"roles"`
+	Ratio   float64       `env:"TEST_RATIO" default:"0.5"`
+	ignored string
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.env")
+	os.WriteFile(path, []byte("# comment\nPORT=8081\nMETRICS_PORT=9000\nTEST_TIMEOUT=\"1m\"\nTEST_ROLES=a\n"), 0o600)
+	t.Setenv(FileEnv, path)
+	t.Setenv("METRICS_PORT", "9100")
+	t.Setenv("TEST_ROLES", "b")
+
+	cfg := testConfig{Service: Service{Name: "identity"}}
+	if err := Load(&cfg, []string{"-roles", "admin, citizen", "-consul-register=false"}); err != nil {
+		t.Fatal(err)
+	}
+	want := testConfig{
+		Service: Service{
+			Name:                    "identity",
+			Port:                    8081,
+			MetricsPort:             9100,
+			MetricsNamespace:        "digit",
+			LogLevel:                "info",
+			LogFormat:               "json",
+			TracesExporter:          "otlp",
+			TracesSampler:           "parentbased_traceidratio",
+			TracesSampleRatio:       1,
+			EventsSink:              "log",
+			KafkaBrokers:            []string{"kafka:9092"},
+			EventsTopic:             "business-events",
+			ConsulAddress:           "consul:8500",
+			DeregisterCriticalAfter: time.Minute,
+			Register:                false,
+		},
+		Timeout: time.Minute,
+		Roles:   []string{"admin", "citizen"},
+		Ratio:   0.5,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("cfg = %+v\nwant %+v", cfg, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv("PORT", "eighty")
+	if err := Load(&Service{}, nil); err == nil {
+		t.Error("invalid PORT accepted")
+	}
+	t.Setenv("PORT", "")
+	if err := Load(&Service{}, []string{"-no-such-flag"}); err == nil {
+		t.Error("unknown flag accepted")
+	}
+	var unsupported struct {
+		M map[string]string `env:"M"`
+	}
+	if err := Load(&unsupported, nil); err == nil {
+		t.Error("unsupported field accepted")
+	}
+	if err := Load(Service{}, nil); err == nil {
+		t.Error("non-pointer accepted")
+	}
+}
+
+func TestInstanceID(t *testing.T) {
+	s := Service{Name: "identity", Address: "10.0.0.7", Port: 8080}
+	if got := s.InstanceID(); got != "identity-10.0.0.7-8080" {
+		t.Errorf("InstanceID = %q", got)
+	}
+	if got := s.URL("/ping"); got != "http://10.0.0.7:8080/ping" {
+		t.Errorf("URL = %q", got)
+	}
+	s.ID = "identity-1"
+	if got := s.InstanceID(); got != "identity-1" {
+		t.Errorf("InstanceID = %q", got)
+	}
+}
+
+func TestOTLPEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		exporter, endpoint, want string
+	}{
+		{"otlp", "", "http://jaeger:4317"},
+		{"otlp-http", "", "http://jaeger:4318"},
+		{"otlp-http", "collector:4318", "collector:4318"},
+	} {
+		s := Service{TracesExporter: tc.exporter, TracesEndpoint: tc.endpoint}
+		if got := s.OTLPEndpoint(); got != tc.want {
+			t.Errorf("OTLPEndpoint(%s, %q) = %q, want %q", tc.exporter, tc.endpoint, got, tc.want)
+		}
+	}
+}
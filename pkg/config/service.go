@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Service is the configuration shared by every DIGIT service: where it
+// listens, where it serves metrics and exports traces, and how it
+// registers with Consul. Services embed it in their own configuration and
+// preset Name before loading.
+type Service struct {
+	Name string `env:"SERVICE_NAME" flag:"service-name" usage:"name registered with Consul and reported in traces"`
+	// ID identifies this instance in Consul. Empty means
+	// <name>-<address>-<port>, so that replicas register separately.
+	ID string `env:"SERVICE_ID" flag:"service-id" usage:"Consul service ID of this instance (default <name>-<address>-<port>)"`
+	// Address is the host other services reach this instance at. Empty
+	// means the hostname.
+	Address string `env:"SERVICE_ADDRESS" flag:"service-address" usage:"address advertised in Consul (default the hostname)"`
+	Port    int    `env:"PORT" flag:"port" default:"8080" usage:"HTTP port"`
+	// TrustedProxies are the IPs and CIDRs of the load balancers and
+	// gateways whose X-Forwarded-For and X-Real-IP headers name the client.
+	// Empty means none: the client is the peer of the connection.
+	TrustedProxies []string `env:"TRUSTED_PROXIES" flag:"trusted-proxies" usage:"comma-separated IPs or CIDRs of proxies trusted to report the client IP"`
+	// MetricsPort serves Prometheus metrics. Zero disables the listener.
+	MetricsPort int `env:"METRICS_PORT" flag:"metrics-port" default:"9464" usage:"Prometheus metrics port, 0 to disable"`
+	// Pprof serves runtime profiles on the metrics port.
+	Pprof bool `env:"PPROF_ENABLED" flag:"pprof" usage:"serve /debug/pprof on the metrics port"`
+	// MetricsNamespace prefixes the common metric names.
+	MetricsNamespace string `env:"METRICS_NAMESPACE" flag:"metrics-namespace" default:"digit" usage:"prefix of the common metric names"`
+	// LogLevel is the initial level; it can be changed at runtime with
+	// logging.LevelHandler.
+	LogLevel  string `env:"LOG_LEVEL" flag:"log-level" default:"info" usage:"minimum log level: debug, info, warn or error"`
+	LogFormat string `env:"LOG_FORMAT" flag:"log-format" default:"json" usage:"log format: json or text"`
+	// Version and Environment describe the deployment in traces.
+	Version     string `env:"SERVICE_VERSION" flag:"service-version" usage:"version reported in traces"`
+	Environment string `env:"DEPLOYMENT_ENVIRONMENT" flag:"environment" usage:"deployment environment reported in traces, e.g. staging"`
+	// TracesExporter is otlp (gRPC), otlp-http, stdout or none. An unset
+	// TracesEndpoint means the Jaeger port for the exporter; see
+	// OTLPEndpoint.
+	TracesExporter    string  `env:"OTEL_TRACES_EXPORTER" flag:"traces-exporter" default:"otlp" usage:"trace exporter: otlp, otlp-http, stdout or none"`
+	TracesEndpoint    string  `env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"otlp-endpoint" usage:"OTLP collector endpoint (default http://jaeger:4317, or http://jaeger:4318 for otlp-http)"`
+	TracesSampler     string  `env:"OTEL_TRACES_SAMPLER" flag:"traces-sampler" default:"parentbased_traceidratio" usage:"trace sampler, e.g. always_on or parentbased_traceidratio"`
+	TracesSampleRatio float64 `env:"OTEL_TRACES_SAMPLER_ARG" flag:"traces-sample-ratio" default:"1" usage:"fraction of traces sampled by the ratio samplers"`
+	// EventsSink receives business events: log, kafka or none.
+	EventsSink    string   `env:"BUSINESS_EVENTS_SINK" flag:"business-events-sink" default:"log" usage:"business event sink: log, kafka or none"`
+	KafkaBrokers  []string `env:"KAFKA_BROKERS" flag:"kafka-brokers" default:"kafka:9092" usage:"comma-separated Kafka brokers"`
+	EventsTopic   string   `env:"BUSINESS_EVENTS_TOPIC" flag:"business-events-topic" default:"business-events" usage:"Kafka topic of business events"`
+	ConsulAddress string   `env:"CONSUL_HTTP_ADDR" flag:"consul-addr" default:"consul:8500" usage:"Consul agent address"`
+	// The Consul ACL token, datacenter, namespace and TLS settings use the
+	// variables the Consul CLI reads.
+	ConsulToken      string `env:"CONSUL_HTTP_TOKEN" flag:"consul-token" usage:"Consul ACL token"`
+	ConsulDatacenter string `env:"CONSUL_DATACENTER" flag:"consul-datacenter" usage:"Consul datacenter (default the agent's)"`
+	ConsulNamespace  string `env:"CONSUL_NAMESPACE" flag:"consul-namespace" usage:"Consul Enterprise namespace"`
+	ConsulTLS        bool   `env:"CONSUL_HTTP_SSL" flag:"consul-tls" usage:"connect to Consul over HTTPS"`
+	ConsulCACert     string `env:"CONSUL_CACERT" flag:"consul-ca-cert" usage:"CA certificate file verifying Consul"`
+	ConsulClientCert string `env:"CONSUL_CLIENT_CERT" flag:"consul-client-cert" usage:"client certificate file for Consul"`
+	ConsulClientKey  string `env:"CONSUL_CLIENT_KEY" flag:"consul-client-key" usage:"client key file for Consul"`
+	// Tags are added to the Consul registration.
+	Tags []string `env:"SERVICE_TAGS" flag:"service-tags" usage:"comma-separated tags registered with Consul"`
+	// DeregisterCriticalAfter has Consul drop an instance whose health
+	// check has failed that long, e.g. after a crash. Zero keeps it.
+	DeregisterCriticalAfter time.Duration `env:"CONSUL_DEREGISTER_CRITICAL_AFTER" flag:"consul-deregister-critical-after" default:"1m" usage:"deregister instances critical this long, 0 to keep them"`
+	// Register controls whether the service registers with Consul.
+	Register bool `env:"CONSUL_REGISTER" flag:"consul-register" default:"true" usage:"register with Consul"`
+}
+
+// AdvertisedAddress returns Address, or the hostname when it is unset.
+func (s *Service) AdvertisedAddress() string {
+	if s.Address != "" {
+		return s.Address
+	}
+	if host, err := os.Hostname(); err == nil {
+		return host
+	}
+	return s.Name
+}
+
+// InstanceID returns ID, or one derived from the name, advertised address
+// and port when it is unset.
+func (s *Service) InstanceID() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	return fmt.Sprintf("%s-%s-%d", s.Name, s.AdvertisedAddress(), s.Port)
+}
+
+// OTLPEndpoint returns TracesEndpoint, or when it is unset the Jaeger
+// collector's port for TracesExporter: 4318 for otlp-http and 4317, gRPC,
+// otherwise.
+func (s *Service) OTLPEndpoint() string {
+	if s.TracesEndpoint != "" {
+		return s.TracesEndpoint
+	}
+	if s.TracesExporter == "otlp-http" {
+		return "http://jaeger:4318"
+	}
+	return "http://jaeger:4317"
+}
+
+// ListenAddr returns the address to serve HTTP on.
+func (s *Service) ListenAddr() string {
+	return fmt.Sprintf(":%d", s.Port)
+}
+
+// URL returns the URL other services reach path of this instance at.
+func (s *Service) URL(path string) string {
+	return fmt.Sprintf("http://%s:%d%s", s.AdvertisedAddress(), s.Port, path)
+}
@@ -0,0 +1,282 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/config"
+	"github.com/hashicorp/consul/api"
+)
+
+// Metadata keys of a Registration, read by services that discover others,
+// such as the model context service.
+const (
+	MetaVersion     = "version"
+	MetaSwaggerPath = "swagger_path"
+	MetaBasePath    = "base_path"
+)
+
+// Default check timings.
+const (
+	DefaultCheckInterval = 10 * time.Second
+	DefaultCheckTimeout  = 5 * time.Second
+)
+
+// Check statuses, for UpdateTTL.
+const (
+	StatusPassing  = api.HealthPassing
+	StatusWarning  = api.HealthWarning
+	StatusCritical = api.HealthCritical
+)
+
+// Option configures NewClient.
+type Option func(*api.Config)
+
+// WithAddress sets the address of the Consul agent, e.g. "consul:8500".
+func WithAddress(addr string) Option {
+	return func(c *api.Config) { c.Address = addr }
+}
+
+// WithToken sets the ACL token requests are made with.
+func WithToken(token string) Option {
+	return func(c *api.Config) { c.Token = token }
+}
+
+// WithDatacenter sets the datacenter requests are made in. Empty means the
+// agent's.
+func WithDatacenter(dc string) Option {
+	return func(c *api.Config) { c.Datacenter = dc }
+}
+
+// WithNamespace sets the Consul Enterprise namespace services are
+// registered in.
+func WithNamespace(ns string) Option {
+	return func(c *api.Config) { c.Namespace = ns }
+}
+
+// TLSConfig configures HTTPS to the Consul agent.
+type TLSConfig struct {
+	// CAFile verifies the agent's certificate. Empty means the system
+	// roots.
+	CAFile string
+	// CertFile and KeyFile are the client certificate, for agents that
+	// verify incoming connections.
+	CertFile string
+	KeyFile  string
+	// ServerName is the name the agent's certificate is checked against.
+	// Empty means the host of the address.
+	ServerName string
+	// InsecureSkipVerify disables certificate verification.
+	InsecureSkipVerify bool
+}
+
+// WithTLS connects to the agent over HTTPS as cfg describes.
+func WithTLS(cfg TLSConfig) Option {
+	return func(c *api.Config) {
+		c.Scheme = "https"
+		c.TLSConfig = api.TLSConfig{
+			Address:            cfg.ServerName,
+			CAFile:             cfg.CAFile,
+			CertFile:           cfg.CertFile,
+			KeyFile:            cfg.KeyFile,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		}
+	}
+}
+
+// ServiceOptions returns the options described by a service's shared
+// settings. Settings left empty keep the client's defaults.
+func ServiceOptions(s *config.Service) []Option {
+	var opts []Option
+	if s.ConsulAddress != "" {
+		opts = append(opts, WithAddress(s.ConsulAddress))
+	}
+	if s.ConsulToken != "" {
+		opts = append(opts, WithToken(s.ConsulToken))
+	}
+	if s.ConsulDatacenter != "" {
+		opts = append(opts, WithDatacenter(s.ConsulDatacenter))
+	}
+	if s.ConsulNamespace != "" {
+		opts = append(opts, WithNamespace(s.ConsulNamespace))
+	}
+	if s.ConsulTLS {
+		opts = append(opts, WithTLS(TLSConfig{
+			CAFile:   s.ConsulCACert,
+			CertFile: s.ConsulClientCert,
+			KeyFile:  s.ConsulClientKey,
+		}))
+	}
+	return opts
+}
+
+// Client registers services with a Consul agent. It is safe for concurrent
+// use and should be reused.
+type Client struct {
+	consul *api.Client
+}
+
+// NewClient returns a client configured by the CONSUL_* environment
+// variables the Consul CLI reads, then opts.
+func NewClient(opts ...Option) (*Client, error) {
+	cfg := api.DefaultConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	consul, err := api.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create Consul client: %w", err)
+	}
+	return &Client{consul: consul}, nil
+}
+
+// Registration describes a service instance.
+type Registration struct {
+	// ID identifies the instance; Name is the service it belongs to.
+	ID   string
+	Name string
+	// Address and Port are where the instance is reached.
+	Address string
+	Port    int
+	// Tags and Meta describe the instance to those who discover it; see
+	// MetaVersion, MetaSwaggerPath and MetaBasePath.
+	Tags []string
+	Meta map[string]string
+	// Checks decide whether the instance is healthy.
+	Checks []Check
+}
+
+// Check is a health check of a service instance. Exactly one of HTTP,
+// GRPC and TTL must be set.
+type Check struct {
+	// Name identifies the check within its service. Empty means its kind:
+	// "http", "grpc" or "ttl".
+	Name string
+	// HTTP is a URL that answers 2xx while the instance is healthy.
+	HTTP string
+	// GRPC is the host:port, optionally followed by /service, of a gRPC
+	// health service.
+	GRPC string
+	// TTL is how long the check stays passing after each UpdateTTL.
+	TTL time.Duration
+	// Interval and Timeout time the HTTP and gRPC checks. Zero means
+	// DefaultCheckInterval and DefaultCheckTimeout.
+	Interval time.Duration
+	Timeout  time.Duration
+	// DeregisterCriticalServiceAfter, if set, has Consul deregister the
+	// instance once the check has been critical that long, so that
+	// instances that crashed do not linger. Consul's minimum is a minute.
+	DeregisterCriticalServiceAfter time.Duration
+}
+
+// HTTPCheck returns a check of url.
+func HTTPCheck(url string) Check {
+	return Check{HTTP: url}
+}
+
+// GRPCCheck returns a check of the gRPC health service at target.
+func GRPCCheck(target string) Check {
+	return Check{GRPC: target}
+}
+
+// TTLCheck returns a check that fails unless updated with UpdateTTL
+// within ttl.
+func TTLCheck(ttl time.Duration) Check {
+	return Check{TTL: ttl}
+}
+
+// CheckID returns the ID of the check named name of the service instance
+// serviceID, for UpdateTTL.
+func CheckID(serviceID, name string) string {
+	return "service:" + serviceID + ":" + name
+}
+
+// kind returns the kind of check c is, or an error unless exactly one kind
+// is set.
+func (c Check) kind() (string, error) {
+	var kinds []string
+	if c.HTTP != "" {
+		kinds = append(kinds, "http")
+	}
+	if c.GRPC != "" {
+		kinds = append(kinds, "grpc")
+	}
+	if c.TTL != 0 {
+		kinds = append(kinds, "ttl")
+	}
+	if len(kinds) != 1 {
+		return "", errors.New("a check needs exactly one of HTTP, GRPC and TTL")
+	}
+	return kinds[0], nil
+}
+
+// agentCheck returns c as registered for the instance serviceID.
+func (c Check) agentCheck(serviceID string) (*api.AgentServiceCheck, error) {
+	kind, err := c.kind()
+	if err != nil {
+		return nil, err
+	}
+	name := c.Name
+	if name == "" {
+		name = kind
+	}
+	check := &api.AgentServiceCheck{
+		CheckID: CheckID(serviceID, name),
+		Name:    name,
+	}
+	if c.DeregisterCriticalServiceAfter > 0 {
+		check.DeregisterCriticalServiceAfter = c.DeregisterCriticalServiceAfter.String()
+	}
+	if kind == "ttl" {
+		check.TTL = c.TTL.String()
+		return check, nil
+	}
+	interval, timeout := c.Interval, c.Timeout
+	if interval == 0 {
+		interval = DefaultCheckInterval
+	}
+	if timeout == 0 {
+		timeout = DefaultCheckTimeout
+	}
+	check.HTTP, check.GRPC = c.HTTP, c.GRPC
+	check.Interval, check.Timeout = interval.String(), timeout.String()
+	return check, nil
+}
+
+// Register registers r with the agent, replacing any registration with the
+// same ID.
+func (c *Client) Register(ctx context.Context, r Registration) error {
+	if r.ID == "" || r.Name == "" {
+		return errors.New("a registration needs an ID and a name")
+	}
+	reg := &api.AgentServiceRegistration{
+		ID:      r.ID,
+		Name:    r.Name,
+		Address: r.Address,
+		Port:    r.Port,
+		Tags:    r.Tags,
+		Meta:    r.Meta,
+	}
+	for _, check := range r.Checks {
+		ac, err := check.agentCheck(r.ID)
+		if err != nil {
+			return fmt.Errorf("register %s: %w", r.ID, err)
+		}
+		reg.Checks = append(reg.Checks, ac)
+	}
+	return c.consul.Agent().ServiceRegisterOpts(reg, api.ServiceRegisterOpts{}.WithContext(ctx))
+}
+
+// Deregister removes the instance serviceID and its checks.
+func (c *Client) Deregister(ctx context.Context, serviceID string) error {
+	return c.consul.Agent().ServiceDeregisterOpts(serviceID, (&api.QueryOptions{}).WithContext(ctx))
+}
+
+// UpdateTTL sets the status of the TTL check checkID, one of
+// StatusPassing, StatusWarning and StatusCritical, with output as its
+// note, and restarts its TTL.
+func (c *Client) UpdateTTL(ctx context.Context, checkID, status, output string) error {
+	return c.consul.Agent().UpdateTTLOpts(checkID, output, status, (&api.QueryOptions{}).WithContext(ctx))
+}
@@ -0,0 +1,107 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestRegister(t *testing.T) {
+	var body api.AgentServiceRegistration
+	var token, dc string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/agent/service/register" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			return
+		}
+		token, dc = r.Header.Get("X-Consul-Token"), r.URL.Query().Get("dc")
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(WithAddress(strings.TrimPrefix(srv.URL, "http://")), WithToken("s3cr3t"), WithDatacenter("dc2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Register(context.Background(), Registration{
+		ID:      "identity-10.0.0.7-8080",
+		Name:    "identity",
+		Address: "10.0.0.7",
+		Port:    8080,
+		Tags:    []string{"v1", "auth"},
+		Meta:    map[string]string{MetaVersion: "1.2.3", MetaSwaggerPath: "/swagger/doc.json", MetaBasePath: "/identity"},
+		Checks: []Check{
+			{HTTP: "http://10.0.0.7:8080/health", DeregisterCriticalServiceAfter: time.Minute},
+			GRPCCheck("10.0.0.7:9090/identity"),
+			{Name: "heartbeat", TTL: 30 * time.Second},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "s3cr3t" || dc != "dc2" {
+		t.Errorf("token %q, dc %q", token, dc)
+	}
+	if !reflect.DeepEqual(body.Tags, []string{"v1", "auth"}) || body.Meta[MetaBasePath] != "/identity" {
+		t.Errorf("tags %v, meta %v", body.Tags, body.Meta)
+	}
+	want := api.AgentServiceChecks{
+		{CheckID: "service:identity-10.0.0.7-8080:http", Name: "http", HTTP: "http://10.0.0.7:8080/health", Interval: "10s", Timeout: "5s", DeregisterCriticalServiceAfter: "1m0s"},
+		{CheckID: "service:identity-10.0.0.7-8080:grpc", Name: "grpc", GRPC: "10.0.0.7:9090/identity", Interval: "10s", Timeout: "5s"},
+		{CheckID: "service:identity-10.0.0.7-8080:heartbeat", Name: "heartbeat", TTL: "30s"},
+	}
+	if !reflect.DeepEqual(body.Checks, want) {
+		t.Errorf("checks = %+v\nwant %+v", body.Checks, want)
+	}
+}
+
+func TestRegisterInvalid(t *testing.T) {
+	c, err := NewClient(WithAddress("127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []Registration{
+		{Name: "identity"},
+		{ID: "identity-1", Name: "identity", Checks: []Check{{}}},
+		{ID: "identity-1", Name: "identity", Checks: []Check{{HTTP: "http://identity/health", TTL: time.Second}}},
+	} {
+		if err := c.Register(context.Background(), r); err == nil {
+			t.Errorf("Register(%+v) accepted", r)
+		}
+	}
+}
+
+func TestDeregisterAndUpdateTTL(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Method+" "+r.URL.Path)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(WithAddress(strings.TrimPrefix(srv.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := c.UpdateTTL(ctx, CheckID("identity-1", "heartbeat"), StatusPassing, "ok"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Deregister(ctx, "identity-1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"PUT /v1/agent/check/update/service:identity-1:heartbeat",
+		"PUT /v1/agent/service/deregister/identity-1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
@@ -1,43 +1,56 @@
+// Package discovery registers DIGIT services with Consul.
 package discovery
 
 import (
-	"github.com/hashicorp/consul/api"
+	"context"
+	"os"
 )
 
+// legacyAddress is the agent RegisterService and DeregisterService have
+// always used when CONSUL_HTTP_ADDR is not set.
+const legacyAddress = "consul:8500"
+
+// legacyClient returns the client of RegisterService and DeregisterService.
+func legacyClient() (*Client, error) {
+	if os.Getenv("CONSUL_HTTP_ADDR") != "" {
+		return NewClient()
+	}
+	return NewClient(WithAddress(legacyAddress))
+}
+
 // RegisterService registers a service with Consul.
 // serviceID: Unique identifier for the service.
 // serviceName: The name of the service.
 // address: The service address.
 // port: The service port.
 // checkURL: The HTTP URL for health check.
+//
+// The agent is the one in CONSUL_HTTP_ADDR, or consul:8500.
+//
+// Deprecated: Use Client.Register, which takes the agent's address, reuses
+// its connection and takes tags, metadata and further checks.
 func RegisterService(serviceID, serviceName, address string, port int, checkURL string) error {
-	config := api.DefaultConfig()
-	config.Address = "consul:8500"
-	client, err := api.NewClient(config)
+	client, err := legacyClient()
 	if err != nil {
 		return err
 	}
-	registration := &api.AgentServiceRegistration{
+	return client.Register(context.Background(), Registration{
 		ID:      serviceID,
 		Name:    serviceName,
 		Address: address,
 		Port:    port,
-		Check: &api.AgentServiceCheck{
-			HTTP:     checkURL,
-			Interval: "10s",
-			Timeout:  "5s",
-		},
-	}
-	return client.Agent().ServiceRegister(registration)
+		Checks:  []Check{HTTPCheck(checkURL)},
+	})
 }
 
 // DeregisterService deregisters a service from Consul using its service ID.
+// The agent is the one in CONSUL_HTTP_ADDR, or consul:8500.
+//
+// Deprecated: Use Client.Deregister.
 func DeregisterService(serviceID string) error {
-	config := api.DefaultConfig()
-	config.Address = "consul:8500"
-	client, err := api.NewClient(config)
+	client, err := legacyClient()
 	if err != nil {
 		return err
 	}
-	return client.Agent().ServiceDeregister(serviceID)
-}
\ No newline at end of file
+	return client.Deregister(context.Background(), serviceID)
+}
@@ -10,8 +10,15 @@ import (
 // SetupDocumentation registers the Swagger and OpenAPI endpoints on the given Gin router.
 // swaggerJSONPath is the path to your swagger.json file.
 func SetupDocumentation(router *gin.Engine, swaggerJSONPath string) {
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	SetupSwaggerUI(router)
 	router.GET("/openapi.json", func(c *gin.Context) {
 		c.File(swaggerJSONPath)
 	})
 }
+
+// SetupSwaggerUI serves the Swagger UI at /swagger/index.html for the
+// document registered by the service's swag-generated docs package, which
+// is served at /swagger/doc.json.
+func SetupSwaggerUI(router *gin.Engine) {
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+}
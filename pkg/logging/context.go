@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TenantBaggageKey is the W3C baggage member naming the tenant, used when
+// the context carries no tenant set by WithTenant.
+const TenantBaggageKey = "tenant"
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx naming tenant, which is then logged
+// with every record logged with the context.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Tenant returns the tenant set by WithTenant, or else the tenant baggage
+// member propagated by the caller.
+func Tenant(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenant
+	}
+	return baggage.FromContext(ctx).Member(TenantBaggageKey).Value()
+}
+
+// contextHandler adds the trace_id, span_id and tenant of the record's
+// context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	if tenant := Tenant(ctx); tenant != "" {
+		r.AddAttrs(slog.String("tenant", tenant))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
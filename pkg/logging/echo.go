@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// EchoMiddleware is GinMiddleware for Echo routers.
+func EchoMiddleware(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			l := logger
+			if l == nil {
+				l = slog.Default()
+			}
+			start := time.Now()
+			r := c.Request()
+			c.SetRequest(r.WithContext(NewContext(r.Context(), requestLogger(l, r))))
+			err := next(c)
+			if err != nil {
+				// Let Echo write the error response now, so that its
+				// status is logged.
+				c.Error(err)
+			}
+			r, res := c.Request(), c.Response()
+			logRequest(r.Context(), l, request{
+				method:    r.Method,
+				route:     c.Path(),
+				path:      r.URL.Path,
+				clientIP:  c.RealIP(),
+				userAgent: r.UserAgent(),
+				requestID: r.Header.Get(RequestIDHeader),
+				status:    res.Status,
+				bytes:     int(res.Size),
+				duration:  time.Since(start),
+			})
+			return nil
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GinMiddleware logs every request once it has been served, replacing
+// Gin's text logger. Handlers get a logger carrying the request ID from
+// FromContext(c.Request.Context()). A nil logger means slog.Default().
+// Use it after observability.TracingMiddleware so that records carry the
+// request's trace.
+func GinMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l := logger
+		if l == nil {
+			l = slog.Default()
+		}
+		start := time.Now()
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), requestLogger(l, c.Request)))
+		c.Next()
+		logRequest(c.Request.Context(), l, request{
+			method:    c.Request.Method,
+			route:     c.FullPath(),
+			path:      c.Request.URL.Path,
+			clientIP:  c.ClientIP(),
+			userAgent: c.Request.UserAgent(),
+			requestID: c.Request.Header.Get(RequestIDHeader),
+			status:    c.Writer.Status(),
+			bytes:     max(c.Writer.Size(), 0),
+			duration:  time.Since(start),
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader is logged as request_id when set by the gateway.
+const RequestIDHeader = "X-Request-ID"
+
+// request describes a served request for logRequest.
+type request struct {
+	method, route, path, clientIP, userAgent, requestID string
+	status, bytes                                       int
+	duration                                            time.Duration
+}
+
+// logRequest logs r at info, or at warn for 4xx and error for 5xx
+// responses.
+func logRequest(ctx context.Context, logger *slog.Logger, r request) {
+	lvl := slog.LevelInfo
+	switch {
+	case r.status >= 500:
+		lvl = slog.LevelError
+	case r.status >= 400:
+		lvl = slog.LevelWarn
+	}
+	attrs := []slog.Attr{
+		slog.String("method", r.method),
+		slog.String("route", r.route),
+		slog.String("path", r.path),
+		slog.Int("status", r.status),
+		slog.Float64("duration_ms", float64(r.duration.Microseconds())/1000),
+		slog.Int("bytes", r.bytes),
+		slog.String("client_ip", r.clientIP),
+		slog.String("user_agent", r.userAgent),
+	}
+	if r.requestID != "" {
+		attrs = append(attrs, slog.String("request_id", r.requestID))
+	}
+	logger.LogAttrs(ctx, lvl, "request", attrs...)
+}
+
+// requestLogger returns the logger handlers of a request log with.
+func requestLogger(logger *slog.Logger, r *http.Request) *slog.Logger {
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		return logger.With("request_id", id)
+	}
+	return logger
+}
+
+// LevelHandler reports the current level on GET and changes it on PUT or
+// POST with {"level": "debug"}. Serve it on an internal port only.
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var body struct {
+				Level string `json:"level"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid request body"})
+				return
+			}
+			if err := SetLevel(body.Level); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			slog.Info("log level changed", "level", Level().String())
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"level": Level().String()})
+	})
+}
@@ -0,0 +1,123 @@
+// Package logging configures structured logging for DIGIT services on top of
+// log/slog. Records are written as JSON, carry the trace_id, span_id and
+// tenant of the context they are logged with, and pass through redactors
+// that keep personal data out of the logs. The level can be changed while
+// the service runs.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Formats accepted in Config.Format.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Config configures New.
+type Config struct {
+	// Level is the initial minimum level: debug, info, warn or error.
+	// Empty means info.
+	Level string
+	// Format is FormatJSON or FormatText. Empty means FormatJSON.
+	Format string
+	// Output receives the records. Nil means os.Stdout.
+	Output io.Writer
+	// Service, when set, is added to every record as "service".
+	Service string
+	// Redactors rewrite attributes before they are written. Nil means
+	// DefaultRedactors; use an empty slice to log everything.
+	Redactors []Redactor
+}
+
+// level is the level of loggers created by New, shared so that SetLevel
+// and LevelHandler change all of them.
+var level = new(slog.LevelVar)
+
+// New returns a logger as cfg describes.
+func New(cfg Config) (*slog.Logger, error) {
+	if cfg.Level != "" {
+		if err := SetLevel(cfg.Level); err != nil {
+			return nil, err
+		}
+	}
+	out := cfg.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	redactors := cfg.Redactors
+	if redactors == nil {
+		redactors = DefaultRedactors
+	}
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: replaceAttr(redactors),
+	}
+	var h slog.Handler
+	switch cfg.Format {
+	case "", FormatJSON:
+		h = slog.NewJSONHandler(out, opts)
+	case FormatText:
+		h = slog.NewTextHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	logger := slog.New(&contextHandler{Handler: h})
+	if cfg.Service != "" {
+		logger = logger.With("service", cfg.Service)
+	}
+	return logger, nil
+}
+
+// Setup creates a logger with New and makes it the default for both slog
+// and the log package, so that existing log.Printf calls are structured
+// too.
+func Setup(cfg Config) (*slog.Logger, error) {
+	logger, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	// slog.SetDefault routes the log package through the handler at info;
+	// log's own prefix and timestamp would only repeat the record's.
+	log.SetFlags(0)
+	return logger, nil
+}
+
+// SetLevel changes the minimum level of every logger created by New.
+func SetLevel(s string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return fmt.Errorf("invalid log level %q", s)
+	}
+	level.Set(l)
+	return nil
+}
+
+// Level returns the current minimum level.
+func Level() slog.Level {
+	return level.Level()
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying logger, e.g. one with the
+// request's attributes added by the request middleware.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx, or slog.Default().
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
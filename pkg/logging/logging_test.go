@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newBuffered returns a JSON logger writing to the returned buffer.
+func newBuffered(t *testing.T) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := New(Config{Output: &buf, Service: "identity"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetLevel("info") })
+	return logger, &buf
+}
+
+// records decodes the JSON lines in buf.
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestContextFields(t *testing.T) {
+	logger, buf := newBuffered(t)
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9},
+		SpanID:  trace.SpanID{0x00, 0xf0},
+	}))
+	member, _ := baggage.NewMember(TenantBaggageKey, "pb")
+	bag, _ := baggage.New(member)
+	logger.InfoContext(baggage.ContextWithBaggage(ctx, bag), "propagated")
+	logger.InfoContext(WithTenant(ctx, "pb.amritsar"), "explicit")
+	logger.Info("bare")
+
+	recs := records(t, buf)
+	if recs[0]["trace_id"] != "4bf90000000000000000000000000000" || recs[0]["span_id"] != "00f0000000000000" {
+		t.Errorf("trace fields = %v, %v", recs[0]["trace_id"], recs[0]["span_id"])
+	}
+	if recs[0]["tenant"] != "pb" || recs[1]["tenant"] != "pb.amritsar" {
+		t.Errorf("tenants = %v, %v", recs[0]["tenant"], recs[1]["tenant"])
+	}
+	if _, ok := recs[2]["trace_id"]; ok || recs[2]["service"] != "identity" {
+		t.Errorf("bare record = %v", recs[2])
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	logger, buf := newBuffered(t)
+	logger.Info("login by asha@example.com from +919876543210",
+		"password", "hunter2",
+		slog.Group("req", "Authorization", "Bearer abc"),
+		"user_id", "42",
+	)
+	rec := records(t, buf)[0]
+	if rec["msg"] != "login by a***@example.com from +**********10" {
+		t.Errorf("msg = %q", rec["msg"])
+	}
+	if rec["password"] != Redacted || rec["req"].(map[string]interface{})["Authorization"] != Redacted {
+		t.Errorf("secrets logged: %v", rec)
+	}
+	if rec["user_id"] != "42" {
+		t.Errorf("user_id = %v", rec["user_id"])
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	logger, buf := newBuffered(t)
+	logger.Debug("hidden")
+
+	rec := httptest.NewRecorder()
+	LevelHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level": "debug"}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "DEBUG") {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	logger.Debug("shown")
+	if got := len(records(t, buf)); got != 1 {
+		t.Errorf("logged %d records, want 1", got)
+	}
+
+	rec = httptest.NewRecorder()
+	LevelHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level": "loud"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid level: status = %d", rec.Code)
+	}
+}
+
+func TestGinMiddleware(t *testing.T) {
+	logger, buf := newBuffered(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(GinMiddleware(logger))
+	r.GET("/users/:id", func(c *gin.Context) {
+		FromContext(c.Request.Context()).Info("handling")
+		c.String(http.StatusNotFound, "no such user")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users/7?email=asha@example.com", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	recs := records(t, buf)
+	if len(recs) != 2 || recs[0]["request_id"] != "req-1" {
+		t.Fatalf("records = %v", recs)
+	}
+	got := recs[1]
+	if got["level"] != "WARN" || got["route"] != "/users/:id" || got["path"] != "/users/7" || got["status"] != 404.0 || got["bytes"] != 12.0 {
+		t.Errorf("request record = %v", got)
+	}
+}
+
+func TestEchoMiddleware(t *testing.T) {
+	logger, buf := newBuffered(t)
+	e := echo.New()
+	e.Use(EchoMiddleware(logger))
+	e.GET("/accounts/:id", func(c echo.Context) error {
+		return errors.New("database down")
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accounts/1", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d", rec.Code)
+	}
+	got := records(t, buf)[0]
+	if got["level"] != "ERROR" || got["route"] != "/accounts/:id" || got["status"] != 500.0 {
+		t.Errorf("request record = %v", got)
+	}
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces redacted values.
+const Redacted = "[REDACTED]"
+
+// Redactor rewrites an attribute before it is written, e.g. to hide
+// personal data. groups are the names of the groups enclosing it.
+type Redactor func(groups []string, a slog.Attr) slog.Attr
+
+// DefaultRedactors hide credentials and contact details by attribute name
+// and mask email addresses and international (+country code) phone
+// numbers in any string value, including the message.
+var DefaultRedactors = []Redactor{
+	RedactKeys("password", "new_password", "secret", "client_secret", "token", "access_token",
+		"refresh_token", "authorization", "cookie", "otp", "api_key"),
+	MaskPattern(emailPattern, maskEmail),
+	MaskPattern(mobilePattern, maskMobile),
+}
+
+// RedactKeys replaces the value of attributes named one of keys, compared
+// case-insensitively, with Redacted.
+func RedactKeys(keys ...string) Redactor {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[strings.ToLower(k)] = true
+	}
+	return func(_ []string, a slog.Attr) slog.Attr {
+		if set[strings.ToLower(a.Key)] {
+			return slog.String(a.Key, Redacted)
+		}
+		return a
+	}
+}
+
+// MaskPattern rewrites every match of re in string values, including the
+// message, with mask.
+func MaskPattern(re *regexp.Regexp, mask func(string) string) Redactor {
+	return func(_ []string, a slog.Attr) slog.Attr {
+		if a.Value.Kind() != slog.KindString {
+			return a
+		}
+		if s := a.Value.String(); re.MatchString(s) {
+			return slog.String(a.Key, re.ReplaceAllStringFunc(s, mask))
+		}
+		return a
+	}
+}
+
+var (
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	mobilePattern = regexp.MustCompile(`\+\d[\d -]{7,}\d`)
+)
+
+// maskEmail keeps the first character of the local part and the domain:
+// a***@example.com.
+func maskEmail(s string) string {
+	local, domain, _ := strings.Cut(s, "@")
+	return local[:1] + "***@" + domain
+}
+
+// maskMobile keeps the last two digits: +**********10.
+func maskMobile(s string) string {
+	digits := 0
+	b := []byte(s)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] >= '0' && b[i] <= '9' {
+			digits++
+			if digits > 2 {
+				b[i] = '*'
+			}
+		}
+	}
+	return string(b)
+}
+
+// replaceAttr applies redactors in order to every attribute except the
+// built-in time, level and source and the trace identifiers.
+func replaceAttr(redactors []Redactor) func([]string, slog.Attr) slog.Attr {
+	if len(redactors) == 0 {
+		return nil
+	}
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 {
+			switch a.Key {
+			case slog.TimeKey, slog.LevelKey, slog.SourceKey, "trace_id", "span_id":
+				return a
+			}
+		}
+		for _, r := range redactors {
+			a = r(groups, a)
+		}
+		return a
+	}
+}
@@ -0,0 +1,226 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// checkTimeout bounds each readiness check.
+const checkTimeout = 2 * time.Second
+
+// HealthCheck reports whether a dependency, such as a database, is usable.
+type HealthCheck func(ctx context.Context) error
+
+// AdminConfig configures an AdminServer.
+type AdminConfig struct {
+	// Addr is the address to listen on, e.g. ":9464".
+	Addr string
+	// Registry is served at /metrics. Nil means the default Prometheus
+	// registry.
+	Registry *prometheus.Registry
+	// Pprof serves the runtime profiles at /debug/pprof/.
+	Pprof bool
+	// BuildInfo is served at /buildinfo; see ReadBuildInfo.
+	BuildInfo BuildInfo
+	// Endpoints are further handlers, such as logging.LevelHandler.
+	Endpoints []Endpoint
+}
+
+// AdminServer serves the operational endpoints of a service on an internal
+// port: /metrics, /healthz, /readyz, /buildinfo, optionally /debug/pprof/
+// and any further endpoints. /healthz answers 200 while the process
+// serves; /readyz answers 200 only when every registered check passes and
+// the server is not shutting down, and 503 otherwise.
+type AdminServer struct {
+	cfg      AdminConfig
+	srv      *http.Server
+	ln       net.Listener
+	draining atomic.Bool
+
+	mu     sync.Mutex
+	checks map[string]HealthCheck
+}
+
+// NewAdminServer returns an admin server configured by cfg. Call Start to
+// serve it.
+func NewAdminServer(cfg AdminConfig) *AdminServer {
+	s := &AdminServer{cfg: cfg, checks: make(map[string]HealthCheck)}
+	s.srv = &http.Server{Addr: cfg.Addr, Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	return s
+}
+
+// AddCheck registers a readiness check under name, replacing any check of
+// that name. Checks may be added while the server runs.
+func (s *AdminServer) AddCheck(name string, check HealthCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks[name] = check
+}
+
+// Handler returns the handler serving the admin endpoints.
+func (s *AdminServer) Handler() http.Handler {
+	var reg prometheus.Registerer = prometheus.DefaultRegisterer
+	var gatherer prometheus.Gatherer = prometheus.DefaultGatherer
+	if s.cfg.Registry != nil {
+		reg, gatherer = s.cfg.Registry, s.cfg.Registry
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler(reg, gatherer))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/readyz", s.serveReady)
+	mux.HandleFunc("/buildinfo", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.cfg.BuildInfo)
+	})
+	if s.cfg.Pprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	for _, e := range s.cfg.Endpoints {
+		mux.Handle(e.Pattern, e.Handler)
+	}
+	return mux
+}
+
+// serveReady runs the readiness checks concurrently and reports each
+// failure by name.
+func (s *AdminServer) serveReady(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "shutting down"})
+		return
+	}
+	s.mu.Lock()
+	checks := make(map[string]HealthCheck, len(s.checks))
+	for name, check := range s.checks {
+		checks[name] = check
+	}
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed = map[string]string{}
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := check(ctx); err != nil {
+				mu.Lock()
+				failed[name] = err.Error()
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "unavailable", "checks": failed})
+		return
+	}
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "checks": names})
+}
+
+// Start listens on the configured address and serves in the background.
+// It returns an error if the address cannot be listened on.
+func (s *AdminServer) Start() error {
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("admin server stopped", "addr", ln.Addr().String(), "error", err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on once started, or the
+// configured address before.
+func (s *AdminServer) Addr() string {
+	if s.ln != nil {
+		return s.ln.Addr().String()
+	}
+	return s.cfg.Addr
+}
+
+// Drain fails readiness from now on, while the other endpoints keep
+// serving, so that load balancers stop routing to the service before it
+// stops serving requests.
+func (s *AdminServer) Drain() {
+	s.draining.Store(true)
+}
+
+// Shutdown drains the server and stops it gracefully, waiting for requests
+// in progress until ctx is done.
+func (s *AdminServer) Shutdown(ctx context.Context) error {
+	s.Drain()
+	return s.srv.Shutdown(ctx)
+}
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Service   string `json:"service"`
+	Version   string `json:"version,omitempty"`
+	GoVersion string `json:"go_version"`
+	Path      string `json:"path,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// ReadBuildInfo returns the build information of the running binary,
+// including the VCS revision it was built from when known. An empty
+// version means that of the main module.
+func ReadBuildInfo(service, version string) BuildInfo {
+	info := BuildInfo{Service: service, Version: version}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion, info.Path = bi.GoVersion, bi.Main.Path
+	if info.Version == "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.Time = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,111 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAdminServer(t *testing.T) {
+	t.Parallel()
+	reg := prometheus.NewRegistry()
+	requests := prometheus.NewCounter(prometheus.CounterOpts{Name: "admin_test_requests_total", Help: "Requests."})
+	reg.MustRegister(requests)
+	requests.Inc()
+
+	s := NewAdminServer(AdminConfig{
+		Addr:      "127.0.0.1:0",
+		Registry:  reg,
+		Pprof:     true,
+		BuildInfo: BuildInfo{Service: "identity", Version: "1.2.3", GoVersion: "go1.24"},
+	})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get("http://" + s.Addr() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("/metrics"); code != http.StatusOK || !strings.Contains(body, "admin_test_requests_total 1") {
+		t.Errorf("/metrics = %d %q", code, body)
+	} else if strings.Contains(body, "go_goroutines") {
+		t.Error("/metrics serves the default registry")
+	}
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz = %d", code)
+	}
+	if code, _ := get("/debug/pprof/"); code != http.StatusOK {
+		t.Errorf("/debug/pprof/ = %d", code)
+	}
+	var info BuildInfo
+	if _, body := get("/buildinfo"); json.Unmarshal([]byte(body), &info) != nil || info.Service != "identity" || info.Version != "1.2.3" {
+		t.Errorf("/buildinfo = %s", body)
+	}
+
+	s.AddCheck("cache", func(context.Context) error { return nil })
+	if code, body := get("/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz = %d %s", code, body)
+	}
+	s.AddCheck("database", func(context.Context) error { return errors.New("connection refused") })
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, `"database":"connection refused"`) {
+		t.Errorf("/readyz with a failing check = %d %s", code, body)
+	}
+
+	s.AddCheck("database", func(context.Context) error { return nil })
+	s.Drain()
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "shutting down") {
+		t.Errorf("/readyz while draining = %d %s", code, body)
+	}
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz while draining = %d", code)
+	}
+}
+
+func TestAdminServerShutdown(t *testing.T) {
+	t.Parallel()
+	s := NewAdminServer(AdminConfig{Addr: "127.0.0.1:0", Registry: prometheus.NewRegistry()})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addr := s.Addr()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get("http://" + addr + "/healthz"); err == nil {
+		t.Error("server still serving after Shutdown")
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/debug/pprof/ served without Pprof: %d", rec.Code)
+	}
+}
+
+func TestStartMetricsServerPortInUse(t *testing.T) {
+	t.Parallel()
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if s, err := StartMetricsServer(ln.Addr().(*net.TCPAddr).Port); err == nil {
+		s.Shutdown(context.Background())
+		t.Fatal("started on a port in use")
+	}
+}
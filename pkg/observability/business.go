@@ -0,0 +1,230 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/config"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Business event sinks.
+const (
+	SinkLog   = "log"
+	SinkKafka = "kafka"
+	SinkNone  = "none"
+)
+
+// BusinessEvent is something of business interest that a service did, such
+// as a payment collected or a certificate issued. Every event is sent to the
+// event sink in full; only What, How and Account, which take few values,
+// label the business metrics, and HowMuch is added to their value.
+type BusinessEvent struct {
+	// Who performed the action, e.g. a user ID.
+	Who string `json:"who,omitempty"`
+	// What happened, e.g. "PropertyTaxPaid". It labels the metrics, so it
+	// must come from a fixed set.
+	What string `json:"what"`
+	// Why it happened, e.g. "AnnualAssessment".
+	Why string `json:"why,omitempty"`
+	// When it happened. Zero means when it is recorded.
+	When time.Time `json:"when"`
+	// How it was done, e.g. "HTTP" or "Counter". It labels the metrics.
+	How string `json:"how,omitempty"`
+	// Where it was done, e.g. an office or ward.
+	Where string `json:"where,omitempty"`
+	// Whom it was done for, e.g. a property or citizen ID.
+	Whom string `json:"whom,omitempty"`
+	// Account is the tenant the event belongs to. It labels the metrics.
+	Account string `json:"account,omitempty"`
+	// HowMuch is the amount involved, e.g. the sum paid.
+	HowMuch float64 `json:"howmuch"`
+}
+
+// EventSink receives the business events recorded by RecordBusinessEvent.
+type EventSink interface {
+	Emit(ctx context.Context, e BusinessEvent) error
+}
+
+// sinkHolder lets the sink be swapped atomically.
+type sinkHolder struct{ EventSink }
+
+var eventSink atomic.Pointer[sinkHolder]
+
+func init() {
+	SetEventSink(LogSink{})
+}
+
+// SetEventSink sends recorded business events to s. Nil discards them. The
+// default sink is LogSink{}.
+func SetEventSink(s EventSink) {
+	eventSink.Store(&sinkHolder{s})
+}
+
+// RecordBusinessEvent counts e in digit_business_events_total, adds HowMuch
+// to digit_business_event_value_total, both labelled by what, how and
+// account, and sends e to the event sink. A counter cannot decrease, so a
+// negative HowMuch, such as a refund, is left out of the value and logged;
+// the event itself is still counted and sent. A sink failure is logged and
+// does not affect the caller.
+func RecordBusinessEvent(ctx context.Context, e BusinessEvent) {
+	if e.When.IsZero() {
+		e.When = time.Now()
+	}
+	BusinessEventCounter.WithLabelValues(e.What, e.How, e.Account).Inc()
+	switch {
+	case e.HowMuch < 0:
+		slog.WarnContext(ctx, "negative business event amount not added to value", "what", e.What, "howmuch", e.HowMuch)
+	case e.HowMuch > 0:
+		BusinessEventValue.WithLabelValues(e.What, e.How, e.Account).Add(e.HowMuch)
+	}
+	if s := eventSink.Load().EventSink; s != nil {
+		if err := s.Emit(ctx, e); err != nil {
+			slog.WarnContext(ctx, "failed to emit business event", "what", e.What, "error", err)
+		}
+	}
+}
+
+// RecordBusinessMetric records a business event given as strings.
+//
+// Deprecated: Use RecordBusinessEvent. when is parsed as RFC 3339 and
+// howmuch as a number; values that do not parse are taken as now and zero.
+func RecordBusinessMetric(who, what, why, when, how, where, whom, account, howmuch string) {
+	e := BusinessEvent{Who: who, What: what, Why: why, How: how, Where: where, Whom: whom, Account: account}
+	e.When, _ = time.Parse(time.RFC3339, when)
+	e.HowMuch, _ = strconv.ParseFloat(howmuch, 64)
+	RecordBusinessEvent(context.Background(), e)
+}
+
+// LogSink writes business events to a structured log as "business event"
+// records, which carry the trace of the context when the logger comes from
+// the logging package.
+type LogSink struct {
+	// Logger receives the events. Nil means slog.Default().
+	Logger *slog.Logger
+}
+
+// Emit implements EventSink.
+func (s LogSink) Emit(ctx context.Context, e BusinessEvent) error {
+	logger := s.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.LogAttrs(ctx, slog.LevelInfo, "business event",
+		slog.String("who", e.Who),
+		slog.String("what", e.What),
+		slog.String("why", e.Why),
+		slog.Time("when", e.When),
+		slog.String("how", e.How),
+		slog.String("where", e.Where),
+		slog.String("whom", e.Whom),
+		slog.String("account", e.Account),
+		slog.Float64("howmuch", e.HowMuch),
+	)
+	return nil
+}
+
+// eventMessage is the JSON value of a business event on Kafka.
+type eventMessage struct {
+	BusinessEvent
+	Service string `json:"service,omitempty"`
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// KafkaSink publishes business events as JSON to a Kafka topic, keyed by
+// account so that each account's events stay in order. Messages are sent
+// in batches in the background; Close flushes them.
+type KafkaSink struct {
+	service string
+	writer  *kafka.Writer
+}
+
+// NewKafkaSink returns a sink publishing to topic on brokers. service is
+// recorded in each message.
+func NewKafkaSink(brokers []string, topic, service string) *KafkaSink {
+	return &KafkaSink{
+		service: service,
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Topic:                  topic,
+			Balancer:               &kafka.Hash{},
+			BatchTimeout:           100 * time.Millisecond,
+			Async:                  true,
+			AllowAutoTopicCreation: true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					slog.Warn("failed to publish business events", "topic", topic, "count", len(messages), "error", err)
+				}
+			},
+		},
+	}
+}
+
+// Emit implements EventSink.
+func (s *KafkaSink) Emit(ctx context.Context, e BusinessEvent) error {
+	msg := eventMessage{BusinessEvent: e, Service: s.service}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		msg.TraceID = sc.TraceID().String()
+	}
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.writer.WriteMessages(ctx, kafka.Message{Key: []byte(e.Account), Value: value})
+}
+
+// Close flushes pending events and closes the connections to the brokers.
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+// EventConfig configures InitEvents.
+type EventConfig struct {
+	// Sink is log, kafka or none. Empty means log.
+	Sink string
+	// Brokers and Topic are where the kafka sink publishes.
+	Brokers []string
+	Topic   string
+	// ServiceName is recorded in the events published to Kafka.
+	ServiceName string
+}
+
+// ServiceEventConfig returns the EventConfig described by a service's
+// shared settings.
+func ServiceEventConfig(s *config.Service) EventConfig {
+	return EventConfig{
+		Sink:        s.EventsSink,
+		Brokers:     s.KafkaBrokers,
+		Topic:       s.EventsTopic,
+		ServiceName: s.Name,
+	}
+}
+
+// InitEvents installs the event sink cfg describes and returns a function
+// that flushes and closes it.
+func InitEvents(cfg EventConfig) (func(context.Context) error, error) {
+	nop := func(context.Context) error { return nil }
+	switch cfg.Sink {
+	case "", SinkLog:
+		SetEventSink(LogSink{})
+		return nop, nil
+	case SinkNone:
+		SetEventSink(nil)
+		return nop, nil
+	case SinkKafka:
+		if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+			return nil, fmt.Errorf("kafka event sink needs brokers and a topic")
+		}
+		s := NewKafkaSink(cfg.Brokers, cfg.Topic, cfg.ServiceName)
+		SetEventSink(s)
+		return func(context.Context) error { return s.Close() }, nil
+	default:
+		return nil, fmt.Errorf("unknown business event sink %q", cfg.Sink)
+	}
+}
@@ -0,0 +1,102 @@
+package observability
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type sinkFunc func(context.Context, BusinessEvent) error
+
+func (f sinkFunc) Emit(ctx context.Context, e BusinessEvent) error { return f(ctx, e) }
+
+func TestRecordBusinessEvent(t *testing.T) {
+	defer newMetrics(DefaultNamespace)
+	defer SetEventSink(LogSink{})
+	newMetrics(DefaultNamespace)
+
+	var got []BusinessEvent
+	SetEventSink(sinkFunc(func(_ context.Context, e BusinessEvent) error {
+		got = append(got, e)
+		return nil
+	}))
+
+	for _, who := range []string{"user-1", "user-2"} {
+		RecordBusinessEvent(context.Background(), BusinessEvent{
+			Who: who, What: "PropertyTaxPaid", How: "HTTP", Account: "pb", Whom: "property-" + who, HowMuch: 150.5,
+		})
+	}
+	RecordBusinessMetric("user-3", "PropertyTaxPaid", "", "2025-04-01T10:00:00Z", "HTTP", "", "", "pb", "99")
+
+	// Who, whom and when vary per event but do not create series.
+	if n := testutil.CollectAndCount(BusinessEventCounter); n != 1 {
+		t.Errorf("%d business event series, want 1", n)
+	}
+	if v := testutil.ToFloat64(BusinessEventCounter.WithLabelValues("PropertyTaxPaid", "HTTP", "pb")); v != 3 {
+		t.Errorf("count = %v, want 3", v)
+	}
+	if v := testutil.ToFloat64(BusinessEventValue.WithLabelValues("PropertyTaxPaid", "HTTP", "pb")); v != 400 {
+		t.Errorf("value = %v, want 400", v)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("sink got %d events, want 3", len(got))
+	}
+	if got[0].When.IsZero() {
+		t.Error("When not set on recording")
+	}
+	if want := time.Date(2025, 4, 1, 10, 0, 0, 0, time.UTC); !got[2].When.Equal(want) || got[2].HowMuch != 99 {
+		t.Errorf("deprecated event = %+v", got[2])
+	}
+}
+
+func TestRecordBusinessEventNegativeAmount(t *testing.T) {
+	defer newMetrics(DefaultNamespace)
+	defer SetEventSink(LogSink{})
+	newMetrics(DefaultNamespace)
+
+	var got []BusinessEvent
+	SetEventSink(sinkFunc(func(_ context.Context, e BusinessEvent) error {
+		got = append(got, e)
+		return nil
+	}))
+
+	RecordBusinessEvent(context.Background(), BusinessEvent{What: "PropertyTaxRefunded", How: "HTTP", Account: "pb", HowMuch: 100})
+	RecordBusinessEvent(context.Background(), BusinessEvent{What: "PropertyTaxRefunded", How: "HTTP", Account: "pb", HowMuch: -40})
+	RecordBusinessMetric("user-1", "PropertyTaxRefunded", "", "", "HTTP", "", "", "pb", "-50")
+
+	if v := testutil.ToFloat64(BusinessEventCounter.WithLabelValues("PropertyTaxRefunded", "HTTP", "pb")); v != 3 {
+		t.Errorf("count = %v, want 3", v)
+	}
+	if v := testutil.ToFloat64(BusinessEventValue.WithLabelValues("PropertyTaxRefunded", "HTTP", "pb")); v != 100 {
+		t.Errorf("value = %v, want 100", v)
+	}
+	if len(got) != 3 || got[1].HowMuch != -40 || got[2].HowMuch != -50 {
+		t.Errorf("sink got %+v", got)
+	}
+}
+
+func TestInitEvents(t *testing.T) {
+	defer SetEventSink(LogSink{})
+
+	for _, cfg := range []EventConfig{
+		{Sink: "syslog"},
+		{Sink: SinkKafka, Topic: "business-events"},
+	} {
+		if _, err := InitEvents(cfg); err == nil {
+			t.Errorf("InitEvents(%+v) accepted", cfg)
+		}
+	}
+	shutdown, err := InitEvents(EventConfig{Sink: SinkKafka, Brokers: []string{"localhost:9092"}, Topic: "business-events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := eventSink.Load().EventSink.(*KafkaSink); !ok {
+		t.Error("kafka sink not installed")
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,22 @@
+package observability
+
+import "github.com/labstack/echo/v4"
+
+// EchoMiddleware is TracingMiddleware for Echo routers. Install it before
+// logging.EchoMiddleware so that request records carry the trace.
+func EchoMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r, span := startServerSpan(c.Request(), c.Path())
+			c.SetRequest(r)
+			err := next(c)
+			if err != nil {
+				// Let Echo write the error response now, so that its
+				// status is recorded.
+				c.Error(err)
+			}
+			endSpan(span, c.Response().Status, 500)
+			return nil
+		}
+	}
+}
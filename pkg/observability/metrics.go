@@ -0,0 +1,247 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MeterConfig configures InitMeter.
+type MeterConfig struct {
+	// ServiceName is recorded as the service.name of the target_info
+	// metric.
+	ServiceName string
+	// Namespace prefixes metric names. Empty means DefaultNamespace.
+	Namespace string
+	// Registerer receives the exported metrics and, unless it is the
+	// default registry, which has them already, the process and Go
+	// collectors. Nil means prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+	// Runtime, when set, also records the OpenTelemetry Go runtime
+	// metrics (go.memory.used, go.goroutine.count and so on).
+	Runtime bool
+}
+
+// InitMeter installs a global OpenTelemetry meter provider exporting to
+// Prometheus, so that metrics recorded through the OTel API, including the
+// RED metrics of InstrumentationMiddleware, are served at /metrics. Histograms
+// keep the trace ID of sampled requests as exemplars, which are exposed in
+// the OpenMetrics format that the AdminServer negotiates. It returns a
+// function that stops the provider.
+func InitMeter(ctx context.Context, cfg MeterConfig) (func(context.Context) error, error) {
+	namespace, reg := cfg.Namespace, cfg.Registerer
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	if reg != prometheus.DefaultRegisterer {
+		if err := reg.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})); err != nil {
+			return nil, fmt.Errorf("register process metrics: %w", err)
+		}
+		if err := reg.Register(collectors.NewGoCollector()); err != nil {
+			return nil, fmt.Errorf("register Go metrics: %w", err)
+		}
+	}
+	exporter, err := otelprom.New(otelprom.WithRegisterer(reg), otelprom.WithNamespace(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("create Prometheus exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithAttributes(attribute.String("service.name", cfg.ServiceName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(exporter),
+		sdkmetric.WithResource(res),
+		sdkmetric.WithExemplarFilter(exemplar.TraceBasedFilter),
+	)
+	otel.SetMeterProvider(mp)
+	if cfg.Runtime {
+		if err := runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
+			return nil, fmt.Errorf("start runtime metrics: %w", err)
+		}
+	}
+	return mp.Shutdown, nil
+}
+
+// metricsHandler serves the metrics gathered by g, in the OpenMetrics
+// format when the scraper accepts it so that exemplars are included. The
+// handler's own metrics are registered with reg.
+func metricsHandler(reg prometheus.Registerer, g prometheus.Gatherer) http.Handler {
+	return promhttp.InstrumentMetricHandler(reg,
+		promhttp.HandlerFor(g, promhttp.HandlerOpts{EnableOpenMetrics: true, Registry: reg}))
+}
+
+// UnmatchedRoute is the route label of requests that match no route, so
+// that scanned or mistyped paths do not create a series each.
+const UnmatchedRoute = "unmatched"
+
+// redInstruments are the RED (rate, errors, duration) metrics of served
+// requests, and their saturation. Rates and error ratios come from the
+// count of the duration histogram, by status class.
+type redInstruments struct {
+	duration     metric.Float64Histogram
+	active       metric.Int64UpDownCounter
+	responseSize metric.Int64Histogram
+	panics       metric.Int64Counter
+}
+
+var (
+	redOnce sync.Once
+	red     redInstruments
+)
+
+// instruments creates the RED instruments from the global meter provider
+// on first use. Instruments created before InitMeter follow the provider
+// it installs.
+func instruments() redInstruments {
+	redOnce.Do(func() {
+		meter := otel.Meter(tracerName)
+		red.duration, _ = meter.Float64Histogram("http.server.request.duration",
+			metric.WithUnit("s"),
+			metric.WithDescription("Duration of served HTTP requests"),
+			metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+		)
+		red.active, _ = meter.Int64UpDownCounter("http.server.active_requests",
+			metric.WithUnit("{request}"),
+			metric.WithDescription("Number of HTTP requests being served"),
+		)
+		red.responseSize, _ = meter.Int64Histogram("http.server.response.body.size",
+			metric.WithUnit("By"),
+			metric.WithDescription("Size of HTTP response bodies"),
+			metric.WithExplicitBucketBoundaries(100, 1000, 10000, 100000, 1000000, 10000000),
+		)
+		red.panics, _ = meter.Int64Counter("http.server.panics",
+			metric.WithUnit("{panic}"),
+			metric.WithDescription("Number of handler panics recovered"),
+		)
+	})
+	return red
+}
+
+// StatusClass returns the class of an HTTP status code, e.g. "4xx".
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// requestMethod returns method, or "_OTHER" for methods other than the
+// standard ones, which clients can make up freely.
+func requestMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "_OTHER"
+}
+
+// recordRequest records a served request in the RED metrics and the
+// common Prometheus metrics. route is the route template, so that paths
+// with IDs do not create a series each.
+func recordRequest(ctx context.Context, method, route string, status int, size int64, elapsed time.Duration) {
+	ins := instruments()
+	attrs := metric.WithAttributes(
+		attribute.String("method", method),
+		attribute.String("route", route),
+		attribute.String("status_class", StatusClass(status)),
+	)
+	ins.duration.Record(ctx, elapsed.Seconds(), attrs)
+	ins.responseSize.Record(ctx, size, attrs)
+
+	DurationHistogram.WithLabelValues(route).Observe(elapsed.Seconds())
+	RequestCounter.WithLabelValues(route).Inc()
+	if status >= 400 {
+		ErrorCounter.WithLabelValues(route).Inc()
+	}
+}
+
+// recoverPanic answers a request whose handler panicked with v with a 500,
+// unless a response was already started, and records the panic in the
+// request's span, the log and http.server.panics.
+func recoverPanic(c *gin.Context, method, route string, v any) {
+	ctx := c.Request.Context()
+	stack := debug.Stack()
+	err := fmt.Errorf("panic: %v", v)
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err, trace.WithAttributes(attribute.String("exception.stacktrace", string(stack))))
+	span.SetStatus(codes.Error, err.Error())
+	slog.ErrorContext(ctx, "panic serving request", "method", method, "route", route, "error", err, "stack", string(stack))
+	instruments().panics.Add(ctx, 1, metric.WithAttributes(attribute.String("method", method), attribute.String("route", route)))
+	if c.Writer.Written() {
+		c.Abort()
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+}
+
+// InstrumentationMiddleware instruments every request served by a Gin
+// router, including those that match no route, which are labelled
+// UnmatchedRoute. It records
+//
+//   - digit_http_server_request_duration_seconds and
+//     digit_http_server_response_body_size_bytes, labelled by method, route
+//     template and status class;
+//   - digit_http_server_active_requests, the requests in flight;
+//   - the common digit_http_requests_total, digit_http_errors_total and
+//     digit_http_request_duration_seconds metrics, labelled by route.
+//
+// A panicking handler is answered with a 500 and counted in
+// digit_http_server_panics_total; the panic is logged and recorded on the
+// request's span. Use it after TracingMiddleware, so that the histograms'
+// exemplars name the request's trace and the span sees the 500, and after
+// logging.GinMiddleware, so that the request is logged with its status.
+func InstrumentationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		method := requestMethod(c.Request.Method)
+		route := c.FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+		inFlight := metric.WithAttributes(attribute.String("method", method), attribute.String("route", route))
+		ins := instruments()
+		ins.active.Add(ctx, 1, inFlight)
+		start := time.Now()
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					// The server aborts the response quietly.
+					ins.active.Add(ctx, -1, inFlight)
+					panic(v)
+				}
+				recoverPanic(c, method, route, v)
+			}
+			ins.active.Add(ctx, -1, inFlight)
+			recordRequest(ctx, method, route, c.Writer.Status(), int64(max(c.Writer.Size(), 0)), time.Since(start))
+		}()
+		c.Next()
+	}
+}
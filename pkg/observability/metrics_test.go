@@ -0,0 +1,77 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestInstrumentationMiddleware(t *testing.T) {
+	spans := useRecorder(t)
+	reg := prometheus.NewRegistry()
+	shutdown, err := InitMeter(context.Background(), MeterConfig{ServiceName: "identity", Registerer: reg, Runtime: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(TracingMiddleware(), InstrumentationMiddleware())
+	r.GET("/users/:id", func(c *gin.Context) { c.String(http.StatusNotFound, "no such user") })
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	for _, path := range []string{"/users/1", "/users/2", "/wp-admin", "/.env"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("panic answered with %d, want 500", rec.Code)
+	}
+	ended := spans.Ended()
+	if span := ended[len(ended)-1]; span.Status().Code != codes.Error || len(span.Events()) == 0 || span.Events()[0].Name != "exception" {
+		t.Errorf("panic span: status %v, events %v", span.Status(), span.Events())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec = httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(rec, req)
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`digit_http_server_request_duration_seconds_count{method="GET",otel_scope_name="github.com/digitnxt/digit/pkg/observability",otel_scope_version="",route="/users/:id",status_class="4xx"} 2`,
+		`digit_http_server_request_duration_seconds_count{method="GET",otel_scope_name="github.com/digitnxt/digit/pkg/observability",otel_scope_version="",route="unmatched",status_class="4xx"} 2`,
+		`digit_http_server_request_duration_seconds_count{method="GET",otel_scope_name="github.com/digitnxt/digit/pkg/observability",otel_scope_version="",route="/panic",status_class="5xx"} 1`,
+		`digit_http_server_response_body_size_bytes_sum{method="GET",otel_scope_name="github.com/digitnxt/digit/pkg/observability",otel_scope_version="",route="/users/:id",status_class="4xx"} 24`,
+		`digit_http_server_panics_total{method="GET",otel_scope_name="github.com/digitnxt/digit/pkg/observability",otel_scope_version="",route="/panic"} 1`,
+		`digit_http_server_active_requests{method="GET",otel_scope_name="github.com/digitnxt/digit/pkg/observability",otel_scope_version="",route="/users/:id"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if !strings.Contains(body, `# {trace_id="`) {
+		t.Error("no exemplar with a trace ID")
+	}
+	for _, want := range []string{"process_cpu_seconds_total", "go_goroutines", `otel_scope_name="go.opentelemetry.io/contrib/instrumentation/runtime"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("%s not exported", want)
+		}
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	for status, want := range map[int]string{200: "2xx", 304: "3xx", 404: "4xx", 503: "5xx", 0: "unknown"} {
+		if got := StatusClass(status); got != want {
+			t.Errorf("StatusClass(%d) = %s, want %s", status, got, want)
+		}
+	}
+}
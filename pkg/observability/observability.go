@@ -3,85 +3,140 @@ package observability
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/jaeger"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Common Prometheus metrics
+// DefaultNamespace prefixes the common metric names unless
+// RegisterPrometheusMetrics is given another namespace, e.g.
+// digit_http_requests_total. The Grafana dashboards query these names.
+const DefaultNamespace = "digit"
+
+// tracerName is the instrumentation scope of spans started by this package.
+const tracerName = "github.com/digitnxt/digit/pkg/observability"
+
+// Common Prometheus metrics. They are replaced by RegisterPrometheusMetrics
+// when it is given a namespace other than DefaultNamespace.
 var (
+	RequestCounter       *prometheus.CounterVec
+	ErrorCounter         *prometheus.CounterVec
+	DurationHistogram    *prometheus.HistogramVec
+	BusinessEventCounter *prometheus.CounterVec
+	BusinessEventValue   *prometheus.CounterVec
+)
+
+func init() {
+	newMetrics(DefaultNamespace)
+}
+
+// newMetrics creates the common metrics in namespace.
+func newMetrics(namespace string) {
 	RequestCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests",
 		},
 		[]string{"path"},
 	)
 	ErrorCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "http_errors_total",
-			Help: "Total number of HTTP errors",
+			Namespace: namespace,
+			Name:      "http_errors_total",
+			Help:      "Total number of HTTP errors",
 		},
 		[]string{"path"},
 	)
 	DurationHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Histogram of response time for handler in seconds",
-			Buckets: prometheus.DefBuckets,
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Histogram of response time for handler in seconds",
+			Buckets:   prometheus.DefBuckets,
 		},
 		[]string{"path"},
 	)
-	BusinessServiceMetric = prometheus.NewCounterVec(
+	// Business events are labelled only by their low-cardinality
+	// dimensions; the full events go to the event sink.
+	BusinessEventCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "business_service_metric_total",
-			Help: "Business service metrics with details like who, what, why, when, how, where, whom, account, howmuch",
+			Namespace: namespace,
+			Name:      "business_events_total",
+			Help:      "Total number of business events",
 		},
-		[]string{"who", "what", "why", "when", "how", "where", "whom", "account", "howmuch"},
+		[]string{"what", "how", "account"},
 	)
-)
+	BusinessEventValue = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "business_event_value_total",
+			Help:      "Sum of the amounts (howmuch) of business events",
+		},
+		[]string{"what", "how", "account"},
+	)
+}
+
+// MetricsOption configures RegisterPrometheusMetrics.
+type MetricsOption func(*metricsOptions)
+
+type metricsOptions struct {
+	namespace  string
+	registerer prometheus.Registerer
+}
+
+// WithNamespace prefixes the common metric names with namespace instead of
+// DefaultNamespace. An empty namespace leaves them unprefixed.
+func WithNamespace(namespace string) MetricsOption {
+	return func(o *metricsOptions) { o.namespace = namespace }
+}
+
+// WithRegisterer registers the metrics with r instead of the default
+// Prometheus registry.
+func WithRegisterer(r prometheus.Registerer) MetricsOption {
+	return func(o *metricsOptions) { o.registerer = r }
+}
 
 // RegisterPrometheusMetrics registers the common metrics with Prometheus.
-func RegisterPrometheusMetrics() {
-	prometheus.MustRegister(RequestCounter, ErrorCounter, DurationHistogram, BusinessServiceMetric)
+// It must be called before the metrics are used when a namespace is given.
+func RegisterPrometheusMetrics(opts ...MetricsOption) {
+	o := metricsOptions{namespace: DefaultNamespace, registerer: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.namespace != DefaultNamespace {
+		newMetrics(o.namespace)
+	}
+	o.registerer.MustRegister(RequestCounter, ErrorCounter, DurationHistogram, BusinessEventCounter, BusinessEventValue)
 }
 
-// StartMetricsServer starts an HTTP server on the specified port to expose Prometheus metrics.
-func StartMetricsServer(port int) {
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
-	addr := fmt.Sprintf(":%d", port)
-	go func() {
-		if err := http.ListenAndServe(addr, mux); err != nil {
-			log.Fatalf("failed to start Prometheus metrics server: %v", err)
-		}
-	}()
+// Endpoint is a further handler served on the admin port, for operational
+// endpoints such as logging.LevelHandler that must not be public.
+type Endpoint struct {
+	Pattern string
+	Handler http.Handler
 }
 
-// InitTracer initializes a Jaeger tracer for the given service and returns a shutdown function.
-// jaegerEndpoint should be in the form "http://jaeger:14268/api/traces"
-func InitTracer(serviceName, jaegerEndpoint string) func(context.Context) error {
-	exp, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(jaegerEndpoint)))
-	if err != nil {
-		log.Fatalf("failed to create Jaeger exporter: %v", err)
+// StartMetricsServer starts an HTTP server on the specified port to expose Prometheus metrics,
+// and endpoints. It returns an error if the port cannot be listened on.
+//
+// Deprecated: Use an AdminServer, which serves health and build
+// information and takes its own registry.
+func StartMetricsServer(port int, endpoints ...Endpoint) (*AdminServer, error) {
+	s := NewAdminServer(AdminConfig{Addr: fmt.Sprintf(":%d", port), Endpoints: endpoints})
+	if err := s.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start Prometheus metrics server: %w", err)
 	}
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exp),
-		sdktrace.WithResource(resource.NewWithAttributes("", attribute.String("service.name", serviceName))),
-	)
-	otel.SetTracerProvider(tp)
-	return tp.Shutdown
+	return s, nil
 }
 
 // InstrumentHandler wraps a gin.HandlerFunc with Prometheus instrumentation.
+//
+// Deprecated: Use InstrumentationMiddleware, which covers every route and
+// survives panics. Using both counts requests twice.
 func InstrumentHandler(handlerFunc gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		path := c.FullPath()
@@ -98,7 +153,18 @@ func InstrumentHandler(handlerFunc gin.HandlerFunc) gin.HandlerFunc {
 	}
 }
 
-// RecordBusinessMetric records an event in the business service metric.
-func RecordBusinessMetric(who, what, why, when, how, where, whom, account, howmuch string) {
-	BusinessServiceMetric.WithLabelValues(who, what, why, when, how, where, whom, account, howmuch).Inc()
-}
\ No newline at end of file
+// StartSpan creates a new tracing span with the given name and returns the updated context and span.
+func StartSpan(ctx context.Context, spanName string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, spanName)
+}
+
+// TracingMiddleware is a Gin middleware that creates a tracing span for each
+// incoming request, continuing the trace named by its traceparent header.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, span := startServerSpan(c.Request, c.FullPath())
+		c.Request = r
+		defer func() { endSpan(span, c.Writer.Status(), 500) }()
+		c.Next()
+	}
+}
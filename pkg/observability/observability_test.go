@@ -0,0 +1,35 @@
+package observability
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegisterPrometheusMetricsNamespace(t *testing.T) {
+	defer newMetrics(DefaultNamespace)
+
+	for _, tc := range []struct {
+		opts []MetricsOption
+		want string
+	}{
+		{nil, "digit_http_requests_total"},
+		{[]MetricsOption{WithNamespace("mdms")}, "mdms_http_requests_total"},
+	} {
+		reg := prometheus.NewRegistry()
+		RegisterPrometheusMetrics(append(tc.opts, WithRegisterer(reg))...)
+		RequestCounter.WithLabelValues("/ping").Inc()
+
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, f := range families {
+			found = found || f.GetName() == tc.want
+		}
+		if !found {
+			t.Errorf("%s not registered", tc.want)
+		}
+	}
+}
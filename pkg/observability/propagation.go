@@ -0,0 +1,123 @@
+package observability
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SetupPropagation installs the W3C TraceContext and Baggage propagators,
+// so that traceparent, tracestate and baggage headers are read by the
+// server middleware and written by Transport. InitTracer calls it;
+// services that only forward trace context call it directly.
+func SetupPropagation() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+}
+
+// startServerSpan starts the span of an incoming request, continuing the
+// trace named by its headers. route is the matched route template, or
+// empty when no route matched.
+func startServerSpan(r *http.Request, route string) (*http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	name := r.Method
+	if route != "" {
+		name += " " + route
+	}
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.method", r.Method),
+			attribute.String("http.path", route),
+		),
+	)
+	return r.WithContext(ctx), span
+}
+
+// endSpan records status on span and ends it. Server spans are errors
+// only for 5xx responses, client spans for any 4xx or 5xx.
+func endSpan(span trace.Span, status int, errorFrom int) {
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= errorFrom {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// Middleware is TracingMiddleware for net/http servers. Without a router
+// there is no route template, so spans are named by method alone.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, span := startServerSpan(r, "")
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() { endSpan(span, rec.status, 500) }()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// Transport is an http.RoundTripper that records a client span for every
+// request and injects its trace context into the request headers. Use it
+// with http.Client or resty's SetTransport.
+type Transport struct {
+	// Base performs the requests. Nil means http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// NewTransport returns a Transport over base.
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+// NewHTTPClient returns an http.Client whose requests are traced.
+func NewHTTPClient() *http.Client {
+	return &http.Client{Transport: NewTransport(nil)}
+}
+
+// RoundTrip sends r within a client span.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer(tracerName).Start(r.Context(), "HTTP "+r.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.method", r.Method),
+			attribute.String("http.url", r.URL.Redacted()),
+			attribute.String("server.address", r.URL.Hostname()),
+		),
+	)
+	// RoundTrippers must not modify the caller's request.
+	r = r.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, fmt.Sprintf("%s %s: %v", r.Method, r.URL.Host, err))
+		span.End()
+		return nil, err
+	}
+	endSpan(span, resp.StatusCode, 400)
+	return resp, nil
+}
@@ -0,0 +1,144 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useRecorder installs a tracer provider recording spans in memory.
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	prev, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		otel.SetTextMapPropagator(prevProp)
+	})
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	SetupPropagation()
+	return rec
+}
+
+func TestPropagationAcrossHops(t *testing.T) {
+	rec := useRecorder(t)
+	gin.SetMode(gin.TestMode)
+
+	// downstream records the trace it was called in.
+	var downstream trace.SpanContext
+	backend := gin.New()
+	backend.Use(TracingMiddleware())
+	backend.GET("/contexts", func(c *gin.Context) {
+		downstream = trace.SpanContextFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+	srv := httptest.NewServer(backend)
+	defer srv.Close()
+
+	// frontend calls downstream through the traced client.
+	client := NewHTTPClient()
+	frontend := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, srv.URL+"/contexts", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}))
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/chat", nil)
+	req.Header.Set("traceparent", parent)
+	req.Header.Set("baggage", "tenant=pb")
+	frontend.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := downstream.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("downstream trace = %s, want the caller's", got)
+	}
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("recorded %d spans, want server, client and server", len(spans))
+	}
+	kinds := map[string]trace.SpanKind{}
+	for _, s := range spans {
+		if s.SpanContext().TraceID() != downstream.TraceID() {
+			t.Errorf("span %s in trace %s", s.Name(), s.SpanContext().TraceID())
+		}
+		kinds[s.Name()] = s.SpanKind()
+	}
+	if kinds["GET /contexts"] != trace.SpanKindServer || kinds["HTTP GET"] != trace.SpanKindClient || kinds["GET"] != trace.SpanKindServer {
+		t.Errorf("spans = %v", kinds)
+	}
+}
+
+func TestTransportInjectsBaggage(t *testing.T) {
+	useRecorder(t)
+	var got string
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		got = r.Header.Get("baggage")
+		return httptest.NewRecorder().Result(), nil
+	})
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), mapCarrier{"baggage": "tenant=pb"})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://account/accounts", nil)
+	if _, err := NewTransport(base).RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if got != "tenant=pb" {
+		t.Errorf("baggage = %q", got)
+	}
+	if req.Header.Get("traceparent") != "" {
+		t.Error("caller's request modified")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+type mapCarrier map[string]string
+
+func (m mapCarrier) Get(key string) string { return m[key] }
+func (m mapCarrier) Set(key, value string) { m[key] = value }
+func (m mapCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestEchoMiddleware(t *testing.T) {
+	rec := useRecorder(t)
+	var got trace.SpanContext
+	e := echo.New()
+	e.Use(EchoMiddleware())
+	e.GET("/accounts/:id", func(c echo.Context) error {
+		got = trace.SpanContextFromContext(c.Request().Context())
+		return echo.NewHTTPError(http.StatusServiceUnavailable)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, req)
+
+	if got.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("handler trace = %s, want the caller's", got.TraceID())
+	}
+	spans := rec.Ended()
+	if len(spans) != 1 || spans[0].Name() != "GET /accounts/:id" || spans[0].Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("spans = %v", spans)
+	}
+	if resp.Code != http.StatusServiceUnavailable || spans[0].Status().Code != codes.Error {
+		t.Errorf("status %d recorded as %v", resp.Code, spans[0].Status())
+	}
+}
@@ -0,0 +1,211 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/digitnxt/digit/pkg/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Exporters accepted in TracerConfig.Exporter.
+const (
+	ExporterOTLPGRPC = "otlp"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+	ExporterNone     = "none"
+)
+
+// Samplers accepted in TracerConfig.Sampler. They follow the names of the
+// OTEL_TRACES_SAMPLER environment variable.
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIDRatio            = "traceidratio"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+)
+
+// TracerConfig configures InitTracer.
+type TracerConfig struct {
+	// ServiceName, ServiceVersion, Environment and InstanceID are recorded
+	// as the service.name, service.version, deployment.environment and
+	// service.instance.id resource attributes.
+	ServiceName    string
+	ServiceVersion string
+	Environment    string
+	InstanceID     string
+	// Attributes are further resource attributes.
+	Attributes map[string]string
+
+	// Exporter is one of the Exporter constants. Empty means
+	// ExporterOTLPGRPC.
+	Exporter string
+	// Endpoint is the OTLP collector, as host:port or a URL such as
+	// "http://jaeger:4317". Empty means the exporter's default,
+	// localhost:4317 for gRPC and localhost:4318 for HTTP.
+	Endpoint string
+	// Insecure disables TLS for host:port endpoints. URL endpoints use
+	// TLS for https only.
+	Insecure bool
+
+	// Sampler is one of the Sampler constants. Empty means
+	// SamplerParentBasedTraceIDRatio.
+	Sampler string
+	// SampleRatio is the fraction of traces sampled by the ratio samplers.
+	// Zero means 1; use SamplerAlwaysOff or SamplerParentBasedAlwaysOff to
+	// sample no new traces.
+	SampleRatio float64
+}
+
+// ServiceTracerConfig returns the TracerConfig described by a service's
+// shared settings.
+func ServiceTracerConfig(s *config.Service) TracerConfig {
+	cfg := TracerConfig{
+		ServiceName:    s.Name,
+		ServiceVersion: s.Version,
+		Environment:    s.Environment,
+		InstanceID:     s.InstanceID(),
+		Exporter:       s.TracesExporter,
+		Endpoint:       s.OTLPEndpoint(),
+		Sampler:        s.TracesSampler,
+		SampleRatio:    s.TracesSampleRatio,
+	}
+	// A service's ratio defaults to 1, so a zero ratio was asked for and
+	// keeps no new traces rather than all of them.
+	if cfg.SampleRatio == 0 {
+		switch cfg.Sampler {
+		case "", SamplerParentBasedTraceIDRatio:
+			cfg.Sampler = SamplerParentBasedAlwaysOff
+		case SamplerTraceIDRatio:
+			cfg.Sampler = SamplerAlwaysOff
+		}
+	}
+	return cfg
+}
+
+// InitTracer installs a global tracer provider exporting spans as cfg
+// describes, and the W3C propagators, and returns a function that flushes
+// and stops the provider.
+func InitTracer(ctx context.Context, cfg TracerConfig) (func(context.Context) error, error) {
+	SetupPropagation()
+	if cfg.Exporter == ExporterNone {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return func(context.Context) error { return nil }, nil
+	}
+	// The exporter holds a connection, so it is created last.
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	sampler, err := newSampler(cfg.Sampler, ratio)
+	if err != nil {
+		return nil, err
+	}
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter: %w", cfg.Exporter, err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, cfg TracerConfig) (sdktrace.SpanExporter, error) {
+	url := strings.Contains(cfg.Endpoint, "://")
+	switch cfg.Exporter {
+	case "", ExporterOTLPGRPC:
+		var opts []otlptracegrpc.Option
+		switch {
+		case url:
+			opts = append(opts, otlptracegrpc.WithEndpointURL(cfg.Endpoint))
+		case cfg.Endpoint != "":
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure && !url {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case ExporterOTLPHTTP:
+		var opts []otlptracehttp.Option
+		switch {
+		case url:
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		case cfg.Endpoint != "":
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure && !url {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	}
+	return nil, fmt.Errorf("unknown exporter %q", cfg.Exporter)
+}
+
+func newSampler(name string, ratio float64) (sdktrace.Sampler, error) {
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("sample ratio %v is not between 0 and 1", ratio)
+	}
+	switch name {
+	case SamplerAlwaysOn:
+		return sdktrace.AlwaysSample(), nil
+	case SamplerAlwaysOff:
+		return sdktrace.NeverSample(), nil
+	case SamplerTraceIDRatio:
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case SamplerParentBasedAlwaysOn:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case SamplerParentBasedAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case "", SamplerParentBasedTraceIDRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	}
+	return nil, fmt.Errorf("unknown sampler %q", name)
+}
+
+// newResource describes the service, adding the attributes in
+// OTEL_RESOURCE_ATTRIBUTES and the SDK's own.
+func newResource(ctx context.Context, cfg TracerConfig) (*resource.Resource, error) {
+	if cfg.ServiceName == "" {
+		return nil, errors.New("tracer needs a service name")
+	}
+	attrs := []attribute.KeyValue{attribute.String("service.name", cfg.ServiceName)}
+	for key, value := range map[string]string{
+		"service.version":        cfg.ServiceVersion,
+		"deployment.environment": cfg.Environment,
+		"service.instance.id":    cfg.InstanceID,
+	} {
+		if value != "" {
+			attrs = append(attrs, attribute.String(key, value))
+		}
+	}
+	for key, value := range cfg.Attributes {
+		attrs = append(attrs, attribute.String(key, value))
+	}
+	return resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(attrs...),
+	)
+}
@@ -0,0 +1,108 @@
+package observability
+
+import (
+	"context"
+	"testing"
+
+	"github.com/digitnxt/digit/pkg/config"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInitTracer(t *testing.T) {
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	ctx := context.Background()
+
+	shutdown, err := InitTracer(ctx, TracerConfig{
+		ServiceName: "identity",
+		InstanceID:  "identity-1",
+		Exporter:    ExporterStdout,
+		Sampler:     SamplerAlwaysOff,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := StartSpan(ctx, "test")
+	if span.SpanContext().IsSampled() {
+		t.Error("always_off sampler sampled a span")
+	}
+	span.End()
+	if err := shutdown(ctx); err != nil {
+		t.Error(err)
+	}
+
+	// An unset ratio keeps every trace.
+	if shutdown, err = InitTracer(ctx, TracerConfig{ServiceName: "identity", Exporter: ExporterStdout}); err != nil {
+		t.Fatal(err)
+	}
+	_, span = StartSpan(ctx, "test")
+	if !span.SpanContext().IsSampled() {
+		t.Error("default sampler with an unset ratio dropped a span")
+	}
+	shutdown(ctx)
+
+	for name, cfg := range map[string]TracerConfig{
+		"no service name":  {Exporter: ExporterStdout},
+		"unknown exporter": {ServiceName: "identity", Exporter: "zipkin"},
+		"unknown sampler":  {ServiceName: "identity", Exporter: ExporterStdout, Sampler: "sometimes"},
+		"bad ratio":        {ServiceName: "identity", Exporter: ExporterStdout, SampleRatio: 2},
+	} {
+		if _, err := InitTracer(ctx, cfg); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestSamplers(t *testing.T) {
+	sampled := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	tests := []struct {
+		sampler string
+		ratio   float64
+		parent  context.Context
+		want    bool
+	}{
+		{SamplerAlwaysOn, 0, context.Background(), true},
+		{SamplerTraceIDRatio, 0, context.Background(), false},
+		{SamplerParentBasedTraceIDRatio, 0, context.Background(), false},
+		{SamplerParentBasedTraceIDRatio, 0, sampled, true},
+		{SamplerParentBasedTraceIDRatio, 1, context.Background(), true},
+		{SamplerParentBasedAlwaysOff, 0, sampled, true},
+	}
+	for _, tc := range tests {
+		s, err := newSampler(tc.sampler, tc.ratio)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := s.ShouldSample(sdktrace.SamplingParameters{
+			ParentContext: tc.parent,
+			TraceID:       trace.TraceID{2},
+			Name:          "test",
+		})
+		if got := res.Decision == sdktrace.RecordAndSample; got != tc.want {
+			t.Errorf("%s(%v): sampled = %v, want %v", tc.sampler, tc.ratio, got, tc.want)
+		}
+	}
+}
+
+func TestServiceTracerConfigZeroRatio(t *testing.T) {
+	for sampler, want := range map[string]string{
+		"":                             SamplerParentBasedAlwaysOff,
+		SamplerParentBasedTraceIDRatio: SamplerParentBasedAlwaysOff,
+		SamplerTraceIDRatio:            SamplerAlwaysOff,
+		SamplerAlwaysOn:                SamplerAlwaysOn,
+	} {
+		cfg := ServiceTracerConfig(&config.Service{Name: "identity", TracesSampler: sampler})
+		if cfg.Sampler != want {
+			t.Errorf("ratio 0 with %q: sampler = %q, want %q", sampler, cfg.Sampler, want)
+		}
+	}
+	cfg := ServiceTracerConfig(&config.Service{Name: "identity", TracesSampleRatio: 0.5})
+	if cfg.Sampler != "" || cfg.SampleRatio != 0.5 {
+		t.Errorf("ratio 0.5: sampler %q, ratio %v", cfg.Sampler, cfg.SampleRatio)
+	}
+}
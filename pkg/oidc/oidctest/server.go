@@ -0,0 +1,110 @@
+// Package oidctest provides a fake OpenID Connect provider for tests. It
+// serves discovery and JWKS documents and signs tokens with keys that can be
+// rotated on demand.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Server is a fake OpenID Connect provider.
+type Server struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	keys []*rsa.PrivateKey // newest first
+	// jwksRequests counts fetches of the key set.
+	jwksRequests int
+}
+
+// NewServer starts a provider with one signing key. Close it when done.
+func NewServer() *Server {
+	s := &Server{}
+	s.RotateKey()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":   s.URL,
+			"jwks_uri": s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.jwksRequests++
+		keys := make([]map[string]string, 0, len(s.keys))
+		for i, k := range s.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": kid(len(s.keys) - i),
+				"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{"keys": keys})
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func kid(n int) string { return fmt.Sprintf("key-%d", n) }
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// RotateKey adds a new signing key. Earlier keys stay published.
+func (s *Server) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s.mu.Lock()
+	s.keys = append([]*rsa.PrivateKey{key}, s.keys...)
+	s.mu.Unlock()
+}
+
+// JWKSRequests returns how many times the key set has been fetched.
+func (s *Server) JWKSRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jwksRequests
+}
+
+// Sign returns a token signed with the newest key. iss, iat and exp
+// default to the server URL, now and an hour from now unless set in claims.
+func (s *Server) Sign(claims map[string]interface{}) string {
+	now := time.Now()
+	full := jwt.MapClaims{
+		"iss": s.URL,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+	s.mu.Lock()
+	key, id := s.keys[0], kid(len(s.keys))
+	s.mu.Unlock()
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, full)
+	t.Header["kid"] = id
+	raw, err := t.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
@@ -0,0 +1,302 @@
+// Package oidc verifies JWTs issued by an OpenID Connect provider, such as
+// the identity service or an external IdP like Keycloak, against the
+// provider's published JWKS. Keys are fetched once and refreshed when a
+// token names a key that is not yet known, so tokens are validated offline.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned for tokens that fail signature, issuer,
+// audience or expiry checks.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Config configures a Verifier.
+type Config struct {
+	// Issuer is the expected iss claim. Unless JWKSURL is set, the key set
+	// is located through Issuer + "/.well-known/openid-configuration".
+	Issuer string
+	// Audience, when set, must appear in the aud claim or be the azp
+	// (authorized party) claim.
+	Audience string
+	// JWKSURL skips discovery and fetches keys from this URL.
+	JWKSURL string
+	// HTTPClient fetches discovery and key documents. Nil means a client
+	// with a 10 second timeout.
+	HTTPClient *http.Client
+	// Leeway tolerates clock skew in exp, nbf and iat checks.
+	Leeway time.Duration
+	// RefreshInterval is the minimum time between key set fetches caused
+	// by unknown key IDs. Zero means 30 seconds.
+	RefreshInterval time.Duration
+}
+
+// Token is a verified token.
+type Token struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	ID        string
+
+	payload []byte
+}
+
+// Claims decodes the token's claims into v.
+func (t *Token) Claims(v interface{}) error {
+	return json.Unmarshal(t.payload, v)
+}
+
+// Verifier verifies tokens from one issuer.
+type Verifier struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	jwksURL   string
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+// NewVerifier returns a Verifier for cfg. Discovery and key fetches happen
+// on first use.
+func NewVerifier(cfg Config) *Verifier {
+	if cfg.RefreshInterval == 0 {
+		cfg.RefreshInterval = 30 * time.Second
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Verifier{cfg: cfg, client: client, jwksURL: cfg.JWKSURL}
+}
+
+// algorithms are the signature algorithms accepted. "none" and HMAC are
+// never accepted.
+var algorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Verify checks raw's signature against the issuer's keys and validates
+// its issuer, audience and lifetime.
+func (v *Verifier) Verify(ctx context.Context, raw string) (*Token, error) {
+	var claims struct {
+		jwt.RegisteredClaims
+		AuthorizedParty string `json:"azp"`
+	}
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	},
+		jwt.WithValidMethods(algorithms),
+		jwt.WithIssuer(v.cfg.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.cfg.Leeway),
+	)
+	if err != nil {
+		var fetchErr *fetchError
+		if errors.As(err, &fetchErr) {
+			return nil, fetchErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if v.cfg.Audience != "" && claims.AuthorizedParty != v.cfg.Audience && !contains(claims.Audience, v.cfg.Audience) {
+		return nil, fmt.Errorf("%w: audience %v does not include %q", ErrInvalidToken, claims.Audience, v.cfg.Audience)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(raw, ".")[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	t := &Token{
+		Issuer:   claims.Issuer,
+		Subject:  claims.Subject,
+		Audience: claims.Audience,
+		ID:       claims.ID,
+		payload:  payload,
+	}
+	if claims.ExpiresAt != nil {
+		t.ExpiresAt = claims.ExpiresAt.Time
+	}
+	if claims.IssuedAt != nil {
+		t.IssuedAt = claims.IssuedAt.Time
+	}
+	return t, nil
+}
+
+// fetchError reports a failure to load the provider's keys, as opposed to
+// a bad token.
+type fetchError struct{ err error }
+
+func (e *fetchError) Error() string { return "oidc: fetch keys: " + e.err.Error() }
+func (e *fetchError) Unwrap() error { return e.err }
+
+// key returns the verification key with id kid, refreshing the key set if
+// it is unknown and the last fetch is older than the refresh interval.
+func (v *Verifier) key(ctx context.Context, kid string) (interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if k, ok := v.lookup(kid); ok {
+		return k, nil
+	}
+	if v.keys != nil && time.Since(v.fetchedAt) < v.cfg.RefreshInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if err := v.refresh(ctx); err != nil {
+		return nil, &fetchError{err}
+	}
+	if k, ok := v.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// lookup finds kid in the cached keys. A token without a kid matches when
+// the set holds exactly one key. Callers hold mu.
+func (v *Verifier) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			return k, true
+		}
+	}
+	k, ok := v.keys[kid]
+	return k, ok
+}
+
+func (v *Verifier) refresh(ctx context.Context) error {
+	if v.jwksURL == "" {
+		var doc struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.get(ctx, strings.TrimSuffix(v.cfg.Issuer, "/")+"/.well-known/openid-configuration", &doc); err != nil {
+			return err
+		}
+		if doc.Issuer != v.cfg.Issuer {
+			return fmt.Errorf("discovery issuer %q does not match %q", doc.Issuer, v.cfg.Issuer)
+		}
+		if doc.JWKSURI == "" {
+			return errors.New("discovery document has no jwks_uri")
+		}
+		v.jwksURL = doc.JWKSURI
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.get(ctx, v.jwksURL, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped rather than failing the
+		// whole set.
+		if k, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyID] = k
+		}
+	}
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	return nil
+}
+
+func (v *Verifier) get(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("GET %s: %v", url, err)
+	}
+	return nil
+}
+
+// jsonWebKey is a public key from a JWKS (RFC 7517).
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/oidc"
+	"github.com/digitnxt/digit/pkg/oidc/oidctest"
+)
+
+func TestVerifier(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	ctx := context.Background()
+	v := oidc.NewVerifier(oidc.Config{Issuer: idp.URL, Audience: "digit", RefreshInterval: time.Nanosecond})
+
+	tok, err := v.Verify(ctx, idp.Sign(map[string]interface{}{"sub": "u1", "aud": "digit", "email": "a@example.org"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims struct {
+		Email string `json:"email"`
+	}
+	if err := tok.Claims(&claims); err != nil || tok.Subject != "u1" || claims.Email != "a@example.org" {
+		t.Fatalf("token = %+v, claims = %+v, err = %v", tok, claims, err)
+	}
+
+	// Keycloak access tokens name the client in azp rather than aud.
+	if _, err := v.Verify(ctx, idp.Sign(map[string]interface{}{"sub": "u1", "aud": "account", "azp": "digit"})); err != nil {
+		t.Fatalf("azp audience: %v", err)
+	}
+
+	for name, raw := range map[string]string{
+		"wrong audience": idp.Sign(map[string]interface{}{"sub": "u1", "aud": "other"}),
+		"expired":        idp.Sign(map[string]interface{}{"sub": "u1", "aud": "digit", "exp": time.Now().Add(-time.Minute).Unix()}),
+		"wrong issuer":   idp.Sign(map[string]interface{}{"sub": "u1", "aud": "digit", "iss": "https://evil.test"}),
+		"garbage":        "not.a.token",
+	} {
+		if _, err := v.Verify(ctx, raw); !errors.Is(err, oidc.ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", name, err)
+		}
+	}
+
+	// Tokens from another provider fail even with a matching kid.
+	other := oidctest.NewServer()
+	defer other.Close()
+	forged := other.Sign(map[string]interface{}{"iss": idp.URL, "sub": "u1", "aud": "digit"})
+	if _, err := v.Verify(ctx, forged); !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Errorf("forged token: err = %v", err)
+	}
+
+	// A rotated key is picked up by refetching the key set.
+	fetches := idp.JWKSRequests()
+	idp.RotateKey()
+	if _, err := v.Verify(ctx, idp.Sign(map[string]interface{}{"sub": "u1", "aud": "digit"})); err != nil {
+		t.Fatalf("after rotation: %v", err)
+	}
+	if idp.JWKSRequests() != fetches+1 {
+		t.Errorf("JWKS fetched %d times after rotation, want 1", idp.JWKSRequests()-fetches)
+	}
+}
+
+func TestVerifierUnreachable(t *testing.T) {
+	v := oidc.NewVerifier(oidc.Config{Issuer: "http://127.0.0.1:1"})
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	_, err := v.Verify(context.Background(), idp.Sign(map[string]interface{}{"iss": "http://127.0.0.1:1"}))
+	if err == nil || errors.Is(err, oidc.ErrInvalidToken) {
+		t.Fatalf("err = %v, want a fetch error distinct from ErrInvalidToken", err)
+	}
+}
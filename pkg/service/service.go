@@ -0,0 +1,318 @@
+// Package service runs a DIGIT HTTP service. Given a Descriptor, Run sets
+// up logging, metrics, tracing and business events from the shared
+// config.Service settings, builds a Gin engine with the standard
+// middleware, serves the admin endpoints and the API documentation,
+// registers the instance with Consul, and on SIGINT or SIGTERM
+// deregisters it and shuts every component down in order.
+//
+// A service's main loads its settings and hands its routes to Run:
+//
+//	cfg := config.Service{Name: "mdms", Port: 8087}
+//	config.MustLoad(&cfg)
+//	err := service.Run(context.Background(), service.Descriptor{
+//		Config: cfg,
+//		Setup: func(ctx context.Context, app *service.App) error {
+//			app.Engine.GET("/masters", listMasters)
+//			return nil
+//		},
+//	})
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/config"
+	"github.com/digitnxt/digit/pkg/discovery"
+	"github.com/digitnxt/digit/pkg/docs"
+	"github.com/digitnxt/digit/pkg/logging"
+	"github.com/digitnxt/digit/pkg/observability"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults of a Descriptor.
+const (
+	DefaultHealthPath      = "/health"
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+// Descriptor describes a service to Run.
+type Descriptor struct {
+	// Config holds the shared settings, loaded with config.MustLoad. Its
+	// Name must be set.
+	Config config.Service
+	// Middleware runs after the standard tracing, logging and
+	// instrumentation middleware, e.g. CORS.
+	Middleware []gin.HandlerFunc
+	// Setup registers the service's routes on app.Engine and its readiness
+	// checks on app.Admin. ctx is cancelled when the service shuts down.
+	// An error stops Run before the service is served or registered.
+	Setup func(ctx context.Context, app *App) error
+	// Swagger serves the Swagger UI for the document registered by the
+	// service's swag-generated docs package at /swagger/index.html.
+	Swagger bool
+	// OpenAPIFile, if set, is served at /openapi.json, along with the
+	// Swagger UI.
+	OpenAPIFile string
+	// HealthPath is checked by Consul. Unless Setup registers a route
+	// there, it answers 200 {"status": "healthy"}. Empty means
+	// DefaultHealthPath.
+	HealthPath string
+	// BasePath is the path the API gateway serves the service under, e.g.
+	// "/identity". It is registered in Consul as discovery.MetaBasePath,
+	// along with the version and the path of the API document.
+	BasePath string
+	// Tags and Meta are registered in Consul in addition to the tags in
+	// Config.
+	Tags []string
+	Meta map[string]string
+	// Checks are registered in Consul in addition to the HTTP check of
+	// HealthPath, e.g. a discovery.TTLCheck the service keeps passing.
+	Checks []discovery.Check
+	// ShutdownTimeout bounds the graceful shutdown. Zero means
+	// DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+}
+
+// App is the running service, as passed to Descriptor.Setup.
+type App struct {
+	// Config is the service's shared settings.
+	Config *config.Service
+	// Engine serves the service's API.
+	Engine *gin.Engine
+	// Registry holds the service's Prometheus metrics, served on the admin
+	// port.
+	Registry *prometheus.Registry
+	// Admin serves the operational endpoints; add readiness checks to it.
+	Admin *observability.AdminServer
+	// Logger is the service logger, also installed as slog's default.
+	Logger *slog.Logger
+
+	ln       net.Listener
+	shutdown []func(context.Context) error
+}
+
+// OnShutdown registers fn to run once the service has stopped serving
+// requests, for example to close a database. Functions run in the reverse
+// of the order they were registered in.
+func (a *App) OnShutdown(fn func(context.Context) error) {
+	a.shutdown = append(a.shutdown, fn)
+}
+
+// Addr returns the address the API is served at.
+func (a *App) Addr() string {
+	return a.ln.Addr().String()
+}
+
+// NewEngine returns a Gin engine without middleware whose Context.ClientIP
+// reads X-Forwarded-For and X-Real-IP only on requests from
+// cfg.TrustedProxies, so that clients cannot choose the IP they are rate
+// limited and locked out by.
+func NewEngine(cfg *config.Service) (*gin.Engine, error) {
+	e := gin.New()
+	if err := e.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	return e, nil
+}
+
+// Run runs the service d describes until ctx is done or the process
+// receives SIGINT or SIGTERM, then shuts it down gracefully. It returns an
+// error if the service cannot be started.
+func Run(ctx context.Context, d Descriptor) error {
+	cfg := d.Config
+	if cfg.Name == "" {
+		return errors.New("service: Config.Name is required")
+	}
+	healthPath := d.HealthPath
+	if healthPath == "" {
+		healthPath = DefaultHealthPath
+	}
+	timeout := d.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app := &App{Config: &cfg, Registry: prometheus.NewRegistry()}
+	// Components are stopped in the reverse of the order they started in,
+	// whether Run returns early or after a signal.
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		for i := len(app.shutdown) - 1; i >= 0; i-- {
+			if err := app.shutdown[i](shutdownCtx); err != nil {
+				slog.Error("shutdown failed", "error", err)
+			}
+		}
+	}()
+
+	logger, err := logging.Setup(logging.Config{Level: cfg.LogLevel, Format: cfg.LogFormat, Service: cfg.Name})
+	if err != nil {
+		return fmt.Errorf("configure logging: %w", err)
+	}
+	app.Logger = logger
+
+	observability.RegisterPrometheusMetrics(observability.WithNamespace(cfg.MetricsNamespace), observability.WithRegisterer(app.Registry))
+	shutdownMeter, err := observability.InitMeter(ctx, observability.MeterConfig{
+		ServiceName: cfg.Name,
+		Namespace:   cfg.MetricsNamespace,
+		Registerer:  app.Registry,
+		Runtime:     true,
+	})
+	if err != nil {
+		return fmt.Errorf("initialize metrics: %w", err)
+	}
+	app.OnShutdown(shutdownMeter)
+	shutdownTracer, err := observability.InitTracer(ctx, observability.ServiceTracerConfig(&cfg))
+	if err != nil {
+		return fmt.Errorf("initialize tracing: %w", err)
+	}
+	app.OnShutdown(shutdownTracer)
+	shutdownEvents, err := observability.InitEvents(observability.ServiceEventConfig(&cfg))
+	if err != nil {
+		return fmt.Errorf("initialize business events: %w", err)
+	}
+	app.OnShutdown(shutdownEvents)
+
+	// The log level can be changed at runtime on the admin port.
+	app.Admin = observability.NewAdminServer(observability.AdminConfig{
+		Addr:      fmt.Sprintf(":%d", cfg.MetricsPort),
+		Registry:  app.Registry,
+		Pprof:     cfg.Pprof,
+		BuildInfo: observability.ReadBuildInfo(cfg.Name, cfg.Version),
+		Endpoints: []observability.Endpoint{{Pattern: "/log/level", Handler: logging.LevelHandler()}},
+	})
+	if cfg.MetricsPort != 0 {
+		if err := app.Admin.Start(); err != nil {
+			return fmt.Errorf("start admin server: %w", err)
+		}
+		app.OnShutdown(app.Admin.Shutdown)
+	}
+
+	if app.Engine, err = NewEngine(&cfg); err != nil {
+		return err
+	}
+	app.Engine.Use(gin.Recovery(), observability.TracingMiddleware(), logging.GinMiddleware(logger), observability.InstrumentationMiddleware())
+	app.Engine.Use(d.Middleware...)
+	switch {
+	case d.OpenAPIFile != "":
+		docs.SetupDocumentation(app.Engine, d.OpenAPIFile)
+	case d.Swagger:
+		docs.SetupSwaggerUI(app.Engine)
+	}
+
+	// Listen before setting up, so that a busy port is reported before
+	// anything else starts.
+	if app.ln, err = net.Listen("tcp", cfg.ListenAddr()); err != nil {
+		return err
+	}
+	if d.Setup != nil {
+		if err := d.Setup(ctx, app); err != nil {
+			app.ln.Close()
+			return err
+		}
+	}
+	if !hasRoute(app.Engine, http.MethodGet, healthPath) {
+		app.Engine.GET(healthPath, func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+		})
+	}
+
+	srv := &http.Server{Handler: app.Engine, ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(app.ln) }()
+	logger.Info("serving", "addr", app.Addr())
+
+	// Register this instance under its own ID, so that replicas do not
+	// replace each other, and deregister it before the server stops, so
+	// that no new requests are routed to it.
+	deregister := func() {}
+	if cfg.Register {
+		consul, err := discovery.NewClient(discovery.ServiceOptions(&cfg)...)
+		if err != nil {
+			srv.Close()
+			return err
+		}
+		reg := registration(&cfg, d, healthPath)
+		if err := consul.Register(ctx, reg); err != nil {
+			srv.Close()
+			return fmt.Errorf("register with Consul: %w", err)
+		}
+		deregister = func() {
+			if err := consul.Deregister(context.Background(), reg.ID); err != nil {
+				slog.Error("failed to deregister from Consul", "error", err)
+			}
+		}
+	}
+
+	select {
+	case err := <-serveErr:
+		deregister()
+		return err
+	case <-ctx.Done():
+	}
+	// Fail readiness along with deregistering, so that nothing routes new
+	// requests here while those in progress drain.
+	deregister()
+	app.Admin.Drain()
+	logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to shut down server", "error", err)
+	}
+	return nil
+}
+
+// registration returns the Consul registration of the instance cfg
+// describes.
+func registration(cfg *config.Service, d Descriptor, healthPath string) discovery.Registration {
+	meta := map[string]string{}
+	if cfg.Version != "" {
+		meta[discovery.MetaVersion] = cfg.Version
+	}
+	switch {
+	case d.OpenAPIFile != "":
+		meta[discovery.MetaSwaggerPath] = "/openapi.json"
+	case d.Swagger:
+		meta[discovery.MetaSwaggerPath] = "/swagger/doc.json"
+	}
+	if d.BasePath != "" {
+		meta[discovery.MetaBasePath] = d.BasePath
+	}
+	for k, v := range d.Meta {
+		meta[k] = v
+	}
+	health := discovery.HTTPCheck(cfg.URL(healthPath))
+	health.DeregisterCriticalServiceAfter = cfg.DeregisterCriticalAfter
+	return discovery.Registration{
+		ID:      cfg.InstanceID(),
+		Name:    cfg.Name,
+		Address: cfg.AdvertisedAddress(),
+		Port:    cfg.Port,
+		Tags:    append(append([]string(nil), cfg.Tags...), d.Tags...),
+		Meta:    meta,
+		Checks:  append([]discovery.Check{health}, d.Checks...),
+	}
+}
+
+// hasRoute reports whether r has a route for method and path.
+func hasRoute(r *gin.Engine, method, path string) bool {
+	for _, route := range r.Routes() {
+		if route.Method == method && route.Path == path {
+			return true
+		}
+	}
+	return false
+}
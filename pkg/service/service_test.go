@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/config"
+	"github.com/digitnxt/digit/pkg/discovery"
+	"github.com/gin-gonic/gin"
+)
+
+// testConfig is a service that listens on a free port and uses nothing
+// outside the process.
+func testConfig() config.Service {
+	return config.Service{
+		Name:             "test",
+		Address:          "127.0.0.1",
+		MetricsNamespace: "digit",
+		LogLevel:         "error",
+		TracesExporter:   "none",
+		EventsSink:       "none",
+	}
+}
+
+func TestRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan *App, 1)
+	var closed []string
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Run(ctx, Descriptor{
+			Config: testConfig(),
+			Setup: func(ctx context.Context, app *App) error {
+				app.Engine.GET("/hello", func(c *gin.Context) { c.String(http.StatusOK, "hello") })
+				app.OnShutdown(func(context.Context) error { closed = append(closed, "db"); return nil })
+				app.OnShutdown(func(context.Context) error { closed = append(closed, "cache"); return nil })
+				started <- app
+				return nil
+			},
+		})
+	}()
+	var app *App
+	select {
+	case app = <-started:
+	case err := <-errc:
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]int{"/hello": http.StatusOK, "/health": http.StatusOK, "/nope": http.StatusNotFound} {
+		resp, err := http.Get("http://" + app.Addr() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 2 || closed[0] != "cache" || closed[1] != "db" {
+		t.Errorf("shutdown order = %v, want [cache db]", closed)
+	}
+	if _, err := http.Get("http://" + app.Addr() + "/hello"); err == nil {
+		t.Error("still serving after shutdown")
+	}
+	rec := httptest.NewRecorder()
+	app.Admin.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz after shutdown = %d, want 503", rec.Code)
+	}
+}
+
+func TestRunSetupError(t *testing.T) {
+	errSetup := errors.New("no database")
+	var closed bool
+	err := Run(context.Background(), Descriptor{
+		Config: testConfig(),
+		Setup: func(ctx context.Context, app *App) error {
+			app.OnShutdown(func(context.Context) error { closed = true; return nil })
+			return errSetup
+		},
+	})
+	if !errors.Is(err, errSetup) {
+		t.Errorf("Run = %v, want %v", err, errSetup)
+	}
+	if !closed {
+		t.Error("shutdown functions not run after a failed setup")
+	}
+	if err := Run(context.Background(), Descriptor{}); err == nil {
+		t.Error("Run without a name succeeded")
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	cfg := testConfig()
+	cfg.Port, cfg.Version, cfg.Tags, cfg.DeregisterCriticalAfter = 8080, "1.2.3", []string{"v1"}, time.Minute
+	reg := registration(&cfg, Descriptor{
+		Swagger:  true,
+		BasePath: "/identity",
+		Tags:     []string{"auth"},
+		Checks:   []discovery.Check{discovery.TTLCheck(30 * time.Second)},
+	}, DefaultHealthPath)
+
+	if reg.ID != "test-127.0.0.1-8080" || reg.Name != "test" || reg.Address != "127.0.0.1" || reg.Port != 8080 {
+		t.Errorf("registration = %+v", reg)
+	}
+	if !reflect.DeepEqual(reg.Tags, []string{"v1", "auth"}) {
+		t.Errorf("tags = %v", reg.Tags)
+	}
+	wantMeta := map[string]string{
+		discovery.MetaVersion:     "1.2.3",
+		discovery.MetaSwaggerPath: "/swagger/doc.json",
+		discovery.MetaBasePath:    "/identity",
+	}
+	if !reflect.DeepEqual(reg.Meta, wantMeta) {
+		t.Errorf("meta = %v", reg.Meta)
+	}
+	wantChecks := []discovery.Check{
+		{HTTP: "http://127.0.0.1:8080/health", DeregisterCriticalServiceAfter: time.Minute},
+		{TTL: 30 * time.Second},
+	}
+	if !reflect.DeepEqual(reg.Checks, wantChecks) {
+		t.Errorf("checks = %+v", reg.Checks)
+	}
+}
+
+func TestNewEngineTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		proxies []string
+		want    string
+	}{
+		{nil, "192.0.2.1"},
+		{[]string{"192.0.2.0/24"}, "203.0.113.9"},
+		{[]string{"10.0.0.1"}, "192.0.2.1"},
+	} {
+		cfg := testConfig()
+		cfg.TrustedProxies = tc.proxies
+		e, err := NewEngine(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("trusted proxies %v: client IP = %q, want %q", tc.proxies, got, tc.want)
+		}
+	}
+	cfg := testConfig()
+	cfg.TrustedProxies = []string{"not an ip"}
+	if _, err := NewEngine(&cfg); err == nil {
+		t.Error("invalid proxy accepted")
+	}
+}
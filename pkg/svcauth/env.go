@@ -0,0 +1,62 @@
+package svcauth
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variables read by SignerFromEnv and VerifierFromEnv.
+const (
+	// EnvKey holds the service's base64 Ed25519 seed.
+	EnvKey = "SERVICE_KEY"
+	// EnvTrustedKeys lists trusted services as name=key pairs.
+	EnvTrustedKeys = "SERVICE_TRUSTED_KEYS"
+	// EnvTrustedKeysFile names a JSON file of trusted keys, used when
+	// EnvTrustedKeys is unset.
+	EnvTrustedKeysFile = "SERVICE_TRUSTED_KEYS_FILE"
+	// EnvAuthDisabled, when true, lets a service without trusted keys
+	// serve without service authentication, e.g. in local development.
+	EnvAuthDisabled = "SERVICE_AUTH_DISABLED"
+)
+
+// SignerFromEnv returns a Signer for service using the key in SERVICE_KEY,
+// or nil when it is unset.
+func SignerFromEnv(service string) (*Signer, error) {
+	seed := os.Getenv(EnvKey)
+	if seed == "" {
+		return nil, nil
+	}
+	key, err := ParsePrivateKey(seed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", EnvKey, err)
+	}
+	return NewSigner(service, key), nil
+}
+
+// VerifierFromEnv returns a Verifier for service trusting the keys in
+// SERVICE_TRUSTED_KEYS or SERVICE_TRUSTED_KEYS_FILE. Without either it
+// returns an error, so that a misconfigured service does not serve
+// unauthenticated, unless SERVICE_AUTH_DISABLED is true, in which case it
+// returns nil.
+func VerifierFromEnv(service string) (*Verifier, error) {
+	var keys Keys
+	var err error
+	switch {
+	case os.Getenv(EnvTrustedKeys) != "":
+		keys, err = ParseKeys(os.Getenv(EnvTrustedKeys))
+	case os.Getenv(EnvTrustedKeysFile) != "":
+		keys, err = LoadKeys(os.Getenv(EnvTrustedKeysFile))
+	default:
+		disabled, err := strconv.ParseBool(os.Getenv(EnvAuthDisabled))
+		if err != nil || !disabled {
+			return nil, fmt.Errorf("no trusted service keys: set %s or %s, or %s=true to serve without service authentication",
+				EnvTrustedKeys, EnvTrustedKeysFile, EnvAuthDisabled)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewVerifier(service, keys), nil
+}
@@ -0,0 +1,36 @@
+package svcauth
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimsKey is the gin.Context key under which GinMiddleware stores the
+// service token's claims.
+const ClaimsKey = "svcauth.claims"
+
+// GinMiddleware is Middleware for Gin routers. The claims are available
+// from both the request context and c.Get(ClaimsKey).
+func GinMiddleware(v *Verifier, allowed ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, status, err := authenticate(v, c.Request, allowed)
+		if err != nil {
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(ClaimsKey, claims)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+// GinOptionalMiddleware is OptionalMiddleware for Gin routers.
+func GinOptionalMiddleware(v *Verifier, allowed ...string) gin.HandlerFunc {
+	strict := GinMiddleware(v, allowed...)
+	return func(c *gin.Context) {
+		if c.GetHeader(Header) == "" {
+			c.Next()
+			return
+		}
+		strict(c)
+	}
+}
@@ -0,0 +1,128 @@
+package svcauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type audienceKey struct{}
+
+// WithAudience returns a copy of ctx naming the service that requests made
+// with it call. It is needed when the request URL does not name the
+// service, e.g. for addresses resolved through Consul.
+func WithAudience(ctx context.Context, service string) context.Context {
+	return context.WithValue(ctx, audienceKey{}, service)
+}
+
+// Audience returns the service a request calls: the one named by
+// WithAudience, or else the first label of the request's host, so that
+// http://model-context-service:8085 calls "model-context-service".
+func Audience(r *http.Request) string {
+	if service, ok := r.Context().Value(audienceKey{}).(string); ok {
+		return service
+	}
+	host := r.URL.Hostname()
+	name, _, _ := strings.Cut(host, ".")
+	return name
+}
+
+// Transport is an http.RoundTripper that adds a service token to every
+// request. Use it with http.Client or resty's SetTransport.
+type Transport struct {
+	Signer *Signer
+	// Base performs the requests. Nil means http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// NewTransport returns a Transport signing with signer over base.
+func NewTransport(signer *Signer, base http.RoundTripper) *Transport {
+	return &Transport{Signer: signer, Base: base}
+}
+
+// RoundTrip adds a token for the request's Audience and sends it.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	raw, err := t.Signer.Token(Audience(r))
+	if err != nil {
+		return nil, fmt.Errorf("sign service token: %w", err)
+	}
+	// RoundTrippers must not modify the caller's request.
+	r = r.Clone(r.Context())
+	r.Header.Set(Header, raw)
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the claims stored by the middleware, if any.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(contextKey{}).(*Claims)
+	return c, ok
+}
+
+// authenticate verifies the token on r and checks its service is one of
+// allowed, when given. It returns the HTTP status to answer with when the
+// request is refused.
+func authenticate(v *Verifier, r *http.Request, allowed []string) (*Claims, int, error) {
+	raw := r.Header.Get(Header)
+	if raw == "" {
+		return nil, http.StatusUnauthorized, errors.New("missing service token")
+	}
+	claims, err := v.Verify(raw)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	if len(allowed) > 0 && !slices.Contains(allowed, claims.Service()) {
+		return nil, http.StatusForbidden, fmt.Errorf("service %q may not call this endpoint", claims.Service())
+	}
+	return claims, 0, nil
+}
+
+// OptionalMiddleware is Middleware for services also called by users:
+// requests without a service token pass on to the routes' own
+// authentication, while a token that is present must be valid and from
+// one of allowed, so that no caller can pose as another service.
+func OptionalMiddleware(v *Verifier, allowed ...string) func(http.Handler) http.Handler {
+	strict := Middleware(v, allowed...)
+	return func(next http.Handler) http.Handler {
+		verified := strict(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(Header) == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			verified.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Middleware rejects requests without a valid service token from one of
+// allowed, or from any trusted service when allowed is empty, and stores
+// the token's claims in the request context.
+func Middleware(v *Verifier, allowed ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, status, err := authenticate(v, r, allowed)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
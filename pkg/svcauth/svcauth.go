@@ -0,0 +1,212 @@
+// Package svcauth authenticates calls between DIGIT services. Each service
+// holds an Ed25519 key and signs short-lived tokens naming itself as the
+// issuer and the called service as the audience. Called services verify
+// tokens against the public keys of the services they trust, so a
+// compromised pod can act only as its own service.
+package svcauth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Header is the request header carrying a service token. It is separate
+// from Authorization so that calls can carry both a service token and the
+// end user's access token.
+const Header = "X-Service-Token"
+
+// ErrInvalidToken is returned for tokens that are malformed, expired, not
+// for this service or not signed by a trusted service.
+var ErrInvalidToken = errors.New("invalid service token")
+
+// ParsePrivateKey decodes a base64-encoded Ed25519 seed.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("service key must be a base64-encoded %d-byte Ed25519 seed", ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ParsePublicKey decodes a base64-encoded Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be a base64-encoded %d-byte Ed25519 key", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// EncodePublicKey returns the base64 form of key accepted by
+// ParsePublicKey.
+func EncodePublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// Keys maps service names to their public keys.
+type Keys map[string]ed25519.PublicKey
+
+// ParseKeys parses a comma-separated list of name=key pairs, e.g.
+// "mcp-service=MCowBQ...,account=Xy9...".
+func ParseKeys(s string) (Keys, error) {
+	keys := Keys{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("trusted key %q is not name=key", pair)
+		}
+		key, err := ParsePublicKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("trusted key of %s: %w", name, err)
+		}
+		keys[name] = key
+	}
+	return keys, nil
+}
+
+// LoadKeys reads a JSON object mapping service names to base64 public keys.
+func LoadKeys(path string) (Keys, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	keys := Keys{}
+	for name, value := range raw {
+		key, err := ParsePublicKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("trusted key of %s: %w", name, err)
+		}
+		keys[name] = key
+	}
+	return keys, nil
+}
+
+// Claims are the claims of a service token. The issuer and subject are the
+// calling service and the audience the called one.
+type Claims struct {
+	jwt.RegisteredClaims
+}
+
+// Service returns the name of the calling service.
+func (c *Claims) Service() string { return c.Issuer }
+
+// Signer issues tokens for one service. Tokens are cached per audience and
+// reissued shortly before they expire.
+type Signer struct {
+	// Service is the name of the calling service.
+	Service string
+	Key     ed25519.PrivateKey
+	// TTL is the lifetime of tokens. Zero means 5 minutes.
+	TTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedToken
+	now   func() time.Time
+}
+
+type cachedToken struct {
+	raw     string
+	expires time.Time
+}
+
+// NewSigner returns a Signer for service.
+func NewSigner(service string, key ed25519.PrivateKey) *Signer {
+	return &Signer{Service: service, Key: key, TTL: 5 * time.Minute, now: time.Now}
+}
+
+// Token returns a token for calling audience.
+func (s *Signer) Token(audience string) (string, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Tokens are reused until a fifth of their lifetime is left, so that
+	// they do not expire in flight.
+	if t, ok := s.cache[audience]; ok && now.Before(t.expires.Add(-s.TTL/5)) {
+		return t.raw, nil
+	}
+	claims := Claims{jwt.RegisteredClaims{
+		Issuer:    s.Service,
+		Subject:   s.Service,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.TTL)),
+		ID:        uuid.NewString(),
+	}}
+	raw, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(s.Key)
+	if err != nil {
+		return "", err
+	}
+	if s.cache == nil {
+		s.cache = make(map[string]cachedToken)
+	}
+	s.cache[audience] = cachedToken{raw: raw, expires: now.Add(s.TTL)}
+	return raw, nil
+}
+
+// Verifier verifies tokens sent to one service.
+type Verifier struct {
+	// Service is the name of the called service, the expected audience.
+	Service string
+	// Keys are the public keys of the services allowed to call.
+	Keys Keys
+	// Leeway tolerates clock skew. Zero means 30 seconds.
+	Leeway time.Duration
+	// MaxTTL rejects tokens issued for longer than this. Zero means 10
+	// minutes.
+	MaxTTL time.Duration
+}
+
+// NewVerifier returns a Verifier for service trusting keys.
+func NewVerifier(service string, keys Keys) *Verifier {
+	return &Verifier{Service: service, Keys: keys}
+}
+
+// Verify checks raw and returns its claims.
+func (v *Verifier) Verify(raw string) (*Claims, error) {
+	leeway, maxTTL := v.Leeway, v.MaxTTL
+	if leeway == 0 {
+		leeway = 30 * time.Second
+	}
+	if maxTTL == 0 {
+		maxTTL = 10 * time.Minute
+	}
+	var claims Claims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		key, ok := v.Keys[claims.Issuer]
+		if !ok || claims.Subject != claims.Issuer {
+			return nil, fmt.Errorf("untrusted service %q", claims.Issuer)
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithAudience(v.Service),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.IssuedAt == nil || claims.ExpiresAt.Sub(claims.IssuedAt.Time) > maxTTL {
+		return nil, fmt.Errorf("%w: lifetime exceeds %s", ErrInvalidToken, maxTTL)
+	}
+	return &claims, nil
+}
@@ -0,0 +1,196 @@
+package svcauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerify(t *testing.T) {
+	mcp, rogue := newKey(t), newKey(t)
+	v := NewVerifier("model-context-service", Keys{"mcp-service": mcp.Public().(ed25519.PublicKey)})
+
+	raw, err := NewSigner("mcp-service", mcp).Token("model-context-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := v.Verify(raw)
+	if err != nil || claims.Service() != "mcp-service" {
+		t.Fatalf("Verify = %+v, %v", claims, err)
+	}
+
+	expired := NewSigner("mcp-service", mcp)
+	expired.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	long := NewSigner("mcp-service", mcp)
+	long.TTL = time.Hour
+
+	tests := []struct {
+		name     string
+		signer   *Signer
+		audience string
+	}{
+		{"wrong audience", NewSigner("mcp-service", mcp), "account"},
+		{"untrusted service", NewSigner("rogue", rogue), "model-context-service"},
+		{"impersonation", NewSigner("mcp-service", rogue), "model-context-service"},
+		{"expired", expired, "model-context-service"},
+		{"long lived", long, "model-context-service"},
+	}
+	for _, tc := range tests {
+		raw, err := tc.signer.Token(tc.audience)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v.Verify(raw); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", tc.name, err)
+		}
+	}
+}
+
+func TestSignerCaches(t *testing.T) {
+	now := time.Now()
+	s := NewSigner("mcp-service", newKey(t))
+	s.now = func() time.Time { return now }
+	first, _ := s.Token("account")
+	if again, _ := s.Token("account"); again != first {
+		t.Error("token not reused")
+	}
+	if other, _ := s.Token("identity"); other == first {
+		t.Error("token reused across audiences")
+	}
+	now = now.Add(4*time.Minute + 30*time.Second)
+	if renewed, _ := s.Token("account"); renewed == first {
+		t.Error("token reused close to expiry")
+	}
+}
+
+func TestTransportAndMiddleware(t *testing.T) {
+	mcp, other := newKey(t), newKey(t)
+	v := NewVerifier("model-context-service", Keys{
+		"mcp-service": mcp.Public().(ed25519.PublicKey),
+		"account":     other.Public().(ed25519.PublicKey),
+	})
+	handler := Middleware(v, "mcp-service")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, ok := FromContext(r.Context()); !ok || c.Service() != "mcp-service" {
+			t.Errorf("claims = %+v, %v", c, ok)
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("missing token: status = %d, want 401", rec.Code)
+	}
+
+	// The audience is taken from the host unless set on the context.
+	var sent string
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		sent = r.Header.Get(Header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Result(), nil
+	})
+	client := &http.Client{Transport: NewTransport(NewSigner("mcp-service", mcp), base)}
+	resp, err := client.Get("http://model-context-service:8085/contexts")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("signed request: %v, %v", resp, err)
+	}
+	if sent == "" {
+		t.Error("no token sent")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://10.0.0.7:8080/contexts", nil)
+	req = req.WithContext(WithAudience(req.Context(), "account"))
+	if resp, _ := client.Do(req); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong audience: status = %d, want 401", resp.StatusCode)
+	}
+
+	accountClient := &http.Client{Transport: NewTransport(NewSigner("account", other), base)}
+	if resp, _ := accountClient.Get("http://model-context-service/contexts"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("disallowed service: status = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestOptionalMiddleware(t *testing.T) {
+	mcp, rogue := newKey(t), newKey(t)
+	v := NewVerifier("identity", Keys{"mcp-service": mcp.Public().(ed25519.PublicKey)})
+	var caller string
+	handler := OptionalMiddleware(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller = ""
+		if c, ok := FromContext(r.Context()); ok {
+			caller = c.Service()
+		}
+	}))
+	serve := func(signer *Signer) int {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		if signer != nil {
+			token, err := signer.Token("identity")
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(Header, token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Users call without a token; services must present a valid one.
+	if code := serve(nil); code != http.StatusOK || caller != "" {
+		t.Errorf("without a token: %d, caller %q", code, caller)
+	}
+	if code := serve(NewSigner("mcp-service", mcp)); code != http.StatusOK || caller != "mcp-service" {
+		t.Errorf("trusted service: %d, caller %q", code, caller)
+	}
+	if code := serve(NewSigner("mcp-service", rogue)); code != http.StatusUnauthorized {
+		t.Errorf("impersonating service: status = %d, want 401", code)
+	}
+}
+
+func TestVerifierFromEnv(t *testing.T) {
+	t.Setenv(EnvTrustedKeys, "")
+	t.Setenv(EnvTrustedKeysFile, "")
+	t.Setenv(EnvAuthDisabled, "")
+	if _, err := VerifierFromEnv("identity"); err == nil {
+		t.Error("no trusted keys accepted")
+	}
+	t.Setenv(EnvAuthDisabled, "true")
+	if v, err := VerifierFromEnv("identity"); v != nil || err != nil {
+		t.Errorf("disabled = %v, %v", v, err)
+	}
+	t.Setenv(EnvTrustedKeys, "mcp-service="+EncodePublicKey(newKey(t).Public().(ed25519.PublicKey)))
+	if v, err := VerifierFromEnv("identity"); v == nil || err != nil {
+		t.Errorf("with trusted keys = %v, %v", v, err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	pub := EncodePublicKey(newKey(t).Public().(ed25519.PublicKey))
+	keys, err := ParseKeys("mcp-service=" + pub + ", account=" + pub)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("ParseKeys = %v, %v", keys, err)
+	}
+	if _, err := ParseKeys("mcp-service"); err == nil {
+		t.Error("pair without key accepted")
+	}
+	if _, err := ParsePrivateKey(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("short seed accepted")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
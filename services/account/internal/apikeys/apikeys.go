@@ -0,0 +1,74 @@
+// Package apikeys generates and parses account API keys.
+//
+// A key has the form dgt_<prefix>_<secret>. The prefix is stored in clear so
+// a key can be looked up and recognised; the full key is only ever stored as
+// a SHA-256 hash. Keys carry 256 bits of randomness, so a fast hash is
+// sufficient.
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const keyPrefix = "dgt_"
+
+// ErrMalformed is returned for strings that are not API keys.
+var ErrMalformed = errors.New("malformed API key")
+
+var (
+	prefixEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+	scopePattern   = regexp.MustCompile(`^[a-z0-9_.-]+(:[a-z0-9_.-]+)*(:\*)?$`)
+)
+
+// Generate returns a new key, its prefix and the hash to store.
+func Generate() (key, prefix, hash string, err error) {
+	id := make([]byte, 5)
+	secret := make([]byte, 32)
+	if _, err = rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	prefix = prefixEncoding.EncodeToString(id)
+	key = keyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, Hash(key), nil
+}
+
+// Prefix extracts the lookup prefix from key.
+func Prefix(key string) (string, error) {
+	rest, ok := strings.CutPrefix(key, keyPrefix)
+	if !ok {
+		return "", ErrMalformed
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 8 || secret == "" {
+		return "", ErrMalformed
+	}
+	return prefix, nil
+}
+
+// Hash returns the stored form of key.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches reports whether key hashes to hash, in constant time.
+func Matches(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(hash)) == 1
+}
+
+// ValidScope reports whether scope is well formed, e.g. "accounts:read" or
+// "accounts:*". A "*" is only allowed as the whole final segment.
+func ValidScope(scope string) bool {
+	return scopePattern.MatchString(scope)
+}
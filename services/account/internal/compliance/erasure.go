@@ -0,0 +1,20 @@
+package compliance
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ErasedAccountName is the placeholder name given to an erased account. It
+// stays unique because it embeds the account ID.
+func ErasedAccountName(id int) string {
+	return fmt.Sprintf("erased-%d", id)
+}
+
+// ErasedConfig replaces the account configuration, which is free-form and
+// may contain PII.
+var ErasedConfig = json.RawMessage(`{}`)
+
+// RedactedActor replaces an erased admin's contact details where they were
+// recorded as the actor of an audit entry or data request.
+const RedactedActor = "redacted"
@@ -0,0 +1,206 @@
+// Package compliance builds signed data-export archives for accounts and
+// defines how account PII is anonymised on erasure.
+package compliance
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"account/internal/models"
+)
+
+// Names of the entries written to an export archive.
+const (
+	AccountFile      = "account.json"
+	AuditFile        = "audit.json"
+	DataRequestsFile = "data_requests.json"
+	APIKeysFile      = "api_keys.json"
+	ManifestName     = "manifest.json"
+	SignatureName    = "manifest.sig"
+)
+
+// Export is everything held about an account.
+type Export struct {
+	Account      models.Account
+	AuditEntries []models.AuditEntry
+	DataRequests []models.DataRequest
+	APIKeys      []models.APIKey
+}
+
+// Manifest describes the contents of an export archive. Its signature covers
+// the digest of every other file in the archive.
+type Manifest struct {
+	AccountID   int            `json:"account_id"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Algorithm   string         `json:"algorithm"`
+	PublicKey   string         `json:"public_key"`
+	Files       []ManifestFile `json:"files"`
+}
+
+// ManifestFile is the digest of a single archive entry.
+type ManifestFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// Signer signs export archives with an Ed25519 key.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewSigner creates a Signer from a base64-encoded Ed25519 seed. An empty
+// seed generates an ephemeral key, which is only suitable for development
+// since archives cannot be verified after a restart.
+func NewSigner(seed string) (*Signer, error) {
+	if seed == "" {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &Signer{key: key}, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(seed)
+	if err != nil {
+		return nil, fmt.Errorf("decode signing key: %w", err)
+	}
+	if len(raw) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes, got %d", ed25519.SeedSize, len(raw))
+	}
+	return &Signer{key: ed25519.NewKeyFromSeed(raw)}, nil
+}
+
+// PublicKey returns the key that verifies archives produced by s.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// BuildArchive writes the export as a zip archive containing one JSON file
+// per record type, a manifest of their digests and a detached signature of
+// the manifest.
+func (s *Signer) BuildArchive(export Export, now time.Time) ([]byte, error) {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{AccountFile, export.Account},
+		{AuditFile, nonNil(export.AuditEntries)},
+		{DataRequestsFile, nonNil(export.DataRequests)},
+		{APIKeysFile, nonNil(export.APIKeys)},
+	}
+
+	manifest := Manifest{
+		AccountID:   export.Account.ID,
+		GeneratedAt: now.UTC(),
+		Algorithm:   "ed25519",
+		PublicKey:   base64.StdEncoding.EncodeToString(s.PublicKey()),
+	}
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, f := range files {
+		body, err := json.MarshalIndent(f.data, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("encode %s: %w", f.name, err)
+		}
+		if err := writeEntry(zw, f.name, body, now); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(body)
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Name:   f.name,
+			SHA256: hex.EncodeToString(sum[:]),
+			Size:   len(body),
+		})
+	}
+
+	body, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encode manifest: %w", err)
+	}
+	if err := writeEntry(zw, ManifestName, body, now); err != nil {
+		return nil, err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, body))
+	if err := writeEntry(zw, SignatureName, []byte(sig), now); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// VerifyArchive checks the manifest signature against pub and every file
+// digest against the manifest, returning the verified manifest.
+func VerifyArchive(archive []byte, pub ed25519.PublicKey) (*Manifest, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string][]byte, len(zr.File))
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		entries[f.Name] = data
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(string(entries[SignatureName]))
+	if err != nil {
+		return nil, fmt.Errorf("decode signature: %w", err)
+	}
+	if !ed25519.Verify(pub, entries[ManifestName], sig) {
+		return nil, errors.New("manifest signature is invalid")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(entries[ManifestName], &manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	for _, f := range manifest.Files {
+		data, ok := entries[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("archive is missing %s", f.Name)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, fmt.Errorf("digest mismatch for %s", f.Name)
+		}
+	}
+	return &manifest, nil
+}
+
+func writeEntry(zw *zip.Writer, name string, body []byte, now time.Time) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now.UTC()})
+	if err != nil {
+		return fmt.Errorf("create %s: %w", name, err)
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// nonNil keeps empty record lists encoded as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"account/internal/models"
+
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = `id, account_id, name, prefix, scopes, expires_at, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(row scanner, extra ...interface{}) (*models.APIKey, error) {
+	k := new(models.APIKey)
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	dest := append([]interface{}{&k.ID, &k.AccountID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &expiresAt, &k.CreatedAt, &lastUsedAt, &revokedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	k.ExpiresAt = nullTime(expiresAt)
+	k.LastUsedAt = nullTime(lastUsedAt)
+	k.RevokedAt = nullTime(revokedAt)
+	return k, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func insertAPIKey(ctx context.Context, tx *sql.Tx, key *models.APIKey, hash string) error {
+	query := `INSERT INTO api_keys (account_id, name, prefix, key_hash, scopes, expires_at)
+              VALUES ($1, $2, $3, $4, $5, $6)
+              RETURNING id, created_at`
+	err := tx.QueryRowContext(ctx, query, key.AccountID, key.Name, key.Prefix, hash, pq.Array(key.Scopes), key.ExpiresAt).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if isUniqueViolation(err) {
+			return models.ErrConflict
+		}
+		// foreign_key_violation: the account does not exist.
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return models.ErrNotFound
+		}
+	}
+	return err
+}
+
+// CreateAPIKey stores a new key for key.AccountID, filling in its ID and
+// creation time.
+func (r *Repository) CreateAPIKey(ctx context.Context, key *models.APIKey, hash, actor string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertAPIKey(ctx, tx, key, hash); err != nil {
+		return err
+	}
+	details := map[string]interface{}{"key_id": key.ID, "prefix": key.Prefix, "scopes": key.Scopes}
+	if err := recordAudit(ctx, tx, key.AccountID, models.AuditAPIKeyCreated, actor, details); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListAPIKeys returns the keys of an account, oldest first.
+func (r *Repository) ListAPIKeys(ctx context.Context, accountID int) ([]models.APIKey, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE account_id = $1 ORDER BY id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKey fetches a key belonging to accountID.
+func (r *Repository) GetAPIKey(ctx context.Context, accountID, id int) (*models.APIKey, error) {
+	return scanAPIKey(r.DB.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE account_id = $1 AND id = $2`, accountID, id))
+}
+
+// FindAPIKeyByPrefix fetches a key and its stored hash by prefix.
+func (r *Repository) FindAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, string, error) {
+	var hash string
+	key, err := scanAPIKey(r.DB.QueryRowContext(ctx, `SELECT `+apiKeyColumns+`, key_hash FROM api_keys WHERE prefix = $1`, prefix), &hash)
+	return key, hash, err
+}
+
+// RotateAPIKey stores replacement and revokes old at graceUntil.
+func (r *Repository) RotateAPIKey(ctx context.Context, old *models.APIKey, replacement *models.APIKey, hash string, graceUntil time.Time, actor string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE api_keys SET revoked_at = $1
+              WHERE id = $2 AND account_id = $3 AND (revoked_at IS NULL OR revoked_at > $1)`,
+		graceUntil, old.ID, old.AccountID)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return models.ErrNotFound
+	}
+	if err := insertAPIKey(ctx, tx, replacement, hash); err != nil {
+		return err
+	}
+	details := map[string]interface{}{"key_id": old.ID, "replaced_by": replacement.ID, "prefix": replacement.Prefix, "grace_until": graceUntil}
+	if err := recordAudit(ctx, tx, old.AccountID, models.AuditAPIKeyRotated, actor, details); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeAPIKey revokes a key at at. Revoking an already revoked key keeps
+// the earlier revocation time.
+func (r *Repository) RevokeAPIKey(ctx context.Context, accountID, id int, at time.Time, actor string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE api_keys SET revoked_at = LEAST(COALESCE(revoked_at, $1), $1)
+              WHERE id = $2 AND account_id = $3`, at, id, accountID)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return models.ErrNotFound
+	}
+	if err := recordAudit(ctx, tx, accountID, models.AuditAPIKeyRevoked, actor, map[string]interface{}{"key_id": id}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TouchAPIKey records that a key was used at at.
+func (r *Repository) TouchAPIKey(ctx context.Context, id int, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, at, id)
+	return err
+}
@@ -38,4 +38,86 @@ func CreateTables(db *sql.DB) {
 		log.Fatalf("Failed to create accounts table: %v", err)
 	}
 	log.Println("Accounts table ensured.")
+
+	// Audit entries reference accounts by ID without a foreign key so that
+	// they outlive deletion and erasure of the account they describe.
+	createAuditTableSQL := `
+	CREATE TABLE IF NOT EXISTS account_audit (
+		id SERIAL PRIMARY KEY,
+		account_id INTEGER NOT NULL,
+		action VARCHAR(64) NOT NULL,
+		actor VARCHAR(255) NOT NULL,
+		details JSONB NOT NULL DEFAULT '{}',
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS account_audit_account_id_idx ON account_audit (account_id);
+	`
+	_, err = db.Exec(createAuditTableSQL)
+	if err != nil {
+		log.Fatalf("Failed to create account_audit table: %v", err)
+	}
+	log.Println("Account audit table ensured.")
+
+	createDataRequestsTableSQL := `
+	CREATE TABLE IF NOT EXISTS data_requests (
+		id SERIAL PRIMARY KEY,
+		account_id INTEGER NOT NULL,
+		type VARCHAR(32) NOT NULL,
+		status VARCHAR(32) NOT NULL,
+		requested_by VARCHAR(255) NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		completed_at TIMESTAMPTZ
+	);
+	CREATE INDEX IF NOT EXISTS data_requests_account_id_idx ON data_requests (account_id);
+	`
+	_, err = db.Exec(createDataRequestsTableSQL)
+	if err != nil {
+		log.Fatalf("Failed to create data_requests table: %v", err)
+	}
+	log.Println("Data requests table ensured.")
+
+	createIdempotencyTableSQL := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		scope VARCHAR(255) NOT NULL,
+		key VARCHAR(255) NOT NULL,
+		request_hash CHAR(64) NOT NULL,
+		account_id INTEGER,
+		status_code INTEGER,
+		content_type VARCHAR(255),
+		body BYTEA,
+		created_at TIMESTAMPTZ NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (scope, key)
+	);
+	CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+	ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS account_id INTEGER;
+	CREATE INDEX IF NOT EXISTS idempotency_keys_account_id_idx ON idempotency_keys (account_id);
+	`
+	_, err = db.Exec(createIdempotencyTableSQL)
+	if err != nil {
+		log.Fatalf("Failed to create idempotency_keys table: %v", err)
+	}
+	log.Println("Idempotency keys table ensured.")
+
+	createAPIKeysTableSQL := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id SERIAL PRIMARY KEY,
+		account_id INTEGER NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+		name VARCHAR(255) NOT NULL DEFAULT '',
+		prefix VARCHAR(32) UNIQUE NOT NULL,
+		key_hash CHAR(64) NOT NULL,
+		scopes TEXT[] NOT NULL DEFAULT '{}',
+		expires_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		last_used_at TIMESTAMPTZ,
+		revoked_at TIMESTAMPTZ
+	);
+	CREATE INDEX IF NOT EXISTS api_keys_account_id_idx ON api_keys (account_id);
+	`
+	_, err = db.Exec(createAPIKeysTableSQL)
+	if err != nil {
+		log.Fatalf("Failed to create api_keys table: %v", err)
+	}
+	log.Println("API keys table ensured.")
 }
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"account/internal/models"
+)
+
+// IdempotencyStore keeps idempotency records in the idempotency_keys table.
+type IdempotencyStore struct {
+	DB *sql.DB
+}
+
+// Reserve inserts record, or returns the unexpired record already holding
+// its scope and key.
+func (s *IdempotencyStore) Reserve(ctx context.Context, record models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND expires_at < $3`,
+		record.Scope, record.Key, record.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.DB.ExecContext(ctx, `INSERT INTO idempotency_keys (scope, key, request_hash, created_at, expires_at)
+              VALUES ($1, $2, $3, $4, $5)
+              ON CONFLICT (scope, key) DO NOTHING`,
+		record.Scope, record.Key, record.RequestHash, record.CreatedAt, record.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if count, err := res.RowsAffected(); err != nil || count == 1 {
+		return nil, err
+	}
+
+	existing := new(models.IdempotencyRecord)
+	var accountID, status sql.NullInt64
+	var contentType sql.NullString
+	err = s.DB.QueryRowContext(ctx, `SELECT scope, key, request_hash, account_id, status_code, content_type, body, created_at, expires_at
+              FROM idempotency_keys WHERE scope = $1 AND key = $2`, record.Scope, record.Key).
+		Scan(&existing.Scope, &existing.Key, &existing.RequestHash, &accountID, &status, &contentType, &existing.Body, &existing.CreatedAt, &existing.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	existing.AccountID = int(accountID.Int64)
+	existing.StatusCode = int(status.Int64)
+	existing.ContentType = contentType.String
+	return existing, nil
+}
+
+// Complete records the response of a reserved request.
+func (s *IdempotencyStore) Complete(ctx context.Context, scope, key string, accountID, statusCode int, contentType string, body []byte) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE idempotency_keys SET account_id = NULLIF($1, 0), status_code = $2, content_type = $3, body = $4
+              WHERE scope = $5 AND key = $6`, accountID, statusCode, contentType, body, scope, key)
+	return err
+}
+
+// Release removes a reservation that did not complete.
+func (s *IdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status_code IS NULL`, scope, key)
+	return err
+}
+
+// DeleteExpired removes records that expired before now.
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context, now time.Time) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < $1`, now)
+	return err
+}
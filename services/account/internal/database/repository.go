@@ -0,0 +1,309 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"account/internal/compliance"
+	"account/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// Repository stores accounts, their audit trail and data requests in
+// PostgreSQL. Every account change is written together with its audit entry
+// in a single transaction.
+type Repository struct {
+	DB *sql.DB
+}
+
+const accountColumns = `id, accountname, admin_email, admin_phone, config, created_at`
+
+const dataRequestColumns = `id, account_id, type, status, requested_by, error, created_at, completed_at`
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique_violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func scanAccount(row scanner) (*models.Account, error) {
+	account := new(models.Account)
+	err := row.Scan(
+		&account.ID,
+		&account.AccountName,
+		&account.AdminEmail,
+		&account.AdminPhone,
+		&account.Config,
+		&account.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	return account, err
+}
+
+func scanDataRequest(row scanner) (*models.DataRequest, error) {
+	r := new(models.DataRequest)
+	var completedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.AccountID, &r.Type, &r.Status, &r.RequestedBy, &r.Error, &r.CreatedAt, &completedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if completedAt.Valid {
+		r.CompletedAt = &completedAt.Time
+	}
+	return r, err
+}
+
+func recordAudit(ctx context.Context, db execer, accountID int, action, actor string, details interface{}) error {
+	if details == nil {
+		details = struct{}{}
+	}
+	body, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO account_audit (account_id, action, actor, details) VALUES ($1, $2, $3, $4)`,
+		accountID, action, actor, body)
+	return err
+}
+
+// CreateAccount inserts account, filling in its ID and creation time.
+func (r *Repository) CreateAccount(ctx context.Context, account *models.Account, actor string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO accounts (accountname, admin_email, admin_phone, config)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id, created_at`
+	err = tx.QueryRowContext(ctx, query, account.AccountName, account.AdminEmail, account.AdminPhone, account.Config).
+		Scan(&account.ID, &account.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.ErrConflict
+		}
+		return err
+	}
+	if err := recordAudit(ctx, tx, account.ID, models.AuditAccountCreated, actor, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAccount fetches a single account.
+func (r *Repository) GetAccount(ctx context.Context, id int) (*models.Account, error) {
+	return scanAccount(r.DB.QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts WHERE id = $1`, id))
+}
+
+// ListAccounts returns all accounts.
+func (r *Repository) ListAccounts(ctx context.Context) ([]models.Account, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+accountColumns+` FROM accounts`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []models.Account
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *account)
+	}
+	return accounts, rows.Err()
+}
+
+// UpdateAccount replaces the fields of the account with account.ID.
+func (r *Repository) UpdateAccount(ctx context.Context, account *models.Account, actor string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE accounts
+              SET accountname = $1, admin_email = $2, admin_phone = $3, config = $4
+              WHERE id = $5`
+	res, err := tx.ExecContext(ctx, query, account.AccountName, account.AdminEmail, account.AdminPhone, account.Config, account.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.ErrConflict
+		}
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return models.ErrNotFound
+	}
+	details := map[string]interface{}{"fields": []string{"accountname", "admin_email", "admin_phone", "config"}}
+	if err := recordAudit(ctx, tx, account.ID, models.AuditAccountUpdated, actor, details); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteAccount removes an account. Its audit trail is kept.
+func (r *Repository) DeleteAccount(ctx context.Context, id int, actor string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM accounts WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return models.ErrNotFound
+	}
+	if err := recordAudit(ctx, tx, id, models.AuditAccountDeleted, actor, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordAudit appends an audit entry for accountID. details must not
+// contain PII values.
+func (r *Repository) RecordAudit(ctx context.Context, accountID int, action, actor string, details interface{}) error {
+	return recordAudit(ctx, r.DB, accountID, action, actor, details)
+}
+
+// ListAuditEntries returns the audit trail of an account, oldest first.
+func (r *Repository) ListAuditEntries(ctx context.Context, accountID int) ([]models.AuditEntry, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, account_id, action, actor, details, created_at
+		FROM account_audit WHERE account_id = $1 ORDER BY id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(&e.ID, &e.AccountID, &e.Action, &e.Actor, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// CreateDataRequest logs a new data-protection request in the processing state.
+func (r *Repository) CreateDataRequest(ctx context.Context, accountID int, requestType, requestedBy string) (*models.DataRequest, error) {
+	query := `INSERT INTO data_requests (account_id, type, status, requested_by)
+              VALUES ($1, $2, $3, $4)
+              RETURNING ` + dataRequestColumns
+	return scanDataRequest(r.DB.QueryRowContext(ctx, query, accountID, requestType, models.DataRequestProcessing, requestedBy))
+}
+
+// FinishDataRequest moves a request to its terminal state, recording cause
+// when the request failed.
+func (r *Repository) FinishDataRequest(ctx context.Context, id int, cause error) (*models.DataRequest, error) {
+	status, message := models.DataRequestCompleted, ""
+	if cause != nil {
+		status, message = models.DataRequestFailed, cause.Error()
+	}
+	query := `UPDATE data_requests SET status = $1, error = $2, completed_at = NOW()
+              WHERE id = $3
+              RETURNING ` + dataRequestColumns
+	return scanDataRequest(r.DB.QueryRowContext(ctx, query, status, message, id))
+}
+
+// GetDataRequest fetches a single data request.
+func (r *Repository) GetDataRequest(ctx context.Context, id int) (*models.DataRequest, error) {
+	return scanDataRequest(r.DB.QueryRowContext(ctx, `SELECT `+dataRequestColumns+` FROM data_requests WHERE id = $1`, id))
+}
+
+// ListDataRequests returns the data requests made against an account, oldest first.
+func (r *Repository) ListDataRequests(ctx context.Context, accountID int) ([]models.DataRequest, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+dataRequestColumns+` FROM data_requests WHERE account_id = $1 ORDER BY id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []models.DataRequest
+	for rows.Next() {
+		req, err := scanDataRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *req)
+	}
+	return requests, rows.Err()
+}
+
+// EraseAccount replaces the PII of account with placeholders and redacts
+// its contact details wherever they appear as the actor of an audit entry or
+// data request. The account row itself is kept so references stay valid.
+func (r *Repository) EraseAccount(ctx context.Context, account models.Account, requestID int, actor string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE accounts SET accountname = $1, admin_email = '', admin_phone = '', config = $2 WHERE id = $3`,
+		compliance.ErasedAccountName(account.ID), compliance.ErasedConfig, account.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, pii := range []string{account.AdminEmail, account.AdminPhone} {
+		if pii == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE account_audit SET actor = $1 WHERE account_id = $2 AND actor = $3`,
+			compliance.RedactedActor, account.ID, pii); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE data_requests SET requested_by = $1 WHERE account_id = $2 AND requested_by = $3`,
+			compliance.RedactedActor, account.ID, pii); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE account_audit SET details = '{}' WHERE account_id = $1 AND strpos(details::text, $2) > 0`,
+			account.ID, pii); err != nil {
+			return err
+		}
+	}
+
+	// API key names are free-form, and stored responses replayed for an
+	// Idempotency-Key still carry the admin's contact details.
+	if _, err := tx.ExecContext(ctx, `UPDATE api_keys SET name = '' WHERE account_id = $1`, account.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE account_id = $1`, account.ID); err != nil {
+		return err
+	}
+
+	if err := recordAudit(ctx, tx, account.ID, models.AuditAccountErased, actor, map[string]interface{}{"request_id": requestID}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
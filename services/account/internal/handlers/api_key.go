@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"account/internal/apikeys"
+	"account/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxKeyAttempts bounds retries when a generated prefix is already taken.
+const maxKeyAttempts = 3
+
+// issueAPIKey generates a key and stores it with store, retrying on prefix
+// collisions.
+func issueAPIKey(key *models.APIKey, store func(hash string) error) (string, error) {
+	var err error
+	for attempt := 0; attempt < maxKeyAttempts; attempt++ {
+		var secret, hash string
+		secret, key.Prefix, hash, err = apikeys.Generate()
+		if err != nil {
+			return "", err
+		}
+		if err = store(hash); err != models.ErrConflict {
+			return secret, err
+		}
+	}
+	return "", err
+}
+
+func apiKeyParams(c echo.Context) (accountID, keyID int, err error) {
+	if accountID, err = strconv.Atoi(c.Param("id")); err != nil {
+		return 0, 0, err
+	}
+	keyID, err = strconv.Atoi(c.Param("keyId"))
+	return accountID, keyID, err
+}
+
+// CreateAPIKey handles POST /accounts/:id/api-keys to issue a key for an
+// account. The secret is only returned in this response.
+func (h *Handler) CreateAPIKey(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid account ID"})
+	}
+
+	req := new(models.APIKeyRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	for _, scope := range req.Scopes {
+		if !apikeys.ValidScope(scope) {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid scope " + strconv.Quote(scope)})
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "expires_at must be in the future"})
+	}
+
+	key := &models.APIKey{AccountID: id, Name: req.Name, Scopes: req.Scopes, ExpiresAt: req.ExpiresAt}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	ctx := c.Request().Context()
+	secret, err := issueAPIKey(key, func(hash string) error {
+		return h.Repo.CreateAPIKey(ctx, key, hash, actor(c))
+	})
+	if err != nil {
+		return errorJSON(c, err, "Account not found")
+	}
+	return c.JSON(http.StatusCreated, models.IssuedAPIKey{APIKey: *key, Key: secret})
+}
+
+// ListAPIKeys handles GET /accounts/:id/api-keys to list the keys of an
+// account, including revoked and expired ones.
+func (h *Handler) ListAPIKeys(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid account ID"})
+	}
+
+	keys, err := h.Repo.ListAPIKeys(c.Request().Context(), id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// RotateAPIKey handles POST /accounts/:id/api-keys/:keyId/rotate. It issues
+// a replacement with the same name, scopes and expiry and revokes the old key
+// once the optional grace period has passed.
+func (h *Handler) RotateAPIKey(c echo.Context) error {
+	accountID, keyID, err := apiKeyParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid account or API key ID"})
+	}
+
+	req := new(models.RotateAPIKeyRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	var grace time.Duration
+	if req.GracePeriod != "" {
+		if grace, err = time.ParseDuration(req.GracePeriod); err != nil || grace < 0 {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid grace_period"})
+		}
+	}
+
+	ctx := c.Request().Context()
+	now := time.Now()
+	old, err := h.Repo.GetAPIKey(ctx, accountID, keyID)
+	if err != nil {
+		return errorJSON(c, err, "API key not found")
+	}
+	if !old.Active(now) {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "API key is revoked or expired"})
+	}
+
+	replacement := &models.APIKey{AccountID: accountID, Name: old.Name, Scopes: old.Scopes, ExpiresAt: old.ExpiresAt}
+	secret, err := issueAPIKey(replacement, func(hash string) error {
+		return h.Repo.RotateAPIKey(ctx, old, replacement, hash, now.Add(grace), actor(c))
+	})
+	if err != nil {
+		return errorJSON(c, err, "API key not found")
+	}
+	return c.JSON(http.StatusCreated, models.IssuedAPIKey{APIKey: *replacement, Key: secret})
+}
+
+// RevokeAPIKey handles DELETE /accounts/:id/api-keys/:keyId to revoke a key
+// immediately.
+func (h *Handler) RevokeAPIKey(c echo.Context) error {
+	accountID, keyID, err := apiKeyParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid account or API key ID"})
+	}
+
+	ctx := c.Request().Context()
+	if err := h.Repo.RevokeAPIKey(ctx, accountID, keyID, time.Now(), actor(c)); err != nil {
+		return errorJSON(c, err, "API key not found")
+	}
+	key, err := h.Repo.GetAPIKey(ctx, accountID, keyID)
+	if err != nil {
+		return errorJSON(c, err, "API key not found")
+	}
+	return c.JSON(http.StatusOK, key)
+}
+
+// VerifyAPIKey handles POST /api-keys/verify. It resolves a key to its
+// account and scopes, answering 401 for unknown, revoked or expired keys.
+func (h *Handler) VerifyAPIKey(c echo.Context) error {
+	req := new(models.VerifyAPIKeyRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	ctx := c.Request().Context()
+	key, err := h.verify(ctx, req.Key, time.Now())
+	if err != nil {
+		if err == models.ErrNotFound {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid API key"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, models.APIKeyVerification{
+		Valid:     true,
+		AccountID: key.AccountID,
+		KeyID:     key.ID,
+		Scopes:    key.Scopes,
+		ExpiresAt: key.ExpiresAt,
+	})
+}
+
+// verify returns the active key matching secret, or ErrNotFound.
+func (h *Handler) verify(ctx context.Context, secret string, now time.Time) (*models.APIKey, error) {
+	prefix, err := apikeys.Prefix(secret)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+	key, hash, err := h.Repo.FindAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !apikeys.Matches(secret, hash) || !key.Active(now) {
+		return nil, models.ErrNotFound
+	}
+	if err := h.Repo.TouchAPIKey(ctx, key.ID, now); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListAuditEntries handles GET /accounts/:id/audit to list the audit trail of an account.
+func (h *Handler) ListAuditEntries(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid account ID"})
+	}
+
+	entries, err := h.Repo.ListAuditEntries(c.Request().Context(), id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/digitnxt/digit/pkg/authz"
+	"github.com/labstack/echo/v4"
+)
+
+// AccountResource describes the account in the :id path parameter for
+// authorization. Policies identify accounts by name, which is what the
+// account_id claim of identity tokens holds, so rules scoped to a subject's
+// account or subtree only match accounts that exist.
+func (h *Handler) AccountResource(c echo.Context) authz.Resource {
+	res := authz.Resource{Type: "account", ID: c.Param("id")}
+	if id, err := strconv.Atoi(c.Param("id")); err == nil {
+		res.AccountID = h.accountName(c, id)
+	}
+	return res
+}
+
+// DataRequestResource describes the data request in the :id path parameter
+// for authorization, owned by the account it was made against.
+func (h *Handler) DataRequestResource(c echo.Context) authz.Resource {
+	res := authz.Resource{Type: "data-request", ID: c.Param("id")}
+	if id, err := strconv.Atoi(c.Param("id")); err == nil {
+		if dr, err := h.Repo.GetDataRequest(c.Request().Context(), id); err == nil {
+			res.AccountID = h.accountName(c, dr.AccountID)
+		}
+	}
+	return res
+}
+
+func (h *Handler) accountName(c echo.Context, id int) string {
+	account, err := h.Repo.GetAccount(c.Request().Context(), id)
+	if err != nil {
+		return ""
+	}
+	return account.AccountName
+}
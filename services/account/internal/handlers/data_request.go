@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"account/internal/compliance"
+	"account/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ExportAccountData handles GET /accounts/:id/data-export and returns a
+// signed zip archive of the account, its audit trail, its data requests and
+// the metadata of its API keys.
+func (h *Handler) ExportAccountData(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid account ID"})
+	}
+
+	ctx := c.Request().Context()
+	account, err := h.Repo.GetAccount(ctx, id)
+	if err != nil {
+		return errorJSON(c, err, "Account not found")
+	}
+
+	request, err := h.Repo.CreateDataRequest(ctx, id, models.DataRequestExport, actor(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	archive, err := h.buildExport(ctx, *account)
+	if _, ferr := h.Repo.FinishDataRequest(ctx, request.ID, err); ferr != nil && err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error(), "request_id": request.ID})
+	}
+	if err := h.Repo.RecordAudit(ctx, id, models.AuditAccountExported, actor(c), echo.Map{"request_id": request.ID}); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=account-%d-export.zip", id))
+	c.Response().Header().Set("X-Data-Request-ID", strconv.Itoa(request.ID))
+	return c.Blob(http.StatusOK, "application/zip", archive)
+}
+
+func (h *Handler) buildExport(ctx context.Context, account models.Account) ([]byte, error) {
+	if h.ExportSigner == nil {
+		return nil, errors.New("export signing key is not configured")
+	}
+	entries, err := h.Repo.ListAuditEntries(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	requests, err := h.Repo.ListDataRequests(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := h.Repo.ListAPIKeys(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	return h.ExportSigner.BuildArchive(compliance.Export{
+		Account:      account,
+		AuditEntries: entries,
+		DataRequests: requests,
+		APIKeys:      keys,
+	}, time.Now())
+}
+
+// EraseAccountData handles POST /accounts/:id/erasure. The account row is
+// kept so that audit entries and other references stay valid, but its PII is
+// replaced with placeholders and the admin's contact details are redacted
+// wherever they appear as the actor of an audit entry or data request.
+func (h *Handler) EraseAccountData(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid account ID"})
+	}
+
+	ctx := c.Request().Context()
+	account, err := h.Repo.GetAccount(ctx, id)
+	if err != nil {
+		return errorJSON(c, err, "Account not found")
+	}
+
+	request, err := h.Repo.CreateDataRequest(ctx, id, models.DataRequestErasure, actor(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	request, err = h.Repo.FinishDataRequest(ctx, request.ID, h.Repo.EraseAccount(ctx, *account, request.ID, actor(c)))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	if request.Status == models.DataRequestFailed {
+		return c.JSON(http.StatusInternalServerError, request)
+	}
+	return c.JSON(http.StatusOK, request)
+}
+
+// ListDataRequests handles GET /accounts/:id/data-requests to list the
+// export and erasure requests made against an account.
+func (h *Handler) ListDataRequests(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid account ID"})
+	}
+
+	requests, err := h.Repo.ListDataRequests(c.Request().Context(), id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, requests)
+}
+
+// GetDataRequest handles GET /data-requests/:id to track a single request.
+func (h *Handler) GetDataRequest(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid data request ID"})
+	}
+
+	request, err := h.Repo.GetDataRequest(c.Request().Context(), id)
+	if err != nil {
+		return errorJSON(c, err, "Data request not found")
+	}
+	return c.JSON(http.StatusOK, request)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"account/internal/compliance"
+	"account/internal/models"
+
+	"github.com/digitnxt/digit/pkg/authz"
+	"github.com/labstack/echo/v4"
+)
+
+// ActorHeader carries the identity of the caller as set by the API gateway.
+const ActorHeader = "X-User-ID"
+
+// Repository is the storage used by the account handlers.
+type Repository interface {
+	CreateAccount(ctx context.Context, account *models.Account, actor string) error
+	GetAccount(ctx context.Context, id int) (*models.Account, error)
+	ListAccounts(ctx context.Context) ([]models.Account, error)
+	UpdateAccount(ctx context.Context, account *models.Account, actor string) error
+	DeleteAccount(ctx context.Context, id int, actor string) error
+
+	RecordAudit(ctx context.Context, accountID int, action, actor string, details interface{}) error
+	ListAuditEntries(ctx context.Context, accountID int) ([]models.AuditEntry, error)
+
+	CreateDataRequest(ctx context.Context, accountID int, requestType, requestedBy string) (*models.DataRequest, error)
+	FinishDataRequest(ctx context.Context, id int, cause error) (*models.DataRequest, error)
+	GetDataRequest(ctx context.Context, id int) (*models.DataRequest, error)
+	ListDataRequests(ctx context.Context, accountID int) ([]models.DataRequest, error)
+	EraseAccount(ctx context.Context, account models.Account, requestID int, actor string) error
+
+	CreateAPIKey(ctx context.Context, key *models.APIKey, hash, actor string) error
+	ListAPIKeys(ctx context.Context, accountID int) ([]models.APIKey, error)
+	GetAPIKey(ctx context.Context, accountID, id int) (*models.APIKey, error)
+	FindAPIKeyByPrefix(ctx context.Context, prefix string) (key *models.APIKey, hash string, err error)
+	RotateAPIKey(ctx context.Context, old *models.APIKey, replacement *models.APIKey, hash string, graceUntil time.Time, actor string) error
+	RevokeAPIKey(ctx context.Context, accountID, id int, at time.Time, actor string) error
+	TouchAPIKey(ctx context.Context, id int, at time.Time) error
+}
+
+// Handler serves the account routes.
+type Handler struct {
+	Repo Repository
+	// ExportSigner signs data-export archives.
+	ExportSigner *compliance.Signer
+}
+
+// New creates a Handler backed by repo.
+func New(repo Repository, signer *compliance.Signer) *Handler {
+	return &Handler{Repo: repo, ExportSigner: signer}
+}
+
+// actor returns the caller recorded in audit entries and data requests:
+// the authorized subject when routes are protected, else the gateway's
+// ActorHeader.
+func actor(c echo.Context) string {
+	if s, ok := authz.FromContext(c.Request().Context()); ok {
+		return s.ID
+	}
+	if a := c.Request().Header.Get(ActorHeader); a != "" {
+		return a
+	}
+	return "anonymous"
+}
+
+// errorJSON writes err as a JSON error, mapping repository errors to
+// notFound or a conflict status.
+func errorJSON(c echo.Context, err error, notFound string) error {
+	switch err {
+	case models.ErrNotFound:
+		return c.JSON(http.StatusNotFound, echo.Map{"error": notFound})
+	case models.ErrConflict:
+		return c.JSON(http.StatusConflict, echo.Map{"error": "Account name already exists"})
+	}
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+}
@@ -0,0 +1,139 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"account/internal/models"
+)
+
+type storedAPIKey struct {
+	key  models.APIKey
+	hash string
+}
+
+func (r *Repository) insertAPIKey(key *models.APIKey, hash string) error {
+	if _, ok := r.accounts[key.AccountID]; !ok {
+		return models.ErrNotFound
+	}
+	for _, k := range r.apiKeys {
+		if k.key.Prefix == key.Prefix {
+			return models.ErrConflict
+		}
+	}
+	r.nextAPIKey++
+	key.ID = r.nextAPIKey
+	key.CreatedAt = time.Now()
+	stored := *key
+	stored.Scopes = append([]string{}, key.Scopes...)
+	r.apiKeys = append(r.apiKeys, storedAPIKey{key: stored, hash: hash})
+	return nil
+}
+
+func (r *Repository) findAPIKey(accountID, id int) *storedAPIKey {
+	for i := range r.apiKeys {
+		if k := &r.apiKeys[i]; k.key.ID == id && k.key.AccountID == accountID {
+			return k
+		}
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new key for key.AccountID.
+func (r *Repository) CreateAPIKey(ctx context.Context, key *models.APIKey, hash, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.insertAPIKey(key, hash); err != nil {
+		return err
+	}
+	details := map[string]interface{}{"key_id": key.ID, "prefix": key.Prefix, "scopes": key.Scopes}
+	return r.recordAudit(key.AccountID, models.AuditAPIKeyCreated, actor, details)
+}
+
+// ListAPIKeys returns the keys of an account, oldest first.
+func (r *Repository) ListAPIKeys(ctx context.Context, accountID int) ([]models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var keys []models.APIKey
+	for _, k := range r.apiKeys {
+		if k.key.AccountID == accountID {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys, nil
+}
+
+// GetAPIKey fetches a key belonging to accountID.
+func (r *Repository) GetAPIKey(ctx context.Context, accountID, id int) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := r.findAPIKey(accountID, id)
+	if k == nil {
+		return nil, models.ErrNotFound
+	}
+	key := k.key
+	return &key, nil
+}
+
+// FindAPIKeyByPrefix fetches a key and its stored hash by prefix.
+func (r *Repository) FindAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.apiKeys {
+		if k.key.Prefix == prefix {
+			key := k.key
+			return &key, k.hash, nil
+		}
+	}
+	return nil, "", models.ErrNotFound
+}
+
+// RotateAPIKey stores replacement and revokes old at graceUntil.
+func (r *Repository) RotateAPIKey(ctx context.Context, old *models.APIKey, replacement *models.APIKey, hash string, graceUntil time.Time, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := r.findAPIKey(old.AccountID, old.ID)
+	if k == nil || (k.key.RevokedAt != nil && !k.key.RevokedAt.After(graceUntil)) {
+		return models.ErrNotFound
+	}
+	if err := r.insertAPIKey(replacement, hash); err != nil {
+		return err
+	}
+	// insertAPIKey may have grown the slice, so look the old key up again.
+	r.findAPIKey(old.AccountID, old.ID).key.RevokedAt = &graceUntil
+	details := map[string]interface{}{"key_id": old.ID, "replaced_by": replacement.ID, "prefix": replacement.Prefix, "grace_until": graceUntil}
+	return r.recordAudit(old.AccountID, models.AuditAPIKeyRotated, actor, details)
+}
+
+// RevokeAPIKey revokes a key at at, keeping any earlier revocation time.
+func (r *Repository) RevokeAPIKey(ctx context.Context, accountID, id int, at time.Time, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := r.findAPIKey(accountID, id)
+	if k == nil {
+		return models.ErrNotFound
+	}
+	if k.key.RevokedAt == nil || k.key.RevokedAt.After(at) {
+		k.key.RevokedAt = &at
+	}
+	return r.recordAudit(accountID, models.AuditAPIKeyRevoked, actor, map[string]interface{}{"key_id": id})
+}
+
+// TouchAPIKey records that a key was used at at.
+func (r *Repository) TouchAPIKey(ctx context.Context, id int, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.apiKeys {
+		if r.apiKeys[i].key.ID == id {
+			r.apiKeys[i].key.LastUsedAt = &at
+		}
+	}
+	return nil
+}
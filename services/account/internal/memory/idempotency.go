@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"account/internal/models"
+)
+
+// IdempotencyStore is an in-memory idempotency record store.
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	records map[[2]string]models.IdempotencyRecord
+}
+
+// NewIdempotencyStore returns an empty IdempotencyStore.
+func NewIdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{records: make(map[[2]string]models.IdempotencyRecord)}
+}
+
+// Reserve stores record unless an unexpired record holds its scope and key.
+func (s *IdempotencyStore) Reserve(ctx context.Context, record models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := [2]string{record.Scope, record.Key}
+	if existing, ok := s.records[id]; ok && !existing.ExpiresAt.Before(record.CreatedAt) {
+		return &existing, nil
+	}
+	s.records[id] = record
+	return nil, nil
+}
+
+// Complete records the response of a reserved request.
+func (s *IdempotencyStore) Complete(ctx context.Context, scope, key string, accountID, statusCode int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := [2]string{scope, key}
+	record, ok := s.records[id]
+	if !ok {
+		return nil
+	}
+	record.AccountID = accountID
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte(nil), body...)
+	s.records[id] = record
+	return nil
+}
+
+// Release removes a reservation that did not complete.
+func (s *IdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := [2]string{scope, key}
+	if record, ok := s.records[id]; ok && !record.Completed() {
+		delete(s.records, id)
+	}
+	return nil
+}
+
+// DeleteExpired removes records that expired before now.
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, record := range s.records {
+		if record.ExpiresAt.Before(now) {
+			delete(s.records, id)
+		}
+	}
+	return nil
+}
+
+// deleteAccount removes the records concerning accountID.
+func (s *IdempotencyStore) deleteAccount(accountID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, record := range s.records {
+		if record.AccountID == accountID {
+			delete(s.records, id)
+		}
+	}
+}
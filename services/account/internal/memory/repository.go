@@ -0,0 +1,280 @@
+// Package memory provides in-process implementations of the account service
+// stores. They mirror the PostgreSQL behaviour closely enough to run the HTTP
+// routes in tests without a database.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"account/internal/compliance"
+	"account/internal/models"
+)
+
+// Repository is an in-memory account repository.
+type Repository struct {
+	// Idempotency, when set, is the idempotency store whose records of an
+	// account are deleted when it is erased.
+	Idempotency *IdempotencyStore
+
+	mu           sync.Mutex
+	accounts     map[int]models.Account
+	audit        []models.AuditEntry
+	dataRequests []models.DataRequest
+	apiKeys      []storedAPIKey
+	nextAccount  int
+	nextAudit    int
+	nextRequest  int
+	nextAPIKey   int
+}
+
+// NewRepository returns an empty Repository.
+func NewRepository() *Repository {
+	return &Repository{accounts: make(map[int]models.Account)}
+}
+
+func (r *Repository) nameTaken(name string, except int) bool {
+	for id, a := range r.accounts {
+		if a.AccountName == name && id != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repository) recordAudit(accountID int, action, actor string, details interface{}) error {
+	if details == nil {
+		details = struct{}{}
+	}
+	body, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	r.nextAudit++
+	r.audit = append(r.audit, models.AuditEntry{
+		ID:        r.nextAudit,
+		AccountID: accountID,
+		Action:    action,
+		Actor:     actor,
+		Details:   body,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+// CreateAccount stores account, filling in its ID and creation time.
+func (r *Repository) CreateAccount(ctx context.Context, account *models.Account, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.nameTaken(account.AccountName, 0) {
+		return models.ErrConflict
+	}
+	r.nextAccount++
+	account.ID = r.nextAccount
+	account.CreatedAt = time.Now()
+	r.accounts[account.ID] = *account
+	return r.recordAudit(account.ID, models.AuditAccountCreated, actor, nil)
+}
+
+// GetAccount fetches a single account.
+func (r *Repository) GetAccount(ctx context.Context, id int) (*models.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	account, ok := r.accounts[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &account, nil
+}
+
+// ListAccounts returns all accounts ordered by ID.
+func (r *Repository) ListAccounts(ctx context.Context) ([]models.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var accounts []models.Account
+	for id := 1; id <= r.nextAccount; id++ {
+		if account, ok := r.accounts[id]; ok {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+// UpdateAccount replaces the fields of the account with account.ID.
+func (r *Repository) UpdateAccount(ctx context.Context, account *models.Account, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.accounts[account.ID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	if r.nameTaken(account.AccountName, account.ID) {
+		return models.ErrConflict
+	}
+	account.CreatedAt = existing.CreatedAt
+	r.accounts[account.ID] = *account
+	details := map[string]interface{}{"fields": []string{"accountname", "admin_email", "admin_phone", "config"}}
+	return r.recordAudit(account.ID, models.AuditAccountUpdated, actor, details)
+}
+
+// DeleteAccount removes an account. Its audit trail is kept.
+func (r *Repository) DeleteAccount(ctx context.Context, id int, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.accounts[id]; !ok {
+		return models.ErrNotFound
+	}
+	delete(r.accounts, id)
+	// API keys are removed with their account, as ON DELETE CASCADE does.
+	keys := r.apiKeys[:0]
+	for _, k := range r.apiKeys {
+		if k.key.AccountID != id {
+			keys = append(keys, k)
+		}
+	}
+	r.apiKeys = keys
+	return r.recordAudit(id, models.AuditAccountDeleted, actor, nil)
+}
+
+// RecordAudit appends an audit entry for accountID.
+func (r *Repository) RecordAudit(ctx context.Context, accountID int, action, actor string, details interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.recordAudit(accountID, action, actor, details)
+}
+
+// ListAuditEntries returns the audit trail of an account, oldest first.
+func (r *Repository) ListAuditEntries(ctx context.Context, accountID int) ([]models.AuditEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []models.AuditEntry
+	for _, e := range r.audit {
+		if e.AccountID == accountID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// CreateDataRequest logs a new data-protection request in the processing state.
+func (r *Repository) CreateDataRequest(ctx context.Context, accountID int, requestType, requestedBy string) (*models.DataRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextRequest++
+	req := models.DataRequest{
+		ID:          r.nextRequest,
+		AccountID:   accountID,
+		Type:        requestType,
+		Status:      models.DataRequestProcessing,
+		RequestedBy: requestedBy,
+		CreatedAt:   time.Now(),
+	}
+	r.dataRequests = append(r.dataRequests, req)
+	return &req, nil
+}
+
+// FinishDataRequest moves a request to its terminal state.
+func (r *Repository) FinishDataRequest(ctx context.Context, id int, cause error) (*models.DataRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.dataRequests {
+		req := &r.dataRequests[i]
+		if req.ID != id {
+			continue
+		}
+		req.Status, req.Error = models.DataRequestCompleted, ""
+		if cause != nil {
+			req.Status, req.Error = models.DataRequestFailed, cause.Error()
+		}
+		now := time.Now()
+		req.CompletedAt = &now
+		result := *req
+		return &result, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+// GetDataRequest fetches a single data request.
+func (r *Repository) GetDataRequest(ctx context.Context, id int) (*models.DataRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, req := range r.dataRequests {
+		if req.ID == id {
+			return &req, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+// ListDataRequests returns the data requests made against an account, oldest first.
+func (r *Repository) ListDataRequests(ctx context.Context, accountID int) ([]models.DataRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var requests []models.DataRequest
+	for _, req := range r.dataRequests {
+		if req.AccountID == accountID {
+			requests = append(requests, req)
+		}
+	}
+	return requests, nil
+}
+
+// EraseAccount anonymises account the same way the PostgreSQL repository does.
+func (r *Repository) EraseAccount(ctx context.Context, account models.Account, requestID int, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.accounts[account.ID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	stored.AccountName = compliance.ErasedAccountName(account.ID)
+	stored.AdminEmail = ""
+	stored.AdminPhone = ""
+	stored.Config = compliance.ErasedConfig
+	r.accounts[account.ID] = stored
+
+	for _, pii := range []string{account.AdminEmail, account.AdminPhone} {
+		if pii == "" {
+			continue
+		}
+		for i := range r.audit {
+			if r.audit[i].AccountID == account.ID && r.audit[i].Actor == pii {
+				r.audit[i].Actor = compliance.RedactedActor
+			}
+		}
+		for i := range r.dataRequests {
+			if r.dataRequests[i].AccountID == account.ID && r.dataRequests[i].RequestedBy == pii {
+				r.dataRequests[i].RequestedBy = compliance.RedactedActor
+			}
+		}
+		for i := range r.audit {
+			if r.audit[i].AccountID == account.ID && bytes.Contains(r.audit[i].Details, []byte(pii)) {
+				r.audit[i].Details = json.RawMessage(`{}`)
+			}
+		}
+	}
+	for i := range r.apiKeys {
+		if r.apiKeys[i].key.AccountID == account.ID {
+			r.apiKeys[i].key.Name = ""
+		}
+	}
+	if r.Idempotency != nil {
+		r.Idempotency.deleteAccount(account.ID)
+	}
+	return r.recordAudit(account.ID, models.AuditAccountErased, actor, map[string]interface{}{"request_id": requestID})
+}
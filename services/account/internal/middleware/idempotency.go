@@ -0,0 +1,209 @@
+// Package middleware contains Echo middleware shared by the account routes.
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"account/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header carrying the client's key.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from a stored record.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+
+	// AccountContextKey is the Echo context key under which a handler that
+	// creates an account stores its ID, so that the stored response is
+	// deleted along with the account's other data on erasure. Routes under
+	// /accounts/:id need not set it.
+	AccountContextKey = "account_id"
+)
+
+// IdempotencyStore persists idempotency records.
+type IdempotencyStore interface {
+	// Reserve stores record unless an unexpired record with the same scope
+	// and key exists, in which case that record is returned instead.
+	Reserve(ctx context.Context, record models.IdempotencyRecord) (existing *models.IdempotencyRecord, err error)
+	// Complete saves the response of a reserved request, which concerns
+	// accountID unless it is zero.
+	Complete(ctx context.Context, scope, key string, accountID, statusCode int, contentType string, body []byte) error
+	// Release drops a reservation so the request can be retried.
+	Release(ctx context.Context, scope, key string) error
+	// DeleteExpired removes records that expired before now.
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+// IdempotencyConfig configures the Idempotency middleware.
+type IdempotencyConfig struct {
+	Store IdempotencyStore
+	// TTL is how long a key and its response are kept.
+	TTL time.Duration
+	// ScopeHeader names the header identifying the caller; keys only collide
+	// within the same scope. Defaults to X-User-ID.
+	ScopeHeader string
+	// Scope, when set, identifies the caller instead of ScopeHeader, e.g.
+	// from an authenticated subject.
+	Scope func(echo.Context) string
+}
+
+// Idempotency replays the stored response when a POST, PUT, PATCH or DELETE
+// request is retried with the same Idempotency-Key. Reusing a key with a
+// different request returns 422 and retrying while the original request is
+// still running returns 409. Server errors and panics are not stored, so such
+// requests can be retried with the same key.
+func Idempotency(config IdempotencyConfig) echo.MiddlewareFunc {
+	if config.ScopeHeader == "" {
+		config.ScopeHeader = "X-User-ID"
+	}
+	if config.Scope == nil {
+		config.Scope = func(c echo.Context) string { return c.Request().Header.Get(config.ScopeHeader) }
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			key := req.Header.Get(IdempotencyKeyHeader)
+			if key == "" || !isMutation(req.Method) {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "Idempotency-Key is too long"})
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+			record := models.IdempotencyRecord{
+				Scope:       config.Scope(c),
+				Key:         key,
+				RequestHash: requestHash(req.Method, req.URL.Path, body),
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(config.TTL),
+			}
+			ctx := req.Context()
+			existing, err := config.Store.Reserve(ctx, record)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+			}
+			if existing != nil {
+				return replay(c, existing, record.RequestHash)
+			}
+
+			release := func() {
+				if rerr := config.Store.Release(ctx, record.Scope, key); rerr != nil {
+					c.Logger().Errorf("release idempotency key: %v", rerr)
+				}
+			}
+			// A panicking handler must not hold the key until it expires;
+			// the panic is passed on to the recovery middleware.
+			defer func() {
+				if r := recover(); r != nil {
+					release()
+					panic(r)
+				}
+			}()
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			err = next(c)
+			status := c.Response().Status
+			if err != nil || status >= http.StatusInternalServerError {
+				release()
+				return err
+			}
+			contentType := c.Response().Header().Get(echo.HeaderContentType)
+			if cerr := config.Store.Complete(ctx, record.Scope, key, accountID(c), status, contentType, recorder.body.Bytes()); cerr != nil {
+				c.Logger().Errorf("store idempotent response: %v", cerr)
+			}
+			return nil
+		}
+	}
+}
+
+// PurgeExpiredIdempotencyKeys deletes expired records every interval until
+// ctx is cancelled.
+func PurgeExpiredIdempotencyKeys(ctx context.Context, store IdempotencyStore, interval time.Duration, logger echo.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := store.DeleteExpired(ctx, now); err != nil {
+				logger.Errorf("purge idempotency keys: %v", err)
+			}
+		}
+	}
+}
+
+// accountID returns the account a response concerns: the one stored under
+// AccountContextKey, or the one named by the path of /accounts/:id routes.
+func accountID(c echo.Context) int {
+	if id, ok := c.Get(AccountContextKey).(int); ok {
+		return id
+	}
+	if !strings.HasPrefix(c.Path(), "/accounts/:id") {
+		return 0
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	return id
+}
+
+func replay(c echo.Context, record *models.IdempotencyRecord, hash string) error {
+	if record.RequestHash != hash {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": "Idempotency-Key was already used with a different request"})
+	}
+	if !record.Completed() {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "A request with this Idempotency-Key is still being processed"})
+	}
+	c.Response().Header().Set(IdempotentReplayedHeader, "true")
+	return c.Blob(record.StatusCode, record.ContentType, record.Body)
+}
+
+func isMutation(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// requestHash fingerprints the parts of a request that must match for a
+// retry to be replayed.
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder copies everything written to the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,46 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"account/internal/memory"
+	"account/internal/middleware"
+
+	"github.com/labstack/echo/v4"
+	echomw "github.com/labstack/echo/v4/middleware"
+)
+
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	e := echo.New()
+	e.Use(echomw.Recover())
+	e.Use(middleware.Idempotency(middleware.IdempotencyConfig{Store: memory.NewIdempotencyStore(), TTL: time.Hour}))
+	calls := 0
+	e.POST("/accounts", func(c echo.Context) error {
+		if calls++; calls == 1 {
+			panic("boom")
+		}
+		return c.JSON(http.StatusCreated, echo.Map{"call": calls})
+	})
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(`{"name":"pb"}`))
+		req.Header.Set(middleware.IdempotencyKeyHeader, "k1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post(); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("panicking request: status %d", rec.Code)
+	}
+	// The retry runs the handler again rather than waiting out the TTL.
+	if rec := post(); rec.Code != http.StatusCreated || rec.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+		t.Fatalf("retry: status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := post(); rec.Header().Get(middleware.IdempotentReplayedHeader) != "true" || !strings.Contains(rec.Body.String(), `"call":2`) {
+		t.Fatalf("second retry not replayed: %s", rec.Body)
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// APIKey is a credential issued to a machine client acting on behalf of an
+// account. Only a hash of the secret is stored; the prefix identifies the
+// key in listings and logs.
+type APIKey struct {
+	ID         int        `json:"id"`
+	AccountID  int        `json:"account_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key may be used at now.
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil && !k.RevokedAt.After(now) {
+		return false
+	}
+	return k.ExpiresAt == nil || k.ExpiresAt.After(now)
+}
+
+// IssuedAPIKey is returned when a key is created or rotated. It is the only
+// time the secret is ever shown.
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyRequest is the body of a request to create an API key.
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// RotateAPIKeyRequest is the optional body of a key rotation. GracePeriod is
+// a Go duration during which the old key keeps working.
+type RotateAPIKeyRequest struct {
+	GracePeriod string `json:"grace_period,omitempty"`
+}
+
+// VerifyAPIKeyRequest is the body of a key verification.
+type VerifyAPIKeyRequest struct {
+	Key string `json:"key"`
+}
+
+// APIKeyVerification describes the account and scopes a valid key grants.
+type APIKeyVerification struct {
+	Valid     bool       `json:"valid"`
+	AccountID int        `json:"account_id"`
+	KeyID     int        `json:"key_id"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit actions recorded against an account.
+const (
+	AuditAccountCreated  = "account.created"
+	AuditAccountUpdated  = "account.updated"
+	AuditAccountDeleted  = "account.deleted"
+	AuditAccountExported = "account.exported"
+	AuditAccountErased   = "account.erased"
+	AuditAPIKeyCreated   = "api_key.created"
+	AuditAPIKeyRotated   = "api_key.rotated"
+	AuditAPIKeyRevoked   = "api_key.revoked"
+)
+
+// AuditEntry represents a single change made to an account. Details never
+// carry PII values, only the names of the fields involved, so entries can be
+// kept intact when the account itself is erased.
+type AuditEntry struct {
+	ID        int             `json:"id"`
+	AccountID int             `json:"account_id"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+}
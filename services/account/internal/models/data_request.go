@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Data request types.
+const (
+	DataRequestExport  = "export"
+	DataRequestErasure = "erasure"
+)
+
+// Data request statuses.
+const (
+	DataRequestPending    = "pending"
+	DataRequestProcessing = "processing"
+	DataRequestCompleted  = "completed"
+	DataRequestFailed     = "failed"
+)
+
+// DataRequest tracks a data-protection request (export or erasure) made
+// against an account from submission to completion.
+type DataRequest struct {
+	ID          int        `json:"id"`
+	AccountID   int        `json:"account_id"`
+	Type        string     `json:"type"`
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,9 @@
+package models
+
+import "errors"
+
+// Errors returned by repositories.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// IdempotencyRecord stores the outcome of a request made with an
+// Idempotency-Key so that retries can be answered with the original response.
+// A record without a status code belongs to a request still being processed.
+type IdempotencyRecord struct {
+	Scope       string `json:"scope"`
+	Key         string `json:"key"`
+	RequestHash string `json:"request_hash"`
+	// AccountID is the account the response concerns, or zero. The record
+	// is deleted when that account is erased.
+	AccountID   int       `json:"account_id,omitempty"`
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Completed reports whether the original request has finished.
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
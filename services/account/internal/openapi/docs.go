@@ -0,0 +1,20 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/labstack/echo/v4"
+	echoSwagger "github.com/swaggo/echo-swagger"
+)
+
+// SpecPath is where the OpenAPI document is served.
+const SpecPath = "/openapi.json"
+
+// RegisterDocs serves doc at /openapi.json and Swagger UI at /swagger/*.
+func RegisterDocs(e *echo.Echo, doc *openapi3.T) {
+	e.GET(SpecPath, func(c echo.Context) error {
+		return c.JSON(http.StatusOK, doc)
+	})
+	e.GET("/swagger/*", echoSwagger.EchoWrapHandler(echoSwagger.URL(SpecPath)))
+}
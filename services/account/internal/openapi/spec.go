@@ -0,0 +1,284 @@
+// Package openapi describes the account service as an OpenAPI 3 document and
+// validates requests and responses against it. Schemas are generated from
+// the model types so the document cannot drift from the JSON the handlers
+// actually produce.
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"account/internal/models"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+)
+
+// Version is the version of the account service API.
+const Version = "1.0"
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	Error     string `json:"error"`
+	RequestID int    `json:"request_id,omitempty"`
+}
+
+// messageResponse is the body of responses that only carry a message.
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// customizeSchema renders free-form JSON fields as objects.
+func customizeSchema(name string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+	if t == rawMessageType {
+		schema.Type = &openapi3.Types{openapi3.TypeObject}
+	}
+	return nil
+}
+
+// schemaFor generates the schema of v's type. Fields whose JSON tag lacks
+// omitempty are marked required.
+func schemaFor(v interface{}) (*openapi3.Schema, error) {
+	ref, err := openapi3gen.NewSchemaRefForValue(v, nil, openapi3gen.SchemaCustomizer(customizeSchema))
+	if err != nil {
+		return nil, err
+	}
+	schema := ref.Value
+	schema.Required = requiredFields(reflect.TypeOf(v))
+	return schema, nil
+}
+
+// requiredFields lists the JSON names of the fields of t, including those of
+// embedded structs, that are always present when t is encoded.
+func requiredFields(t reflect.Type) []string {
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			required = append(required, requiredFields(field.Type)...)
+			continue
+		}
+		if name != "" && name != "-" && !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return required
+}
+
+// Spec builds the OpenAPI document for every route served by the account
+// service.
+func Spec() (*openapi3.T, error) {
+	components := openapi3.NewComponents()
+	components.Schemas = openapi3.Schemas{}
+	for name, v := range map[string]interface{}{
+		"Account":     models.Account{},
+		"AuditEntry":  models.AuditEntry{},
+		"DataRequest": models.DataRequest{},
+		"Error":       errorResponse{},
+		"Message":     messageResponse{},
+
+		"APIKey":              models.APIKey{},
+		"IssuedAPIKey":        models.IssuedAPIKey{},
+		"APIKeyRequest":       models.APIKeyRequest{},
+		"RotateAPIKeyRequest": models.RotateAPIKeyRequest{},
+		"VerifyAPIKeyRequest": models.VerifyAPIKeyRequest{},
+		"APIKeyVerification":  models.APIKeyVerification{},
+	} {
+		schema, err := schemaFor(v)
+		if err != nil {
+			return nil, fmt.Errorf("generate %s schema: %w", name, err)
+		}
+		components.Schemas[name] = openapi3.NewSchemaRef("", schema)
+	}
+
+	// Clients send accounts without the server-assigned fields and must name
+	// the account.
+	input := openapi3.NewObjectSchema()
+	for name, prop := range components.Schemas["Account"].Value.Properties {
+		if name != "id" && name != "created_at" {
+			input.WithPropertyRef(name, prop)
+		}
+	}
+	input.Properties["accountname"] = openapi3.NewSchemaRef("", openapi3.NewStringSchema().WithMinLength(1))
+	input.Required = []string{"accountname"}
+	components.Schemas["AccountInput"] = openapi3.NewSchemaRef("", input)
+
+	// Only the key name is required when creating a key, and only the key
+	// itself when verifying one.
+	components.Schemas["APIKeyRequest"].Value.Required = []string{"name"}
+	components.Schemas["VerifyAPIKeyRequest"].Value.Required = []string{"key"}
+
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:       "Account Service API",
+			Description: "Manages DIGIT accounts, their audit trail and data-protection requests",
+			Version:     Version,
+		},
+		Servers:    openapi3.Servers{{URL: "/"}},
+		Components: &components,
+		Paths:      openapi3.NewPaths(),
+	}
+
+	// Deployments that enforce authorization require an identity service
+	// access token, answering 401 without one and 403 when the policy
+	// denies the request; others accept anonymous calls.
+	components.SecuritySchemes = openapi3.SecuritySchemes{
+		"BearerAuth": &openapi3.SecuritySchemeRef{Value: openapi3.NewJWTSecurityScheme().
+			WithDescription("Identity service access token, required when authorization is enforced")},
+	}
+	doc.Security = *openapi3.NewSecurityRequirements().
+		With(openapi3.NewSecurityRequirement().Authenticate("BearerAuth")).
+		With(openapi3.NewSecurityRequirement())
+
+	idempotencyKey := &openapi3.ParameterRef{Value: openapi3.NewHeaderParameter("Idempotency-Key").
+		WithDescription("Retries with the same key replay the original response").
+		WithSchema(openapi3.NewStringSchema().WithMaxLength(255))}
+	accountID := &openapi3.ParameterRef{Value: openapi3.NewPathParameter("id").
+		WithDescription("Account ID").
+		WithSchema(openapi3.NewIntegerSchema())}
+	accountBody := jsonBody("AccountInput", true)
+
+	doc.AddOperation("/accounts", http.MethodPost, operation("createAccount", "accounts", "Create an account",
+		params(idempotencyKey), accountBody,
+		jsonResponse(http.StatusCreated, "Created account", schemaRef("Account")),
+		errorResponses(http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity)))
+	doc.AddOperation("/accounts", http.MethodGet, operation("listAccounts", "accounts", "List accounts",
+		nil, nil,
+		jsonResponse(http.StatusOK, "All accounts", nullableArrayOf("Account"))))
+	doc.AddOperation("/accounts/{id}", http.MethodGet, operation("getAccount", "accounts", "Get an account",
+		params(accountID), nil,
+		jsonResponse(http.StatusOK, "The account", schemaRef("Account")),
+		errorResponses(http.StatusBadRequest, http.StatusNotFound)))
+	doc.AddOperation("/accounts/{id}", http.MethodPut, operation("updateAccount", "accounts", "Replace an account",
+		params(accountID, idempotencyKey), accountBody,
+		jsonResponse(http.StatusOK, "Updated account", schemaRef("Account")),
+		errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity)))
+	doc.AddOperation("/accounts/{id}", http.MethodDelete, operation("deleteAccount", "accounts", "Delete an account",
+		params(accountID, idempotencyKey), nil,
+		jsonResponse(http.StatusOK, "Account deleted", schemaRef("Message")),
+		errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity)))
+
+	doc.AddOperation("/accounts/{id}/audit", http.MethodGet, operation("listAuditEntries", "audit", "List the audit trail of an account",
+		params(accountID), nil,
+		jsonResponse(http.StatusOK, "Audit entries, oldest first", nullableArrayOf("AuditEntry")),
+		errorResponses(http.StatusBadRequest)))
+
+	archive := openapi3.NewResponse().WithDescription("Signed zip archive of the account, its audit trail, data requests and API key metadata")
+	archive.Content = openapi3.NewContentWithSchema(openapi3.NewStringSchema().WithFormat("binary"), []string{"application/zip"})
+	doc.AddOperation("/accounts/{id}/data-export", http.MethodGet, operation("exportAccountData", "data-protection", "Export everything held about an account",
+		params(accountID), nil,
+		map[int]*openapi3.Response{http.StatusOK: archive},
+		errorResponses(http.StatusBadRequest, http.StatusNotFound)))
+	doc.AddOperation("/accounts/{id}/erasure", http.MethodPost, operation("eraseAccountData", "data-protection", "Anonymise the PII of an account",
+		params(accountID, idempotencyKey), nil,
+		jsonResponse(http.StatusOK, "Completed erasure request", schemaRef("DataRequest")),
+		errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity)))
+	doc.AddOperation("/accounts/{id}/data-requests", http.MethodGet, operation("listDataRequests", "data-protection", "List the data requests made against an account",
+		params(accountID), nil,
+		jsonResponse(http.StatusOK, "Data requests, oldest first", nullableArrayOf("DataRequest")),
+		errorResponses(http.StatusBadRequest)))
+	doc.AddOperation("/data-requests/{id}", http.MethodGet, operation("getDataRequest", "data-protection", "Get a data request",
+		params(&openapi3.ParameterRef{Value: openapi3.NewPathParameter("id").
+			WithDescription("Data request ID").
+			WithSchema(openapi3.NewIntegerSchema())}), nil,
+		jsonResponse(http.StatusOK, "The data request", schemaRef("DataRequest")),
+		errorResponses(http.StatusBadRequest, http.StatusNotFound)))
+
+	keyID := &openapi3.ParameterRef{Value: openapi3.NewPathParameter("keyId").
+		WithDescription("API key ID").
+		WithSchema(openapi3.NewIntegerSchema())}
+	doc.AddOperation("/accounts/{id}/api-keys", http.MethodPost, operation("createAPIKey", "api-keys", "Issue an API key for an account",
+		params(accountID, idempotencyKey), jsonBody("APIKeyRequest", true),
+		jsonResponse(http.StatusCreated, "The new key; the secret is only shown once", schemaRef("IssuedAPIKey")),
+		errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity)))
+	doc.AddOperation("/accounts/{id}/api-keys", http.MethodGet, operation("listAPIKeys", "api-keys", "List the API keys of an account",
+		params(accountID), nil,
+		jsonResponse(http.StatusOK, "API keys, oldest first", nullableArrayOf("APIKey")),
+		errorResponses(http.StatusBadRequest)))
+	doc.AddOperation("/accounts/{id}/api-keys/{keyId}/rotate", http.MethodPost, operation("rotateAPIKey", "api-keys", "Replace an API key",
+		params(accountID, keyID, idempotencyKey), jsonBody("RotateAPIKeyRequest", false),
+		jsonResponse(http.StatusCreated, "The replacement key; the secret is only shown once", schemaRef("IssuedAPIKey")),
+		errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity)))
+	doc.AddOperation("/accounts/{id}/api-keys/{keyId}", http.MethodDelete, operation("revokeAPIKey", "api-keys", "Revoke an API key",
+		params(accountID, keyID, idempotencyKey), nil,
+		jsonResponse(http.StatusOK, "The revoked key", schemaRef("APIKey")),
+		errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity)))
+	verify := operation("verifyAPIKey", "api-keys", "Resolve an API key to its account and scopes",
+		nil, jsonBody("VerifyAPIKeyRequest", true),
+		jsonResponse(http.StatusOK, "The key is valid", schemaRef("APIKeyVerification")),
+		errorResponses(http.StatusBadRequest, http.StatusUnauthorized))
+	verify.Security = openapi3.NewSecurityRequirements()
+	doc.AddOperation("/api-keys/verify", http.MethodPost, verify)
+
+	if err := openapi3.NewLoader().ResolveRefsIn(doc, nil); err != nil {
+		return nil, fmt.Errorf("resolve references: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	return doc, nil
+}
+
+func schemaRef(name string) *openapi3.SchemaRef {
+	return openapi3.NewSchemaRef("#/components/schemas/"+name, nil)
+}
+
+// nullableArrayOf describes list responses, which are null when empty.
+func nullableArrayOf(name string) *openapi3.SchemaRef {
+	schema := openapi3.NewArraySchema().WithNullable()
+	schema.Items = schemaRef(name)
+	return openapi3.NewSchemaRef("", schema)
+}
+
+func jsonBody(schema string, required bool) *openapi3.RequestBodyRef {
+	return &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().
+		WithRequired(required).
+		WithJSONSchemaRef(schemaRef(schema))}
+}
+
+func params(refs ...*openapi3.ParameterRef) openapi3.Parameters {
+	return openapi3.Parameters(refs)
+}
+
+func jsonResponse(status int, description string, schema *openapi3.SchemaRef) map[int]*openapi3.Response {
+	return map[int]*openapi3.Response{
+		status: openapi3.NewResponse().WithDescription(description).WithJSONSchemaRef(schema),
+	}
+}
+
+func errorResponses(statuses ...int) map[int]*openapi3.Response {
+	responses := make(map[int]*openapi3.Response, len(statuses))
+	for _, status := range statuses {
+		responses[status] = openapi3.NewResponse().WithDescription(http.StatusText(status)).WithJSONSchemaRef(schemaRef("Error"))
+	}
+	return responses
+}
+
+func operation(id, tag, summary string, parameters openapi3.Parameters, body *openapi3.RequestBodyRef, responses ...map[int]*openapi3.Response) *openapi3.Operation {
+	op := openapi3.NewOperation()
+	op.OperationID = id
+	op.Summary = summary
+	op.Tags = []string{tag}
+	op.Parameters = parameters
+	op.RequestBody = body
+	op.Responses = openapi3.NewResponses()
+	op.Responses.Delete("default")
+	for _, group := range responses {
+		for status, response := range group {
+			op.AddResponse(status, response)
+		}
+	}
+	// Any status may also be a server error.
+	op.Responses.Set("default", &openapi3.ResponseRef{Value: openapi3.NewResponse().
+		WithDescription("Unexpected error").
+		WithJSONSchemaRef(schemaRef("Error"))})
+	return op
+}
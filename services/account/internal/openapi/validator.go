@@ -0,0 +1,111 @@
+package openapi
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/labstack/echo/v4"
+)
+
+func init() {
+	openapi3filter.RegisterBodyDecoder("application/zip", openapi3filter.FileBodyDecoder)
+}
+
+// ValidatorConfig configures the Validator middleware.
+type ValidatorConfig struct {
+	// ValidateResponses checks every response against the document as well.
+	// Responses are buffered to do so.
+	ValidateResponses bool
+	// StrictResponses replaces a response that does not match the document
+	// with a 500. Otherwise mismatches are only logged.
+	StrictResponses bool
+}
+
+// Validator rejects requests that do not match doc with a 400. Requests for
+// paths the document does not describe, such as the documentation routes,
+// are passed through untouched.
+func Validator(doc *openapi3.T, cfg ValidatorConfig) (echo.MiddlewareFunc, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	options := &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			route, pathParams, err := router.FindRoute(req)
+			if err != nil {
+				return next(c)
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			}
+			if err := openapi3filter.ValidateRequest(req.Context(), input); err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+			}
+			if !cfg.ValidateResponses {
+				return next(c)
+			}
+			return validateResponse(c, next, input, cfg.StrictResponses)
+		}
+	}, nil
+}
+
+func validateResponse(c echo.Context, next echo.HandlerFunc, input *openapi3filter.RequestValidationInput, strict bool) error {
+	res := c.Response()
+	original := res.Writer
+	buffer := &bufferedWriter{header: original.Header()}
+	res.Writer = buffer
+	err := next(c)
+	res.Writer = original
+	if err != nil {
+		return err
+	}
+
+	status := buffer.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	verr := openapi3filter.ValidateResponse(c.Request().Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 status,
+		Header:                 buffer.header,
+		Body:                   io.NopCloser(bytes.NewReader(buffer.body.Bytes())),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	})
+	if verr != nil {
+		c.Logger().Errorf("response for %s %s does not match the OpenAPI document: %v", input.Request.Method, input.Route.Path, verr)
+		if strict {
+			original.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+			original.WriteHeader(http.StatusInternalServerError)
+			_, err := original.Write([]byte(`{"error":"response does not match the API contract"}` + "\n"))
+			return err
+		}
+	}
+
+	original.WriteHeader(status)
+	_, err = original.Write(buffer.body.Bytes())
+	return err
+}
+
+// bufferedWriter holds a response until it has been validated.
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) Header() http.Header { return w.header }
+
+func (w *bufferedWriter) WriteHeader(status int) { w.status = status }
+
+func (w *bufferedWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"account/internal/handlers"
+	"account/internal/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/contract")
+
+// shape replaces every JSON value with the name of its type so that golden
+// files pin field names and types without depending on IDs or timestamps.
+func shape(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[k] = shape(val)
+		}
+		return out
+	case []interface{}:
+		if len(v) == 0 {
+			return []interface{}{}
+		}
+		return []interface{}{shape(v[0])}
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return "unknown"
+}
+
+func checkGolden(t *testing.T, name string, body []byte) {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("%s: decode %q: %v", name, body, err)
+	}
+	got, err := json.MarshalIndent(shape(v), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", "contract", name+".json")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s: %v (run go test -update to create it)", name, err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s: response contract changed\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// TestContract pins the JSON field names and types of every route's
+// response. A failure means clients would see a breaking change; if the
+// change is intended, regenerate the golden files with go test -update.
+func TestContract(t *testing.T) {
+	e, _ := newTestServer(t)
+	actor := map[string]string{handlers.ActorHeader: "ops"}
+
+	steps := []struct {
+		name, method, path, body string
+		status                   int
+	}{
+		{"create_account", http.MethodPost, "/accounts", accountBody, http.StatusCreated},
+		{"create_account_conflict", http.MethodPost, "/accounts", accountBody, http.StatusConflict},
+		{"get_account", http.MethodGet, "/accounts/1", "", http.StatusOK},
+		{"get_account_not_found", http.MethodGet, "/accounts/42", "", http.StatusNotFound},
+		{"get_account_invalid_id", http.MethodGet, "/accounts/abc", "", http.StatusBadRequest},
+		{"list_accounts", http.MethodGet, "/accounts", "", http.StatusOK},
+		{"update_account", http.MethodPut, "/accounts/1", accountBody, http.StatusOK},
+		{"create_api_key", http.MethodPost, "/accounts/1/api-keys", `{"name":"ci","scopes":["accounts:read"]}`, http.StatusCreated},
+		{"list_api_keys", http.MethodGet, "/accounts/1/api-keys", "", http.StatusOK},
+		{"verify_api_key", http.MethodPost, "/api-keys/verify", `{"key":"{{key}}"}`, http.StatusOK},
+		{"verify_api_key_invalid", http.MethodPost, "/api-keys/verify", `{"key":"dgt_aaaaaaaa_nope"}`, http.StatusUnauthorized},
+		{"rotate_api_key", http.MethodPost, "/accounts/1/api-keys/1/rotate", `{"grace_period":"1h"}`, http.StatusCreated},
+		{"revoke_api_key", http.MethodDelete, "/accounts/1/api-keys/2", "", http.StatusOK},
+		{"list_audit", http.MethodGet, "/accounts/1/audit", "", http.StatusOK},
+		{"erase_account", http.MethodPost, "/accounts/1/erasure", "", http.StatusOK},
+		{"list_data_requests", http.MethodGet, "/accounts/1/data-requests", "", http.StatusOK},
+		{"get_data_request", http.MethodGet, "/data-requests/1", "", http.StatusOK},
+		{"delete_account", http.MethodDelete, "/accounts/1", "", http.StatusOK},
+	}
+
+	// {{key}} in a body is replaced with the most recently issued API key.
+	var key string
+	seen := make(map[string]bool)
+	for _, step := range steps {
+		body := strings.ReplaceAll(step.body, "{{key}}", key)
+		rec := do(t, e, step.method, step.path, body, actor)
+		if rec.Code != step.status {
+			t.Fatalf("%s: status = %d, want %d; body: %s", step.name, rec.Code, step.status, rec.Body.String())
+		}
+		checkGolden(t, step.name, rec.Body.Bytes())
+		seen[step.name] = true
+
+		var issued models.IssuedAPIKey
+		if json.Unmarshal(rec.Body.Bytes(), &issued) == nil && issued.Key != "" {
+			key = issued.Key
+		}
+	}
+
+	// Every golden file must still be exercised so stale contracts are noticed.
+	files, err := filepath.Glob(filepath.Join("testdata", "contract", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stale []string
+	for _, f := range files {
+		if name := filepath.Base(f); !seen[name[:len(name)-len(".json")]] {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	if len(stale) > 0 {
+		t.Errorf("golden files without a matching step: %v", stale)
+	}
+}
+
+// TestRoutesCovered fails when a route is added to the router without a
+// contract or behaviour test exercising it.
+func TestRoutesCovered(t *testing.T) {
+	e, _ := newTestServer(t)
+	covered := map[string]bool{
+		"POST /accounts":                            true,
+		"GET /accounts":                             true,
+		"GET /accounts/:id":                         true,
+		"PUT /accounts/:id":                         true,
+		"DELETE /accounts/:id":                      true,
+		"GET /accounts/:id/audit":                   true,
+		"GET /accounts/:id/data-export":             true,
+		"POST /accounts/:id/erasure":                true,
+		"GET /accounts/:id/data-requests":           true,
+		"GET /data-requests/:id":                    true,
+		"POST /accounts/:id/api-keys":               true,
+		"GET /accounts/:id/api-keys":                true,
+		"POST /accounts/:id/api-keys/:keyId/rotate": true,
+		"DELETE /accounts/:id/api-keys/:keyId":      true,
+		"POST /api-keys/verify":                     true,
+		"GET /openapi.json":                         true,
+		"GET /swagger/*":                            true,
+	}
+	for _, r := range e.Routes() {
+		if !covered[r.Method+" "+r.Path] {
+			t.Errorf("route %s %s has no test coverage listed", r.Method, r.Path)
+		}
+	}
+}
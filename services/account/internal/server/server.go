@@ -0,0 +1,118 @@
+// Package server assembles the account service's Echo router so that main and
+// the tests serve exactly the same routes.
+package server
+
+import (
+	"log/slog"
+	"time"
+
+	"account/internal/compliance"
+	"account/internal/handlers"
+	"account/internal/middleware"
+	"account/internal/openapi"
+
+	"github.com/digitnxt/digit/pkg/authz"
+	"github.com/digitnxt/digit/pkg/logging"
+	"github.com/digitnxt/digit/pkg/observability"
+	"github.com/digitnxt/digit/pkg/svcauth"
+	"github.com/labstack/echo/v4"
+)
+
+// Config holds the dependencies of the account service router.
+type Config struct {
+	Repository     handlers.Repository
+	Idempotency    middleware.IdempotencyStore
+	IdempotencyTTL time.Duration
+	ExportSigner   *compliance.Signer
+	// Validation controls how requests and responses are checked against
+	// the OpenAPI document.
+	Validation openapi.ValidatorConfig
+	// Authz, when set, requires an identity service access token on every
+	// route except API key verification and the documentation, and checks
+	// it against the authorization policy. Idempotency keys are then scoped
+	// to the authorized subject.
+	Authz *authz.Enforcer
+	// Logger, when set, logs every request.
+	Logger *slog.Logger
+	// ServiceAuth, when set, verifies the service tokens of calls from
+	// other services. Calls without one are left to Authz.
+	ServiceAuth *svcauth.Verifier
+}
+
+// New returns an Echo instance with every account route registered and the
+// OpenAPI document served at /openapi.json.
+func New(cfg Config) (*echo.Echo, error) {
+	h := handlers.New(cfg.Repository, cfg.ExportSigner)
+
+	doc, err := openapi.Spec()
+	if err != nil {
+		return nil, err
+	}
+	validator, err := openapi.Validator(doc, cfg.Validation)
+	if err != nil {
+		return nil, err
+	}
+
+	e := echo.New()
+	e.HideBanner = true
+	// Requests continue the caller's trace, which their log records name.
+	e.Use(observability.EchoMiddleware())
+	if cfg.Logger != nil {
+		e.Use(logging.EchoMiddleware(cfg.Logger))
+	}
+	if cfg.ServiceAuth != nil {
+		e.Use(echo.WrapMiddleware(svcauth.OptionalMiddleware(cfg.ServiceAuth)))
+	}
+	e.Use(validator)
+
+	// Without authorization, idempotency applies to every route and is
+	// scoped by the gateway's X-User-ID header. With it, idempotency runs
+	// after authorization on each protected route, so stored responses
+	// are only replayed to the subject that made the request.
+	idempotency := middleware.IdempotencyConfig{
+		Store: cfg.Idempotency,
+		TTL:   cfg.IdempotencyTTL,
+	}
+	guard := func(action string, resource func(echo.Context) authz.Resource) []echo.MiddlewareFunc {
+		return nil
+	}
+	if cfg.Authz == nil {
+		e.Use(middleware.Idempotency(idempotency))
+	} else {
+		idempotency.Scope = func(c echo.Context) string {
+			s, _ := authz.FromContext(c.Request().Context())
+			return s.ID
+		}
+		scoped := middleware.Idempotency(idempotency)
+		guard = func(action string, resource func(echo.Context) authz.Resource) []echo.MiddlewareFunc {
+			return []echo.MiddlewareFunc{cfg.Authz.Echo(action, resource), scoped}
+		}
+	}
+
+	// Register CRUD routes for accounts.
+	e.POST("/accounts", h.CreateAccount, guard("accounts:create", nil)...)
+	e.GET("/accounts", h.ListAccounts, guard("accounts:list", nil)...)
+	e.GET("/accounts/:id", h.GetAccount, guard("accounts:read", h.AccountResource)...)
+	e.PUT("/accounts/:id", h.UpdateAccount, guard("accounts:update", h.AccountResource)...)
+	e.DELETE("/accounts/:id", h.DeleteAccount, guard("accounts:delete", h.AccountResource)...)
+
+	// Audit trail and data-protection routes.
+	e.GET("/accounts/:id/audit", h.ListAuditEntries, guard("audit:read", h.AccountResource)...)
+	e.GET("/accounts/:id/data-export", h.ExportAccountData, guard("accounts:export", h.AccountResource)...)
+	e.POST("/accounts/:id/erasure", h.EraseAccountData, guard("accounts:erase", h.AccountResource)...)
+	e.GET("/accounts/:id/data-requests", h.ListDataRequests, guard("data-requests:read", h.AccountResource)...)
+	e.GET("/data-requests/:id", h.GetDataRequest, guard("data-requests:read", h.DataRequestResource)...)
+
+	// API keys for machine clients. Verification authenticates with the
+	// key itself.
+	e.POST("/accounts/:id/api-keys", h.CreateAPIKey, guard("api-keys:create", h.AccountResource)...)
+	e.GET("/accounts/:id/api-keys", h.ListAPIKeys, guard("api-keys:read", h.AccountResource)...)
+	e.POST("/accounts/:id/api-keys/:keyId/rotate", h.RotateAPIKey, guard("api-keys:rotate", h.AccountResource)...)
+	e.DELETE("/accounts/:id/api-keys/:keyId", h.RevokeAPIKey, guard("api-keys:revoke", h.AccountResource)...)
+	e.POST("/api-keys/verify", h.VerifyAPIKey)
+
+	// API documentation.
+	openapi.RegisterDocs(e, doc)
+
+	return e, nil
+}
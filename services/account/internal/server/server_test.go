@@ -0,0 +1,534 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"account/internal/compliance"
+	"account/internal/handlers"
+	"account/internal/memory"
+	"account/internal/middleware"
+	"account/internal/models"
+	"account/internal/openapi"
+
+	"github.com/digitnxt/digit/pkg/authz"
+	"github.com/digitnxt/digit/pkg/logging"
+	"github.com/digitnxt/digit/pkg/observability"
+	"github.com/digitnxt/digit/pkg/oidc"
+	"github.com/digitnxt/digit/pkg/oidc/oidctest"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestServer(t *testing.T) (*echo.Echo, *compliance.Signer) {
+	t.Helper()
+	signer, err := compliance.NewSigner("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := memory.NewRepository()
+	repo.Idempotency = memory.NewIdempotencyStore()
+	e, err := New(Config{
+		Repository:     repo,
+		Idempotency:    repo.Idempotency,
+		IdempotencyTTL: time.Hour,
+		ExportSigner:   signer,
+		Validation:     openapi.ValidatorConfig{ValidateResponses: true, StrictResponses: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, signer
+}
+
+func do(t *testing.T, e *echo.Echo, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+const accountBody = `{"accountname":"district-1","admin_email":"admin@example.gov","admin_phone":"+911234567890","config":{"tier":"gold"}}`
+
+func createAccount(t *testing.T, e *echo.Echo, body string) models.Account {
+	t.Helper()
+	rec := do(t, e, http.MethodPost, "/accounts", body, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var account models.Account
+	decode(t, rec, &account)
+	return account
+}
+
+func TestAccountCRUD(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	account := createAccount(t, e, accountBody)
+	if account.ID == 0 || account.AccountName != "district-1" {
+		t.Fatalf("unexpected account: %+v", account)
+	}
+
+	rec := do(t, e, http.MethodPost, "/accounts", accountBody, nil)
+	expectStatus(t, rec, http.StatusConflict)
+
+	rec = do(t, e, http.MethodGet, "/accounts/1", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = do(t, e, http.MethodGet, "/accounts", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var accounts []models.Account
+	decode(t, rec, &accounts)
+	if len(accounts) != 1 {
+		t.Fatalf("len(accounts) = %d, want 1", len(accounts))
+	}
+
+	rec = do(t, e, http.MethodPut, "/accounts/1", `{"accountname":"district-2","config":{}}`, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &account)
+	if account.AccountName != "district-2" || account.AdminEmail != "" {
+		t.Fatalf("update not applied: %+v", account)
+	}
+
+	rec = do(t, e, http.MethodDelete, "/accounts/1", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/accounts/1"},
+		{http.MethodPut, "/accounts/1"},
+		{http.MethodDelete, "/accounts/1"},
+		{http.MethodGet, "/accounts/1/data-export"},
+		{http.MethodPost, "/accounts/1/erasure"},
+		{http.MethodGet, "/data-requests/99"},
+	} {
+		rec := do(t, e, tc.method, tc.path, accountBody, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s: status = %d, want 404", tc.method, tc.path, rec.Code)
+		}
+	}
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/accounts/abc"},
+		{http.MethodPut, "/accounts/abc"},
+		{http.MethodDelete, "/accounts/abc"},
+		{http.MethodGet, "/accounts/abc/audit"},
+		{http.MethodGet, "/accounts/abc/data-export"},
+		{http.MethodPost, "/accounts/abc/erasure"},
+		{http.MethodGet, "/accounts/abc/data-requests"},
+		{http.MethodGet, "/data-requests/abc"},
+	} {
+		rec := do(t, e, tc.method, tc.path, `{}`, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: status = %d, want 400", tc.method, tc.path, rec.Code)
+		}
+	}
+}
+
+func TestAuditTrail(t *testing.T) {
+	e, _ := newTestServer(t)
+	createAccount(t, e, accountBody)
+	do(t, e, http.MethodPut, "/accounts/1", accountBody, map[string]string{handlers.ActorHeader: "ops"})
+	do(t, e, http.MethodDelete, "/accounts/1", "", nil)
+
+	rec := do(t, e, http.MethodGet, "/accounts/1/audit", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var entries []models.AuditEntry
+	decode(t, rec, &entries)
+
+	want := []struct{ action, actor string }{
+		{models.AuditAccountCreated, "anonymous"},
+		{models.AuditAccountUpdated, "ops"},
+		{models.AuditAccountDeleted, "anonymous"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d audit entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		if entries[i].Action != w.action || entries[i].Actor != w.actor {
+			t.Errorf("entry %d = %s by %s, want %s by %s", i, entries[i].Action, entries[i].Actor, w.action, w.actor)
+		}
+	}
+}
+
+func TestDataExport(t *testing.T) {
+	e, signer := newTestServer(t)
+	createAccount(t, e, accountBody)
+
+	rec := do(t, e, http.MethodGet, "/accounts/1/data-export", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "application/zip" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	manifest, err := compliance.VerifyArchive(rec.Body.Bytes(), signer.PublicKey())
+	if err != nil {
+		t.Fatalf("verify archive: %v", err)
+	}
+	if manifest.AccountID != 1 || len(manifest.Files) != 4 {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+
+	rec = do(t, e, http.MethodGet, "/accounts/1/data-requests", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var requests []models.DataRequest
+	decode(t, rec, &requests)
+	if len(requests) != 1 || requests[0].Type != models.DataRequestExport || requests[0].Status != models.DataRequestCompleted {
+		t.Fatalf("unexpected data requests: %+v", requests)
+	}
+}
+
+func TestErasure(t *testing.T) {
+	e, _ := newTestServer(t)
+	createAccount(t, e, accountBody)
+	do(t, e, http.MethodPut, "/accounts/1", accountBody, map[string]string{handlers.ActorHeader: "admin@example.gov"})
+
+	rec := do(t, e, http.MethodPost, "/accounts/1/erasure", "", map[string]string{handlers.ActorHeader: "dpo"})
+	expectStatus(t, rec, http.StatusOK)
+	var request models.DataRequest
+	decode(t, rec, &request)
+	if request.Status != models.DataRequestCompleted || request.CompletedAt == nil {
+		t.Fatalf("erasure not completed: %+v", request)
+	}
+
+	rec = do(t, e, http.MethodGet, "/accounts/1", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var account models.Account
+	decode(t, rec, &account)
+	if account.AccountName != "erased-1" || account.AdminEmail != "" || account.AdminPhone != "" || string(account.Config) != "{}" {
+		t.Fatalf("account not anonymised: %+v", account)
+	}
+
+	rec = do(t, e, http.MethodGet, "/accounts/1/audit", "", nil)
+	var entries []models.AuditEntry
+	decode(t, rec, &entries)
+	for _, entry := range entries {
+		if entry.Actor == "admin@example.gov" {
+			t.Errorf("audit entry %d still names the admin", entry.ID)
+		}
+	}
+	if last := entries[len(entries)-1]; last.Action != models.AuditAccountErased || last.Actor != "dpo" {
+		t.Errorf("last audit entry = %s by %s", last.Action, last.Actor)
+	}
+
+	rec = do(t, e, http.MethodGet, "/data-requests/1", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestErasureDropsIdempotentResponses(t *testing.T) {
+	e, _ := newTestServer(t)
+	key := map[string]string{middleware.IdempotencyKeyHeader: "create-1"}
+	expectStatus(t, do(t, e, http.MethodPost, "/accounts", accountBody, key), http.StatusCreated)
+	rec := do(t, e, http.MethodPost, "/accounts/1/api-keys", `{"name":"Asha's laptop","scopes":["accounts:read"]}`, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	expectStatus(t, do(t, e, http.MethodPost, "/accounts/1/erasure", "", nil), http.StatusOK)
+
+	// Replaying the original key must not return the erased admin's
+	// contact details; the request runs again instead.
+	rec = do(t, e, http.MethodPost, "/accounts", accountBody, key)
+	expectStatus(t, rec, http.StatusCreated)
+	var account models.Account
+	decode(t, rec, &account)
+	if rec.Header().Get(middleware.IdempotentReplayedHeader) != "" || account.ID == 1 {
+		t.Fatalf("replayed the erased account: %+v", account)
+	}
+
+	rec = do(t, e, http.MethodGet, "/accounts/1/api-keys", "", nil)
+	if strings.Contains(rec.Body.String(), "Asha") {
+		t.Errorf("API key name survived erasure: %s", rec.Body.String())
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	e, _ := newTestServer(t)
+	key := map[string]string{middleware.IdempotencyKeyHeader: "create-1"}
+
+	first := do(t, e, http.MethodPost, "/accounts", accountBody, key)
+	expectStatus(t, first, http.StatusCreated)
+
+	retry := do(t, e, http.MethodPost, "/accounts", accountBody, key)
+	expectStatus(t, retry, http.StatusCreated)
+	if retry.Body.String() != first.Body.String() {
+		t.Fatalf("replayed body = %s, want %s", retry.Body.String(), first.Body.String())
+	}
+	if retry.Header().Get(middleware.IdempotentReplayedHeader) != "true" {
+		t.Fatal("replayed response is not marked")
+	}
+
+	other := do(t, e, http.MethodPost, "/accounts", `{"accountname":"other","config":{}}`, key)
+	expectStatus(t, other, http.StatusUnprocessableEntity)
+
+	// The same key from another caller is an independent request.
+	scoped := do(t, e, http.MethodPost, "/accounts", `{"accountname":"other","config":{}}`,
+		map[string]string{middleware.IdempotencyKeyHeader: "create-1", handlers.ActorHeader: "someone-else"})
+	expectStatus(t, scoped, http.StatusCreated)
+
+	rec := do(t, e, http.MethodGet, "/accounts", "", nil)
+	var accounts []models.Account
+	decode(t, rec, &accounts)
+	if len(accounts) != 2 {
+		t.Fatalf("len(accounts) = %d, want 2", len(accounts))
+	}
+}
+
+func TestValidation(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	for _, body := range []string{
+		`{"admin_email":"admin@example.gov","config":{}}`,
+		`{"accountname":"","config":{}}`,
+		`{"accountname":"district-1","config":"not-an-object"}`,
+		`{"accountname":42}`,
+	} {
+		rec := do(t, e, http.MethodPost, "/accounts", body, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("POST /accounts %s: status = %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	rec := do(t, e, http.MethodGet, openapi.SpecPath, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	doc, err := openapi3.NewLoader().LoadFromData(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("load served document: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("served document is invalid: %v", err)
+	}
+
+	// Every API route must be documented.
+	for _, r := range e.Routes() {
+		if r.Path == openapi.SpecPath || strings.HasPrefix(r.Path, "/swagger/") {
+			continue
+		}
+		path := echoParam.ReplaceAllString(r.Path, "{$1}")
+		item := doc.Paths.Value(path)
+		if item == nil || item.GetOperation(r.Method) == nil {
+			t.Errorf("route %s %s is missing from the OpenAPI document", r.Method, r.Path)
+		}
+	}
+
+	rec = do(t, e, http.MethodGet, "/swagger/index.html", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+var echoParam = regexp.MustCompile(`:([^/]+)`)
+
+func TestAPIKeys(t *testing.T) {
+	e, _ := newTestServer(t)
+	createAccount(t, e, accountBody)
+
+	verify := func(key string) *httptest.ResponseRecorder {
+		return do(t, e, http.MethodPost, "/api-keys/verify", `{"key":"`+key+`"}`, nil)
+	}
+
+	rec := do(t, e, http.MethodPost, "/accounts/1/api-keys", `{"name":"ci","scopes":["accounts:read","accounts:write"]}`, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var issued models.IssuedAPIKey
+	decode(t, rec, &issued)
+	if !strings.HasPrefix(issued.Key, "dgt_"+issued.Prefix+"_") {
+		t.Fatalf("key %q does not start with its prefix %q", issued.Key, issued.Prefix)
+	}
+
+	rec = verify(issued.Key)
+	expectStatus(t, rec, http.StatusOK)
+	var verification models.APIKeyVerification
+	decode(t, rec, &verification)
+	if !verification.Valid || verification.AccountID != 1 || len(verification.Scopes) != 2 {
+		t.Fatalf("unexpected verification: %+v", verification)
+	}
+
+	// The listing never exposes the secret and records the last use.
+	rec = do(t, e, http.MethodGet, "/accounts/1/api-keys", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if strings.Contains(rec.Body.String(), issued.Key) {
+		t.Fatal("key listing contains the secret")
+	}
+	var keys []models.APIKey
+	decode(t, rec, &keys)
+	if len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+
+	expectStatus(t, verify(issued.Key[:len(issued.Key)-1]+"x"), http.StatusUnauthorized)
+	expectStatus(t, verify("not-a-key"), http.StatusUnauthorized)
+
+	// Rotation without a grace period revokes the old key at once.
+	rec = do(t, e, http.MethodPost, "/accounts/1/api-keys/1/rotate", "", nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var rotated models.IssuedAPIKey
+	decode(t, rec, &rotated)
+	if rotated.Name != "ci" || len(rotated.Scopes) != 2 {
+		t.Fatalf("rotation lost key attributes: %+v", rotated)
+	}
+	expectStatus(t, verify(issued.Key), http.StatusUnauthorized)
+	expectStatus(t, verify(rotated.Key), http.StatusOK)
+	expectStatus(t, do(t, e, http.MethodPost, "/accounts/1/api-keys/1/rotate", "", nil), http.StatusConflict)
+
+	// With a grace period both keys work until it ends.
+	rec = do(t, e, http.MethodPost, "/accounts/1/api-keys/2/rotate", `{"grace_period":"1h"}`, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var graced models.IssuedAPIKey
+	decode(t, rec, &graced)
+	expectStatus(t, verify(rotated.Key), http.StatusOK)
+	expectStatus(t, verify(graced.Key), http.StatusOK)
+
+	expectStatus(t, do(t, e, http.MethodDelete, "/accounts/1/api-keys/3", "", nil), http.StatusOK)
+	expectStatus(t, verify(graced.Key), http.StatusUnauthorized)
+	expectStatus(t, do(t, e, http.MethodDelete, "/accounts/1/api-keys/99", "", nil), http.StatusNotFound)
+
+	// Keys cannot be created for unknown accounts or with bad input.
+	expectStatus(t, do(t, e, http.MethodPost, "/accounts/42/api-keys", `{"name":"ci"}`, nil), http.StatusNotFound)
+	expectStatus(t, do(t, e, http.MethodPost, "/accounts/1/api-keys", `{"name":"ci","scopes":["Bad Scope"]}`, nil), http.StatusBadRequest)
+	expectStatus(t, do(t, e, http.MethodPost, "/accounts/1/api-keys", `{"name":"ci","scopes":["accounts:re*"]}`, nil), http.StatusBadRequest)
+	expectStatus(t, do(t, e, http.MethodPost, "/accounts/1/api-keys", `{"name":"ci","scopes":["*"]}`, nil), http.StatusBadRequest)
+	expectStatus(t, do(t, e, http.MethodPost, "/accounts/1/api-keys", `{"name":"ci","expires_at":"2000-01-01T00:00:00Z"}`, nil), http.StatusBadRequest)
+
+	// Deleting the account removes its keys.
+	expectStatus(t, do(t, e, http.MethodDelete, "/accounts/1", "", nil), http.StatusOK)
+	expectStatus(t, verify(rotated.Key), http.StatusUnauthorized)
+}
+
+func TestAuthorization(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	signer, err := compliance.NewSigner("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := authz.Policy{Rules: []authz.Rule{
+		{Name: "admin", Roles: []string{"admin"}, Actions: []string{"*"}},
+		{Name: "district-admin", Roles: []string{"district-admin"}, Actions: []string{"accounts:read", "accounts:update", "audit:read"}, Scope: authz.ScopeSubtree},
+	}}
+	verifier := oidc.NewVerifier(oidc.Config{Issuer: idp.URL, Audience: "digit"})
+	e, err := New(Config{
+		Repository:     memory.NewRepository(),
+		Idempotency:    memory.NewIdempotencyStore(),
+		IdempotencyTTL: time.Hour,
+		ExportSigner:   signer,
+		Validation:     openapi.ValidatorConfig{ValidateResponses: true, StrictResponses: true},
+		Authz:          authz.NewEnforcer(verifier, authz.NewCache(authz.NewEngine(policy), time.Minute)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bearer := func(claims map[string]interface{}) map[string]string {
+		claims["aud"] = "digit"
+		return map[string]string{"Authorization": "Bearer " + idp.Sign(claims)}
+	}
+	admin := bearer(map[string]interface{}{"sub": "root", "roles": []string{"admin"}})
+	district := bearer(map[string]interface{}{"sub": "dist-1", "roles": []string{"district-admin"}, "account_id": "pb"})
+
+	expectStatus(t, do(t, e, http.MethodPost, "/accounts", accountBody, nil), http.StatusUnauthorized)
+	for _, name := range []string{"pb.amritsar", "ka"} {
+		body := strings.Replace(accountBody, "district-1", name, 1)
+		expectStatus(t, do(t, e, http.MethodPost, "/accounts", body, admin), http.StatusCreated)
+	}
+
+	// The district admin manages accounts below its own but nothing else.
+	expectStatus(t, do(t, e, http.MethodGet, "/accounts/1", "", district), http.StatusOK)
+	update := strings.Replace(accountBody, "district-1", "pb.amritsar", 1)
+	expectStatus(t, do(t, e, http.MethodPut, "/accounts/1", update, district), http.StatusOK)
+	expectStatus(t, do(t, e, http.MethodDelete, "/accounts/1", "", district), http.StatusForbidden)
+	expectStatus(t, do(t, e, http.MethodGet, "/accounts/2", "", district), http.StatusForbidden)
+	expectStatus(t, do(t, e, http.MethodGet, "/accounts/99", "", district), http.StatusForbidden)
+	expectStatus(t, do(t, e, http.MethodGet, "/accounts", "", district), http.StatusForbidden)
+
+	// Audit entries name the authorized subject.
+	rec := do(t, e, http.MethodGet, "/accounts/1/audit", "", district)
+	expectStatus(t, rec, http.StatusOK)
+	var entries []models.AuditEntry
+	decode(t, rec, &entries)
+	if len(entries) != 2 || entries[0].Actor != "root" || entries[1].Actor != "dist-1" {
+		t.Fatalf("unexpected audit entries: %+v", entries)
+	}
+
+	// Idempotency keys are scoped to the subject, so another caller
+	// reusing a key is not replayed the original response.
+	key := map[string]string{middleware.IdempotencyKeyHeader: "k1"}
+	for k, v := range district {
+		key[k] = v
+	}
+	expectStatus(t, do(t, e, http.MethodPut, "/accounts/1", update, key), http.StatusOK)
+	key["Authorization"] = admin["Authorization"]
+	rec = do(t, e, http.MethodPut, "/accounts/1", update, key)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+		t.Fatal("response replayed to a different subject")
+	}
+}
+
+func TestTracing(t *testing.T) {
+	prev, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		otel.SetTextMapPropagator(prevProp)
+	})
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	observability.SetupPropagation()
+
+	var logs bytes.Buffer
+	logger, err := logging.New(logging.Config{Output: &logs, Service: "account"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(Config{
+		Repository:     memory.NewRepository(),
+		Idempotency:    memory.NewIdempotencyStore(),
+		IdempotencyTTL: time.Hour,
+		Logger:         logger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	rec := do(t, e, http.MethodGet, "/accounts", "", map[string]string{"traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"})
+	expectStatus(t, rec, http.StatusOK)
+
+	ended := spans.Ended()
+	if len(ended) != 1 || ended[0].Name() != "GET /accounts" || ended[0].SpanContext().TraceID().String() != traceID {
+		t.Fatalf("spans = %v, want one in the caller's trace", ended)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("request record %q: %v", logs.String(), err)
+	}
+	if record["trace_id"] != traceID || record["span_id"] != ended[0].SpanContext().SpanID().String() {
+		t.Errorf("request record = %v, want the request's trace", record)
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"identity/internal/models"
+)
+
+// Notifier delivers password reset tokens to users.
+type Notifier interface {
+	SendPasswordReset(ctx context.Context, user *models.User, token string) error
+}
+
+// LogNotifier writes reset tokens to the service log. It stands in for an
+// email or SMS channel during development and must not be used elsewhere:
+// anyone who can read the log can reset any password.
+type LogNotifier struct{}
+
+// SendPasswordReset logs the reset token for user.
+func (LogNotifier) SendPasswordReset(_ context.Context, user *models.User, token string) error {
+	log.Printf("password reset requested for user %s: token %s", user.ID, token)
+	return nil
+}
+
+// WebhookNotifier posts reset tokens to a mail or SMS gateway as JSON:
+//
+//	{"user_id": "...", "email": "...", "mobile": "...", "token": "..."}
+//
+// Any status other than 2xx is an error.
+type WebhookNotifier struct {
+	URL string
+	// Client sends the requests. Nil means a client with a 10 second
+	// timeout.
+	Client *http.Client
+}
+
+// SendPasswordReset posts the reset token for user to the webhook.
+func (n *WebhookNotifier) SendPasswordReset(ctx context.Context, user *models.User, token string) error {
+	return postJSON(ctx, n.Client, n.URL, map[string]string{
+		"user_id": user.ID,
+		"email":   user.Email,
+		"mobile":  user.Mobile,
+		"token":   token,
+	})
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON posts v to url as JSON and fails unless the response is 2xx.
+func postJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	if client == nil {
+		client = webhookClient
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: status %d", url, resp.StatusCode)
+	}
+	return nil
+}
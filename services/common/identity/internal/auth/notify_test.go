@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"identity/internal/memory"
+	"identity/internal/models"
+	"identity/internal/token"
+)
+
+func TestForgotPasswordNotifier(t *testing.T) {
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := token.NewIssuer(token.StaticKeySet(key), token.Config{Issuer: "http://identity.test", Audience: "digit", TTL: time.Minute})
+	store := memory.NewStore()
+	store.CreateUser(ctx, &models.User{ID: "u1", Email: "ravi@example.org", Roles: []string{models.RoleUser}})
+
+	// Without a notifier, password reset is refused rather than logged.
+	svc, err := NewService(store, issuer, Config{Params: testParams})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ForgotPassword(ctx, "ravi@example.org"); !errors.Is(err, ErrResetUnavailable) {
+		t.Fatalf("ForgotPassword without notifier = %v", err)
+	}
+
+	var sent map[string]string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&sent)
+	}))
+	defer gateway.Close()
+	svc.Notifier = &WebhookNotifier{URL: gateway.URL}
+	if err := svc.ForgotPassword(ctx, "ravi@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if sent["user_id"] != "u1" || sent["email"] != "ravi@example.org" || sent["token"] == "" {
+		t.Fatalf("webhook got %v", sent)
+	}
+	if err := svc.ResetPassword(ctx, sent["token"], "new password"); err != nil {
+		t.Errorf("ResetPassword with the posted token = %v", err)
+	}
+
+	svc.Notifier = &WebhookNotifier{URL: gateway.URL + "/missing"}
+	if err := svc.ForgotPassword(ctx, "ravi@example.org"); err == nil {
+		t.Error("gateway failure not reported")
+	}
+}
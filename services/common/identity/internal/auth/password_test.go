@@ -0,0 +1,27 @@
+package auth
+
+import "testing"
+
+var testParams = Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := HashPassword("correct horse", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyPassword("correct horse", hash); err != nil || !ok {
+		t.Fatalf("VerifyPassword(correct) = %v, %v", ok, err)
+	}
+	if ok, _ := VerifyPassword("battery staple", hash); ok {
+		t.Fatal("VerifyPassword accepted a wrong password")
+	}
+	if NeedsRehash(hash, testParams) {
+		t.Error("NeedsRehash reported a hash made with the current parameters")
+	}
+	if !NeedsRehash(hash, DefaultParams) {
+		t.Error("NeedsRehash missed a parameter change")
+	}
+	if _, err := VerifyPassword("x", "$2a$10$bcrypt"); err == nil {
+		t.Error("VerifyPassword accepted a non-argon2id hash")
+	}
+}
@@ -0,0 +1,497 @@
+// Package auth implements registration, password login, refresh-token
+// rotation and password reset for the identity service.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"identity/internal/lockout"
+	"identity/internal/models"
+	"identity/internal/token"
+)
+
+// Password length limits. The upper bound keeps hashing cost predictable.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 256
+)
+
+// Errors returned by Service.
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrWeakPassword       = errors.New("password must be between 8 and 256 characters")
+	ErrEmailTaken         = errors.New("email already registered")
+	ErrResetUnavailable   = errors.New("password reset is not available")
+)
+
+// Store is the storage used by Service.
+type Store interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	UpdatePasswordHash(ctx context.Context, userID, hash string) error
+
+	CreateRefreshToken(ctx context.Context, t *models.RefreshToken) error
+	GetRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error)
+	// RevokeRefreshToken revokes an active token and returns ErrNotFound
+	// if it was already revoked, so concurrent rotations cannot both win.
+	RevokeRefreshToken(ctx context.Context, id string, at time.Time) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string, at time.Time) error
+	RevokeUserRefreshTokens(ctx context.Context, userID string, at time.Time) error
+
+	// RevokeAccessToken records the jti of an access token revoked before
+	// it expires. Entries can be dropped once expiresAt has passed.
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	AccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+
+	CreatePasswordReset(ctx context.Context, r *models.PasswordReset) error
+	// ResetPassword consumes an unused, unexpired reset token, replaces
+	// the user's password hash and revokes the user's sessions and
+	// refresh tokens in one step. It returns ErrNotFound when the token cannot be used.
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string, at time.Time) (userID string, err error)
+
+	SessionStore
+}
+
+// Config configures a Service.
+type Config struct {
+	// Params are the argon2id parameters for new hashes. Zero means
+	// DefaultParams.
+	Params Params
+	// RefreshTTL is the lifetime of refresh tokens. Zero means 30 days.
+	RefreshTTL time.Duration
+	// IdleTimeout ends sessions unused for this long unless a session
+	// policy says otherwise. Zero means RefreshTTL.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout ends sessions this long after sign-in unless a
+	// session policy says otherwise. Zero means 90 days.
+	AbsoluteTimeout time.Duration
+	// ResetTTL is the lifetime of password reset tokens. Zero means 30
+	// minutes.
+	ResetTTL time.Duration
+	// Notifier delivers reset tokens. Nil disables password reset.
+	Notifier Notifier
+}
+
+// Service implements the authentication flows.
+type Service struct {
+	Store    Store
+	Tokens   *token.Issuer
+	Notifier Notifier
+	// Guard, when set, locks out users and client IPs after repeated
+	// failed password logins.
+	Guard *lockout.Guard
+
+	params     Params
+	refreshTTL time.Duration
+	resetTTL   time.Duration
+
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	// dummyHash is verified against when a login names an unknown user so
+	// that the response time does not reveal which emails are registered.
+	dummyHash string
+	now       func() time.Time
+}
+
+// NewService returns a Service backed by store that signs access tokens
+// with issuer.
+func NewService(store Store, issuer *token.Issuer, cfg Config) (*Service, error) {
+	s := &Service{
+		Store:      store,
+		Tokens:     issuer,
+		Notifier:   cfg.Notifier,
+		params:     cfg.Params,
+		refreshTTL: cfg.RefreshTTL,
+		resetTTL:   cfg.ResetTTL,
+		now:        time.Now,
+
+		idleTimeout:     cfg.IdleTimeout,
+		absoluteTimeout: cfg.AbsoluteTimeout,
+	}
+	if s.params == (Params{}) {
+		s.params = DefaultParams
+	}
+	if s.refreshTTL == 0 {
+		s.refreshTTL = 30 * 24 * time.Hour
+	}
+	if s.idleTimeout == 0 {
+		s.idleTimeout = s.refreshTTL
+	}
+	if s.absoluteTimeout == 0 {
+		s.absoluteTimeout = 90 * 24 * time.Hour
+	}
+	if s.resetTTL == 0 {
+		s.resetTTL = 30 * time.Minute
+	}
+	var err error
+	if s.dummyHash, err = HashPassword(RandomToken(), s.params); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NormalizeEmail returns the canonical form used to store and look up
+// emails.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func checkPassword(password string) error {
+	if n := utf8.RuneCountInString(password); n < MinPasswordLength || n > MaxPasswordLength {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// Register creates a user with the default role.
+func (s *Service) Register(ctx context.Context, req models.RegisterRequest) (*models.User, error) {
+	if err := checkPassword(req.Password); err != nil {
+		return nil, err
+	}
+	hash, err := HashPassword(req.Password, s.params)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	user := &models.User{
+		ID:           uuid.NewString(),
+		Email:        NormalizeEmail(req.Email),
+		Name:         strings.TrimSpace(req.Name),
+		PasswordHash: hash,
+		Roles:        []string{models.RoleUser},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := s.Store.CreateUser(ctx, user); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// Login verifies a password and returns a new token pair.
+func (s *Service) Login(ctx context.Context, email, password string) (*models.TokenPair, error) {
+	user, err := s.Authenticate(ctx, email, password)
+	if err != nil {
+		return nil, err
+	}
+	return s.IssueTokens(ctx, user, Grant{})
+}
+
+// Authenticate returns the user with email if password matches. With a
+// Guard it fails with a *lockout.LockedError while the user or client IP
+// is locked out, and wraps ErrInvalidCredentials in a
+// *lockout.CaptchaError once clients should show a CAPTCHA. Unknown emails
+// are tracked like registered ones.
+func (s *Service) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	email = NormalizeEmail(email)
+	if s.Guard == nil {
+		return s.authenticate(ctx, email, password)
+	}
+	ip := ClientInfoFrom(ctx).IP
+	if err := s.Guard.Check(ctx, email, ip); err != nil {
+		return nil, err
+	}
+	user, err := s.authenticate(ctx, email, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return nil, s.Guard.Fail(ctx, email, ip, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Guard.Succeed(ctx, email); err != nil {
+		log.Printf("reset login failures of user %s: %v", user.ID, err)
+	}
+	return user, nil
+}
+
+func (s *Service) authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := s.Store.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return nil, err
+	}
+	// Unknown users and users without a local password, such as those
+	// provisioned by an external IdP, cost the same as a wrong password.
+	if err != nil || user.PasswordHash == "" {
+		VerifyPassword(password, s.dummyHash)
+		return nil, ErrInvalidCredentials
+	}
+	ok, err := VerifyPassword(password, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if NeedsRehash(user.PasswordHash, s.params) {
+		if hash, err := HashPassword(password, s.params); err == nil {
+			if err := s.Store.UpdatePasswordHash(ctx, user.ID, hash); err != nil {
+				log.Printf("rehash password for user %s: %v", user.ID, err)
+			}
+		}
+	}
+	return user, nil
+}
+
+// Grant describes who a token pair is issued to.
+type Grant struct {
+	// ClientID is the OAuth client, empty for first-party logins.
+	ClientID string
+	// Scope is the space-separated list of granted OAuth scopes.
+	Scope string
+}
+
+// IssueTokens starts a new session for user from the client in ctx and
+// returns the first token pair in it. The session's refresh tokens form
+// one family, whose ID is the session ID.
+func (s *Service) IssueTokens(ctx context.Context, user *models.User, g Grant) (*models.TokenPair, error) {
+	sess, err := s.startSession(ctx, uuid.NewString(), user, g.ClientID, s.now())
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, user, sess, g)
+}
+
+// Refresh rotates a refresh token issued to clientID (empty for first-party
+// logins): the presented token is revoked and a new pair is issued in the
+// same family. Presenting a token that was already rotated is treated as
+// theft and revokes the whole family. Sessions past their idle or absolute
+// timeout are revoked instead.
+func (s *Service) Refresh(ctx context.Context, raw, clientID string) (*models.TokenPair, error) {
+	now := s.now()
+	rt, err := s.Store.GetRefreshToken(ctx, HashToken(raw))
+	if errors.Is(err, models.ErrNotFound) || (err == nil && rt.ClientID != clientID) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rt.RevokedAt != nil {
+		if err := s.endSession(ctx, rt.FamilyID, now); err != nil {
+			return nil, err
+		}
+		log.Printf("refresh token reuse detected for user %s; family %s revoked", rt.UserID, rt.FamilyID)
+		return nil, ErrInvalidToken
+	}
+	if !rt.Active(now) {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.Store.GetUser(ctx, rt.UserID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Families issued before sessions were tracked get one now.
+	sess, err := s.Store.GetSession(ctx, rt.FamilyID)
+	if errors.Is(err, models.ErrNotFound) {
+		sess, err = s.startSession(ctx, rt.FamilyID, user, rt.ClientID, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSession(ctx, sess, now); err != nil {
+		return nil, err
+	}
+	if err := s.Store.RevokeRefreshToken(ctx, rt.ID, now); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if err := s.Store.TouchSession(ctx, sess.ID, now.UTC(), ClientInfoFrom(ctx).IP); err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, user, sess, Grant{ClientID: rt.ClientID, Scope: rt.Scope})
+}
+
+// Logout ends the session of a refresh token, or every session of its user
+// when all is set. Unknown tokens are ignored so that logout is idempotent.
+func (s *Service) Logout(ctx context.Context, raw string, all bool) error {
+	rt, err := s.Store.GetRefreshToken(ctx, HashToken(raw))
+	if errors.Is(err, models.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	if all {
+		return s.Store.RevokeUserSessions(ctx, rt.UserID, now)
+	}
+	return s.endSession(ctx, rt.FamilyID, now)
+}
+
+// ForgotPassword issues a reset token and hands it to the Notifier. It
+// succeeds for unknown emails so that callers cannot probe for accounts,
+// and fails with ErrResetUnavailable when there is no Notifier.
+func (s *Service) ForgotPassword(ctx context.Context, email string) error {
+	if s.Notifier == nil {
+		return ErrResetUnavailable
+	}
+	user, err := s.Store.GetUserByEmail(ctx, NormalizeEmail(email))
+	if errors.Is(err, models.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	raw := RandomToken()
+	now := s.now()
+	reset := &models.PasswordReset{
+		TokenHash: HashToken(raw),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(s.resetTTL),
+		CreatedAt: now,
+	}
+	if err := s.Store.CreatePasswordReset(ctx, reset); err != nil {
+		return err
+	}
+	return s.Notifier.SendPasswordReset(ctx, user, raw)
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out everywhere.
+func (s *Service) ResetPassword(ctx context.Context, raw, password string) error {
+	if err := checkPassword(password); err != nil {
+		return err
+	}
+	hash, err := HashPassword(password, s.params)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Store.ResetPassword(ctx, HashToken(raw), hash, s.now()); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+	return nil
+}
+
+// VerifyAccessToken checks an access token's signature and claims and that
+// neither it nor its session has been revoked or timed out, and records
+// use of the session. Services validating tokens offline against the JWKS
+// skip these checks.
+func (s *Service) VerifyAccessToken(ctx context.Context, raw string) (*token.Claims, error) {
+	claims, err := s.Tokens.Verify(raw)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	revoked, err := s.Store.AccessTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+	if claims.SessionID == "" {
+		return claims, nil
+	}
+	sess, err := s.Store.GetSession(ctx, claims.SessionID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if err := s.checkSession(ctx, sess, now); err != nil {
+		return nil, err
+	}
+	if now.Sub(sess.LastSeenAt) >= touchInterval {
+		if err := s.Store.TouchSession(ctx, sess.ID, now.UTC(), ClientInfoFrom(ctx).IP); err != nil {
+			log.Printf("touch session %s: %v", sess.ID, err)
+		}
+	}
+	return claims, nil
+}
+
+// RevokeAccessToken revokes the access token described by claims.
+func (s *Service) RevokeAccessToken(ctx context.Context, claims *token.Claims) error {
+	return s.Store.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// AccessClaims returns the access token claims for user.
+func AccessClaims(user *models.User) token.Claims {
+	return token.Claims{
+		Email:       user.Email,
+		PhoneNumber: user.Mobile,
+		Name:        user.Name,
+		AccountID:   user.AccountID,
+		Roles:       user.Roles,
+	}
+}
+
+// issue returns a token pair in sess. The refresh token expires no later
+// than the session.
+func (s *Service) issue(ctx context.Context, user *models.User, sess *models.Session, g Grant) (*models.TokenPair, error) {
+	claims := AccessClaims(user)
+	claims.ClientID = g.ClientID
+	claims.Scope = g.Scope
+	claims.SessionID = sess.ID
+	if err := s.annotate(ctx, sess); err != nil {
+		return nil, err
+	}
+	access, err := s.Tokens.Issue(user.ID, claims)
+	if err != nil {
+		return nil, err
+	}
+	raw := RandomToken()
+	now := s.now()
+	expires := now.Add(s.refreshTTL)
+	if sess.ExpiresAt.Before(expires) {
+		expires = sess.ExpiresAt
+	}
+	rt := &models.RefreshToken{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		FamilyID:  sess.ID,
+		TokenHash: HashToken(raw),
+		ClientID:  g.ClientID,
+		Scope:     g.Scope,
+		ExpiresAt: expires,
+		CreatedAt: now,
+	}
+	if err := s.Store.CreateRefreshToken(ctx, rt); err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.Tokens.TTL().Seconds()),
+		RefreshToken: raw,
+		Scope:        g.Scope,
+	}, nil
+}
+
+// RandomToken returns 32 random bytes encoded for use in URLs.
+func RandomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// HashToken returns the stored form of an opaque token.
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
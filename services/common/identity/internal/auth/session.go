@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"identity/internal/models"
+)
+
+// touchInterval is how often use of an access token updates its session's
+// last-seen time.
+const touchInterval = time.Minute
+
+// SessionStore is the storage used for sessions.
+type SessionStore interface {
+	CreateSession(ctx context.Context, sess *models.Session) error
+	GetSession(ctx context.Context, id string) (*models.Session, error)
+	// TouchSession records use of a session from ip at at.
+	TouchSession(ctx context.Context, id string, at time.Time, ip string) error
+	// ListSessions returns the user's unrevoked sessions, newest first.
+	ListSessions(ctx context.Context, userID string) ([]models.Session, error)
+	// RevokeSession revokes a session and its refresh tokens. It returns
+	// ErrNotFound for unknown sessions.
+	RevokeSession(ctx context.Context, id string, at time.Time) error
+	// RevokeUserSessions revokes every session and refresh token of the
+	// user.
+	RevokeUserSessions(ctx context.Context, userID string, at time.Time) error
+
+	GetSessionPolicy(ctx context.Context, accountID string) (*models.SessionPolicy, error)
+	PutSessionPolicy(ctx context.Context, p *models.SessionPolicy) error
+}
+
+// ClientInfo describes the client a request came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type clientInfoKey struct{}
+
+// WithClientInfo returns a copy of ctx carrying info, which is recorded on
+// sessions started or used with it.
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientInfoFrom returns the client info in ctx.
+func ClientInfoFrom(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
+
+// SessionTimeouts returns the idle and absolute session timeouts in
+// accountID. Each is taken from the policy of the account, of the nearest
+// account above it by dotted name, or the platform-wide policy, falling
+// back to the service defaults.
+func (s *Service) SessionTimeouts(ctx context.Context, accountID string) (idle, absolute time.Duration, err error) {
+	for id := accountID; idle == 0 || absolute == 0; id = parentAccount(id) {
+		p, err := s.Store.GetSessionPolicy(ctx, id)
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			return 0, 0, err
+		}
+		if err == nil {
+			if idle == 0 {
+				idle = time.Duration(p.IdleTimeout) * time.Second
+			}
+			if absolute == 0 {
+				absolute = time.Duration(p.AbsoluteTimeout) * time.Second
+			}
+		}
+		if id == "" {
+			break
+		}
+	}
+	if idle == 0 {
+		idle = s.idleTimeout
+	}
+	if absolute == 0 {
+		absolute = s.absoluteTimeout
+	}
+	return idle, absolute, nil
+}
+
+// parentAccount returns the account above id, or "" at the top.
+func parentAccount(id string) string {
+	if i := strings.LastIndex(id, "."); i >= 0 {
+		return id[:i]
+	}
+	return ""
+}
+
+// startSession records a new session of user from the client in ctx.
+func (s *Service) startSession(ctx context.Context, id string, user *models.User, clientID string, now time.Time) (*models.Session, error) {
+	info := ClientInfoFrom(ctx)
+	sess := &models.Session{
+		ID:         id,
+		UserID:     user.ID,
+		ClientID:   clientID,
+		Device:     DescribeDevice(info.UserAgent),
+		IP:         info.IP,
+		UserAgent:  info.UserAgent,
+		AccountID:  user.AccountID,
+		CreatedAt:  now.UTC(),
+		LastSeenAt: now.UTC(),
+	}
+	if err := s.Store.CreateSession(ctx, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// annotate sets the expiry times of sess under the current policy.
+func (s *Service) annotate(ctx context.Context, sess *models.Session) error {
+	idle, absolute, err := s.SessionTimeouts(ctx, sess.AccountID)
+	if err != nil {
+		return err
+	}
+	sess.ExpiresAt = sess.CreatedAt.Add(absolute)
+	sess.IdleExpiresAt = sess.LastSeenAt.Add(idle)
+	if sess.IdleExpiresAt.After(sess.ExpiresAt) {
+		sess.IdleExpiresAt = sess.ExpiresAt
+	}
+	return nil
+}
+
+// checkSession returns ErrInvalidToken if sess is revoked or has timed
+// out, revoking it in the latter case.
+func (s *Service) checkSession(ctx context.Context, sess *models.Session, now time.Time) error {
+	if sess.RevokedAt != nil {
+		return ErrInvalidToken
+	}
+	if err := s.annotate(ctx, sess); err != nil {
+		return err
+	}
+	if now.Before(sess.IdleExpiresAt) {
+		return nil
+	}
+	if err := s.Store.RevokeSession(ctx, sess.ID, now); err != nil {
+		return err
+	}
+	return ErrInvalidToken
+}
+
+// endSession revokes a session and its refresh tokens. Refresh token
+// families issued before sessions were tracked have no session record.
+func (s *Service) endSession(ctx context.Context, id string, now time.Time) error {
+	err := s.Store.RevokeSession(ctx, id, now)
+	if errors.Is(err, models.ErrNotFound) {
+		return s.Store.RevokeRefreshTokenFamily(ctx, id, now)
+	}
+	return err
+}
+
+// Sessions returns the user's active sessions, marking the one with ID
+// current.
+func (s *Service) Sessions(ctx context.Context, userID, current string) ([]models.Session, error) {
+	all, err := s.Store.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	sessions := make([]models.Session, 0, len(all))
+	for _, sess := range all {
+		if err := s.annotate(ctx, &sess); err != nil {
+			return nil, err
+		}
+		if !now.Before(sess.IdleExpiresAt) {
+			continue
+		}
+		sess.Current = sess.ID == current
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs the user out of one of their sessions. It returns
+// ErrNotFound if the session belongs to someone else.
+func (s *Service) RevokeSession(ctx context.Context, userID, id string) error {
+	sess, err := s.Store.GetSession(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sess.UserID != userID {
+		return models.ErrNotFound
+	}
+	return s.Store.RevokeSession(ctx, id, s.now())
+}
+
+// RevokeOtherSessions signs the user out of every session but keep and
+// returns how many were revoked.
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, keep string) (int, error) {
+	sessions, err := s.Store.ListSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	now, n := s.now(), 0
+	for _, sess := range sessions {
+		if sess.ID == keep {
+			continue
+		}
+		if err := s.Store.RevokeSession(ctx, sess.ID, now); err != nil && !errors.Is(err, models.ErrNotFound) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// RevokeUserSessions signs the user out everywhere. Access tokens already
+// issued stop working at this service at once and elsewhere when they
+// expire.
+func (s *Service) RevokeUserSessions(ctx context.Context, userID string) error {
+	return s.Store.RevokeUserSessions(ctx, userID, s.now())
+}
+
+// SessionPolicy returns the session policy set on accountID.
+func (s *Service) SessionPolicy(ctx context.Context, accountID string) (*models.SessionPolicy, error) {
+	return s.Store.GetSessionPolicy(ctx, accountID)
+}
+
+// SetSessionPolicy sets the session timeouts of accountID. Existing
+// sessions are held to the new timeouts on their next use.
+func (s *Service) SetSessionPolicy(ctx context.Context, req models.SessionPolicyRequest) (*models.SessionPolicy, error) {
+	p := &models.SessionPolicy{
+		AccountID:       req.AccountID,
+		IdleTimeout:     req.IdleTimeout,
+		AbsoluteTimeout: req.AbsoluteTimeout,
+		UpdatedAt:       s.now().UTC(),
+	}
+	if err := s.Store.PutSessionPolicy(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DescribeDevice returns a short description of the browser and platform
+// named in a User-Agent header, such as "Chrome on Android".
+func DescribeDevice(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"okhttp/", "Android app"},
+		{"Dalvik/", "Android app"},
+		{"CFNetwork/", "iOS app"},
+		{"Go-http-client/", "Go client"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, p.token) {
+			return browser + " on " + p.name
+		}
+	}
+	return browser
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"identity/internal/memory"
+	"identity/internal/models"
+	"identity/internal/token"
+)
+
+func TestSessionTimeouts(t *testing.T) {
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := token.NewIssuer(token.StaticKeySet(key), token.Config{Issuer: "http://identity.test", Audience: "digit", TTL: time.Minute})
+	store := memory.NewStore()
+	svc, err := NewService(store, issuer, Config{Params: testParams, IdleTimeout: time.Hour, AbsoluteTimeout: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+
+	// Policies are inherited down the account tree field by field.
+	store.PutSessionPolicy(ctx, &models.SessionPolicy{AccountID: "pb", IdleTimeout: 600})
+	store.PutSessionPolicy(ctx, &models.SessionPolicy{AccountID: "", AbsoluteTimeout: 7200})
+	for _, tc := range []struct {
+		account        string
+		idle, absolute time.Duration
+	}{
+		{"", time.Hour, 2 * time.Hour},
+		{"pb.amritsar", 10 * time.Minute, 2 * time.Hour},
+		{"ka", time.Hour, 2 * time.Hour},
+	} {
+		idle, absolute, err := svc.SessionTimeouts(ctx, tc.account)
+		if err != nil || idle != tc.idle || absolute != tc.absolute {
+			t.Errorf("SessionTimeouts(%q) = %v, %v, %v", tc.account, idle, absolute, err)
+		}
+	}
+
+	user := &models.User{ID: "u1", Email: "asha@example.org", AccountID: "pb.amritsar"}
+	store.CreateUser(ctx, user)
+	pair, err := svc.IssueTokens(WithClientInfo(ctx, ClientInfo{IP: "10.0.0.1", UserAgent: "curl/8.0"}), user, Grant{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := svc.VerifyAccessToken(ctx, pair.AccessToken)
+	if err != nil || claims.SessionID == "" {
+		t.Fatalf("VerifyAccessToken = %+v, %v", claims, err)
+	}
+
+	// Activity within the idle timeout keeps the session alive.
+	now = now.Add(9 * time.Minute)
+	if pair, err = svc.Refresh(ctx, pair.RefreshToken, ""); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	now = now.Add(11 * time.Minute)
+	if _, err := svc.Refresh(ctx, pair.RefreshToken, ""); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Refresh after idle timeout = %v", err)
+	}
+	sess, err := store.GetSession(ctx, claims.SessionID)
+	if err != nil || sess.RevokedAt == nil || sess.Device != "curl" || sess.IP != "10.0.0.1" {
+		t.Fatalf("session = %+v, %v", sess, err)
+	}
+}
+
+func TestDescribeDevice(t *testing.T) {
+	for ua, want := range map[string]string{
+		"": "Unknown device",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36 Edg/126.0": "Edge on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 Version/17.5 Mobile/15E148 Safari/604.1":   "Safari on iPhone",
+		"okhttp/4.12.0": "Android app",
+	} {
+		if got := DescribeDevice(ua); got != want {
+			t.Errorf("DescribeDevice(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package database provides the PostgreSQL implementation of the identity
+// store.
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+// Open connects to PostgreSQL and ensures the identity tables exist.
+func Open(connStr string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot reach database: %w", err)
+	}
+	if err := CreateTables(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// CreateTables creates all required tables if they do not already exist.
+func CreateTables(db *sql.DB) error {
+	stmts := []struct{ name, sql string }{
+		{"users", `
+		CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY,
+			email VARCHAR(320) UNIQUE NOT NULL,
+			name VARCHAR(255) NOT NULL DEFAULT '',
+			password_hash TEXT NOT NULL,
+			account_id VARCHAR(255) NOT NULL DEFAULT '',
+			roles TEXT[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS mobile VARCHAR(32) UNIQUE;
+		ALTER TABLE users ALTER COLUMN email DROP NOT NULL;`},
+		{"refresh_tokens", `
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id UUID PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			family_id UUID NOT NULL,
+			token_hash CHAR(64) UNIQUE NOT NULL,
+			client_id VARCHAR(255) NOT NULL DEFAULT '',
+			scope TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			revoked_at TIMESTAMPTZ
+		);
+		ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS client_id VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+		CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);`},
+		{"password_resets", `
+		CREATE TABLE IF NOT EXISTS password_resets (
+			token_hash CHAR(64) PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			expires_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			used_at TIMESTAMPTZ
+		);`},
+		{"revoked_access_tokens", `
+		CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+			jti VARCHAR(64) PRIMARY KEY,
+			expires_at TIMESTAMPTZ NOT NULL
+		);`},
+		{"oauth_clients", `
+		CREATE TABLE IF NOT EXISTS oauth_clients (
+			id VARCHAR(255) PRIMARY KEY,
+			secret_hash CHAR(64),
+			name VARCHAR(255) NOT NULL DEFAULT '',
+			redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+			grant_types TEXT[] NOT NULL DEFAULT '{}',
+			scopes TEXT[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);`},
+		{"authorization_codes", `
+		CREATE TABLE IF NOT EXISTS authorization_codes (
+			code_hash CHAR(64) PRIMARY KEY,
+			client_id VARCHAR(255) NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			redirect_uri TEXT NOT NULL,
+			scope TEXT NOT NULL DEFAULT '',
+			nonce TEXT NOT NULL DEFAULT '',
+			code_challenge VARCHAR(128) NOT NULL DEFAULT '',
+			auth_time TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			used_at TIMESTAMPTZ
+		);`},
+		{"federated_identities", `
+		CREATE TABLE IF NOT EXISTS federated_identities (
+			provider VARCHAR(64) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (provider, subject)
+		);`},
+		// A session's ID is the family ID of its refresh tokens.
+		{"sessions", `
+		CREATE TABLE IF NOT EXISTS sessions (
+			id UUID PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			client_id VARCHAR(255) NOT NULL DEFAULT '',
+			device VARCHAR(255) NOT NULL DEFAULT '',
+			ip VARCHAR(64) NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			account_id VARCHAR(255) NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			revoked_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);`},
+		{"session_policies", `
+		CREATE TABLE IF NOT EXISTS session_policies (
+			account_id VARCHAR(255) PRIMARY KEY,
+			idle_timeout INTEGER NOT NULL DEFAULT 0,
+			absolute_timeout INTEGER NOT NULL DEFAULT 0,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);`},
+		{"otps", `
+		CREATE TABLE IF NOT EXISTS otps (
+			mobile VARCHAR(32) PRIMARY KEY,
+			code_hash CHAR(64),
+			attempts INTEGER NOT NULL DEFAULT 0,
+			sends INTEGER NOT NULL DEFAULT 0,
+			window_start TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);`},
+		// TOTP secrets are stored unencrypted, like signing keys.
+		{"mfa_totp", `
+		CREATE TABLE IF NOT EXISTS mfa_totp (
+			user_id UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+			secret TEXT NOT NULL,
+			confirmed_at TIMESTAMPTZ,
+			last_step BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);`},
+		{"mfa_recovery_codes", `
+		CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			code_hash CHAR(64) NOT NULL,
+			used_at TIMESTAMPTZ,
+			PRIMARY KEY (user_id, code_hash)
+		);`},
+		{"mfa_challenges", `
+		CREATE TABLE IF NOT EXISTS mfa_challenges (
+			token_hash CHAR(64) PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			enroll BOOLEAN NOT NULL DEFAULT FALSE,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			expires_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);`},
+		{"mfa_policies", `
+		CREATE TABLE IF NOT EXISTS mfa_policies (
+			account_id VARCHAR(255) PRIMARY KEY,
+			roles TEXT[] NOT NULL DEFAULT '{}',
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);`},
+		// Signing keys are stored unencrypted; restrict access to this
+		// table accordingly.
+		{"signing_keys", `
+		CREATE TABLE IF NOT EXISTS signing_keys (
+			kid VARCHAR(64) PRIMARY KEY,
+			private_key TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ
+		);`},
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s.sql); err != nil {
+			return fmt.Errorf("create %s table: %w", s.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+
+	"identity/internal/models"
+)
+
+func (s *Store) GetFederatedUser(ctx context.Context, provider, subject string) (*models.User, error) {
+	return scanUser(s.DB.QueryRowContext(ctx, `
+		SELECT `+prefixed("u.", userColumns)+`
+		FROM users u JOIN federated_identities f ON f.user_id = u.id
+		WHERE f.provider = $1 AND f.subject = $2`, provider, subject))
+}
+
+func (s *Store) CreateFederatedUser(ctx context.Context, user *models.User, provider, subject string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `INSERT INTO users (`+userColumns+`) VALUES (`+userValues+`)`, userArgs(user)...)
+	if isUniqueViolation(err) {
+		return models.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO federated_identities (provider, subject, user_id) VALUES ($1, $2, $3)`,
+		provider, subject, user.ID)
+	if isUniqueViolation(err) {
+		return models.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) LinkFederatedIdentity(ctx context.Context, provider, subject, userID string) error {
+	_, err := s.DB.ExecContext(ctx, `INSERT INTO federated_identities (provider, subject, user_id) VALUES ($1, $2, $3)`,
+		provider, subject, userID)
+	if isUniqueViolation(err) {
+		return models.ErrConflict
+	}
+	return err
+}
+
+func (s *Store) UpdateUserProfile(ctx context.Context, user *models.User) error {
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE users SET name = $2, account_id = $3, roles = $4, updated_at = $5 WHERE id = $1`,
+		user.ID, user.Name, user.AccountID, pq.Array(user.Roles), user.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"identity/internal/models"
+)
+
+func (s *Store) GetTOTP(ctx context.Context, userID string) (*models.TOTP, error) {
+	var t models.TOTP
+	var confirmed sql.NullTime
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT user_id, secret, confirmed_at, last_step, created_at FROM mfa_totp WHERE user_id = $1`, userID).
+		Scan(&t.UserID, &t.Secret, &confirmed, &t.LastStep, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if confirmed.Valid {
+		t.ConfirmedAt = &confirmed.Time
+	}
+	return &t, nil
+}
+
+func (s *Store) SaveTOTP(ctx context.Context, t *models.TOTP) error {
+	res, err := s.DB.ExecContext(ctx, `
+		INSERT INTO mfa_totp (user_id, secret, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, created_at = EXCLUDED.created_at
+		WHERE mfa_totp.confirmed_at IS NULL`, t.UserID, t.Secret, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+	// The upsert leaves confirmed authenticators alone.
+	if err := requireRow(res); err != nil {
+		return models.ErrConflict
+	}
+	return nil
+}
+
+func (s *Store) ConfirmTOTP(ctx context.Context, userID string, step int64, codeHashes []string, at time.Time) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
+		UPDATE mfa_totp SET confirmed_at = $2, last_step = $3 WHERE user_id = $1 AND confirmed_at IS NULL`,
+		userID, at, step)
+	if err != nil {
+		return err
+	}
+	if err := requireRow(res); err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE mfa_totp SET last_step = $2 WHERE user_id = $1 AND last_step < $2`, userID, step)
+	if err != nil {
+		return err
+	}
+	if err := requireRow(res); err != nil {
+		return models.ErrConflict
+	}
+	return nil
+}
+
+func (s *Store) DeleteTOTP(ctx context.Context, userID string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO mfa_recovery_codes (user_id, code_hash) SELECT $1, unnest($2::TEXT[])`,
+		userID, pq.Array(codeHashes))
+	return err
+}
+
+func (s *Store) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, userID, codeHash string, at time.Time) error {
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE mfa_recovery_codes SET used_at = $3 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash, at)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (s *Store) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+func (s *Store) CreateMFAChallenge(ctx context.Context, c *models.MFAChallenge) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO mfa_challenges (token_hash, user_id, enroll, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		c.TokenHash, c.UserID, c.Enroll, c.ExpiresAt, c.CreatedAt)
+	return err
+}
+
+func (s *Store) GetMFAChallenge(ctx context.Context, tokenHash string) (*models.MFAChallenge, error) {
+	var c models.MFAChallenge
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT token_hash, user_id, enroll, attempts, expires_at, created_at FROM mfa_challenges WHERE token_hash = $1`, tokenHash).
+		Scan(&c.TokenHash, &c.UserID, &c.Enroll, &c.Attempts, &c.ExpiresAt, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *Store) AttemptMFAChallenge(ctx context.Context, tokenHash string, maxAttempts int) (int, error) {
+	var n int
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1 AND attempts < $2 RETURNING attempts`, tokenHash, maxAttempts).Scan(&n)
+	if err == sql.ErrNoRows {
+		return 0, models.ErrNotFound
+	}
+	return n, err
+}
+
+func (s *Store) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM mfa_challenges WHERE token_hash = $1`, tokenHash)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (s *Store) GetMFAPolicy(ctx context.Context, accountID string) (*models.MFAPolicy, error) {
+	var p models.MFAPolicy
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT account_id, roles, updated_at FROM mfa_policies WHERE account_id = $1`, accountID).
+		Scan(&p.AccountID, pq.Array(&p.Roles), &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *Store) PutMFAPolicy(ctx context.Context, p *models.MFAPolicy) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO mfa_policies (account_id, roles, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (account_id) DO UPDATE SET roles = EXCLUDED.roles, updated_at = EXCLUDED.updated_at`,
+		p.AccountID, pq.Array(p.Roles), p.UpdatedAt)
+	return err
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"identity/internal/models"
+	"identity/internal/token"
+)
+
+func (s *Store) GetClient(ctx context.Context, id string) (*models.Client, error) {
+	var c models.Client
+	var secret sql.NullString
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, secret_hash, name, redirect_uris, grant_types, scopes, created_at
+		FROM oauth_clients WHERE id = $1`, id).
+		Scan(&c.ID, &secret, &c.Name, pq.Array(&c.RedirectURIs), pq.Array(&c.GrantTypes), pq.Array(&c.Scopes), &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.SecretHash = secret.String
+	return &c, nil
+}
+
+func (s *Store) UpsertClient(ctx context.Context, c *models.Client) error {
+	secret := sql.NullString{String: c.SecretHash, Valid: c.SecretHash != ""}
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO oauth_clients (id, secret_hash, name, redirect_uris, grant_types, scopes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			secret_hash = EXCLUDED.secret_hash,
+			name = EXCLUDED.name,
+			redirect_uris = EXCLUDED.redirect_uris,
+			grant_types = EXCLUDED.grant_types,
+			scopes = EXCLUDED.scopes`,
+		c.ID, secret, c.Name, pq.Array(c.RedirectURIs), pq.Array(c.GrantTypes), pq.Array(c.Scopes), c.CreatedAt)
+	return err
+}
+
+func (s *Store) CreateAuthorizationCode(ctx context.Context, c *models.AuthorizationCode) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO authorization_codes
+			(code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		c.CodeHash, c.ClientID, c.UserID, c.RedirectURI, c.Scope, c.Nonce, c.CodeChallenge, c.AuthTime, c.ExpiresAt, c.CreatedAt)
+	return err
+}
+
+func (s *Store) ConsumeAuthorizationCode(ctx context.Context, hash string, at time.Time) (*models.AuthorizationCode, error) {
+	var c models.AuthorizationCode
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE authorization_codes SET used_at = $2
+		WHERE code_hash = $1 AND used_at IS NULL AND expires_at > $2
+		RETURNING code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at, created_at, used_at`,
+		hash, at).
+		Scan(&c.CodeHash, &c.ClientID, &c.UserID, &c.RedirectURI, &c.Scope, &c.Nonce, &c.CodeChallenge, &c.AuthTime, &c.ExpiresAt, &c.CreatedAt, &c.UsedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *Store) SigningKeys(ctx context.Context) ([]token.SigningKey, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT kid, private_key, created_at, expires_at FROM signing_keys`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []token.SigningKey
+	for rows.Next() {
+		var k token.SigningKey
+		var pemKey string
+		var expires sql.NullTime
+		if err := rows.Scan(&k.ID, &pemKey, &k.CreatedAt, &expires); err != nil {
+			return nil, err
+		}
+		if k.Key, err = token.DecodePrivateKey([]byte(pemKey)); err != nil {
+			return nil, err
+		}
+		k.ExpiresAt = expires.Time
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Store) AddSigningKey(ctx context.Context, k token.SigningKey) error {
+	pemKey, err := token.EncodePrivateKey(k.Key)
+	if err != nil {
+		return err
+	}
+	expires := sql.NullTime{Time: k.ExpiresAt, Valid: !k.ExpiresAt.IsZero()}
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO signing_keys (kid, private_key, created_at, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (kid) DO NOTHING`, k.ID, string(pemKey), k.CreatedAt, expires)
+	return err
+}
+
+func (s *Store) DeleteSigningKeys(ctx context.Context, expiredBefore time.Time) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM signing_keys WHERE expires_at <= $1`, expiredBefore)
+	return err
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"identity/internal/models"
+)
+
+func (s *Store) GetOTP(ctx context.Context, mobile string) (*models.OTP, error) {
+	var o models.OTP
+	var code sql.NullString
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT mobile, code_hash, attempts, sends, window_start, expires_at, created_at FROM otps WHERE mobile = $1`, mobile).
+		Scan(&o.Mobile, &code, &o.Attempts, &o.Sends, &o.WindowStart, &o.ExpiresAt, &o.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.CodeHash = code.String
+	return &o, nil
+}
+
+func (s *Store) PutOTP(ctx context.Context, o *models.OTP) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO otps (mobile, code_hash, attempts, sends, window_start, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (mobile) DO UPDATE SET code_hash = EXCLUDED.code_hash, attempts = EXCLUDED.attempts,
+			sends = EXCLUDED.sends, window_start = EXCLUDED.window_start,
+			expires_at = EXCLUDED.expires_at, created_at = EXCLUDED.created_at`,
+		o.Mobile, sql.NullString{String: o.CodeHash, Valid: o.CodeHash != ""}, o.Attempts, o.Sends,
+		o.WindowStart, o.ExpiresAt, o.CreatedAt)
+	return err
+}
+
+func (s *Store) AttemptOTP(ctx context.Context, mobile string, maxAttempts int, now time.Time) error {
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE otps SET attempts = attempts + 1
+		WHERE mobile = $1 AND code_hash IS NOT NULL AND attempts < $2 AND expires_at > $3`, mobile, maxAttempts, now)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (s *Store) ConsumeOTP(ctx context.Context, mobile, codeHash string, maxAttempts int, now time.Time) error {
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE otps SET code_hash = NULL
+		WHERE mobile = $1 AND code_hash = $2 AND attempts <= $3 AND expires_at > $4`, mobile, codeHash, maxAttempts, now)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"identity/internal/models"
+)
+
+const sessionColumns = `id, user_id, client_id, device, ip, user_agent, account_id, created_at, last_seen_at, revoked_at`
+
+func scanSession(row interface{ Scan(...any) error }) (*models.Session, error) {
+	var sess models.Session
+	var revoked sql.NullTime
+	err := row.Scan(&sess.ID, &sess.UserID, &sess.ClientID, &sess.Device, &sess.IP, &sess.UserAgent,
+		&sess.AccountID, &sess.CreatedAt, &sess.LastSeenAt, &revoked)
+	if err != nil {
+		return nil, err
+	}
+	if revoked.Valid {
+		sess.RevokedAt = &revoked.Time
+	}
+	return &sess, nil
+}
+
+func (s *Store) CreateSession(ctx context.Context, sess *models.Session) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO sessions (id, user_id, client_id, device, ip, user_agent, account_id, created_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		sess.ID, sess.UserID, sess.ClientID, sess.Device, sess.IP, sess.UserAgent, sess.AccountID,
+		sess.CreatedAt, sess.LastSeenAt)
+	return err
+}
+
+func (s *Store) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	sess, err := scanSession(s.DB.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	return sess, err
+}
+
+func (s *Store) TouchSession(ctx context.Context, id string, at time.Time, ip string) error {
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE sessions SET last_seen_at = $2, ip = COALESCE(NULLIF($3, ''), ip) WHERE id = $1`, id, at, ip)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (s *Store) ListSessions(ctx context.Context, userID string) ([]models.Session, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Session
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *sess)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return models.ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL`, id, at); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL`, id, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) RevokeUserSessions(ctx context.Context, userID string, at time.Time) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := revokeUserSessions(ctx, tx, userID, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// revokeUserSessions revokes the user's sessions and refresh tokens in tx.
+func revokeUserSessions(ctx context.Context, tx *sql.Tx, userID string, at time.Time) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`, userID, at); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`, userID, at)
+	return err
+}
+
+func (s *Store) GetSessionPolicy(ctx context.Context, accountID string) (*models.SessionPolicy, error) {
+	var p models.SessionPolicy
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT account_id, idle_timeout, absolute_timeout, updated_at FROM session_policies WHERE account_id = $1`, accountID).
+		Scan(&p.AccountID, &p.IdleTimeout, &p.AbsoluteTimeout, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *Store) PutSessionPolicy(ctx context.Context, p *models.SessionPolicy) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO session_policies (account_id, idle_timeout, absolute_timeout, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id) DO UPDATE SET idle_timeout = EXCLUDED.idle_timeout,
+			absolute_timeout = EXCLUDED.absolute_timeout, updated_at = EXCLUDED.updated_at`,
+		p.AccountID, p.IdleTimeout, p.AbsoluteTimeout, p.UpdatedAt)
+	return err
+}
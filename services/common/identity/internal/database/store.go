@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"identity/internal/models"
+)
+
+// Store is the PostgreSQL identity store.
+type Store struct {
+	DB *sql.DB
+}
+
+// NewStore returns a Store using db.
+func NewStore(db *sql.DB) *Store {
+	return &Store{DB: db}
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+const userColumns = `id, email, mobile, name, password_hash, account_id, roles, created_at, updated_at`
+
+// userValues are the placeholders for userColumns.
+const userValues = `$1, $2, $3, $4, $5, $6, $7, $8, $9`
+
+// userArgs returns the values of userColumns for user. Citizens may have
+// no email and other users no mobile; both are stored as NULL so that the
+// unique constraints ignore them.
+func userArgs(user *models.User) []interface{} {
+	return []interface{}{
+		user.ID, sql.NullString{String: user.Email, Valid: user.Email != ""},
+		sql.NullString{String: user.Mobile, Valid: user.Mobile != ""}, user.Name, user.PasswordHash,
+		user.AccountID, pq.Array(user.Roles), user.CreatedAt, user.UpdatedAt,
+	}
+}
+
+// prefixed qualifies each column in a comma-separated list with prefix.
+func prefixed(prefix, columns string) string {
+	cols := strings.Split(columns, ", ")
+	for i, c := range cols {
+		cols[i] = prefix + c
+	}
+	return strings.Join(cols, ", ")
+}
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var u models.User
+	var email, mobile sql.NullString
+	err := row.Scan(&u.ID, &email, &mobile, &u.Name, &u.PasswordHash, &u.AccountID, pq.Array(&u.Roles), &u.CreatedAt, &u.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.Email, u.Mobile = email.String, mobile.String
+	return &u, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, user *models.User) error {
+	_, err := s.DB.ExecContext(ctx, `INSERT INTO users (`+userColumns+`) VALUES (`+userValues+`)`, userArgs(user)...)
+	if isUniqueViolation(err) {
+		return models.ErrConflict
+	}
+	return err
+}
+
+func (s *Store) GetUser(ctx context.Context, id string) (*models.User, error) {
+	return scanUser(s.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return scanUser(s.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, email))
+}
+
+func (s *Store) GetUserByMobile(ctx context.Context, mobile string) (*models.User, error) {
+	return scanUser(s.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE mobile = $1`, mobile))
+}
+
+func (s *Store) UpdatePasswordHash(ctx context.Context, userID, hash string) error {
+	res, err := s.DB.ExecContext(ctx, `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`, userID, hash)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, t *models.RefreshToken) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, client_id, scope, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		t.ID, t.UserID, t.FamilyID, t.TokenHash, t.ClientID, t.Scope, t.ExpiresAt, t.CreatedAt)
+	return err
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	var t models.RefreshToken
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, user_id, family_id, token_hash, client_id, scope, expires_at, created_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = $1`, hash).
+		Scan(&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.ClientID, &t.Scope, &t.ExpiresAt, &t.CreatedAt, &t.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, id string, at time.Time) error {
+	res, err := s.DB.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL`, id, at)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (s *Store) RevokeRefreshTokenFamily(ctx context.Context, familyID string, at time.Time) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL`, familyID, at)
+	return err
+}
+
+func (s *Store) RevokeUserRefreshTokens(ctx context.Context, userID string, at time.Time) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`, userID, at)
+	return err
+}
+
+func (s *Store) CreatePasswordReset(ctx context.Context, r *models.PasswordReset) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO password_resets (token_hash, user_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4)`,
+		r.TokenHash, r.UserID, r.ExpiresAt, r.CreatedAt)
+	return err
+}
+
+func (s *Store) ResetPassword(ctx context.Context, tokenHash, passwordHash string, at time.Time) (string, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE password_resets SET used_at = $2
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+		RETURNING user_id`, tokenHash, at).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", models.ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = $2, updated_at = $3 WHERE id = $1`, userID, passwordHash, at); err != nil {
+		return "", err
+	}
+	if err := revokeUserSessions(ctx, tx, userID, at); err != nil {
+		return "", err
+	}
+	return userID, tx.Commit()
+}
+
+func (s *Store) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM revoked_access_tokens WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO revoked_access_tokens (jti, expires_at) VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING`, jti, expiresAt)
+	return err
+}
+
+func (s *Store) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $1)`, jti).Scan(&revoked)
+	return revoked, err
+}
+
+// DeleteExpired deletes the records that expired before the given time:
+// MFA challenges, authorization codes, password reset tokens and one-time
+// passwords, the last once their send window has also passed.
+func (s *Store) DeleteExpired(ctx context.Context, before time.Time) error {
+	for _, query := range []string{
+		`DELETE FROM mfa_challenges WHERE expires_at <= $1`,
+		`DELETE FROM authorization_codes WHERE expires_at <= $1`,
+		`DELETE FROM password_resets WHERE expires_at <= $1`,
+	} {
+		if _, err := s.DB.ExecContext(ctx, query, before); err != nil {
+			return err
+		}
+	}
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM otps WHERE expires_at <= $1 AND window_start <= $2`,
+		before, before.Add(-models.OTPSendWindow))
+	return err
+}
@@ -0,0 +1,177 @@
+// Package federation signs in users of an external OpenID Connect IdP,
+// such as Keycloak, by exchanging the IdP's tokens for DIGIT tokens. Local
+// user records are provisioned on first login and kept in line with the
+// IdP's roles and groups on every login.
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/oidc"
+	"github.com/google/uuid"
+
+	"identity/internal/auth"
+	"identity/internal/mfa"
+	"identity/internal/models"
+)
+
+// ErrMissingEmail is returned when the IdP token carries no email claim,
+// which local user records require.
+var ErrMissingEmail = errors.New("identity provider token has no email claim")
+
+// Store is the storage used for federated users.
+type Store interface {
+	// GetFederatedUser returns the user linked to subject at provider.
+	GetFederatedUser(ctx context.Context, provider, subject string) (*models.User, error)
+	// CreateFederatedUser creates user and links it to subject at
+	// provider.
+	CreateFederatedUser(ctx context.Context, user *models.User, provider, subject string) error
+	LinkFederatedIdentity(ctx context.Context, provider, subject, userID string) error
+	// UpdateUserProfile stores the name, account and roles of user.
+	UpdateUserProfile(ctx context.Context, user *models.User) error
+}
+
+// Config configures a Federator.
+type Config struct {
+	// Name identifies the IdP in links and routes, e.g. "keycloak".
+	Name string
+	// Issuer is the IdP's issuer URL, e.g.
+	// http://keycloak:8080/realms/digit.
+	Issuer string
+	// ClientID is the IdP client DIGIT tokens are exchanged for. It must
+	// be the token's audience or authorized party. It is required: without
+	// it, tokens the IdP issued to any of its clients would be accepted.
+	ClientID string
+	// JWKSURL overrides JWKS discovery.
+	JWKSURL string
+	Mapping Mapping
+}
+
+// Federator exchanges tokens from one IdP.
+type Federator struct {
+	// MFA, when set, holds federated users to the local MFA policy: those
+	// with an authenticator, or whose roles require one, get a
+	// *mfa.ChallengeError instead of tokens.
+	MFA *mfa.Service
+
+	cfg      Config
+	verifier *oidc.Verifier
+	store    Store
+	auth     *auth.Service
+}
+
+// New returns a Federator for cfg that provisions users in store and
+// issues tokens through svc.
+func New(cfg Config, store Store, svc *auth.Service) *Federator {
+	return &Federator{
+		cfg: cfg,
+		verifier: oidc.NewVerifier(oidc.Config{
+			Issuer:   cfg.Issuer,
+			Audience: cfg.ClientID,
+			JWKSURL:  cfg.JWKSURL,
+			Leeway:   30 * time.Second,
+		}),
+		store: store,
+		auth:  svc,
+	}
+}
+
+// Name returns the IdP name.
+func (f *Federator) Name() string { return f.cfg.Name }
+
+// Exchange verifies an IdP token against the IdP's JWKS, provisions or
+// updates the local user and returns a DIGIT token pair, subject to MFA.
+func (f *Federator) Exchange(ctx context.Context, raw string) (*models.TokenPair, error) {
+	tok, err := f.verifier.Verify(ctx, raw)
+	if errors.Is(err, oidc.ErrInvalidToken) {
+		return nil, auth.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err := tok.Claims(&claims); err != nil {
+		return nil, auth.ErrInvalidToken
+	}
+	user, err := f.Provision(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if f.MFA != nil {
+		return f.MFA.SignIn(ctx, user)
+	}
+	return f.auth.IssueTokens(ctx, user, auth.Grant{})
+}
+
+// Provision returns the local user for claims, creating it on first login.
+// An existing local user is linked only when the IdP has verified that the
+// email belongs to the subject; otherwise anyone able to set an email at
+// the IdP could take over a local account.
+func (f *Federator) Provision(ctx context.Context, claims Claims) (*models.User, error) {
+	roles, accountID := f.cfg.Mapping.Apply(claims, f.cfg.ClientID)
+	name := claims.Name
+	if name == "" {
+		name = claims.PreferredUsername
+	}
+
+	user, err := f.store.GetFederatedUser(ctx, f.cfg.Name, claims.Subject)
+	if err == nil {
+		return user, f.sync(ctx, user, name, accountID, roles)
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		return nil, err
+	}
+
+	email := auth.NormalizeEmail(claims.Email)
+	if email == "" {
+		return nil, ErrMissingEmail
+	}
+	existing, err := f.auth.Store.GetUserByEmail(ctx, email)
+	switch {
+	case err == nil && claims.EmailVerified:
+		if err := f.store.LinkFederatedIdentity(ctx, f.cfg.Name, claims.Subject, existing.ID); err != nil {
+			return nil, err
+		}
+		log.Printf("linked %s subject %s to user %s", f.cfg.Name, claims.Subject, existing.ID)
+		return existing, f.sync(ctx, existing, name, accountID, roles)
+	case err == nil:
+		return nil, fmt.Errorf("%w: verify the email with %s to link it", auth.ErrEmailTaken, f.cfg.Name)
+	case !errors.Is(err, models.ErrNotFound):
+		return nil, err
+	}
+
+	// Federated users have no local password and sign in through the IdP.
+	now := time.Now().UTC()
+	user = &models.User{
+		ID:        uuid.NewString(),
+		Email:     email,
+		Name:      name,
+		AccountID: accountID,
+		Roles:     roles,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := f.store.CreateFederatedUser(ctx, user, f.cfg.Name, claims.Subject); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return nil, auth.ErrEmailTaken
+		}
+		return nil, err
+	}
+	log.Printf("provisioned user %s for %s subject %s", user.ID, f.cfg.Name, claims.Subject)
+	return user, nil
+}
+
+// sync updates user with the profile from the IdP when it has changed.
+func (f *Federator) sync(ctx context.Context, user *models.User, name, accountID string, roles []string) error {
+	if user.Name == name && user.AccountID == accountID && reflect.DeepEqual(user.Roles, roles) {
+		return nil
+	}
+	user.Name, user.AccountID, user.Roles = name, accountID, roles
+	user.UpdatedAt = time.Now().UTC()
+	return f.store.UpdateUserProfile(ctx, user)
+}
@@ -0,0 +1,180 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/oidc/oidctest"
+
+	"identity/internal/auth"
+	"identity/internal/memory"
+	"identity/internal/mfa"
+	"identity/internal/models"
+	"identity/internal/token"
+)
+
+var mapping = Mapping{
+	Roles: map[string][]string{
+		"digit-admin": {models.RoleAdmin},
+		"auditor":     {"auditor"},
+	},
+	Groups: map[string]GroupMapping{
+		"/tenants/pb": {AccountID: "pb", Roles: []string{"employee"}},
+		"/tenants/ka": {AccountID: "ka"},
+	},
+}
+
+func newFederator(t *testing.T, idp *oidctest.Server) (*Federator, *auth.Service) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := token.NewIssuer(token.StaticKeySet(key), token.Config{Issuer: "digit", Audience: "digit", TTL: time.Minute})
+	store := memory.NewStore()
+	svc, err := auth.NewService(store, issuer, auth.Config{
+		Params: auth.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := New(Config{Name: "keycloak", Issuer: idp.URL, ClientID: "digit-ui", Mapping: mapping}, store, svc)
+	return f, svc
+}
+
+// keycloakToken returns a token shaped like a Keycloak access token.
+func keycloakToken(idp *oidctest.Server, sub, email string, verified bool, realmRoles, groups []string) string {
+	return idp.Sign(map[string]interface{}{
+		"sub":                sub,
+		"aud":                "account",
+		"azp":                "digit-ui",
+		"email":              email,
+		"email_verified":     verified,
+		"preferred_username": "asha",
+		"realm_access":       map[string]interface{}{"roles": realmRoles},
+		"resource_access": map[string]interface{}{
+			"digit-ui": map[string]interface{}{"roles": []string{"auditor"}},
+		},
+		"groups": groups,
+	})
+}
+
+func TestExchangeProvisionsAndSyncs(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	f, svc := newFederator(t, idp)
+	ctx := context.Background()
+
+	raw := keycloakToken(idp, "kc-1", "Asha@Example.org", true, []string{"digit-admin", "offline_access"}, []string{"/tenants/pb", "/other"})
+	pair, err := f.Exchange(ctx, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := svc.VerifyAccessToken(ctx, pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"admin", "auditor", "employee", "user"}
+	if !reflect.DeepEqual(claims.Roles, want) || claims.AccountID != "pb" || claims.Email != "asha@example.org" || claims.Name != "asha" {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	// The next login reuses the user and follows role and group changes.
+	pair, err = f.Exchange(ctx, keycloakToken(idp, "kc-1", "asha@example.org", true, nil, []string{"/tenants/ka"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := svc.VerifyAccessToken(ctx, pair.AccessToken)
+	if again.Subject != claims.Subject {
+		t.Fatalf("second login created user %s, want %s", again.Subject, claims.Subject)
+	}
+	if !reflect.DeepEqual(again.Roles, []string{"auditor", "user"}) || again.AccountID != "ka" {
+		t.Fatalf("roles not synced: %+v", again)
+	}
+
+	// Federated users have no local password.
+	if _, err := svc.Login(ctx, "asha@example.org", ""); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Errorf("password login of federated user: %v", err)
+	}
+}
+
+func TestExchangeLinksVerifiedEmail(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	f, svc := newFederator(t, idp)
+	ctx := context.Background()
+	local, err := svc.Register(ctx, models.RegisterRequest{Email: "ravi@example.org", Password: "local-passw0rd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.Exchange(ctx, keycloakToken(idp, "kc-2", "ravi@example.org", false, nil, nil))
+	if !errors.Is(err, auth.ErrEmailTaken) {
+		t.Fatalf("unverified email: err = %v, want ErrEmailTaken", err)
+	}
+
+	pair, err := f.Exchange(ctx, keycloakToken(idp, "kc-2", "ravi@example.org", true, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := svc.VerifyAccessToken(ctx, pair.AccessToken)
+	if claims.Subject != local.ID {
+		t.Fatalf("verified email linked to %s, want %s", claims.Subject, local.ID)
+	}
+	// The local password keeps working.
+	if _, err := svc.Login(ctx, "ravi@example.org", "local-passw0rd"); err != nil {
+		t.Errorf("local login after linking: %v", err)
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	f, _ := newFederator(t, idp)
+	ctx := context.Background()
+
+	other := oidctest.NewServer()
+	defer other.Close()
+	for name, raw := range map[string]string{
+		"other IdP":    keycloakToken(other, "kc-3", "x@example.org", true, nil, nil),
+		"other client": idp.Sign(map[string]interface{}{"sub": "kc-3", "aud": "account", "azp": "another-app", "email": "x@example.org"}),
+		"expired":      idp.Sign(map[string]interface{}{"sub": "kc-3", "azp": "digit-ui", "exp": time.Now().Add(-time.Hour).Unix()}),
+	} {
+		if _, err := f.Exchange(ctx, raw); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", name, err)
+		}
+	}
+	if _, err := f.Exchange(ctx, idp.Sign(map[string]interface{}{"sub": "kc-3", "azp": "digit-ui"})); !errors.Is(err, ErrMissingEmail) {
+		t.Errorf("missing email: err = %v", err)
+	}
+}
+
+func TestExchangeRequiresMFA(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+	f, svc := newFederator(t, idp)
+	ctx := context.Background()
+	f.MFA = mfa.NewService(svc.Store.(*memory.Store), svc, mfa.Config{})
+	if _, err := f.MFA.SetPolicy(ctx, "", []string{models.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Register(ctx, models.RegisterRequest{Email: "ravi@example.org", Password: "local-passw0rd"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Linking a local user does not skip the second factor their roles
+	// require.
+	_, err := f.Exchange(ctx, keycloakToken(idp, "kc-4", "ravi@example.org", true, []string{"digit-admin"}, nil))
+	var challenge *mfa.ChallengeError
+	if !errors.As(err, &challenge) || challenge.Challenge.Error != models.MFAEnrollmentRequired {
+		t.Fatalf("admin exchange: err = %v, want an enrolment challenge", err)
+	}
+	if _, err := f.Exchange(ctx, keycloakToken(idp, "kc-5", "sita@example.org", true, nil, nil)); err != nil {
+		t.Errorf("exchange without MFA required: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package federation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"identity/internal/models"
+)
+
+// Mapping translates IdP roles and groups into DIGIT roles and accounts.
+type Mapping struct {
+	// Roles maps realm roles, and client roles of the configured client,
+	// to DIGIT roles.
+	Roles map[string][]string `json:"roles"`
+	// Groups maps group names as they appear in the groups claim, e.g.
+	// "/tenants/pb" with Keycloak's full-path group mapper, to an account
+	// and roles.
+	Groups map[string]GroupMapping `json:"groups"`
+	// DefaultRoles are granted to every federated user. Nil means the user
+	// role.
+	DefaultRoles []string `json:"default_roles"`
+}
+
+// GroupMapping is what membership of one IdP group grants.
+type GroupMapping struct {
+	AccountID string   `json:"account_id"`
+	Roles     []string `json:"roles"`
+}
+
+// LoadMapping reads a Mapping from the JSON file at path.
+func LoadMapping(path string) (Mapping, error) {
+	var m Mapping
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// Claims are the IdP token claims used for federation. The role and group
+// claims follow Keycloak's default mappers.
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	RealmAccess       struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+	ResourceAccess map[string]struct {
+		Roles []string `json:"roles"`
+	} `json:"resource_access"`
+	Groups []string `json:"groups"`
+}
+
+// Apply returns the DIGIT roles and account granted by claims. idpRoles
+// considered are the realm roles and the client roles of clientID. When
+// several groups name an account, the group that sorts first wins so that
+// the result does not depend on claim order.
+func (m Mapping) Apply(c Claims, clientID string) (roles []string, accountID string) {
+	set := make(map[string]bool)
+	add := func(rs []string) {
+		for _, r := range rs {
+			set[r] = true
+		}
+	}
+	if m.DefaultRoles == nil {
+		add([]string{models.RoleUser})
+	} else {
+		add(m.DefaultRoles)
+	}
+	for _, r := range c.RealmAccess.Roles {
+		add(m.Roles[r])
+	}
+	for _, r := range c.ResourceAccess[clientID].Roles {
+		add(m.Roles[r])
+	}
+
+	groups := append([]string(nil), c.Groups...)
+	sort.Strings(groups)
+	for _, g := range groups {
+		gm, ok := m.Groups[g]
+		if !ok {
+			continue
+		}
+		add(gm.Roles)
+		if accountID == "" {
+			accountID = gm.AccountID
+		}
+	}
+
+	roles = make([]string, 0, len(set))
+	for r := range set {
+		roles = append(roles, r)
+	}
+	sort.Strings(roles)
+	return roles, accountID
+}
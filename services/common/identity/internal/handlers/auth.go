@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"identity/internal/mfa"
+	"identity/internal/models"
+)
+
+// RegisterUser creates a user.
+// @Summary Register a user
+// @Description Creates a user with a password login. Passwords must be 8 to 256 characters.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RegisterRequest true "New user"
+// @Success 201 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /auth/register [post]
+func (h *Handler) RegisterUser(c *gin.Context) {
+	var req models.RegisterRequest
+	if !bind(c, &req) {
+		return
+	}
+	user, err := h.Auth.Register(c.Request.Context(), req)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+// Login exchanges an email and password for a token pair.
+// @Summary Password login
+// @Description Returns a signed access token and a refresh token. Users with an authenticator, or whose roles require MFA, get a 403 challenge instead: complete it at /auth/mfa/verify, or enrol first via /auth/mfa/challenge/totp when the error is mfa_enrollment_required. Repeated failures set captcha_required in the 401 response and then lock the user or client IP out with a 429 and Retry-After for a period that doubles with each further failure.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.LoginRequest true "Credentials"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.MFAChallengeResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /auth/login [post]
+func (h *Handler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if !bind(c, &req) {
+		return
+	}
+	var pair *models.TokenPair
+	var err error
+	if h.MFA != nil {
+		pair, err = h.MFA.Login(c.Request.Context(), req.Email, req.Password)
+	} else {
+		pair, err = h.Auth.Login(c.Request.Context(), req.Email, req.Password)
+	}
+	var challenge *mfa.ChallengeError
+	if errors.As(err, &challenge) {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusForbidden, challenge.Challenge)
+		return
+	}
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pair)
+}
+
+// Refresh rotates a refresh token.
+// @Summary Refresh tokens
+// @Description Exchanges a refresh token for a new token pair. The presented refresh token is revoked; presenting it again revokes every token descended from the same login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /auth/refresh [post]
+func (h *Handler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if !bind(c, &req) {
+		return
+	}
+	pair, err := h.Auth.Refresh(c.Request.Context(), req.RefreshToken, "")
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pair)
+}
+
+// Logout revokes refresh tokens.
+// @Summary Log out
+// @Description Revokes the refresh token and the tokens rotated from it, or every refresh token of the user when all is true. Access tokens stay valid until they expire.
+// @Tags auth
+// @Accept json
+// @Param request body models.LogoutRequest true "Refresh token"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Router /auth/logout [post]
+func (h *Handler) Logout(c *gin.Context) {
+	var req models.LogoutRequest
+	if !bind(c, &req) {
+		return
+	}
+	if err := h.Auth.Logout(c.Request.Context(), req.RefreshToken, req.All); err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ForgotPassword starts a password reset.
+// @Summary Request a password reset
+// @Description Sends a single-use reset token to the user. The response is the same whether or not the email is registered.
+// @Tags auth
+// @Accept json
+// @Param request body models.ForgotPasswordRequest true "Email"
+// @Success 202
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse "No reset notifier is configured"
+// @Router /auth/password/forgot [post]
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if !bind(c, &req) {
+		return
+	}
+	if err := h.Auth.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// ResetPassword completes a password reset.
+// @Summary Reset a password
+// @Description Sets a new password with a reset token and revokes all of the user's refresh tokens.
+// @Tags auth
+// @Accept json
+// @Param request body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /auth/password/reset [post]
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if !bind(c, &req) {
+		return
+	}
+	if err := h.Auth.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Me returns the signed-in user.
+// @Summary Current user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.User
+// @Failure 401 {object} models.ErrorResponse
+// @Router /auth/me [get]
+func (h *Handler) Me(c *gin.Context) {
+	user, err := h.Auth.Store.GetUser(c.Request.Context(), ClaimsFrom(c).Subject)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/authz"
+	"github.com/digitnxt/digit/pkg/config"
+	"github.com/digitnxt/digit/pkg/service"
+	"github.com/gin-gonic/gin"
+
+	"identity/internal/auth"
+	"identity/internal/lockout"
+	"identity/internal/memory"
+	"identity/internal/mfa"
+	"identity/internal/models"
+	"identity/internal/oidc"
+	"identity/internal/otp"
+	"identity/internal/token"
+)
+
+// captureNotifier records the last reset token and one-time password
+// instead of delivering them.
+type captureNotifier struct{ token, otp string }
+
+func (n *captureNotifier) SendPasswordReset(_ context.Context, _ *models.User, token string) error {
+	n.token = token
+	return nil
+}
+
+func (n *captureNotifier) SendOTP(_ context.Context, _, code string) error {
+	n.otp = code
+	return nil
+}
+
+func newTestRouter(t *testing.T) (*gin.Engine, *captureNotifier) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := token.NewIssuer(token.StaticKeySet(key), token.Config{Issuer: "http://identity.test", Audience: "digit", TTL: time.Minute})
+	notifier := &captureNotifier{}
+	store := memory.NewStore()
+	svc, err := auth.NewService(store, issuer, auth.Config{
+		Params:   auth.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		Notifier: notifier,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Guard = lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{})
+	svc.Guard.Record = nil
+	provider := oidc.NewProvider(svc, store)
+	for _, client := range testClients {
+		if err := provider.RegisterClient(context.Background(), client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := New(svc, provider)
+	h.Authz = authz.NewEngine(testPolicy)
+	h.MFA = mfa.NewService(store, svc, mfa.Config{})
+	h.OTP = otp.NewService(store, svc, otp.Config{Sender: notifier})
+	h.OTP.Limiter = svc.Guard.Store
+	// Client IPs are taken as pkg/service serves identity: with no
+	// trusted proxies.
+	r, err := service.NewEngine(&config.Service{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Register(r)
+	return r, notifier
+}
+
+func do(t *testing.T, r http.Handler, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+func login(t *testing.T, r http.Handler, password string) models.TokenPair {
+	t.Helper()
+	rec := do(t, r, http.MethodPost, "/auth/login", `{"email":"Asha@Example.org","password":"`+password+`"}`, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var pair models.TokenPair
+	if err := json.Unmarshal(rec.Body.Bytes(), &pair); err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+func refresh(t *testing.T, r http.Handler, raw string) *httptest.ResponseRecorder {
+	return do(t, r, http.MethodPost, "/auth/refresh", `{"refresh_token":"`+raw+`"}`, nil)
+}
+
+const registerBody = `{"email":"asha@example.org","password":"s3cret-passw0rd","name":"Asha"}`
+
+func TestRegisterAndLogin(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusConflict)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", `{"email":"b@example.org","password":"short"}`, nil), http.StatusBadRequest)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", `{"email":"not-an-email","password":"long enough"}`, nil), http.StatusBadRequest)
+
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/login", `{"email":"asha@example.org","password":"wrong-password"}`, nil), http.StatusUnauthorized)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/login", `{"email":"nobody@example.org","password":"wrong-password"}`, nil), http.StatusUnauthorized)
+
+	pair := login(t, r, "s3cret-passw0rd")
+	if pair.TokenType != "Bearer" || pair.ExpiresIn != 60 || pair.AccessToken == "" || pair.RefreshToken == "" {
+		t.Fatalf("unexpected token pair: %+v", pair)
+	}
+
+	expectStatus(t, do(t, r, http.MethodGet, "/auth/me", "", nil), http.StatusUnauthorized)
+	expectStatus(t, do(t, r, http.MethodGet, "/auth/me", "", map[string]string{"Authorization": "Bearer nope"}), http.StatusUnauthorized)
+	rec := do(t, r, http.MethodGet, "/auth/me", "", map[string]string{"Authorization": "Bearer " + pair.AccessToken})
+	expectStatus(t, rec, http.StatusOK)
+	var me map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &me)
+	if me["email"] != "asha@example.org" || me["name"] != "Asha" {
+		t.Errorf("me = %v", me)
+	}
+	if _, ok := me["password_hash"]; ok {
+		t.Error("password hash leaked in user response")
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	first := login(t, r, "s3cret-passw0rd")
+
+	rec := refresh(t, r, first.RefreshToken)
+	expectStatus(t, rec, http.StatusOK)
+	var second models.TokenPair
+	json.Unmarshal(rec.Body.Bytes(), &second)
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	// Replaying the rotated token revokes the whole family.
+	expectStatus(t, refresh(t, r, first.RefreshToken), http.StatusUnauthorized)
+	expectStatus(t, refresh(t, r, second.RefreshToken), http.StatusUnauthorized)
+	expectStatus(t, refresh(t, r, "unknown"), http.StatusUnauthorized)
+}
+
+func TestLogout(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	a := login(t, r, "s3cret-passw0rd")
+	b := login(t, r, "s3cret-passw0rd")
+
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/logout", `{"refresh_token":"`+a.RefreshToken+`"}`, nil), http.StatusNoContent)
+	expectStatus(t, refresh(t, r, a.RefreshToken), http.StatusUnauthorized)
+	expectStatus(t, refresh(t, r, b.RefreshToken), http.StatusOK)
+
+	c := login(t, r, "s3cret-passw0rd")
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/logout", `{"refresh_token":"`+c.RefreshToken+`","all":true}`, nil), http.StatusNoContent)
+	expectStatus(t, refresh(t, r, c.RefreshToken), http.StatusUnauthorized)
+
+	// Logging out twice is not an error.
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/logout", `{"refresh_token":"`+c.RefreshToken+`"}`, nil), http.StatusNoContent)
+}
+
+func TestPasswordReset(t *testing.T) {
+	r, notifier := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	session := login(t, r, "s3cret-passw0rd")
+
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/password/forgot", `{"email":"nobody@example.org"}`, nil), http.StatusAccepted)
+	if notifier.token != "" {
+		t.Fatal("reset token sent for an unknown email")
+	}
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/password/forgot", `{"email":"ASHA@example.org"}`, nil), http.StatusAccepted)
+	if notifier.token == "" {
+		t.Fatal("no reset token sent")
+	}
+
+	reset := `{"token":"` + notifier.token + `","password":"new-passw0rd!"}`
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/password/reset", `{"token":"`+notifier.token+`","password":"short"}`, nil), http.StatusBadRequest)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/password/reset", reset, nil), http.StatusNoContent)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/password/reset", reset, nil), http.StatusUnauthorized)
+
+	expectStatus(t, refresh(t, r, session.RefreshToken), http.StatusUnauthorized)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/login", `{"email":"asha@example.org","password":"s3cret-passw0rd"}`, nil), http.StatusUnauthorized)
+	login(t, r, "new-passw0rd!")
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/digitnxt/digit/pkg/authz"
+	"github.com/gin-gonic/gin"
+
+	"identity/internal/models"
+	"identity/internal/token"
+)
+
+// Decide is the policy decision point used by other services.
+// @Summary Authorization decision
+// @Description Decides whether the caller identified by the bearer token may perform an action on a resource, evaluating role- and attribute-based rules scoped to accounts. Denials are answered with 200 and allowed false.
+// @Tags authz
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.AuthorizeRequest true "Action and resource"
+// @Success 200 {object} models.AuthorizeResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /authorize [post]
+func (h *Handler) Decide(c *gin.Context) {
+	var req models.AuthorizeRequest
+	if !bind(c, &req) {
+		return
+	}
+	d, err := h.Authz.Decide(c.Request.Context(), authz.Request{
+		Subject: subject(ClaimsFrom(c)),
+		Action:  req.Action,
+		Resource: authz.Resource{
+			Type:       req.Resource.Type,
+			ID:         req.Resource.ID,
+			AccountID:  req.Resource.AccountID,
+			Attributes: req.Resource.Attributes,
+		},
+	})
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.AuthorizeResponse{Allowed: d.Allowed, Rule: d.Rule, Reason: d.Reason})
+}
+
+// subject is the authorization subject for an access token.
+func subject(claims *token.Claims) authz.Subject {
+	s := authz.Subject{ID: claims.Subject, Roles: claims.Roles, AccountID: claims.AccountID}
+	if claims.ClientID != "" || claims.Scope != "" {
+		s.Attributes = map[string]string{}
+		if claims.ClientID != "" {
+			s.Attributes["client_id"] = claims.ClientID
+		}
+		if claims.Scope != "" {
+			s.Attributes["scope"] = claims.Scope
+		}
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/digitnxt/digit/pkg/authz"
+
+	"identity/internal/models"
+)
+
+// testPolicy lets users read reports of every account, update their own
+// profile, manage their own sessions, unlock users and manage MFA and
+// session policies.
+var testPolicy = authz.Policy{Rules: []authz.Rule{
+	{Name: "read-reports", Roles: []string{models.RoleUser}, Actions: []string{"reports:read"}},
+	{Name: "mfa-policies", Roles: []string{models.RoleUser}, Actions: []string{"mfa-policies:*"}},
+	{Name: "unlock-users", Roles: []string{models.RoleUser}, Actions: []string{"users:unlock"}},
+	{Name: "session-policies", Roles: []string{models.RoleUser}, Actions: []string{"session-policies:*"}},
+	{Name: "own-sessions", Actions: []string{"sessions:*"}, Conditions: []authz.Condition{
+		{Attribute: "resource.id", EqualsAttribute: "subject.id"},
+	}},
+	{Name: "own-profile", Actions: []string{"profiles:update"}, Conditions: []authz.Condition{
+		{Attribute: "resource.id", EqualsAttribute: "subject.id"},
+	}},
+}}
+
+func TestAuthorize(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	pair := login(t, r, "s3cret-passw0rd")
+	bearer := map[string]string{"Authorization": "Bearer " + pair.AccessToken}
+
+	rec := do(t, r, http.MethodGet, "/auth/me", "", bearer)
+	expectStatus(t, rec, http.StatusOK)
+	var me models.User
+	json.Unmarshal(rec.Body.Bytes(), &me)
+
+	tests := []struct {
+		body    string
+		allowed bool
+		rule    string
+	}{
+		{`{"action":"reports:read","resource":{"type":"report","account_id":"pb"}}`, true, "read-reports"},
+		{`{"action":"reports:delete","resource":{"type":"report"}}`, false, ""},
+		{`{"action":"profiles:update","resource":{"type":"profile","id":"` + me.ID + `"}}`, true, "own-profile"},
+		{`{"action":"profiles:update","resource":{"type":"profile","id":"someone-else"}}`, false, ""},
+	}
+	for _, tc := range tests {
+		rec := do(t, r, http.MethodPost, "/authorize", tc.body, bearer)
+		expectStatus(t, rec, http.StatusOK)
+		var d models.AuthorizeResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &d); err != nil {
+			t.Fatal(err)
+		}
+		if d.Allowed != tc.allowed || d.Rule != tc.rule || d.Reason == "" {
+			t.Errorf("%s: decision = %+v", tc.body, d)
+		}
+	}
+
+	expectStatus(t, do(t, r, http.MethodPost, "/authorize", `{"action":"reports:read"}`, nil), http.StatusUnauthorized)
+	expectStatus(t, do(t, r, http.MethodPost, "/authorize", `{"resource":{}}`, bearer), http.StatusBadRequest)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"identity/internal/mfa"
+	"identity/internal/models"
+)
+
+// FederatedLogin exchanges a token from an external IdP for DIGIT tokens.
+// @Summary Sign in with an external IdP
+// @Description Verifies an ID or access token from a configured OpenID Connect IdP such as Keycloak against its JWKS, provisions the local user on first login, maps IdP roles and groups to DIGIT roles and account, and returns a token pair. Users with an authenticator, or whose roles require MFA, get a 403 challenge instead, completed as for /auth/login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "IdP name, e.g. keycloak"
+// @Param request body models.FederatedLoginRequest true "IdP token"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.MFAChallengeResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /auth/federated/{provider} [post]
+func (h *Handler) FederatedLogin(c *gin.Context) {
+	f, ok := h.Federators[c.Param("provider")]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, models.ErrorResponse{Error: "unknown identity provider"})
+		return
+	}
+	var req models.FederatedLoginRequest
+	if !bind(c, &req) {
+		return
+	}
+	pair, err := f.Exchange(c.Request.Context(), req.Token)
+	var challenge *mfa.ChallengeError
+	if errors.As(err, &challenge) {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusForbidden, challenge.Challenge)
+		return
+	}
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pair)
+}
@@ -0,0 +1,144 @@
+// Package handlers exposes the identity service flows over HTTP.
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/authz"
+	"github.com/gin-gonic/gin"
+
+	"identity/internal/auth"
+	"identity/internal/federation"
+	"identity/internal/lockout"
+	"identity/internal/mfa"
+	"identity/internal/models"
+	"identity/internal/oidc"
+	"identity/internal/otp"
+)
+
+// Handler serves the identity routes.
+type Handler struct {
+	Auth *auth.Service
+	OIDC *oidc.Provider
+	// Federators exchange tokens from external IdPs, keyed by IdP name.
+	Federators map[string]*federation.Federator
+	// Authz answers POST /authorize.
+	Authz authz.Decider
+	// MFA, when set, challenges logins for a second factor and serves
+	// the /auth/mfa routes.
+	MFA *mfa.Service
+	// OTP, when set, signs citizens in with one-time passwords sent to
+	// their mobile at /auth/otp.
+	OTP *otp.Service
+}
+
+// New creates a Handler for svc serving the OpenID Connect endpoints of
+// provider and deciding authorization with the default policy.
+func New(svc *auth.Service, provider *oidc.Provider) *Handler {
+	return &Handler{Auth: svc, OIDC: provider, Authz: authz.NewEngine(authz.DefaultPolicy())}
+}
+
+// Register mounts the identity routes on r.
+func (h *Handler) Register(r gin.IRouter) {
+	r.Use(ClientInfo())
+	g := r.Group("/auth")
+	g.POST("/register", h.RegisterUser)
+	g.POST("/login", h.Login)
+	g.POST("/refresh", h.Refresh)
+	g.POST("/logout", h.Logout)
+	g.POST("/password/forgot", h.ForgotPassword)
+	g.POST("/password/reset", h.ResetPassword)
+	g.GET("/me", RequireAuth(h.Auth), h.Me)
+	g.POST("/federated/:provider", h.FederatedLogin)
+	g.GET("/sessions", RequireAuth(h.Auth), h.ListSessions)
+	g.DELETE("/sessions", RequireAuth(h.Auth), h.RevokeOtherSessions)
+	g.DELETE("/sessions/:id", RequireAuth(h.Auth), h.RevokeSession)
+	g.GET("/session-policies", RequireAuth(h.Auth), h.GetSessionPolicy)
+	g.PUT("/session-policies", RequireAuth(h.Auth), h.PutSessionPolicy)
+	if h.OTP != nil {
+		g.POST("/otp/request", h.RequestOTP)
+		g.POST("/otp/verify", h.VerifyOTP)
+	}
+	if h.MFA != nil {
+		m := g.Group("/mfa")
+		m.POST("/verify", h.VerifyMFA)
+		m.POST("/challenge/totp", h.EnrollTOTPChallenge)
+		m.POST("/challenge/totp/confirm", h.ConfirmTOTPChallenge)
+		m.GET("", RequireAuth(h.Auth), h.MFAStatus)
+		m.DELETE("", RequireAuth(h.Auth), h.DisableMFA)
+		m.POST("/totp", RequireAuth(h.Auth), h.EnrollTOTP)
+		m.POST("/totp/confirm", RequireAuth(h.Auth), h.ConfirmTOTP)
+		m.POST("/recovery-codes", RequireAuth(h.Auth), h.RegenerateRecoveryCodes)
+		m.GET("/policies", RequireAuth(h.Auth), h.GetMFAPolicy)
+		m.PUT("/policies", RequireAuth(h.Auth), h.PutMFAPolicy)
+	}
+
+	r.GET(oidc.DiscoveryPath, h.Discovery)
+	r.GET(oidc.JWKSPath, h.JWKS)
+	o := r.Group("/oauth2")
+	o.GET("/authorize", h.AuthorizeForm)
+	o.POST("/authorize", h.Authorize)
+	o.POST("/token", h.Token)
+	o.GET("/userinfo", RequireAuth(h.Auth), h.UserInfo)
+	o.POST("/introspect", h.Introspect)
+	o.POST("/revoke", h.Revoke)
+
+	r.POST("/authorize", RequireAuth(h.Auth), h.Decide)
+	r.GET("/users/:id/sessions", RequireAuth(h.Auth), h.ListUserSessions)
+	r.DELETE("/users/:id/sessions", RequireAuth(h.Auth), h.RevokeUserSessions)
+	if h.Auth.Guard != nil {
+		r.DELETE("/users/:id/lockout", RequireAuth(h.Auth), h.UnlockUser)
+	}
+}
+
+// errorJSON writes err as a JSON error, mapping service errors to their
+// status codes. Unexpected errors are logged and hidden from the caller.
+func errorJSON(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrInvalidToken), errors.Is(err, mfa.ErrInvalidCode),
+		errors.Is(err, otp.ErrInvalidCode):
+		status = http.StatusUnauthorized
+	case errors.Is(err, auth.ErrWeakPassword), errors.Is(err, federation.ErrMissingEmail), errors.Is(err, mfa.ErrNotEnrolled),
+		errors.Is(err, otp.ErrInvalidMobile):
+		status = http.StatusBadRequest
+	case errors.Is(err, mfa.ErrRequired), errors.Is(err, otp.ErrNotCitizen):
+		status = http.StatusForbidden
+	case errors.Is(err, auth.ErrEmailTaken), errors.Is(err, mfa.ErrAlreadyEnrolled):
+		status = http.StatusConflict
+	case errors.Is(err, models.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, lockout.ErrLocked), errors.Is(err, otp.ErrRateLimited):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, auth.ErrResetUnavailable):
+		status = http.StatusServiceUnavailable
+	}
+	var locked *lockout.LockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter(time.Now()).Seconds())))
+	}
+	var limited *otp.RateLimitError
+	if errors.As(err, &limited) {
+		c.Header("Retry-After", strconv.Itoa(int(limited.RetryAfter.Round(time.Second).Seconds())))
+	}
+	var captcha *lockout.CaptchaError
+	resp := models.ErrorResponse{Error: err.Error(), CaptchaRequired: errors.As(err, &captcha)}
+	if status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Request.Method, c.FullPath(), err)
+		resp.Error = "internal error"
+	}
+	c.AbortWithStatusJSON(status, resp)
+}
+
+// bind decodes the JSON body into v, writing a 400 response on failure.
+func bind(c *gin.Context, v interface{}) bool {
+	if err := c.ShouldBindJSON(v); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UnlockUser clears a user's failed logins and second-factor codes and
+// their lockouts.
+// @Summary Unlock a user
+// @Description Clears the user's failed login and second-factor attempts and lifts their lockouts. Lockouts of client IPs are left alone. Requires the users:unlock permission on the user.
+// @Tags auth
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /users/{id}/lockout [delete]
+func (h *Handler) UnlockUser(c *gin.Context) {
+	user, ok := h.authorizeUser(c, "users:unlock")
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.Auth.Guard.Unlock(ctx, user.Email); err != nil {
+		errorJSON(c, err)
+		return
+	}
+	if err := h.Auth.Guard.UnlockMFA(ctx, user.ID); err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
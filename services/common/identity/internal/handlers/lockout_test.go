@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"identity/internal/models"
+)
+
+func TestLoginLockout(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	bearer := map[string]string{"Authorization": "Bearer " + login(t, r, "s3cret-passw0rd").AccessToken}
+	wrong := `{"email":"asha@example.org","password":"wrong-password"}`
+
+	for i := 1; i <= 5; i++ {
+		rec := do(t, r, http.MethodPost, "/auth/login", wrong, nil)
+		expectStatus(t, rec, http.StatusUnauthorized)
+		var resp models.ErrorResponse
+		decodeJSON(t, rec, &resp)
+		if resp.CaptchaRequired != (i >= 3) {
+			t.Fatalf("attempt %d: captcha_required = %v", i, resp.CaptchaRequired)
+		}
+	}
+	// The right password is refused while locked out.
+	rec := do(t, r, http.MethodPost, "/auth/login", `{"email":"asha@example.org","password":"s3cret-passw0rd"}`, nil)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("missing Retry-After")
+	}
+
+	rec = do(t, r, http.MethodGet, "/auth/me", "", bearer)
+	var me models.User
+	decodeJSON(t, rec, &me)
+	expectStatus(t, do(t, r, http.MethodDelete, "/users/"+me.ID+"/lockout", "", bearer), http.StatusNoContent)
+	login(t, r, "s3cret-passw0rd")
+}
+
+func TestSpoofedForwardedFor(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+
+	// Sessions record the peer, not the address the client claims.
+	spoofed := map[string]string{"X-Forwarded-For": "203.0.113.9"}
+	rec := do(t, r, http.MethodPost, "/auth/login", `{"email":"asha@example.org","password":"s3cret-passw0rd"}`, spoofed)
+	expectStatus(t, rec, http.StatusOK)
+	var pair models.TokenPair
+	decodeJSON(t, rec, &pair)
+	rec = do(t, r, http.MethodGet, "/auth/sessions", "", map[string]string{"Authorization": "Bearer " + pair.AccessToken})
+	var sessions []models.Session
+	decodeJSON(t, rec, &sessions)
+	if len(sessions) != 1 || sessions[0].IP != "192.0.2.1" {
+		t.Fatalf("sessions = %+v, want IP 192.0.2.1", sessions)
+	}
+
+	// Rotating the header does not escape the per-IP lockout.
+	for i := 1; i <= 50; i++ {
+		body := fmt.Sprintf(`{"email":"user%d@example.org","password":"wrong-password"}`, i)
+		rec := do(t, r, http.MethodPost, "/auth/login", body, map[string]string{"X-Forwarded-For": fmt.Sprintf("198.51.100.%d", i)})
+		expectStatus(t, rec, http.StatusUnauthorized)
+	}
+	rec = do(t, r, http.MethodPost, "/auth/login", `{"email":"asha@example.org","password":"s3cret-passw0rd"}`, map[string]string{"X-Forwarded-For": "198.51.100.200"})
+	expectStatus(t, rec, http.StatusTooManyRequests)
+}
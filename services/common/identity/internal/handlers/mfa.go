@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/digitnxt/digit/pkg/authz"
+	"github.com/gin-gonic/gin"
+
+	"identity/internal/models"
+)
+
+// currentUser loads the user named by the access token, writing the error
+// response when that fails.
+func (h *Handler) currentUser(c *gin.Context) (*models.User, bool) {
+	user, err := h.Auth.Store.GetUser(c.Request.Context(), ClaimsFrom(c).Subject)
+	if err != nil {
+		errorJSON(c, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// authorize checks the caller may perform action on res, writing a 403
+// response when the policy denies it.
+func (h *Handler) authorize(c *gin.Context, action string, res authz.Resource) bool {
+	d, err := h.Authz.Decide(c.Request.Context(), authz.Request{Subject: subject(ClaimsFrom(c)), Action: action, Resource: res})
+	if err != nil {
+		errorJSON(c, err)
+		return false
+	}
+	if !d.Allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{Error: "permission denied: " + d.Reason})
+		return false
+	}
+	return true
+}
+
+// VerifyMFA completes a login challenged for a second factor.
+// @Summary Complete an MFA login
+// @Description Exchanges the mfa_token returned by /auth/login and a code from the user's authenticator app, or one of their recovery codes, for a token pair. Each recovery code works once; the challenge is dropped after five wrong codes.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body models.MFAVerifyRequest true "Challenge and code"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /auth/mfa/verify [post]
+func (h *Handler) VerifyMFA(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	if !bind(c, &req) {
+		return
+	}
+	pair, err := h.MFA.Verify(c.Request.Context(), req.MFAToken, req.Code)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pair)
+}
+
+// MFAStatus reports the signed-in user's second factors.
+// @Summary MFA status
+// @Tags mfa
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.MFAStatus
+// @Failure 401 {object} models.ErrorResponse
+// @Router /auth/mfa [get]
+func (h *Handler) MFAStatus(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	status, err := h.MFA.Status(c.Request.Context(), user)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// EnrollTOTP starts enrolling an authenticator app.
+// @Summary Enrol an authenticator
+// @Description Generates a TOTP secret for the signed-in user. Render otpauth_uri as a QR code for the authenticator app, then confirm with a code from it. Replaces an unconfirmed enrolment.
+// @Tags mfa
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.TOTPEnrollment
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /auth/mfa/totp [post]
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	enrollment, err := h.MFA.Enroll(c.Request.Context(), user)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP enables the authenticator being enrolled.
+// @Summary Confirm an authenticator
+// @Description Enables the enrolled authenticator with a code from it and returns recovery codes, which are only shown once.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.MFACodeRequest true "Authenticator code"
+// @Success 200 {object} models.MFAEnabledResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /auth/mfa/totp/confirm [post]
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var req models.MFACodeRequest
+	if !bind(c, &req) {
+		return
+	}
+	codes, err := h.MFA.Confirm(c.Request.Context(), user, req.Code)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.MFAEnabledResponse{RecoveryCodes: codes})
+}
+
+// EnrollTOTPChallenge enrols an authenticator during a login that requires
+// one.
+// @Summary Enrol an authenticator to sign in
+// @Description For logins refused with mfa_enrollment_required: generates a TOTP secret for the user named by the mfa_token.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body models.MFATokenRequest true "Challenge"
+// @Success 200 {object} models.TOTPEnrollment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /auth/mfa/challenge/totp [post]
+func (h *Handler) EnrollTOTPChallenge(c *gin.Context) {
+	var req models.MFATokenRequest
+	if !bind(c, &req) {
+		return
+	}
+	enrollment, err := h.MFA.EnrollChallenge(c.Request.Context(), req.MFAToken)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTPChallenge confirms the authenticator enrolled during a login
+// and completes it.
+// @Summary Confirm an authenticator to sign in
+// @Description Enables the authenticator enrolled with /auth/mfa/challenge/totp and returns recovery codes together with the login's token pair.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body models.MFAVerifyRequest true "Challenge and authenticator code"
+// @Success 200 {object} models.MFAEnabledResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /auth/mfa/challenge/totp/confirm [post]
+func (h *Handler) ConfirmTOTPChallenge(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	if !bind(c, &req) {
+		return
+	}
+	resp, err := h.MFA.ConfirmChallenge(c.Request.Context(), req.MFAToken, req.Code)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// DisableMFA removes the signed-in user's authenticator.
+// @Summary Disable MFA
+// @Description Removes the authenticator and recovery codes after checking a code from either. Refused when a policy requires MFA for the user.
+// @Tags mfa
+// @Accept json
+// @Security BearerAuth
+// @Param request body models.MFACodeRequest true "Authenticator or recovery code"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /auth/mfa [delete]
+func (h *Handler) DisableMFA(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var req models.MFACodeRequest
+	if !bind(c, &req) {
+		return
+	}
+	if err := h.MFA.Disable(c.Request.Context(), user, req.Code); err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the signed-in user's recovery codes.
+// @Summary Regenerate recovery codes
+// @Description Replaces every recovery code after checking an authenticator or recovery code.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.MFACodeRequest true "Authenticator or recovery code"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /auth/mfa/recovery-codes [post]
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var req models.MFACodeRequest
+	if !bind(c, &req) {
+		return
+	}
+	codes, err := h.MFA.RegenerateRecoveryCodes(c.Request.Context(), user, req.Code)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// GetMFAPolicy returns the MFA policy of an account.
+// @Summary Get an MFA policy
+// @Description Returns the roles that must use MFA in the account and the accounts below it. Omit account_id for the policy that applies to every user. Requires the mfa-policies:read permission on the account.
+// @Tags mfa
+// @Produce json
+// @Security BearerAuth
+// @Param account_id query string false "Account"
+// @Success 200 {object} models.MFAPolicy
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /auth/mfa/policies [get]
+func (h *Handler) GetMFAPolicy(c *gin.Context) {
+	account := c.Query("account_id")
+	if !h.authorize(c, "mfa-policies:read", authz.Resource{Type: "account", ID: account, AccountID: account}) {
+		return
+	}
+	p, err := h.MFA.Policy(c.Request.Context(), account)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// PutMFAPolicy sets the MFA policy of an account.
+// @Summary Set an MFA policy
+// @Description Requires MFA for the given roles ("*" for everyone) in the account and the accounts below it; an empty account_id sets the policy for every user. Affected users without an authenticator must enrol one at their next login. Requires the mfa-policies:update permission on the account.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.MFAPolicyRequest true "Policy"
+// @Success 200 {object} models.MFAPolicy
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /auth/mfa/policies [put]
+func (h *Handler) PutMFAPolicy(c *gin.Context) {
+	var req models.MFAPolicyRequest
+	if !bind(c, &req) {
+		return
+	}
+	if !h.authorize(c, "mfa-policies:update", authz.Resource{Type: "account", ID: req.AccountID, AccountID: req.AccountID}) {
+		return
+	}
+	p, err := h.MFA.SetPolicy(c.Request.Context(), req.AccountID, req.Roles)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"identity/internal/auth"
+	"identity/internal/mfa"
+	"identity/internal/models"
+)
+
+func totpCode(t *testing.T, secret string, offset time.Duration) string {
+	t.Helper()
+	code, err := mfa.Code(secret, mfa.Step(time.Now().Add(offset)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func challenge(t *testing.T, r http.Handler, body, want string) string {
+	t.Helper()
+	rec := do(t, r, http.MethodPost, "/auth/login", body, nil)
+	expectStatus(t, rec, http.StatusForbidden)
+	var ch models.MFAChallengeResponse
+	decodeJSON(t, rec, &ch)
+	if ch.Error != want || ch.MFAToken == "" {
+		t.Fatalf("unexpected challenge: %+v", ch)
+	}
+	return ch.MFAToken
+}
+
+func TestMFA(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	bearer := map[string]string{"Authorization": "Bearer " + login(t, r, "s3cret-passw0rd").AccessToken}
+	loginBody := `{"email":"asha@example.org","password":"s3cret-passw0rd"}`
+
+	rec := do(t, r, http.MethodPost, "/auth/mfa/totp", "", bearer)
+	expectStatus(t, rec, http.StatusOK)
+	var enrollment models.TOTPEnrollment
+	decodeJSON(t, rec, &enrollment)
+
+	// An unconfirmed authenticator does not protect logins.
+	login(t, r, "s3cret-passw0rd")
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/mfa/totp/confirm", `{"code":"000000"}`, bearer), http.StatusUnauthorized)
+	rec = do(t, r, http.MethodPost, "/auth/mfa/totp/confirm", `{"code":"`+totpCode(t, enrollment.Secret, 0)+`"}`, bearer)
+	expectStatus(t, rec, http.StatusOK)
+	var enabled models.MFAEnabledResponse
+	decodeJSON(t, rec, &enabled)
+	if len(enabled.RecoveryCodes) != mfa.RecoveryCodeCount || enabled.Tokens != nil {
+		t.Fatalf("unexpected confirmation: %+v", enabled)
+	}
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/mfa/totp", "", bearer), http.StatusConflict)
+
+	// Logins now need a code, and codes cannot be replayed.
+	token := challenge(t, r, loginBody, models.MFARequired)
+	verify := func(token, code string) *httptest.ResponseRecorder {
+		return do(t, r, http.MethodPost, "/auth/mfa/verify", `{"mfa_token":"`+token+`","code":"`+code+`"}`, nil)
+	}
+	expectStatus(t, verify(token, totpCode(t, enrollment.Secret, 0)), http.StatusUnauthorized)
+	expectStatus(t, verify(token, totpCode(t, enrollment.Secret, mfa.Period)), http.StatusOK)
+	expectStatus(t, verify(token, totpCode(t, enrollment.Secret, mfa.Period)), http.StatusUnauthorized)
+
+	// Recovery codes work once.
+	expectStatus(t, verify(challenge(t, r, loginBody, models.MFARequired), enabled.RecoveryCodes[0]), http.StatusOK)
+	expectStatus(t, verify(challenge(t, r, loginBody, models.MFARequired), enabled.RecoveryCodes[0]), http.StatusUnauthorized)
+
+	rec = do(t, r, http.MethodGet, "/auth/mfa", "", bearer)
+	expectStatus(t, rec, http.StatusOK)
+	var status models.MFAStatus
+	decodeJSON(t, rec, &status)
+	if !status.Enabled || status.Required || status.RecoveryCodesRemaining != mfa.RecoveryCodeCount-1 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	// Wrong codes are counted per user across challenges, so that fresh
+	// logins do not grant fresh guesses: the replayed recovery code above
+	// and four more lock the second factor out, even for a right code.
+	for i := 0; i < 4; i++ {
+		expectStatus(t, verify(challenge(t, r, loginBody, models.MFARequired), "wrong-code"), http.StatusUnauthorized)
+	}
+	for i := 0; i < 3; i++ {
+		expectStatus(t, verify(challenge(t, r, loginBody, models.MFARequired), enabled.RecoveryCodes[1]), http.StatusTooManyRequests)
+	}
+	expectStatus(t, do(t, r, http.MethodDelete, "/auth/mfa", `{"code":"`+enabled.RecoveryCodes[1]+`"}`, bearer), http.StatusTooManyRequests)
+}
+
+func TestMFAChallengeAttempts(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	bearer := map[string]string{"Authorization": "Bearer " + login(t, r, "s3cret-passw0rd").AccessToken}
+	rec := do(t, r, http.MethodPost, "/auth/mfa/totp", "", bearer)
+	var enrollment models.TOTPEnrollment
+	decodeJSON(t, rec, &enrollment)
+	rec = do(t, r, http.MethodPost, "/auth/mfa/totp/confirm", `{"code":"`+totpCode(t, enrollment.Secret, 0)+`"}`, bearer)
+	var enabled models.MFAEnabledResponse
+	decodeJSON(t, rec, &enabled)
+
+	// Of many concurrent guesses on one challenge, only MaxAttempts reach
+	// the code check; the rest are refused as for an expired challenge.
+	token := challenge(t, r, `{"email":"asha@example.org","password":"s3cret-passw0rd"}`, models.MFARequired)
+	body := `{"mfa_token":"` + token + `","code":"wrong-code"}`
+	errs := make(chan string, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/auth/mfa/verify", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			var resp models.ErrorResponse
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			errs <- resp.Error
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var checked int
+	for e := range errs {
+		if e != auth.ErrInvalidToken.Error() {
+			checked++
+		}
+	}
+	if checked != 5 {
+		t.Errorf("%d concurrent codes checked, want 5", checked)
+	}
+	rec = do(t, r, http.MethodPost, "/auth/mfa/verify", `{"mfa_token":"`+token+`","code":"`+enabled.RecoveryCodes[0]+`"}`, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"identity/internal/auth"
+	"identity/internal/models"
+	"identity/internal/token"
+)
+
+// ClaimsKey is the gin context key holding the verified access token claims.
+const ClaimsKey = "identity.claims"
+
+// RequireAuth rejects requests without a valid, unrevoked bearer access
+// token and stores the verified claims under ClaimsKey.
+func RequireAuth(svc *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{Error: "missing bearer token"})
+			return
+		}
+		claims, err := svc.VerifyAccessToken(c.Request.Context(), raw)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{Error: "invalid access token"})
+			return
+		}
+		if err != nil {
+			errorJSON(c, err)
+			return
+		}
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// ClientInfo records the caller's IP address and user agent in the
+// request context for the sessions it starts or uses.
+func ClientInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info := auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+		c.Request = c.Request.WithContext(auth.WithClientInfo(c.Request.Context(), info))
+		c.Next()
+	}
+}
+
+// ClaimsFrom returns the claims stored by RequireAuth.
+func ClaimsFrom(c *gin.Context) *token.Claims {
+	claims, _ := c.Get(ClaimsKey)
+	tc, _ := claims.(*token.Claims)
+	return tc
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, raw, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || raw == "" {
+		return "", false
+	}
+	return strings.TrimSpace(raw), true
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"identity/internal/auth"
+	"identity/internal/lockout"
+	"identity/internal/mfa"
+	"identity/internal/models"
+	"identity/internal/oidc"
+)
+
+// Discovery serves the OpenID Provider Metadata.
+// @Summary OpenID Connect discovery
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} oidc.Discovery
+// @Router /.well-known/openid-configuration [get]
+func (h *Handler) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, h.OIDC.Discovery())
+}
+
+// JWKS serves the public keys that verify tokens.
+// @Summary JSON Web Key Set
+// @Description Public keys that verify access and ID tokens, selected by the kid header. Keys rotate; refetch when a token names an unknown kid.
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} token.JWKS
+// @Router /jwks.json [get]
+func (h *Handler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.Auth.Tokens.Keys().JWKS())
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<h1>Sign in{{if .Client}} to {{.Client}}{{end}}</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post">
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">
+{{end}}<label>Email <input type="email" name="email" value="{{.Email}}" required autofocus></label>
+<label>Password <input type="password" name="password" required></label>
+{{if .MFA}}<label>Authenticator or recovery code <input name="code" autocomplete="one-time-code"></label>
+{{end}}<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign-in error</title></head>
+<body><h1>Sign-in error</h1><p>{{.}}</p></body>
+</html>
+`))
+
+func (h *Handler) renderLogin(c *gin.Context, status int, client *models.Client, req oidc.AuthorizeRequest, email, msg string) {
+	name := client.Name
+	if name == "" {
+		name = client.ID
+	}
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	loginPage.Execute(c.Writer, map[string]interface{}{
+		"Client": name,
+		"Params": req.Values(),
+		"Email":  email,
+		"Error":  msg,
+		"MFA":    h.MFA != nil,
+	})
+}
+
+// validateAuthorize checks an authorization request, writing the error
+// response when it is invalid.
+func (h *Handler) validateAuthorize(c *gin.Context, req *oidc.AuthorizeRequest) (*models.Client, bool) {
+	client, oerr := h.OIDC.ValidateAuthorize(c.Request.Context(), req)
+	if oerr == nil {
+		return client, true
+	}
+	if client == nil {
+		c.Status(oerr.Status)
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		errorPage.Execute(c.Writer, oerr.Description)
+		return nil, false
+	}
+	c.Redirect(http.StatusFound, oidc.ErrorRedirect(*req, oerr))
+	return nil, false
+}
+
+// AuthorizeForm starts the authorization code flow by asking the user to
+// sign in.
+// @Summary Authorization endpoint
+// @Description Starts the authorization code flow. Public clients must send an S256 code_challenge. Renders a sign-in form that posts back to the same URL.
+// @Tags oidc
+// @Produce html
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string false "Registered redirect URI"
+// @Param scope query string false "Space-separated scopes, e.g. openid email"
+// @Param state query string false "Opaque value returned to the client"
+// @Param nonce query string false "Value copied into the ID token"
+// @Param code_challenge query string false "PKCE code challenge"
+// @Param code_challenge_method query string false "Must be S256"
+// @Success 200 {string} string "Sign-in form"
+// @Failure 302 {string} string "Redirect to the client with an error"
+// @Failure 400 {string} string "Unknown client or redirect URI"
+// @Router /oauth2/authorize [get]
+func (h *Handler) AuthorizeForm(c *gin.Context) {
+	req := oidc.ParseAuthorizeRequest(c.Request.URL.Query())
+	client, ok := h.validateAuthorize(c, &req)
+	if !ok {
+		return
+	}
+	h.renderLogin(c, http.StatusOK, client, req, "", "")
+}
+
+// Authorize signs the user in and redirects back to the client with an
+// authorization code.
+// @Summary Complete authorization
+// @Description Verifies the credentials posted by the sign-in form and redirects to the client with a code and the original state.
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param email formData string true "Email"
+// @Param password formData string true "Password"
+// @Param code formData string false "Authenticator or recovery code, for users with MFA"
+// @Success 302 {string} string "Redirect to the client with a code"
+// @Failure 401 {string} string "Sign-in form with an error"
+// @Failure 429 {string} string "Sign-in form reporting a lockout"
+// @Router /oauth2/authorize [post]
+func (h *Handler) Authorize(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		c.String(http.StatusBadRequest, "malformed form")
+		return
+	}
+	req := oidc.ParseAuthorizeRequest(c.Request.PostForm)
+	client, ok := h.validateAuthorize(c, &req)
+	if !ok {
+		return
+	}
+	email := c.PostForm("email")
+	user, err := h.Auth.Authenticate(c.Request.Context(), email, c.PostForm("password"))
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		h.renderLogin(c, http.StatusUnauthorized, client, req, email, "Incorrect email or password.")
+		return
+	}
+	if errors.Is(err, lockout.ErrLocked) {
+		h.renderLogin(c, http.StatusTooManyRequests, client, req, email, "Too many failed attempts. Try again later.")
+		return
+	}
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	if h.MFA != nil {
+		msg, status, err := h.secondFactor(c, user)
+		if err != nil {
+			errorJSON(c, err)
+			return
+		}
+		if msg != "" {
+			h.renderLogin(c, status, client, req, email, msg)
+			return
+		}
+	}
+	location, err := h.OIDC.Authorize(c.Request.Context(), req, user, time.Now())
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, location)
+}
+
+// secondFactor checks the code posted with the sign-in form for users who
+// need one. It returns the message and status to show the form again
+// with, or an empty message when the user may proceed. Users whose roles
+// require MFA but who have no authenticator must enrol through the API
+// first.
+func (h *Handler) secondFactor(c *gin.Context, user *models.User) (string, int, error) {
+	ctx := c.Request.Context()
+	enabled, err := h.MFA.Enabled(ctx, user.ID)
+	if err != nil {
+		return "", 0, err
+	}
+	if !enabled {
+		required, err := h.MFA.Required(ctx, user)
+		if err != nil || !required {
+			return "", 0, err
+		}
+		return "Your account requires two-factor authentication. Set up an authenticator app before signing in to applications.", http.StatusForbidden, nil
+	}
+	code := c.PostForm("code")
+	if code == "" {
+		return "Enter the code from your authenticator app or a recovery code.", http.StatusUnauthorized, nil
+	}
+	err = h.MFA.CheckCode(ctx, user.ID, code)
+	switch {
+	case errors.Is(err, mfa.ErrInvalidCode):
+		return "Incorrect code.", http.StatusUnauthorized, nil
+	case errors.Is(err, lockout.ErrLocked):
+		return "Too many incorrect codes. Try again later.", http.StatusTooManyRequests, nil
+	}
+	return "", 0, err
+}
+
+// authenticateClient resolves the calling client from HTTP Basic
+// credentials or the client_id and client_secret form fields, writing an
+// error response when authentication fails.
+func (h *Handler) authenticateClient(c *gin.Context) (*models.Client, bool) {
+	if err := c.Request.ParseForm(); err != nil {
+		oauthErrorJSON(c, &oidc.Error{Code: "invalid_request", Description: "malformed form", Status: http.StatusBadRequest})
+		return nil, false
+	}
+	id, secret, basic := c.Request.BasicAuth()
+	if !basic {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	client, oerr := h.OIDC.AuthenticateClient(c.Request.Context(), id, secret)
+	if oerr != nil {
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="identity"`)
+		}
+		oauthErrorJSON(c, oerr)
+		return nil, false
+	}
+	return client, true
+}
+
+func oauthErrorJSON(c *gin.Context, e *oidc.Error) {
+	c.Header("Cache-Control", "no-store")
+	c.AbortWithStatusJSON(e.Status, e)
+}
+
+// Token serves the OAuth token endpoint.
+// @Summary Token endpoint
+// @Description Exchanges an authorization code (with code_verifier for PKCE), a refresh token, or client credentials for tokens. Clients authenticate with HTTP Basic or client_id and client_secret form fields; public clients send only client_id.
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token or client_credentials"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI used in the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Requested scopes for client_credentials"
+// @Param client_id formData string false "Client ID"
+// @Param client_secret formData string false "Client secret"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} oidc.Error
+// @Failure 401 {object} oidc.Error
+// @Router /oauth2/token [post]
+func (h *Handler) Token(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	pair, oerr := h.OIDC.Exchange(c.Request.Context(), client, c.Request.PostForm)
+	if oerr != nil {
+		oauthErrorJSON(c, oerr)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, pair)
+}
+
+// UserInfo returns claims about the user named by the access token.
+// @Summary UserInfo endpoint
+// @Tags oidc
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} oidc.UserInfo
+// @Failure 401 {object} models.ErrorResponse
+// @Router /oauth2/userinfo [get]
+func (h *Handler) UserInfo(c *gin.Context) {
+	claims := ClaimsFrom(c)
+	user, err := h.Auth.Store.GetUser(c.Request.Context(), claims.Subject)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, h.OIDC.UserInfo(user, claims))
+}
+
+// Introspect reports whether a token is active (RFC 7662).
+// @Summary Token introspection
+// @Description Confidential clients can check whether an access or refresh token is active, including revocations that offline JWKS validation cannot see.
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to introspect"
+// @Success 200 {object} oidc.Introspection
+// @Failure 401 {object} oidc.Error
+// @Router /oauth2/introspect [post]
+func (h *Handler) Introspect(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	result, oerr := h.OIDC.Introspect(c.Request.Context(), client, c.PostForm("token"))
+	if oerr != nil {
+		oauthErrorJSON(c, oerr)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, result)
+}
+
+// Revoke revokes a token issued to the calling client (RFC 7009).
+// @Summary Token revocation
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "Access or refresh token"
+// @Success 200
+// @Failure 401 {object} oidc.Error
+// @Router /oauth2/revoke [post]
+func (h *Handler) Revoke(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	if oerr := h.OIDC.Revoke(c.Request.Context(), client, c.PostForm("token")); oerr != nil {
+		oauthErrorJSON(c, oerr)
+		return
+	}
+	c.Status(http.StatusOK)
+}
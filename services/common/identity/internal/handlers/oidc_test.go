@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"identity/internal/models"
+	"identity/internal/oidc"
+	"identity/internal/token"
+)
+
+var testClients = []models.ClientConfig{
+	{
+		ClientID:     "web",
+		ClientSecret: "web-secret",
+		RedirectURIs: []string{"https://app.test/cb"},
+		GrantTypes:   []string{models.GrantAuthorizationCode, models.GrantRefreshToken},
+		Scopes:       []string{"openid", "email", "profile"},
+	},
+	{
+		ClientID:     "spa",
+		RedirectURIs: []string{"https://spa.test/cb"},
+		GrantTypes:   []string{models.GrantAuthorizationCode, models.GrantRefreshToken},
+		Scopes:       []string{"openid", "email"},
+	},
+	{
+		ClientID:     "worker",
+		ClientSecret: "worker-secret",
+		GrantTypes:   []string{models.GrantClientCredentials},
+		Scopes:       []string{"accounts:read", "accounts:write"},
+	},
+}
+
+const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func postForm(t *testing.T, r http.Handler, path string, form url.Values, user, pass string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+}
+
+// authorize runs the sign-in form for client and returns the redirect
+// location.
+func authorize(t *testing.T, r http.Handler, params url.Values, password string) *url.URL {
+	t.Helper()
+	form := url.Values{"email": {"asha@example.org"}, "password": {password}}
+	for k, v := range params {
+		form[k] = v
+	}
+	rec := postForm(t, r, "/oauth2/authorize", form, "", "")
+	expectStatus(t, rec, http.StatusFound)
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func spaParams() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"spa"},
+		"redirect_uri":          {"https://spa.test/cb"},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6"},
+		"code_challenge":        {oidc.S256Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func TestDiscoveryAndJWKS(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	rec := do(t, r, http.MethodGet, "/.well-known/openid-configuration", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var disco oidc.Discovery
+	decodeJSON(t, rec, &disco)
+	if disco.Issuer != "http://identity.test" || disco.JWKSURI != "http://identity.test/jwks.json" || disco.TokenEndpoint != "http://identity.test/oauth2/token" {
+		t.Fatalf("unexpected discovery document: %+v", disco)
+	}
+
+	rec = do(t, r, http.MethodGet, "/jwks.json", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var set token.JWKS
+	decodeJSON(t, rec, &set)
+	if len(set.Keys) != 1 {
+		t.Fatalf("JWKS has %d keys, want 1", len(set.Keys))
+	}
+
+	// A token from the service verifies using only the published key.
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	pair := login(t, r, "s3cret-passw0rd")
+	jwk := set.Keys[0]
+	n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	parsed, err := jwt.Parse(pair.AccessToken, func(tok *jwt.Token) (interface{}, error) {
+		if tok.Header["kid"] != jwk.KeyID {
+			t.Errorf("kid = %v, want %s", tok.Header["kid"], jwk.KeyID)
+		}
+		return pub, nil
+	}, jwt.WithIssuer(disco.Issuer), jwt.WithAudience("digit"))
+	if err != nil || !parsed.Valid {
+		t.Fatalf("offline verification failed: %v", err)
+	}
+}
+
+func TestAuthorizationCodePKCE(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+
+	// Unknown redirect URIs are never redirected to.
+	bad := spaParams()
+	bad.Set("redirect_uri", "https://evil.test/cb")
+	expectStatus(t, do(t, r, http.MethodGet, "/oauth2/authorize?"+bad.Encode(), "", nil), http.StatusBadRequest)
+
+	// Public clients must use PKCE.
+	noPKCE := spaParams()
+	noPKCE.Del("code_challenge")
+	rec := do(t, r, http.MethodGet, "/oauth2/authorize?"+noPKCE.Encode(), "", nil)
+	expectStatus(t, rec, http.StatusFound)
+	if loc := rec.Header().Get("Location"); !strings.Contains(loc, "error=invalid_request") || !strings.Contains(loc, "state=xyz") {
+		t.Fatalf("Location = %s", loc)
+	}
+
+	rec = do(t, r, http.MethodGet, "/oauth2/authorize?"+spaParams().Encode(), "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), `name="code_challenge"`) {
+		t.Fatal("sign-in form does not carry the authorization request")
+	}
+
+	form := spaParams()
+	form.Set("email", "asha@example.org")
+	form.Set("password", "wrong-password")
+	expectStatus(t, postForm(t, r, "/oauth2/authorize", form, "", ""), http.StatusUnauthorized)
+
+	loc := authorize(t, r, spaParams(), "s3cret-passw0rd")
+	if loc.Host != "spa.test" || loc.Query().Get("state") != "xyz" || loc.Query().Get("code") == "" {
+		t.Fatalf("unexpected redirect %s", loc)
+	}
+	code := loc.Query().Get("code")
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"spa"},
+		"code":          {code},
+		"redirect_uri":  {"https://spa.test/cb"},
+		"code_verifier": {verifier},
+	}
+	rec = postForm(t, r, "/oauth2/token", exchange, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	var pair models.TokenPair
+	decodeJSON(t, rec, &pair)
+	if pair.IDToken == "" || pair.RefreshToken == "" || pair.Scope != "openid email" {
+		t.Fatalf("unexpected token response: %+v", pair)
+	}
+	var id token.IDClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(pair.IDToken, &id); err != nil {
+		t.Fatal(err)
+	}
+	if id.Nonce != "n-0S6" || id.Email != "asha@example.org" || len(id.Audience) != 1 || id.Audience[0] != "spa" {
+		t.Errorf("unexpected ID token claims: %+v", id)
+	}
+
+	// Codes are single use.
+	rec = postForm(t, r, "/oauth2/token", exchange, "", "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	var oerr oidc.Error
+	decodeJSON(t, rec, &oerr)
+	if oerr.Code != "invalid_grant" {
+		t.Errorf("error = %q, want invalid_grant", oerr.Code)
+	}
+
+	// A wrong verifier is rejected.
+	exchange.Set("code", authorize(t, r, spaParams(), "s3cret-passw0rd").Query().Get("code"))
+	exchange.Set("code_verifier", strings.Repeat("a", 43))
+	expectStatus(t, postForm(t, r, "/oauth2/token", exchange, "", ""), http.StatusBadRequest)
+
+	// Client refresh tokens are redeemed at the token endpoint by the same
+	// client only.
+	expectStatus(t, refresh(t, r, pair.RefreshToken), http.StatusUnauthorized)
+	rec = postForm(t, r, "/oauth2/token", url.Values{
+		"grant_type": {"refresh_token"}, "client_id": {"spa"}, "refresh_token": {pair.RefreshToken},
+	}, "", "")
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = do(t, r, http.MethodGet, "/oauth2/userinfo", "", map[string]string{"Authorization": "Bearer " + pair.AccessToken})
+	expectStatus(t, rec, http.StatusOK)
+	var info oidc.UserInfo
+	decodeJSON(t, rec, &info)
+	if info.Email != "asha@example.org" || info.Name != "" {
+		t.Errorf("userinfo released %+v for scope openid email", info)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	rec := postForm(t, r, "/oauth2/token", url.Values{"grant_type": {"client_credentials"}}, "worker", "worker-secret")
+	expectStatus(t, rec, http.StatusOK)
+	var pair models.TokenPair
+	decodeJSON(t, rec, &pair)
+	if pair.Scope != "accounts:read accounts:write" || pair.RefreshToken != "" {
+		t.Fatalf("unexpected token response: %+v", pair)
+	}
+
+	rec = postForm(t, r, "/oauth2/token", url.Values{"grant_type": {"client_credentials"}, "scope": {"accounts:read"},
+		"client_id": {"worker"}, "client_secret": {"worker-secret"}}, "", "")
+	expectStatus(t, rec, http.StatusOK)
+
+	expectStatus(t, postForm(t, r, "/oauth2/token", url.Values{"grant_type": {"client_credentials"}}, "worker", "nope"), http.StatusUnauthorized)
+	expectStatus(t, postForm(t, r, "/oauth2/token", url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}}, "worker", "worker-secret"), http.StatusBadRequest)
+	expectStatus(t, postForm(t, r, "/oauth2/token", url.Values{"grant_type": {"client_credentials"}, "client_id": {"spa"}}, "", ""), http.StatusBadRequest)
+	expectStatus(t, postForm(t, r, "/oauth2/token", url.Values{"grant_type": {"password"}}, "worker", "worker-secret"), http.StatusBadRequest)
+}
+
+func TestIntrospectAndRevoke(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+
+	// Confidential clients may skip PKCE.
+	loc := authorize(t, r, url.Values{
+		"response_type": {"code"}, "client_id": {"web"}, "scope": {"openid profile"},
+	}, "s3cret-passw0rd")
+	rec := postForm(t, r, "/oauth2/token", url.Values{
+		"grant_type": {"authorization_code"}, "code": {loc.Query().Get("code")}, "redirect_uri": {"https://app.test/cb"},
+	}, "web", "web-secret")
+	expectStatus(t, rec, http.StatusOK)
+	var pair models.TokenPair
+	decodeJSON(t, rec, &pair)
+
+	introspect := func(tok string) oidc.Introspection {
+		t.Helper()
+		rec := postForm(t, r, "/oauth2/introspect", url.Values{"token": {tok}}, "web", "web-secret")
+		expectStatus(t, rec, http.StatusOK)
+		var result oidc.Introspection
+		decodeJSON(t, rec, &result)
+		return result
+	}
+
+	if got := introspect(pair.AccessToken); !got.Active || got.ClientID != "web" || got.TokenType != "access_token" {
+		t.Fatalf("introspect access token = %+v", got)
+	}
+	if got := introspect(pair.RefreshToken); !got.Active || got.TokenType != "refresh_token" {
+		t.Fatalf("introspect refresh token = %+v", got)
+	}
+	if got := introspect("garbage"); got.Active {
+		t.Fatal("garbage token reported active")
+	}
+	expectStatus(t, postForm(t, r, "/oauth2/introspect", url.Values{"token": {pair.AccessToken}, "client_id": {"spa"}}, "", ""), http.StatusUnauthorized)
+
+	// Other clients cannot revoke the tokens.
+	expectStatus(t, postForm(t, r, "/oauth2/revoke", url.Values{"token": {pair.AccessToken}, "client_id": {"spa"}}, "", ""), http.StatusOK)
+	if !introspect(pair.AccessToken).Active {
+		t.Fatal("token revoked by another client")
+	}
+
+	expectStatus(t, postForm(t, r, "/oauth2/revoke", url.Values{"token": {pair.AccessToken}}, "web", "web-secret"), http.StatusOK)
+	if introspect(pair.AccessToken).Active {
+		t.Fatal("revoked access token still active")
+	}
+	expectStatus(t, do(t, r, http.MethodGet, "/oauth2/userinfo", "", map[string]string{"Authorization": "Bearer " + pair.AccessToken}), http.StatusUnauthorized)
+
+	expectStatus(t, postForm(t, r, "/oauth2/revoke", url.Values{"token": {pair.RefreshToken}}, "web", "web-secret"), http.StatusOK)
+	if introspect(pair.RefreshToken).Active {
+		t.Fatal("revoked refresh token still active")
+	}
+	expectStatus(t, postForm(t, r, "/oauth2/token", url.Values{
+		"grant_type": {"refresh_token"}, "refresh_token": {pair.RefreshToken},
+	}, "web", "web-secret"), http.StatusBadRequest)
+}
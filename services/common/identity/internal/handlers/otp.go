@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"identity/internal/models"
+)
+
+// RequestOTP sends a one-time password to a mobile.
+// @Summary Request a one-time password
+// @Description Sends a code by SMS to the mobile, replacing any code sent before. Codes can be requested again after resend_in seconds and a few times an hour per mobile and client IP; beyond that the response is 429 with Retry-After.
+// @Tags citizens
+// @Accept json
+// @Produce json
+// @Param request body models.OTPRequest true "Mobile number"
+// @Success 202 {object} models.OTPSentResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /auth/otp/request [post]
+func (h *Handler) RequestOTP(c *gin.Context) {
+	var req models.OTPRequest
+	if !bind(c, &req) {
+		return
+	}
+	resp, err := h.OTP.Request(c.Request.Context(), req.Mobile)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// VerifyOTP exchanges a one-time password for a token pair.
+// @Summary Sign in with a one-time password
+// @Description Returns a token pair for the citizen with the mobile, registering them with the citizen role on first login. Each code works once and is dropped after five wrong guesses. Mobiles of users who sign in with a password are refused.
+// @Tags citizens
+// @Accept json
+// @Produce json
+// @Param request body models.OTPVerifyRequest true "Mobile and code"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /auth/otp/verify [post]
+func (h *Handler) VerifyOTP(c *gin.Context) {
+	var req models.OTPVerifyRequest
+	if !bind(c, &req) {
+		return
+	}
+	pair, err := h.OTP.Verify(c.Request.Context(), req)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pair)
+}
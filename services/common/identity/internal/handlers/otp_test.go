@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"identity/internal/models"
+)
+
+func TestOTPLogin(t *testing.T) {
+	r, n := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/otp/request", `{"mobile":"98765"}`, nil), http.StatusBadRequest)
+	rec := do(t, r, http.MethodPost, "/auth/otp/request", `{"mobile":"+91 98765-43210"}`, nil)
+	expectStatus(t, rec, http.StatusAccepted)
+	var sent models.OTPSentResponse
+	decodeJSON(t, rec, &sent)
+	if len(n.otp) != 6 || sent.ExpiresIn != 300 || sent.ResendIn != 30 {
+		t.Fatalf("unexpected OTP %q, response %+v", n.otp, sent)
+	}
+	rec = do(t, r, http.MethodPost, "/auth/otp/request", `{"mobile":"+919876543210"}`, nil)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("missing Retry-After")
+	}
+
+	wrong := "000000"
+	if n.otp == wrong {
+		wrong = "111111"
+	}
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/otp/verify", `{"mobile":"+919876543210","code":"`+wrong+`"}`, nil), http.StatusUnauthorized)
+	body := `{"mobile":"+919876543210","code":"` + n.otp + `","name":"Meena"}`
+	rec = do(t, r, http.MethodPost, "/auth/otp/verify", body, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var pair models.TokenPair
+	decodeJSON(t, rec, &pair)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/otp/verify", body, nil), http.StatusUnauthorized)
+
+	rec = do(t, r, http.MethodGet, "/auth/me", "", map[string]string{"Authorization": "Bearer " + pair.AccessToken})
+	expectStatus(t, rec, http.StatusOK)
+	var me models.User
+	decodeJSON(t, rec, &me)
+	if me.Mobile != "+919876543210" || me.Name != "Meena" || len(me.Roles) != 1 || me.Roles[0] != models.RoleCitizen {
+		t.Fatalf("unexpected citizen: %+v", me)
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/digitnxt/digit/pkg/authz"
+	"github.com/gin-gonic/gin"
+
+	"identity/internal/models"
+)
+
+// ListSessions returns the caller's active sessions.
+// @Summary List my sessions
+// @Description Returns the signed-in user's active sessions with their device, IP address and last activity, newest first. The session of the presented token is marked current.
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Session
+// @Failure 401 {object} models.ErrorResponse
+// @Router /auth/sessions [get]
+func (h *Handler) ListSessions(c *gin.Context) {
+	claims := ClaimsFrom(c)
+	sessions, err := h.Auth.Sessions(c.Request.Context(), claims.Subject, claims.SessionID)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession signs the caller out of one of their sessions.
+// @Summary Revoke one of my sessions
+// @Description Signs the session out: its refresh token stops working at once and its access tokens stop working at this service.
+// @Tags sessions
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 204
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /auth/sessions/{id} [delete]
+func (h *Handler) RevokeSession(c *gin.Context) {
+	if err := h.Auth.RevokeSession(c.Request.Context(), ClaimsFrom(c).Subject, c.Param("id")); err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeOtherSessions signs the caller out everywhere else.
+// @Summary Revoke my other sessions
+// @Description Signs out every session of the signed-in user except the current one.
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SessionsRevokedResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /auth/sessions [delete]
+func (h *Handler) RevokeOtherSessions(c *gin.Context) {
+	claims := ClaimsFrom(c)
+	n, err := h.Auth.RevokeOtherSessions(c.Request.Context(), claims.Subject, claims.SessionID)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SessionsRevokedResponse{Revoked: n})
+}
+
+// authorizeUser checks the caller may perform action on the user named by
+// the id path parameter.
+func (h *Handler) authorizeUser(c *gin.Context, action string) (*models.User, bool) {
+	user, err := h.Auth.Store.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		errorJSON(c, err)
+		return nil, false
+	}
+	if !h.authorize(c, action, authz.Resource{Type: "user", ID: user.ID, AccountID: user.AccountID}) {
+		return nil, false
+	}
+	return user, true
+}
+
+// ListUserSessions returns a user's active sessions.
+// @Summary List a user's sessions
+// @Description Requires the sessions:read permission on the user.
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {array} models.Session
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /users/{id}/sessions [get]
+func (h *Handler) ListUserSessions(c *gin.Context) {
+	user, ok := h.authorizeUser(c, "sessions:read")
+	if !ok {
+		return
+	}
+	sessions, err := h.Auth.Sessions(c.Request.Context(), user.ID, ClaimsFrom(c).SessionID)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeUserSessions signs a user out everywhere.
+// @Summary Force-logout a user
+// @Description Signs out every session of the user. Requires the sessions:revoke permission on the user.
+// @Tags sessions
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /users/{id}/sessions [delete]
+func (h *Handler) RevokeUserSessions(c *gin.Context) {
+	user, ok := h.authorizeUser(c, "sessions:revoke")
+	if !ok {
+		return
+	}
+	if err := h.Auth.RevokeUserSessions(c.Request.Context(), user.ID); err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetSessionPolicy returns the session policy of an account.
+// @Summary Get a session policy
+// @Description Returns the session timeouts, in seconds, set on the account. Omit account_id for the policy that applies to every user. Requires the session-policies:read permission on the account.
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Param account_id query string false "Account"
+// @Success 200 {object} models.SessionPolicy
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /auth/session-policies [get]
+func (h *Handler) GetSessionPolicy(c *gin.Context) {
+	account := c.Query("account_id")
+	if !h.authorize(c, "session-policies:read", authz.Resource{Type: "account", ID: account, AccountID: account}) {
+		return
+	}
+	p, err := h.Auth.SessionPolicy(c.Request.Context(), account)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// PutSessionPolicy sets the session policy of an account.
+// @Summary Set a session policy
+// @Description Sets the idle and absolute session timeouts, in seconds, in the account and the accounts below it; an empty account_id sets them for every user. Zero inherits the timeout from the enclosing account or the service default. Existing sessions are held to the new timeouts on their next use. Requires the session-policies:update permission on the account.
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.SessionPolicyRequest true "Policy"
+// @Success 200 {object} models.SessionPolicy
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /auth/session-policies [put]
+func (h *Handler) PutSessionPolicy(c *gin.Context) {
+	var req models.SessionPolicyRequest
+	if !bind(c, &req) {
+		return
+	}
+	if !h.authorize(c, "session-policies:update", authz.Resource{Type: "account", ID: req.AccountID, AccountID: req.AccountID}) {
+		return
+	}
+	p, err := h.Auth.SetSessionPolicy(c.Request.Context(), req)
+	if err != nil {
+		errorJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"identity/internal/models"
+)
+
+func TestSessions(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	phone := map[string]string{"User-Agent": "Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 Chrome/126.0 Mobile Safari/537.36"}
+	rec := do(t, r, http.MethodPost, "/auth/login", `{"email":"asha@example.org","password":"s3cret-passw0rd"}`, phone)
+	expectStatus(t, rec, http.StatusOK)
+	var other models.TokenPair
+	decodeJSON(t, rec, &other)
+	pair := login(t, r, "s3cret-passw0rd")
+	bearer := map[string]string{"Authorization": "Bearer " + pair.AccessToken}
+
+	rec = do(t, r, http.MethodGet, "/auth/sessions", "", bearer)
+	expectStatus(t, rec, http.StatusOK)
+	var sessions []models.Session
+	decodeJSON(t, rec, &sessions)
+	if len(sessions) != 2 || !sessions[0].Current || sessions[1].Current {
+		t.Fatalf("unexpected sessions: %+v", sessions)
+	}
+	if sessions[1].Device != "Chrome on Android" || sessions[1].IP == "" || sessions[1].ExpiresAt.IsZero() {
+		t.Fatalf("unexpected session: %+v", sessions[1])
+	}
+
+	// Revoking a session ends both its refresh and access tokens.
+	expectStatus(t, do(t, r, http.MethodDelete, "/auth/sessions/"+sessions[1].ID, "", bearer), http.StatusNoContent)
+	expectStatus(t, refresh(t, r, other.RefreshToken), http.StatusUnauthorized)
+	expectStatus(t, do(t, r, http.MethodGet, "/auth/me", "", map[string]string{"Authorization": "Bearer " + other.AccessToken}), http.StatusUnauthorized)
+	expectStatus(t, do(t, r, http.MethodDelete, "/auth/sessions/unknown", "", bearer), http.StatusNotFound)
+
+	login(t, r, "s3cret-passw0rd")
+	rec = do(t, r, http.MethodDelete, "/auth/sessions", "", bearer)
+	expectStatus(t, rec, http.StatusOK)
+	var revoked models.SessionsRevokedResponse
+	decodeJSON(t, rec, &revoked)
+	if revoked.Revoked != 1 {
+		t.Fatalf("revoked %d sessions, want 1", revoked.Revoked)
+	}
+
+	// Force-logout ends every session of the user.
+	rec = do(t, r, http.MethodGet, "/auth/me", "", bearer)
+	var me models.User
+	decodeJSON(t, rec, &me)
+	rec = do(t, r, http.MethodGet, "/users/"+me.ID+"/sessions", "", bearer)
+	expectStatus(t, rec, http.StatusOK)
+	decodeJSON(t, rec, &sessions)
+	if len(sessions) != 1 {
+		t.Fatalf("unexpected sessions: %+v", sessions)
+	}
+	expectStatus(t, do(t, r, http.MethodDelete, "/users/"+me.ID+"/sessions", "", bearer), http.StatusNoContent)
+	expectStatus(t, refresh(t, r, pair.RefreshToken), http.StatusUnauthorized)
+	expectStatus(t, do(t, r, http.MethodGet, "/auth/me", "", bearer), http.StatusUnauthorized)
+}
+
+func TestSessionPolicy(t *testing.T) {
+	r, _ := newTestRouter(t)
+	expectStatus(t, do(t, r, http.MethodPost, "/auth/register", registerBody, nil), http.StatusCreated)
+	bearer := map[string]string{"Authorization": "Bearer " + login(t, r, "s3cret-passw0rd").AccessToken}
+
+	expectStatus(t, do(t, r, http.MethodGet, "/auth/session-policies", "", bearer), http.StatusNotFound)
+	expectStatus(t, do(t, r, http.MethodPut, "/auth/session-policies", `{"idle_timeout":-1}`, bearer), http.StatusBadRequest)
+	expectStatus(t, do(t, r, http.MethodPut, "/auth/session-policies", `{"idle_timeout":600,"absolute_timeout":3600}`, bearer), http.StatusOK)
+	rec := do(t, r, http.MethodGet, "/auth/session-policies", "", bearer)
+	expectStatus(t, rec, http.StatusOK)
+	var policy models.SessionPolicy
+	decodeJSON(t, rec, &policy)
+	if policy.IdleTimeout != 600 || policy.AbsoluteTimeout != 3600 {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+
+	rec = do(t, r, http.MethodGet, "/auth/sessions", "", bearer)
+	var sessions []models.Session
+	decodeJSON(t, rec, &sessions)
+	if len(sessions) != 1 || sessions[0].ExpiresAt.Sub(sessions[0].CreatedAt).Seconds() != 3600 {
+		t.Fatalf("unexpected sessions: %+v", sessions)
+	}
+}
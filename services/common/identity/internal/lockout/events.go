@@ -0,0 +1,73 @@
+package lockout
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/digitnxt/digit/pkg/observability"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Security event types.
+const (
+	EventLoginFailure  = "login_failure"
+	EventLockout       = "lockout"
+	EventLockedAttempt = "locked_attempt"
+	EventUnlock        = "unlock"
+	EventMFAFailure    = "mfa_failure"
+)
+
+// Event is a security event recorded by a Guard. User is empty for events
+// about an IP alone.
+type Event struct {
+	Type     string    `json:"type"`
+	User     string    `json:"user,omitempty"`
+	IP       string    `json:"ip,omitempty"`
+	Failures int       `json:"failures,omitempty"`
+	Until    time.Time `json:"until,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// SecurityEvents counts security events by type. It is replaced by
+// RegisterMetrics, in the service's metric namespace.
+var SecurityEvents = newSecurityEvents(observability.DefaultNamespace)
+
+func newSecurityEvents(namespace string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "identity_security_events_total",
+			Help:      "Total number of identity security events such as failed logins and lockouts",
+		},
+		[]string{"event"},
+	)
+}
+
+// RegisterMetrics creates the security event metrics in namespace, as
+// config.Service.MetricsNamespace, and registers them with reg. It must be
+// called before the metrics are used.
+func RegisterMetrics(reg prometheus.Registerer, namespace string) {
+	SecurityEvents = newSecurityEvents(namespace)
+	reg.MustRegister(SecurityEvents)
+}
+
+// Audit counts e in SecurityEvents and writes it to the service log as a
+// "security event" record marked audit=true.
+func Audit(ctx context.Context, e Event) {
+	SecurityEvents.WithLabelValues(e.Type).Inc()
+	attrs := []slog.Attr{slog.Bool("audit", true), slog.String("type", e.Type)}
+	if e.User != "" {
+		attrs = append(attrs, slog.String("user", e.User))
+	}
+	if e.IP != "" {
+		attrs = append(attrs, slog.String("ip", e.IP))
+	}
+	if e.Failures != 0 {
+		attrs = append(attrs, slog.Int("failures", e.Failures))
+	}
+	if !e.Until.IsZero() {
+		attrs = append(attrs, slog.Time("until", e.Until))
+	}
+	slog.LogAttrs(ctx, slog.LevelInfo, "security event", attrs...)
+}
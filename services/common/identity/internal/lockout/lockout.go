@@ -0,0 +1,257 @@
+// Package lockout protects password logins against brute force and
+// credential stuffing. Failed attempts are counted per user and per client
+// IP; past a threshold the user or IP is locked out for a period that
+// doubles with every further failure, and clients are told to show a
+// CAPTCHA.
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLocked is returned while a user or IP is locked out.
+var ErrLocked = errors.New("too many failed login attempts")
+
+// LockedError reports a lockout and when it ends.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v; try again after %s", ErrLocked, e.Until.UTC().Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error { return ErrLocked }
+
+// RetryAfter returns how long until the lockout ends, rounded up to a
+// second.
+func (e *LockedError) RetryAfter(now time.Time) time.Duration {
+	d := e.Until.Sub(now).Round(time.Second)
+	if d < time.Second {
+		d = time.Second
+	}
+	return d
+}
+
+// CaptchaError wraps a failed login after which the client should solve a
+// CAPTCHA before trying again.
+type CaptchaError struct {
+	Err error
+}
+
+func (e *CaptchaError) Error() string { return e.Err.Error() }
+
+func (e *CaptchaError) Unwrap() error { return e.Err }
+
+// Store keeps failure counts and lockouts. Keys expire on their own so
+// that stores need no cleanup.
+type Store interface {
+	// Fail increments the failures of key and returns the count. The
+	// count resets window after the first failure.
+	Fail(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock locks key until until.
+	Lock(ctx context.Context, key string, until time.Time) error
+	// LockedUntil returns when the lock on key ends, or the zero time when
+	// key is not locked.
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+	// Reset clears the failures and lock of key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Config configures a Guard.
+type Config struct {
+	// UserThreshold is the number of failures after which a user is
+	// locked out. Zero means 5.
+	UserThreshold int
+	// IPThreshold is the number of failures after which a client IP is
+	// locked out. Zero means 50.
+	IPThreshold int
+	// CaptchaThreshold is the number of failures for a user or IP after
+	// which clients should show a CAPTCHA. Zero means 3.
+	CaptchaThreshold int
+	// Lockout is the first lockout period, doubled on each further
+	// failure. Zero means a minute.
+	Lockout time.Duration
+	// MaxLockout caps the lockout period. Zero means an hour.
+	MaxLockout time.Duration
+	// Window is how long failures are remembered. Zero means a day.
+	Window time.Duration
+}
+
+// Guard tracks failed logins.
+type Guard struct {
+	Store Store
+	// Record receives the security events. Nil means Audit.
+	Record func(ctx context.Context, e Event)
+
+	cfg Config
+	now func() time.Time
+}
+
+// NewGuard returns a Guard keeping its state in store.
+func NewGuard(store Store, cfg Config) *Guard {
+	if cfg.UserThreshold == 0 {
+		cfg.UserThreshold = 5
+	}
+	if cfg.IPThreshold == 0 {
+		cfg.IPThreshold = 50
+	}
+	if cfg.CaptchaThreshold == 0 {
+		cfg.CaptchaThreshold = 3
+	}
+	if cfg.Lockout == 0 {
+		cfg.Lockout = time.Minute
+	}
+	if cfg.MaxLockout == 0 {
+		cfg.MaxLockout = time.Hour
+	}
+	if cfg.Window == 0 {
+		cfg.Window = 24 * time.Hour
+	}
+	return &Guard{Store: store, Record: Audit, cfg: cfg, now: time.Now}
+}
+
+func userKey(user string) string  { return "user:" + user }
+func ipKey(ip string) string      { return "ip:" + ip }
+func mfaKey(userID string) string { return "mfa:" + userID }
+
+// Check returns a LockedError if user or ip is locked out. Attempts made
+// while locked out are not counted, so that they do not extend the
+// lockout of a user under attack.
+func (g *Guard) Check(ctx context.Context, user, ip string) error {
+	keys := []string{userKey(user)}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	var until time.Time
+	for _, key := range keys {
+		t, err := g.Store.LockedUntil(ctx, key)
+		if err != nil {
+			return err
+		}
+		if t.After(until) {
+			until = t
+		}
+	}
+	if until.After(g.now()) {
+		g.record(ctx, Event{Type: EventLockedAttempt, User: user, IP: ip, Until: until})
+		return &LockedError{Until: until}
+	}
+	return nil
+}
+
+// Fail records a failed login of user from ip, locking either out once
+// past its threshold, and wraps err in a CaptchaError once the CAPTCHA
+// threshold is reached.
+func (g *Guard) Fail(ctx context.Context, user, ip string, err error) error {
+	n, lockErr := g.fail(ctx, userKey(user), g.cfg.UserThreshold, Event{Type: EventLockout, User: user, IP: ip})
+	if lockErr != nil {
+		return lockErr
+	}
+	g.record(ctx, Event{Type: EventLoginFailure, User: user, IP: ip, Failures: n})
+	captcha := n >= g.cfg.CaptchaThreshold
+	if ip != "" {
+		m, lockErr := g.fail(ctx, ipKey(ip), g.cfg.IPThreshold, Event{Type: EventLockout, IP: ip})
+		if lockErr != nil {
+			return lockErr
+		}
+		captcha = captcha || m >= g.cfg.CaptchaThreshold
+	}
+	if captcha {
+		return &CaptchaError{Err: err}
+	}
+	return err
+}
+
+// fail counts a failure of key and locks it out once past threshold,
+// recording locked.
+func (g *Guard) fail(ctx context.Context, key string, threshold int, locked Event) (int, error) {
+	n, err := g.Store.Fail(ctx, key, g.cfg.Window)
+	if err != nil {
+		return 0, err
+	}
+	if n < threshold {
+		return n, nil
+	}
+	d := g.cfg.Lockout
+	for i := threshold; i < n && d < g.cfg.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > g.cfg.MaxLockout {
+		d = g.cfg.MaxLockout
+	}
+	locked.Failures = n
+	locked.Until = g.now().Add(d)
+	if err := g.Store.Lock(ctx, key, locked.Until); err != nil {
+		return 0, err
+	}
+	g.record(ctx, locked)
+	return n, nil
+}
+
+// Succeed clears the failures of user after a successful login. Failures
+// of the IP are kept, so that an attacker cannot reset them by signing in
+// to an account of their own.
+func (g *Guard) Succeed(ctx context.Context, user string) error {
+	return g.Store.Reset(ctx, userKey(user))
+}
+
+// Unlock clears the failures and lockout of user.
+func (g *Guard) Unlock(ctx context.Context, user string) error {
+	if err := g.Store.Reset(ctx, userKey(user)); err != nil {
+		return err
+	}
+	g.record(ctx, Event{Type: EventUnlock, User: user})
+	return nil
+}
+
+// CheckMFA returns a LockedError while the second factor of the user
+// userID is locked out. Second-factor codes are counted per user ID,
+// apart from passwords, so that knowing the password does not reset them.
+func (g *Guard) CheckMFA(ctx context.Context, userID string) error {
+	until, err := g.Store.LockedUntil(ctx, mfaKey(userID))
+	if err != nil {
+		return err
+	}
+	if until.After(g.now()) {
+		g.record(ctx, Event{Type: EventLockedAttempt, User: userID, Until: until})
+		return &LockedError{Until: until}
+	}
+	return nil
+}
+
+// FailMFA records a wrong second-factor code of the user userID, locking
+// their second factor out once past the user threshold, and returns err.
+func (g *Guard) FailMFA(ctx context.Context, userID string, err error) error {
+	n, lockErr := g.fail(ctx, mfaKey(userID), g.cfg.UserThreshold, Event{Type: EventLockout, User: userID})
+	if lockErr != nil {
+		return lockErr
+	}
+	g.record(ctx, Event{Type: EventMFAFailure, User: userID, Failures: n})
+	return err
+}
+
+// SucceedMFA clears the second-factor failures of the user userID.
+func (g *Guard) SucceedMFA(ctx context.Context, userID string) error {
+	return g.Store.Reset(ctx, mfaKey(userID))
+}
+
+// UnlockMFA clears the second-factor failures and lockout of the user
+// userID.
+func (g *Guard) UnlockMFA(ctx context.Context, userID string) error {
+	if err := g.Store.Reset(ctx, mfaKey(userID)); err != nil {
+		return err
+	}
+	g.record(ctx, Event{Type: EventUnlock, User: userID})
+	return nil
+}
+
+func (g *Guard) record(ctx context.Context, e Event) {
+	e.Time = g.now().UTC()
+	if g.Record != nil {
+		g.Record(ctx, e)
+	}
+}
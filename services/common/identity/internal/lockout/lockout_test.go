@@ -0,0 +1,115 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errBadPassword = errors.New("bad password")
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	g := NewGuard(store, Config{UserThreshold: 3, IPThreshold: 5, CaptchaThreshold: 2})
+	g.now = store.now
+	var events []Event
+	g.Record = func(_ context.Context, e Event) { events = append(events, e) }
+
+	if err := g.Fail(ctx, "asha", "10.0.0.1", errBadPassword); err != errBadPassword {
+		t.Fatalf("first failure = %v", err)
+	}
+	var captcha *CaptchaError
+	if err := g.Fail(ctx, "asha", "10.0.0.1", errBadPassword); !errors.As(err, &captcha) || !errors.Is(err, errBadPassword) {
+		t.Fatalf("second failure = %v", err)
+	}
+	g.Fail(ctx, "asha", "10.0.0.1", errBadPassword)
+	var locked *LockedError
+	if err := g.Check(ctx, "asha", "10.0.0.2"); !errors.As(err, &locked) || !locked.Until.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Check after lockout = %v", err)
+	}
+	if err := g.Check(ctx, "ravi", "10.0.0.1"); err != nil {
+		t.Fatalf("Check of another user = %v", err)
+	}
+
+	// Each further failure doubles the lockout.
+	now = now.Add(2 * time.Minute)
+	if err := g.Check(ctx, "asha", ""); err != nil {
+		t.Fatalf("Check after lockout ends = %v", err)
+	}
+	g.Fail(ctx, "asha", "", errBadPassword)
+	if err := g.Check(ctx, "asha", ""); !errors.As(err, &locked) || !locked.Until.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("Check after second lockout = %v", err)
+	}
+
+	// Failures across users lock out the IP.
+	g.Fail(ctx, "ravi", "10.0.0.1", errBadPassword)
+	g.Fail(ctx, "meena", "10.0.0.1", errBadPassword)
+	if err := g.Check(ctx, "joseph", "10.0.0.1"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Check from locked IP = %v", err)
+	}
+
+	if err := g.Unlock(ctx, "asha"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(ctx, "asha", ""); err != nil {
+		t.Fatalf("Check after unlock = %v", err)
+	}
+	counts := map[string]int{}
+	for _, e := range events {
+		counts[e.Type]++
+	}
+	if counts[EventLockout] != 3 || counts[EventLockedAttempt] != 3 || counts[EventUnlock] != 1 || counts[EventLoginFailure] != 6 {
+		t.Fatalf("unexpected events: %v", counts)
+	}
+}
+
+// downStore fails every call.
+type downStore struct{}
+
+var errDown = errors.New("connection refused")
+
+func (downStore) Fail(context.Context, string, time.Duration) (int, error) { return 0, errDown }
+func (downStore) Lock(context.Context, string, time.Time) error            { return errDown }
+func (downStore) LockedUntil(context.Context, string) (time.Time, error)   { return time.Time{}, errDown }
+func (downStore) Reset(context.Context, string) error                      { return errDown }
+
+func TestFallbackStore(t *testing.T) {
+	ctx := context.Background()
+	g := NewGuard(NewFallbackStore(downStore{}), Config{UserThreshold: 1})
+	g.Record = nil
+	g.Fail(ctx, "asha", "", errBadPassword)
+	if err := g.Check(ctx, "asha", ""); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Check with Redis down = %v", err)
+	}
+}
+
+func TestMemoryStoreBounded(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryStore()
+	store.MaxEntries = 10
+	store.now = func() time.Time { return now }
+
+	store.Lock(ctx, "user:asha", now.Add(time.Hour))
+	for i := 0; i < 100; i++ {
+		store.Fail(ctx, fmt.Sprintf("user:%d", i), time.Minute)
+	}
+	if n := len(store.entries); n > 10 {
+		t.Errorf("%d entries, want at most 10", n)
+	}
+	if until, _ := store.LockedUntil(ctx, "user:asha"); until.IsZero() {
+		t.Error("lock evicted by new keys")
+	}
+
+	// Expired keys are swept once the sweep interval has passed.
+	now = now.Add(2 * time.Minute)
+	store.Fail(ctx, "user:ravi", time.Minute)
+	if n := len(store.entries); n != 2 {
+		t.Errorf("%d entries after sweep, want 2", n)
+	}
+}
@@ -0,0 +1,249 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Defaults of a MemoryStore.
+const (
+	// DefaultMaxEntries caps the keys a MemoryStore tracks.
+	DefaultMaxEntries = 100_000
+	// sweepInterval is how often expired keys are dropped.
+	sweepInterval = time.Minute
+)
+
+// MemoryStore keeps failures in process. Replicas each keep their own
+// counts, so use RedisStore when running more than one.
+//
+// Expired keys are dropped at most once every minute, and at most
+// MaxEntries keys are tracked: when full, a key that is not locked out is
+// forgotten to make room, so that a flood of distinct users or IPs costs
+// bounded memory and time.
+type MemoryStore struct {
+	// MaxEntries caps the keys tracked. Zero means DefaultMaxEntries.
+	MaxEntries int
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type entry struct {
+	failures    int
+	expires     time.Time
+	lockedUntil time.Time
+}
+
+// live reports whether e still counts failures or holds a lock at now.
+func (e *entry) live(now time.Time) bool {
+	return now.Before(e.expires) || now.Before(e.lockedUntil)
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*entry), now: time.Now}
+}
+
+// get returns the entry of key, creating it if needed. Callers hold mu.
+func (s *MemoryStore) get(key string) *entry {
+	if e, ok := s.entries[key]; ok {
+		return e
+	}
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+	}
+	max := s.MaxEntries
+	if max <= 0 {
+		max = DefaultMaxEntries
+	}
+	if len(s.entries) >= max {
+		s.evict(now)
+	}
+	e := &entry{}
+	s.entries[key] = e
+	return e
+}
+
+// sweep drops the expired entries. Callers hold mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if !e.live(now) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// evict drops one entry, preferring one that is not locked out, so that
+// locks outlast a flood of new keys. Callers hold mu.
+func (s *MemoryStore) evict(now time.Time) {
+	const tries = 16
+	var victim string
+	i := 0
+	for k, e := range s.entries {
+		victim = k
+		if !now.Before(e.lockedUntil) {
+			break
+		}
+		if i++; i == tries {
+			break
+		}
+	}
+	delete(s.entries, victim)
+}
+
+func (s *MemoryStore) Fail(_ context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.get(key)
+	if !s.now().Before(e.expires) {
+		e.failures, e.expires = 0, s.now().Add(window)
+	}
+	e.failures++
+	return e.failures, nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(key).lockedUntil = until
+	return nil
+}
+
+func (s *MemoryStore) LockedUntil(_ context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || !s.now().Before(e.lockedUntil) {
+		return time.Time{}, nil
+	}
+	return e.lockedUntil, nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// RedisStore keeps failures in Redis, shared by every replica.
+type RedisStore struct {
+	Client redis.UniversalClient
+	// Prefix is prepended to every key. Zero means "identity:lockout:".
+	Prefix string
+}
+
+// NewRedisStore returns a RedisStore using client.
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{Client: client, Prefix: "identity:lockout:"}
+}
+
+func (s *RedisStore) failKey(key string) string { return s.Prefix + "fail:" + key }
+func (s *RedisStore) lockKey(key string) string { return s.Prefix + "lock:" + key }
+
+func (s *RedisStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	var incr *redis.IntCmd
+	_, err := s.Client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		incr = p.Incr(ctx, s.failKey(key))
+		p.ExpireNX(ctx, s.failKey(key), window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+func (s *RedisStore) Lock(ctx context.Context, key string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.Client.Set(ctx, s.lockKey(key), strconv.FormatInt(until.UnixMilli(), 10), ttl).Err()
+}
+
+func (s *RedisStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	v, err := s.Client.Get(ctx, s.lockKey(key)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(v), nil
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.Client.Del(ctx, s.failKey(key), s.lockKey(key)).Err()
+}
+
+// FallbackStore uses Primary and switches to Fallback for any call that
+// Primary fails, so that logins stay protected while Redis is down.
+// Counts kept by Fallback are not merged back into Primary.
+type FallbackStore struct {
+	Primary  Store
+	Fallback Store
+
+	mu   sync.Mutex
+	down bool
+}
+
+// NewFallbackStore returns a FallbackStore over primary that falls back
+// to an in-memory store.
+func NewFallbackStore(primary Store) *FallbackStore {
+	return &FallbackStore{Primary: primary, Fallback: NewMemoryStore()}
+}
+
+// failed reports whether err from Primary should send the call to
+// Fallback, logging when Primary goes down or recovers.
+func (s *FallbackStore) failed(err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil && !s.down {
+		slog.Warn("lockout store unavailable, counting failures in memory", "error", err)
+	} else if err == nil && s.down {
+		slog.Info("lockout store available again")
+	}
+	s.down = err != nil
+	return s.down
+}
+
+func (s *FallbackStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	n, err := s.Primary.Fail(ctx, key, window)
+	if s.failed(err) {
+		return s.Fallback.Fail(ctx, key, window)
+	}
+	return n, nil
+}
+
+func (s *FallbackStore) Lock(ctx context.Context, key string, until time.Time) error {
+	if err := s.Primary.Lock(ctx, key, until); s.failed(err) {
+		return s.Fallback.Lock(ctx, key, until)
+	}
+	return nil
+}
+
+func (s *FallbackStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	t, err := s.Primary.LockedUntil(ctx, key)
+	if s.failed(err) {
+		return s.Fallback.LockedUntil(ctx, key)
+	}
+	return t, nil
+}
+
+func (s *FallbackStore) Reset(ctx context.Context, key string) error {
+	if err := s.Primary.Reset(ctx, key); s.failed(err) {
+		return s.Fallback.Reset(ctx, key)
+	}
+	return nil
+}
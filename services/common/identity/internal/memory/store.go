@@ -0,0 +1,644 @@
+// Package memory provides an in-process implementation of the identity
+// store for development and tests.
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"identity/internal/models"
+	"identity/internal/token"
+)
+
+// Store is an in-memory identity store.
+type Store struct {
+	mu            sync.Mutex
+	users         map[string]models.User
+	refreshTokens map[string]models.RefreshToken // by token hash
+	resets        map[string]models.PasswordReset
+	revoked       map[string]time.Time // access token jti to expiry
+	clients       map[string]models.Client
+	codes         map[string]models.AuthorizationCode
+	signingKeys   []token.SigningKey
+	federated     map[[2]string]string // provider and subject to user ID
+	totps         map[string]models.TOTP
+	recoveryCodes map[string]map[string]bool // user ID to code hash to used
+	challenges    map[string]models.MFAChallenge
+	mfaPolicies   map[string]models.MFAPolicy
+	sessions      map[string]models.Session
+	sessionPolicy map[string]models.SessionPolicy
+	otps          map[string]models.OTP
+}
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{
+		users:         make(map[string]models.User),
+		refreshTokens: make(map[string]models.RefreshToken),
+		resets:        make(map[string]models.PasswordReset),
+		revoked:       make(map[string]time.Time),
+		clients:       make(map[string]models.Client),
+		codes:         make(map[string]models.AuthorizationCode),
+		federated:     make(map[[2]string]string),
+		totps:         make(map[string]models.TOTP),
+		recoveryCodes: make(map[string]map[string]bool),
+		challenges:    make(map[string]models.MFAChallenge),
+		mfaPolicies:   make(map[string]models.MFAPolicy),
+		sessions:      make(map[string]models.Session),
+		sessionPolicy: make(map[string]models.SessionPolicy),
+		otps:          make(map[string]models.OTP),
+	}
+}
+
+func copyUser(u models.User) *models.User {
+	u.Roles = append([]string(nil), u.Roles...)
+	return &u
+}
+
+func (s *Store) CreateUser(_ context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if (user.Email != "" && u.Email == user.Email) || (user.Mobile != "" && u.Mobile == user.Mobile) {
+			return models.ErrConflict
+		}
+	}
+	s.users[user.ID] = *copyUser(*user)
+	return nil
+}
+
+func (s *Store) GetUser(_ context.Context, id string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return copyUser(u), nil
+}
+
+func (s *Store) GetUserByEmail(_ context.Context, email string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if email != "" && u.Email == email {
+			return copyUser(u), nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (s *Store) GetUserByMobile(_ context.Context, mobile string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if mobile != "" && u.Mobile == mobile {
+			return copyUser(u), nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (s *Store) UpdatePasswordHash(_ context.Context, userID, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	u.PasswordHash = hash
+	u.UpdatedAt = time.Now().UTC()
+	s.users[userID] = u
+	return nil
+}
+
+func (s *Store) CreateRefreshToken(_ context.Context, t *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens[t.TokenHash] = *t
+	return nil
+}
+
+func (s *Store) GetRefreshToken(_ context.Context, hash string) (*models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.refreshTokens[hash]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &t, nil
+}
+
+func (s *Store) RevokeRefreshToken(_ context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.refreshTokens {
+		if t.ID == id && t.RevokedAt == nil {
+			t.RevokedAt = &at
+			s.refreshTokens[hash] = t
+			return nil
+		}
+	}
+	return models.ErrNotFound
+}
+
+// revokeWhere revokes every active token matching match. Callers hold mu.
+func (s *Store) revokeWhere(at time.Time, match func(models.RefreshToken) bool) {
+	for hash, t := range s.refreshTokens {
+		if t.RevokedAt == nil && match(t) {
+			t.RevokedAt = &at
+			s.refreshTokens[hash] = t
+		}
+	}
+}
+
+func (s *Store) RevokeRefreshTokenFamily(_ context.Context, familyID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokeWhere(at, func(t models.RefreshToken) bool { return t.FamilyID == familyID })
+	return nil
+}
+
+func (s *Store) RevokeUserRefreshTokens(_ context.Context, userID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokeWhere(at, func(t models.RefreshToken) bool { return t.UserID == userID })
+	return nil
+}
+
+func (s *Store) CreatePasswordReset(_ context.Context, r *models.PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resets[r.TokenHash] = *r
+	return nil
+}
+
+func (s *Store) ResetPassword(_ context.Context, tokenHash, passwordHash string, at time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.resets[tokenHash]
+	if !ok || r.UsedAt != nil || !at.Before(r.ExpiresAt) {
+		return "", models.ErrNotFound
+	}
+	u, ok := s.users[r.UserID]
+	if !ok {
+		return "", models.ErrNotFound
+	}
+	r.UsedAt = &at
+	s.resets[tokenHash] = r
+	u.PasswordHash = passwordHash
+	u.UpdatedAt = at.UTC()
+	s.users[u.ID] = u
+	s.revokeSessionsWhere(at, func(sess models.Session) bool { return sess.UserID == u.ID })
+	s.revokeWhere(at, func(t models.RefreshToken) bool { return t.UserID == u.ID })
+	return u.ID, nil
+}
+
+func (s *Store) RevokeAccessToken(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, exp := range s.revoked {
+		if exp.Before(now) {
+			delete(s.revoked, id)
+		}
+	}
+	s.revoked[jti] = expiresAt
+	return nil
+}
+
+func (s *Store) AccessTokenRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.revoked[jti]
+	return ok, nil
+}
+
+// DeleteExpired deletes the records that expired before the given time:
+// MFA challenges, authorization codes, password reset tokens and one-time
+// passwords, the last once their send window has also passed.
+func (s *Store) DeleteExpired(_ context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, c := range s.challenges {
+		if !c.ExpiresAt.After(before) {
+			delete(s.challenges, hash)
+		}
+	}
+	for hash, c := range s.codes {
+		if !c.ExpiresAt.After(before) {
+			delete(s.codes, hash)
+		}
+	}
+	for hash, r := range s.resets {
+		if !r.ExpiresAt.After(before) {
+			delete(s.resets, hash)
+		}
+	}
+	for mobile, o := range s.otps {
+		if !o.ExpiresAt.After(before) && !o.WindowStart.After(before.Add(-models.OTPSendWindow)) {
+			delete(s.otps, mobile)
+		}
+	}
+	return nil
+}
+
+func copyClient(c models.Client) *models.Client {
+	c.RedirectURIs = append([]string(nil), c.RedirectURIs...)
+	c.GrantTypes = append([]string(nil), c.GrantTypes...)
+	c.Scopes = append([]string(nil), c.Scopes...)
+	return &c
+}
+
+func (s *Store) GetClient(_ context.Context, id string) (*models.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return copyClient(c), nil
+}
+
+func (s *Store) UpsertClient(_ context.Context, client *models.Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.clients[client.ID]; ok {
+		client.CreatedAt = existing.CreatedAt
+	}
+	s.clients[client.ID] = *copyClient(*client)
+	return nil
+}
+
+func (s *Store) CreateAuthorizationCode(_ context.Context, code *models.AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code.CodeHash] = *code
+	return nil
+}
+
+func (s *Store) ConsumeAuthorizationCode(_ context.Context, hash string, at time.Time) (*models.AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[hash]
+	if !ok || code.UsedAt != nil || !at.Before(code.ExpiresAt) {
+		return nil, models.ErrNotFound
+	}
+	code.UsedAt = &at
+	s.codes[hash] = code
+	return &code, nil
+}
+
+func (s *Store) SigningKeys(context.Context) ([]token.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]token.SigningKey(nil), s.signingKeys...), nil
+}
+
+func (s *Store) AddSigningKey(_ context.Context, key token.SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signingKeys = append(s.signingKeys, key)
+	return nil
+}
+
+func (s *Store) DeleteSigningKeys(_ context.Context, expiredBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.signingKeys[:0]
+	for _, k := range s.signingKeys {
+		if k.ExpiresAt.IsZero() || k.ExpiresAt.After(expiredBefore) {
+			kept = append(kept, k)
+		}
+	}
+	s.signingKeys = kept
+	return nil
+}
+
+func (s *Store) GetFederatedUser(_ context.Context, provider, subject string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[s.federated[[2]string{provider, subject}]]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return copyUser(u), nil
+}
+
+func (s *Store) CreateFederatedUser(ctx context.Context, user *models.User, provider, subject string) error {
+	if err := s.CreateUser(ctx, user); err != nil {
+		return err
+	}
+	return s.LinkFederatedIdentity(ctx, provider, subject, user.ID)
+}
+
+func (s *Store) LinkFederatedIdentity(_ context.Context, provider, subject, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]string{provider, subject}
+	if _, ok := s.federated[key]; ok {
+		return models.ErrConflict
+	}
+	s.federated[key] = userID
+	return nil
+}
+
+func (s *Store) UpdateUserProfile(_ context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[user.ID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	u.Name, u.AccountID, u.Roles, u.UpdatedAt = user.Name, user.AccountID, append([]string(nil), user.Roles...), user.UpdatedAt
+	s.users[user.ID] = u
+	return nil
+}
+
+func (s *Store) GetTOTP(_ context.Context, userID string) (*models.TOTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.totps[userID]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &t, nil
+}
+
+func (s *Store) SaveTOTP(_ context.Context, t *models.TOTP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.totps[t.UserID]; ok && existing.ConfirmedAt != nil {
+		return models.ErrConflict
+	}
+	s.totps[t.UserID] = *t
+	return nil
+}
+
+func (s *Store) ConfirmTOTP(_ context.Context, userID string, step int64, codeHashes []string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.totps[userID]
+	if !ok || t.ConfirmedAt != nil {
+		return models.ErrNotFound
+	}
+	t.ConfirmedAt, t.LastStep = &at, step
+	s.totps[userID] = t
+	s.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (s *Store) UseTOTPStep(_ context.Context, userID string, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.totps[userID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	if step <= t.LastStep {
+		return models.ErrConflict
+	}
+	t.LastStep = step
+	s.totps[userID] = t
+	return nil
+}
+
+func (s *Store) DeleteTOTP(_ context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.totps, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
+
+func (s *Store) replaceRecoveryCodes(userID string, codeHashes []string) {
+	codes := make(map[string]bool, len(codeHashes))
+	for _, h := range codeHashes {
+		codes[h] = false
+	}
+	s.recoveryCodes[userID] = codes
+}
+
+func (s *Store) ReplaceRecoveryCodes(_ context.Context, userID string, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (s *Store) UseRecoveryCode(_ context.Context, userID, codeHash string, _ time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used, ok := s.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return models.ErrNotFound
+	}
+	s.recoveryCodes[userID][codeHash] = true
+	return nil
+}
+
+func (s *Store) CountRecoveryCodes(_ context.Context, userID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, used := range s.recoveryCodes[userID] {
+		if !used {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) CreateMFAChallenge(_ context.Context, c *models.MFAChallenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.challenges[c.TokenHash] = *c
+	return nil
+}
+
+func (s *Store) GetMFAChallenge(_ context.Context, tokenHash string) (*models.MFAChallenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[tokenHash]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &c, nil
+}
+
+func (s *Store) AttemptMFAChallenge(_ context.Context, tokenHash string, maxAttempts int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[tokenHash]
+	if !ok || c.Attempts >= maxAttempts {
+		return 0, models.ErrNotFound
+	}
+	c.Attempts++
+	s.challenges[tokenHash] = c
+	return c.Attempts, nil
+}
+
+func (s *Store) DeleteMFAChallenge(_ context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.challenges[tokenHash]; !ok {
+		return models.ErrNotFound
+	}
+	delete(s.challenges, tokenHash)
+	return nil
+}
+
+func (s *Store) GetMFAPolicy(_ context.Context, accountID string) (*models.MFAPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.mfaPolicies[accountID]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	p.Roles = append([]string(nil), p.Roles...)
+	return &p, nil
+}
+
+func (s *Store) PutMFAPolicy(_ context.Context, p *models.MFAPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *p
+	stored.Roles = append([]string(nil), p.Roles...)
+	s.mfaPolicies[p.AccountID] = stored
+	return nil
+}
+
+func (s *Store) CreateSession(_ context.Context, sess *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sess.ID] = *sess
+	return nil
+}
+
+func (s *Store) GetSession(_ context.Context, id string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &sess, nil
+}
+
+func (s *Store) TouchSession(_ context.Context, id string, at time.Time, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return models.ErrNotFound
+	}
+	sess.LastSeenAt = at
+	if ip != "" {
+		sess.IP = ip
+	}
+	s.sessions[id] = sess
+	return nil
+}
+
+func (s *Store) ListSessions(_ context.Context, userID string) ([]models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []models.Session
+	for _, sess := range s.sessions {
+		if sess.UserID == userID && sess.RevokedAt == nil {
+			out = append(out, sess)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// revokeSessionsWhere revokes every active session matching match. Callers
+// hold mu.
+func (s *Store) revokeSessionsWhere(at time.Time, match func(models.Session) bool) {
+	for id, sess := range s.sessions {
+		if sess.RevokedAt == nil && match(sess) {
+			sess.RevokedAt = &at
+			s.sessions[id] = sess
+		}
+	}
+}
+
+func (s *Store) RevokeSession(_ context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[id]; !ok {
+		return models.ErrNotFound
+	}
+	s.revokeSessionsWhere(at, func(sess models.Session) bool { return sess.ID == id })
+	s.revokeWhere(at, func(t models.RefreshToken) bool { return t.FamilyID == id })
+	return nil
+}
+
+func (s *Store) RevokeUserSessions(_ context.Context, userID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokeSessionsWhere(at, func(sess models.Session) bool { return sess.UserID == userID })
+	s.revokeWhere(at, func(t models.RefreshToken) bool { return t.UserID == userID })
+	return nil
+}
+
+func (s *Store) GetSessionPolicy(_ context.Context, accountID string) (*models.SessionPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.sessionPolicy[accountID]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &p, nil
+}
+
+func (s *Store) PutSessionPolicy(_ context.Context, p *models.SessionPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessionPolicy[p.AccountID] = *p
+	return nil
+}
+
+func (s *Store) GetOTP(_ context.Context, mobile string) (*models.OTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.otps[mobile]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &o, nil
+}
+
+func (s *Store) PutOTP(_ context.Context, o *models.OTP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.otps[o.Mobile] = *o
+	return nil
+}
+
+func (s *Store) AttemptOTP(_ context.Context, mobile string, maxAttempts int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.otps[mobile]
+	if !ok || o.CodeHash == "" || o.Attempts >= maxAttempts || !now.Before(o.ExpiresAt) {
+		return models.ErrNotFound
+	}
+	o.Attempts++
+	s.otps[mobile] = o
+	return nil
+}
+
+func (s *Store) ConsumeOTP(_ context.Context, mobile, codeHash string, maxAttempts int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.otps[mobile]
+	if !ok || o.CodeHash == "" || o.CodeHash != codeHash || o.Attempts > maxAttempts || !now.Before(o.ExpiresAt) {
+		return models.ErrNotFound
+	}
+	o.CodeHash = ""
+	s.otps[mobile] = o
+	return nil
+}
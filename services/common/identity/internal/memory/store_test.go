@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"identity/internal/models"
+)
+
+func TestDeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewStore()
+	s.CreateMFAChallenge(ctx, &models.MFAChallenge{TokenHash: "expired", UserID: "u1", ExpiresAt: now.Add(-time.Second)})
+	s.CreateMFAChallenge(ctx, &models.MFAChallenge{TokenHash: "live", UserID: "u1", ExpiresAt: now.Add(time.Minute)})
+	s.CreateAuthorizationCode(ctx, &models.AuthorizationCode{CodeHash: "expired", ClientID: "console", ExpiresAt: now.Add(-time.Second)})
+	s.CreateAuthorizationCode(ctx, &models.AuthorizationCode{CodeHash: "live", ClientID: "console", ExpiresAt: now.Add(time.Minute)})
+	s.CreatePasswordReset(ctx, &models.PasswordReset{TokenHash: "expired", UserID: "u1", ExpiresAt: now.Add(-time.Second)})
+	s.CreatePasswordReset(ctx, &models.PasswordReset{TokenHash: "live", UserID: "u1", ExpiresAt: now.Add(time.Minute)})
+	// An expired code's record is kept while it still limits sends.
+	s.PutOTP(ctx, &models.OTP{Mobile: "+911111111111", WindowStart: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)})
+	s.PutOTP(ctx, &models.OTP{Mobile: "+912222222222", WindowStart: now.Add(-10 * time.Minute), ExpiresAt: now.Add(-5 * time.Minute)})
+
+	if err := s.DeleteExpired(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetMFAChallenge(ctx, "expired"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expired MFA challenge: err = %v", err)
+	}
+	if _, err := s.GetMFAChallenge(ctx, "live"); err != nil {
+		t.Errorf("live MFA challenge: err = %v", err)
+	}
+	if len(s.codes) != 1 || s.codes["live"].ExpiresAt.IsZero() {
+		t.Errorf("authorization codes = %v, want only the live one", s.codes)
+	}
+	if len(s.resets) != 1 || s.resets["live"].ExpiresAt.IsZero() {
+		t.Errorf("password resets = %v, want only the live one", s.resets)
+	}
+	if _, err := s.GetOTP(ctx, "+911111111111"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("OTP past its send window: err = %v", err)
+	}
+	if _, err := s.GetOTP(ctx, "+912222222222"); err != nil {
+		t.Errorf("OTP in its send window: err = %v", err)
+	}
+}
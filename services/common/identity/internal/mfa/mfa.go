@@ -0,0 +1,521 @@
+// Package mfa adds a second login factor to the identity service: TOTP
+// authenticators, single-use recovery codes, and per-account policies
+// that require MFA for some roles.
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"identity/internal/auth"
+	"identity/internal/models"
+)
+
+// Errors returned by Service.
+var (
+	ErrInvalidCode      = errors.New("invalid verification code")
+	ErrAlreadyEnrolled  = errors.New("an authenticator is already enrolled")
+	ErrNotEnrolled      = errors.New("no authenticator enrolled")
+	ErrRequired         = errors.New("MFA is required for this user and cannot be disabled")
+	ErrEnrollmentNeeded = errors.New("MFA enrolment is required to sign in")
+)
+
+// RecoveryCodeCount is how many recovery codes are issued at a time.
+const RecoveryCodeCount = 10
+
+// Store is the storage used by Service.
+type Store interface {
+	GetUser(ctx context.Context, id string) (*models.User, error)
+
+	GetTOTP(ctx context.Context, userID string) (*models.TOTP, error)
+	// SaveTOTP stores an unconfirmed authenticator, replacing any other
+	// unconfirmed one. It returns ErrConflict if one is confirmed.
+	SaveTOTP(ctx context.Context, t *models.TOTP) error
+	// ConfirmTOTP enables the user's authenticator, records step as used
+	// and replaces the recovery codes in one step.
+	ConfirmTOTP(ctx context.Context, userID string, step int64, codeHashes []string, at time.Time) error
+	// UseTOTPStep records step as used and returns ErrConflict if it or a
+	// later step already was.
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+	// DeleteTOTP removes the user's authenticator and recovery codes.
+	DeleteTOTP(ctx context.Context, userID string) error
+
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+	// UseRecoveryCode marks an unused code as used and returns
+	// ErrNotFound if there is none.
+	UseRecoveryCode(ctx context.Context, userID, codeHash string, at time.Time) error
+	CountRecoveryCodes(ctx context.Context, userID string) (int, error)
+
+	CreateMFAChallenge(ctx context.Context, c *models.MFAChallenge) error
+	GetMFAChallenge(ctx context.Context, tokenHash string) (*models.MFAChallenge, error)
+	// AttemptMFAChallenge counts an attempt at a challenge that has had
+	// fewer than maxAttempts and returns the attempts so far, or
+	// ErrNotFound if there is no such challenge. It is atomic, so that
+	// concurrent attempts cannot exceed maxAttempts.
+	AttemptMFAChallenge(ctx context.Context, tokenHash string, maxAttempts int) (int, error)
+	// DeleteMFAChallenge returns ErrNotFound if the challenge is gone, so
+	// concurrent completions cannot both succeed.
+	DeleteMFAChallenge(ctx context.Context, tokenHash string) error
+
+	GetMFAPolicy(ctx context.Context, accountID string) (*models.MFAPolicy, error)
+	PutMFAPolicy(ctx context.Context, p *models.MFAPolicy) error
+}
+
+// Config configures a Service.
+type Config struct {
+	// Issuer labels the account in authenticator apps. Empty means
+	// "DIGIT".
+	Issuer string
+	// ChallengeTTL bounds the time between password and code. Zero means
+	// 5 minutes.
+	ChallengeTTL time.Duration
+	// MaxAttempts is the number of codes a challenge can be tried with.
+	// Zero means 5. Wrong codes are also counted per user by the lockout
+	// guard of the auth service, if any, across challenges.
+	MaxAttempts int
+}
+
+// Service implements MFA enrolment and login challenges on top of the
+// password login of auth.Service.
+type Service struct {
+	Store Store
+	Auth  *auth.Service
+
+	issuer       string
+	challengeTTL time.Duration
+	maxAttempts  int
+	now          func() time.Time
+}
+
+// NewService returns a Service backed by store that issues tokens through
+// svc.
+func NewService(store Store, svc *auth.Service, cfg Config) *Service {
+	s := &Service{
+		Store:        store,
+		Auth:         svc,
+		issuer:       cfg.Issuer,
+		challengeTTL: cfg.ChallengeTTL,
+		maxAttempts:  cfg.MaxAttempts,
+		now:          time.Now,
+	}
+	if s.issuer == "" {
+		s.issuer = "DIGIT"
+	}
+	if s.challengeTTL == 0 {
+		s.challengeTTL = 5 * time.Minute
+	}
+	if s.maxAttempts == 0 {
+		s.maxAttempts = 5
+	}
+	return s
+}
+
+// ChallengeError is returned by Login when a second factor is needed.
+type ChallengeError struct {
+	Challenge models.MFAChallengeResponse
+}
+
+func (e *ChallengeError) Error() string { return e.Challenge.Error }
+
+// Required reports whether a policy of the user's account, of an account
+// above it, or the platform-wide policy requires MFA for one of the
+// user's roles. Accounts form a tree by their dotted names.
+func (s *Service) Required(ctx context.Context, user *models.User) (bool, error) {
+	accounts := []string{""}
+	if user.AccountID != "" {
+		parts := strings.Split(user.AccountID, ".")
+		for i := range parts {
+			accounts = append(accounts, strings.Join(parts[:i+1], "."))
+		}
+	}
+	for _, account := range accounts {
+		p, err := s.Store.GetMFAPolicy(ctx, account)
+		if errors.Is(err, models.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		for _, role := range p.Roles {
+			if role == "*" || contains(user.Roles, role) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Enabled reports whether user has a confirmed authenticator.
+func (s *Service) Enabled(ctx context.Context, userID string) (bool, error) {
+	t, err := s.Store.GetTOTP(ctx, userID)
+	if errors.Is(err, models.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return t.ConfirmedAt != nil, nil
+}
+
+// Status describes user's second factors.
+func (s *Service) Status(ctx context.Context, user *models.User) (*models.MFAStatus, error) {
+	var st models.MFAStatus
+	var err error
+	if st.Enabled, err = s.Enabled(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if st.Required, err = s.Required(ctx, user); err != nil {
+		return nil, err
+	}
+	if st.Enabled {
+		if st.RecoveryCodesRemaining, err = s.Store.CountRecoveryCodes(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return &st, nil
+}
+
+// Login verifies a password and returns a token pair, or a
+// *ChallengeError when the user must present a code or enrol an
+// authenticator first.
+func (s *Service) Login(ctx context.Context, email, password string) (*models.TokenPair, error) {
+	user, err := s.Auth.Authenticate(ctx, email, password)
+	if err != nil {
+		return nil, err
+	}
+	return s.SignIn(ctx, user)
+}
+
+// SignIn returns a token pair for a user who has proved their first
+// factor, or a *ChallengeError when they must present a code or enrol an
+// authenticator first.
+func (s *Service) SignIn(ctx context.Context, user *models.User) (*models.TokenPair, error) {
+	enabled, err := s.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, s.challenge(ctx, user, false)
+	}
+	required, err := s.Required(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if required {
+		return nil, s.challenge(ctx, user, true)
+	}
+	return s.Auth.IssueTokens(ctx, user, auth.Grant{})
+}
+
+func (s *Service) challenge(ctx context.Context, user *models.User, enroll bool) error {
+	raw := auth.RandomToken()
+	now := s.now()
+	if err := s.Store.CreateMFAChallenge(ctx, &models.MFAChallenge{
+		TokenHash: auth.HashToken(raw),
+		UserID:    user.ID,
+		Enroll:    enroll,
+		ExpiresAt: now.Add(s.challengeTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
+	resp := models.MFAChallengeResponse{
+		Error:     models.MFARequired,
+		MFAToken:  raw,
+		Methods:   []string{models.MFAMethodTOTP, models.MFAMethodRecoveryCode},
+		ExpiresIn: int(s.challengeTTL / time.Second),
+	}
+	if enroll {
+		resp.Error = models.MFAEnrollmentRequired
+		resp.Methods = []string{models.MFAMethodTOTP}
+	}
+	return &ChallengeError{Challenge: resp}
+}
+
+// pending returns the unexpired challenge for raw and its user.
+func (s *Service) pending(ctx context.Context, raw string, enroll bool) (*models.MFAChallenge, *models.User, error) {
+	c, err := s.Store.GetMFAChallenge(ctx, auth.HashToken(raw))
+	if errors.Is(err, models.ErrNotFound) || (err == nil && (c.Enroll != enroll || !s.now().Before(c.ExpiresAt))) {
+		return nil, nil, auth.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := s.Store.GetUser(ctx, c.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, user, nil
+}
+
+// complete consumes challenge c and issues tokens to user.
+func (s *Service) complete(ctx context.Context, c *models.MFAChallenge, user *models.User) (*models.TokenPair, error) {
+	if err := s.Store.DeleteMFAChallenge(ctx, c.TokenHash); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, auth.ErrInvalidToken
+		}
+		return nil, err
+	}
+	return s.Auth.IssueTokens(ctx, user, auth.Grant{})
+}
+
+// Verify completes a login challenged for a second factor with an
+// authenticator or recovery code. The challenge is dropped after too many
+// attempts.
+func (s *Service) Verify(ctx context.Context, mfaToken, code string) (*models.TokenPair, error) {
+	c, user, err := s.pending(ctx, mfaToken, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attempt(ctx, c); err != nil {
+		return nil, err
+	}
+	if err := s.CheckCode(ctx, user.ID, code); err != nil {
+		return nil, err
+	}
+	return s.complete(ctx, c, user)
+}
+
+// attempt reserves an attempt at challenge c before its code is checked,
+// so that concurrent requests cannot try more codes than allowed. A
+// challenge out of attempts is refused until it expires.
+func (s *Service) attempt(ctx context.Context, c *models.MFAChallenge) error {
+	_, err := s.Store.AttemptMFAChallenge(ctx, c.TokenHash, s.maxAttempts)
+	if errors.Is(err, models.ErrNotFound) {
+		return auth.ErrInvalidToken
+	}
+	return err
+}
+
+// CheckCode verifies a code from the user's confirmed authenticator, or
+// consumes one of their recovery codes. Six-digit codes are authenticator
+// codes; anything else is taken as a recovery code. Wrong codes are
+// counted per user by the lockout guard of the auth service, if any, and
+// a *lockout.LockedError is returned while the user is locked out.
+func (s *Service) CheckCode(ctx context.Context, userID, code string) error {
+	g := s.Auth.Guard
+	if g == nil {
+		return s.checkCode(ctx, userID, code)
+	}
+	if err := g.CheckMFA(ctx, userID); err != nil {
+		return err
+	}
+	err := s.checkCode(ctx, userID, code)
+	switch {
+	case errors.Is(err, ErrInvalidCode):
+		return g.FailMFA(ctx, userID, err)
+	case err == nil:
+		return g.SucceedMFA(ctx, userID)
+	}
+	return err
+}
+
+func (s *Service) checkCode(ctx context.Context, userID, code string) error {
+	t, err := s.Store.GetTOTP(ctx, userID)
+	if errors.Is(err, models.ErrNotFound) || (err == nil && t.ConfirmedAt == nil) {
+		return ErrNotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		step, ok := Validate(t.Secret, code, s.now())
+		if !ok || step <= t.LastStep {
+			return ErrInvalidCode
+		}
+		if err := s.Store.UseTOTPStep(ctx, userID, step); err != nil {
+			if errors.Is(err, models.ErrConflict) {
+				return ErrInvalidCode
+			}
+			return err
+		}
+		return nil
+	}
+	err = s.Store.UseRecoveryCode(ctx, userID, auth.HashToken(normalizeRecoveryCode(code)), s.now())
+	if errors.Is(err, models.ErrNotFound) {
+		return ErrInvalidCode
+	}
+	return err
+}
+
+// Enroll starts enrolling a new authenticator for user. It must be
+// confirmed with a code before it protects logins.
+func (s *Service) Enroll(ctx context.Context, user *models.User) (*models.TOTPEnrollment, error) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	err = s.Store.SaveTOTP(ctx, &models.TOTP{UserID: user.ID, Secret: secret, CreatedAt: s.now()})
+	if errors.Is(err, models.ErrConflict) {
+		return nil, ErrAlreadyEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.TOTPEnrollment{Secret: secret, OTPAuthURI: URI(s.issuer, user.Email, secret)}, nil
+}
+
+// Confirm enables the authenticator being enrolled for user with a code
+// from it and returns new recovery codes.
+func (s *Service) Confirm(ctx context.Context, user *models.User, code string) ([]string, error) {
+	t, err := s.Store.GetTOTP(ctx, user.ID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, ErrNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.ConfirmedAt != nil {
+		return nil, ErrAlreadyEnrolled
+	}
+	step, ok := Validate(t.Secret, strings.TrimSpace(code), s.now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+	codes, hashes, err := recoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Store.ConfirmTOTP(ctx, user.ID, step, hashes, s.now()); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// EnrollChallenge starts enrolling an authenticator for a login that was
+// refused until the user enrols one.
+func (s *Service) EnrollChallenge(ctx context.Context, mfaToken string) (*models.TOTPEnrollment, error) {
+	_, user, err := s.pending(ctx, mfaToken, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.Enroll(ctx, user)
+}
+
+// ConfirmChallenge confirms the authenticator enrolled with
+// EnrollChallenge and completes the login.
+func (s *Service) ConfirmChallenge(ctx context.Context, mfaToken, code string) (*models.MFAEnabledResponse, error) {
+	c, user, err := s.pending(ctx, mfaToken, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attempt(ctx, c); err != nil {
+		return nil, err
+	}
+	codes, err := s.Confirm(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := s.complete(ctx, c, user)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MFAEnabledResponse{RecoveryCodes: codes, Tokens: pair}, nil
+}
+
+// Disable removes user's authenticator and recovery codes after checking
+// a code, unless a policy requires MFA for the user.
+func (s *Service) Disable(ctx context.Context, user *models.User, code string) error {
+	required, err := s.Required(ctx, user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrRequired
+	}
+	if err := s.CheckCode(ctx, user.ID, code); err != nil {
+		return err
+	}
+	return s.Store.DeleteTOTP(ctx, user.ID)
+}
+
+// RegenerateRecoveryCodes replaces user's recovery codes after checking a
+// code.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, user *models.User, code string) ([]string, error) {
+	if err := s.CheckCode(ctx, user.ID, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := recoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Store.ReplaceRecoveryCodes(ctx, user.ID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Policy returns the MFA policy of accountID, empty if none is set.
+func (s *Service) Policy(ctx context.Context, accountID string) (*models.MFAPolicy, error) {
+	p, err := s.Store.GetMFAPolicy(ctx, accountID)
+	if errors.Is(err, models.ErrNotFound) {
+		return &models.MFAPolicy{AccountID: accountID, Roles: []string{}}, nil
+	}
+	return p, err
+}
+
+// SetPolicy requires MFA for roles in accountID and the accounts below it.
+func (s *Service) SetPolicy(ctx context.Context, accountID string, roles []string) (*models.MFAPolicy, error) {
+	if roles == nil {
+		roles = []string{}
+	}
+	p := &models.MFAPolicy{AccountID: accountID, Roles: roles, UpdatedAt: s.now().UTC()}
+	if err := s.Store.PutMFAPolicy(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// recoveryAlphabet has 32 characters, none easily confused with another.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz123456789"
+
+// recoveryCodes returns new recovery codes, formatted "xxxxx-xxxxx", and
+// their hashes.
+func recoveryCodes() (codes, hashes []string, err error) {
+	buf := make([]byte, 10)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		var b strings.Builder
+		for j, c := range buf {
+			if j == 5 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(recoveryAlphabet[c&31])
+		}
+		code := b.String()
+		codes = append(codes, code)
+		hashes = append(hashes, auth.HashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != Digits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package mfa
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, truncated to six digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for _, tc := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		got, err := Code(secret, Step(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("code at %d = %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+
+	now := time.Unix(1111111109, 0)
+	for offset, want := range map[time.Duration]bool{-Period: true, 0: true, Period: true, 2 * Period: false, -2 * Period: false} {
+		code, _ := Code(secret, Step(now.Add(offset)))
+		if _, ok := Validate(secret, code, now); ok != want {
+			t.Errorf("code %v from now: valid = %v, want %v", offset, ok, want)
+		}
+	}
+
+	uri := URI("DIGIT", "asha@example.org", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/DIGIT:asha@example.org?") || !strings.Contains(uri, "secret=ABC") {
+		t.Errorf("unexpected URI %s", uri)
+	}
+}
@@ -0,0 +1,22 @@
+package models
+
+// AuthorizeResource is the resource an authorization request is about.
+type AuthorizeResource struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id,omitempty"`
+	AccountID  string            `json:"account_id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// AuthorizeRequest asks whether the caller may perform Action on Resource.
+type AuthorizeRequest struct {
+	Action   string            `json:"action" binding:"required" example:"accounts:update"`
+	Resource AuthorizeResource `json:"resource"`
+}
+
+// AuthorizeResponse is a policy decision.
+type AuthorizeResponse struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason"`
+}
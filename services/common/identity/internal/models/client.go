@@ -0,0 +1,86 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OAuth grant types.
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// Client is an OAuth 2.0 client registered with the identity service.
+// Public clients have no secret and must use PKCE.
+type Client struct {
+	ID           string    `json:"client_id"`
+	SecretHash   string    `json:"-"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Public reports whether the client cannot keep a secret.
+func (c *Client) Public() bool { return c.SecretHash == "" }
+
+// AllowsGrant reports whether the client may use grant.
+func (c *Client) AllowsGrant(grant string) bool {
+	return contains(c.GrantTypes, grant)
+}
+
+// AllowsRedirect reports whether uri exactly matches a registered redirect
+// URI.
+func (c *Client) AllowsRedirect(uri string) bool {
+	return contains(c.RedirectURIs, uri)
+}
+
+// AllowsScope reports whether every space-separated scope in scope was
+// registered for the client.
+func (c *Client) AllowsScope(scope string) bool {
+	for _, s := range strings.Fields(scope) {
+		if !contains(c.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientConfig is a client entry in the OIDC_CLIENTS_FILE. ClientSecret is
+// omitted for public clients.
+type ClientConfig struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+}
+
+// AuthorizationCode is a single-use code issued by the authorization
+// endpoint. Only a hash of the code is kept.
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        string
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+	UsedAt        *time.Time
+}
@@ -0,0 +1,17 @@
+package models
+
+import "errors"
+
+// Errors returned by stores.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// CaptchaRequired asks the client to show a CAPTCHA before the next
+	// login attempt.
+	CaptchaRequired bool `json:"captcha_required,omitempty"`
+}
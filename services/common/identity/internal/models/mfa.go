@@ -0,0 +1,110 @@
+package models
+
+import "time"
+
+// TOTP is a user's time-based one-time password authenticator. It only
+// protects logins once confirmed with a valid code.
+type TOTP struct {
+	UserID string
+	// Secret is the base32-encoded shared secret.
+	Secret      string
+	ConfirmedAt *time.Time
+	// LastStep is the last time step a code was accepted for, so that a
+	// code cannot be used twice.
+	LastStep  int64
+	CreatedAt time.Time
+}
+
+// MFAChallenge is the pending second step of a login. Only a hash of its
+// token is kept.
+type MFAChallenge struct {
+	TokenHash string
+	UserID    string
+	// Enroll is set when the user must enrol an authenticator before
+	// tokens are issued.
+	Enroll    bool
+	Attempts  int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// MFAPolicy lists the roles that must use MFA in an account and the
+// accounts below it. The policy with an empty AccountID applies to every
+// user.
+type MFAPolicy struct {
+	AccountID string `json:"account_id"`
+	// Roles that require MFA; "*" means every user.
+	Roles     []string  `json:"roles"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MFA challenge errors and methods.
+const (
+	MFARequired           = "mfa_required"
+	MFAEnrollmentRequired = "mfa_enrollment_required"
+
+	MFAMethodTOTP         = "totp"
+	MFAMethodRecoveryCode = "recovery_code"
+)
+
+// MFAChallengeResponse is returned instead of tokens when a login needs a
+// second factor.
+type MFAChallengeResponse struct {
+	Error string `json:"error" example:"mfa_required"`
+	// MFAToken identifies the login at /auth/mfa/verify or, when enrolment
+	// is required, at /auth/mfa/challenge/totp.
+	MFAToken  string   `json:"mfa_token"`
+	Methods   []string `json:"methods"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+// MFAVerifyRequest completes a login with an authenticator or recovery
+// code.
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFATokenRequest names a login challenge.
+type MFATokenRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// MFACodeRequest carries an authenticator or recovery code.
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TOTPEnrollment is the secret of a new authenticator. OTPAuthURI is the
+// payload to render as a QR code.
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// MFAEnabledResponse is returned when an authenticator is confirmed.
+// Recovery codes are only shown once.
+type MFAEnabledResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	// Tokens completes the login when enrolment was required to sign in.
+	Tokens *TokenPair `json:"tokens,omitempty"`
+}
+
+// RecoveryCodesResponse carries newly generated recovery codes.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAStatus describes a user's second factors.
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// MFAPolicyRequest sets the roles that must use MFA in an account.
+type MFAPolicyRequest struct {
+	// AccountID is empty for the policy that applies to every user.
+	AccountID string   `json:"account_id"`
+	Roles     []string `json:"roles"`
+}
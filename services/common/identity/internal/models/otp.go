@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// OTP is the one-time password most recently sent to a mobile number,
+// together with the counters used to rate-limit sending.
+type OTP struct {
+	Mobile string
+	// CodeHash is empty once the code has been used or given up on.
+	CodeHash string
+	Attempts int
+	// Sends counts the codes sent since WindowStart, for OTPSendWindow.
+	Sends       int
+	WindowStart time.Time
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+}
+
+// OTPSendWindow is how long codes sent to a mobile count against its send
+// limit. An OTP is kept this long after its WindowStart, even once the
+// code has expired.
+const OTPSendWindow = time.Hour
+
+// OTPRequest asks for a one-time password to be sent to a mobile number.
+type OTPRequest struct {
+	Mobile string `json:"mobile" binding:"required"`
+}
+
+// OTPSentResponse reports that a one-time password was sent.
+type OTPSentResponse struct {
+	// ExpiresIn is the lifetime of the code in seconds.
+	ExpiresIn int `json:"expires_in"`
+	// ResendIn is the number of seconds before another code can be sent.
+	ResendIn int `json:"resend_in"`
+}
+
+// OTPVerifyRequest exchanges a one-time password for a token pair.
+type OTPVerifyRequest struct {
+	Mobile string `json:"mobile" binding:"required"`
+	Code   string `json:"code" binding:"required"`
+	// Name is recorded for citizens signing in for the first time.
+	Name string `json:"name"`
+}
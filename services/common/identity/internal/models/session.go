@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Session is one sign-in of a user on a device. It spans every token pair
+// rotated from the login's first refresh token, and its ID is carried in
+// access tokens as the sid claim.
+type Session struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	ClientID  string `json:"client_id,omitempty"`
+	Device    string `json:"device"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	// AccountID is the user's account when the session started; its
+	// session policy sets the timeouts.
+	AccountID  string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"-"`
+
+	// IdleExpiresAt and ExpiresAt are when the session ends without
+	// activity and at the latest, under the current session policy.
+	IdleExpiresAt time.Time `json:"idle_expires_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	// Current marks the session of the token that listed it.
+	Current bool `json:"current"`
+}
+
+// SessionPolicy sets session timeouts in an account and the accounts below
+// it. The policy with an empty AccountID applies to every user. Zero
+// timeouts are inherited from the enclosing account's policy or the
+// service defaults.
+type SessionPolicy struct {
+	AccountID string `json:"account_id"`
+	// IdleTimeout ends sessions unused for this many seconds.
+	IdleTimeout int `json:"idle_timeout"`
+	// AbsoluteTimeout ends sessions this many seconds after sign-in.
+	AbsoluteTimeout int       `json:"absolute_timeout"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// SessionPolicyRequest sets the session timeouts of an account.
+type SessionPolicyRequest struct {
+	// AccountID is empty for the policy that applies to every user.
+	AccountID       string `json:"account_id"`
+	IdleTimeout     int    `json:"idle_timeout" binding:"min=0"`
+	AbsoluteTimeout int    `json:"absolute_timeout" binding:"min=0"`
+}
+
+// SessionsRevokedResponse reports how many sessions were signed out.
+type SessionsRevokedResponse struct {
+	Revoked int `json:"revoked"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// TokenPair is returned by login, refresh and the OAuth token endpoint.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// RefreshToken is a stored refresh token. Only a hash of the token is kept.
+// Tokens issued by rotating one another share a FamilyID so that reuse of a
+// rotated token can revoke the whole chain.
+type RefreshToken struct {
+	ID        string
+	UserID    string
+	FamilyID  string
+	TokenHash string
+	// ClientID is the OAuth client the token was issued to, empty for
+	// first-party logins. Only that client can redeem it.
+	ClientID  string
+	Scope     string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// Active reports whether the token can still be exchanged at now.
+func (t *RefreshToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// PasswordReset is a single-use password reset token. Only a hash of the
+// token is kept.
+type PasswordReset struct {
+	TokenHash string
+	UserID    string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Roles assigned to users.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+	// RoleCitizen is held by members of the public who sign in with a
+	// one-time password sent to their mobile.
+	RoleCitizen = "citizen"
+)
+
+// User is a person who can sign in to the platform.
+type User struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email"`
+	Mobile       string    `json:"mobile,omitempty"`
+	Name         string    `json:"name"`
+	PasswordHash string    `json:"-"`
+	AccountID    string    `json:"account_id,omitempty"`
+	Roles        []string  `json:"roles"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// RegisterRequest is the payload for creating a user.
+type RegisterRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	Name     string `json:"name"`
+}
+
+// LoginRequest is the payload for a password login.
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// RefreshRequest exchanges a refresh token for a new token pair.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest revokes a refresh token, or every refresh token of its
+// user when All is set.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+	All          bool   `json:"all"`
+}
+
+// ForgotPasswordRequest starts a password reset.
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// ResetPasswordRequest completes a password reset.
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// FederatedLoginRequest exchanges a token from an external IdP.
+type FederatedLoginRequest struct {
+	// Token is an ID or access token issued by the IdP.
+	Token string `json:"token" binding:"required"`
+}
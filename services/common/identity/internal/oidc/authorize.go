@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"identity/internal/auth"
+	"identity/internal/models"
+)
+
+// AuthorizeRequest holds the parameters of an authorization request.
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// ParseAuthorizeRequest reads an authorization request from query or form
+// values.
+func ParseAuthorizeRequest(v url.Values) AuthorizeRequest {
+	return AuthorizeRequest{
+		ResponseType:        v.Get("response_type"),
+		ClientID:            v.Get("client_id"),
+		RedirectURI:         v.Get("redirect_uri"),
+		Scope:               v.Get("scope"),
+		State:               v.Get("state"),
+		Nonce:               v.Get("nonce"),
+		CodeChallenge:       v.Get("code_challenge"),
+		CodeChallengeMethod: v.Get("code_challenge_method"),
+	}
+}
+
+// Values returns the request as query or form values.
+func (r AuthorizeRequest) Values() url.Values {
+	v := url.Values{}
+	set := func(k, val string) {
+		if val != "" {
+			v.Set(k, val)
+		}
+	}
+	set("response_type", r.ResponseType)
+	set("client_id", r.ClientID)
+	set("redirect_uri", r.RedirectURI)
+	set("scope", r.Scope)
+	set("state", r.State)
+	set("nonce", r.Nonce)
+	set("code_challenge", r.CodeChallenge)
+	set("code_challenge_method", r.CodeChallengeMethod)
+	return v
+}
+
+// ValidateAuthorize checks an authorization request and fills in a default
+// redirect URI. If the client or redirect URI is invalid the returned
+// client is nil and the error must be shown to the user; otherwise errors
+// are reported to the client with ErrorRedirect.
+func (p *Provider) ValidateAuthorize(ctx context.Context, r *AuthorizeRequest) (*models.Client, *Error) {
+	client, err := p.Store.GetClient(ctx, r.ClientID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, oauthError(http.StatusBadRequest, "invalid_request", "unknown client %q", r.ClientID)
+	}
+	if err != nil {
+		return nil, oauthError(http.StatusInternalServerError, "server_error", "%v", err)
+	}
+	if r.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		r.RedirectURI = client.RedirectURIs[0]
+	}
+	if !client.AllowsRedirect(r.RedirectURI) {
+		return nil, oauthError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for the client")
+	}
+	switch {
+	case r.ResponseType != "code":
+		return client, oauthError(http.StatusBadRequest, "unsupported_response_type", "only the code response type is supported")
+	case !client.AllowsGrant(models.GrantAuthorizationCode):
+		return client, oauthError(http.StatusBadRequest, "unauthorized_client", "client may not use the authorization code grant")
+	case !client.AllowsScope(r.Scope):
+		return client, oauthError(http.StatusBadRequest, "invalid_scope", "scope is not registered for the client")
+	case r.CodeChallenge == "" && client.Public():
+		return client, oauthError(http.StatusBadRequest, "invalid_request", "public clients must use PKCE")
+	case r.CodeChallenge != "" && r.CodeChallengeMethod != "S256":
+		return client, oauthError(http.StatusBadRequest, "invalid_request", "code_challenge_method must be S256")
+	case r.CodeChallenge != "" && (len(r.CodeChallenge) < 43 || len(r.CodeChallenge) > 128):
+		return client, oauthError(http.StatusBadRequest, "invalid_request", "code_challenge must be 43 to 128 characters")
+	}
+	return client, nil
+}
+
+// Authorize issues an authorization code for user, who authenticated at
+// authTime, and returns the URL to redirect the user agent to.
+func (p *Provider) Authorize(ctx context.Context, r AuthorizeRequest, user *models.User, authTime time.Time) (string, error) {
+	raw := auth.RandomToken()
+	now := p.now()
+	code := &models.AuthorizationCode{
+		CodeHash:      auth.HashToken(raw),
+		ClientID:      r.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   r.RedirectURI,
+		Scope:         r.Scope,
+		Nonce:         r.Nonce,
+		CodeChallenge: r.CodeChallenge,
+		AuthTime:      authTime,
+		ExpiresAt:     now.Add(p.codeTTL),
+		CreatedAt:     now,
+	}
+	if err := p.Store.CreateAuthorizationCode(ctx, code); err != nil {
+		return "", err
+	}
+	return redirectWith(r.RedirectURI, url.Values{"code": {raw}, "state": {r.State}}), nil
+}
+
+// ErrorRedirect returns the URL that reports e to the client.
+func ErrorRedirect(r AuthorizeRequest, e *Error) string {
+	v := url.Values{"error": {e.Code}, "state": {r.State}}
+	if e.Description != "" {
+		v.Set("error_description", e.Description)
+	}
+	return redirectWith(r.RedirectURI, v)
+}
+
+func redirectWith(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	for k, vs := range params {
+		if len(vs) > 0 && vs[0] != "" {
+			q.Set(k, vs[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// S256Challenge returns the PKCE S256 code challenge for verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,217 @@
+// Package oidc implements the OpenID Connect provider endpoints of the
+// identity service: discovery, the authorization code flow with PKCE, the
+// client credentials grant, and token introspection and revocation.
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"identity/internal/auth"
+	"identity/internal/models"
+)
+
+// Paths of the provider endpoints, relative to the issuer URL.
+const (
+	DiscoveryPath     = "/.well-known/openid-configuration"
+	JWKSPath          = "/jwks.json"
+	AuthorizePath     = "/oauth2/authorize"
+	TokenPath         = "/oauth2/token"
+	UserInfoPath      = "/oauth2/userinfo"
+	IntrospectionPath = "/oauth2/introspect"
+	RevocationPath    = "/oauth2/revoke"
+)
+
+// Scopes defined by OpenID Connect.
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopeOfflineAccess = "offline_access"
+)
+
+// Store is the storage used by the provider in addition to the auth store.
+type Store interface {
+	GetClient(ctx context.Context, id string) (*models.Client, error)
+	UpsertClient(ctx context.Context, client *models.Client) error
+
+	CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error
+	// ConsumeAuthorizationCode marks an unused, unexpired code as used and
+	// returns it. It returns ErrNotFound when the code cannot be used.
+	ConsumeAuthorizationCode(ctx context.Context, hash string, at time.Time) (*models.AuthorizationCode, error)
+}
+
+// Error is an OAuth 2.0 error response (RFC 6749 section 5.2).
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	// Status is the HTTP status of the response.
+	Status int `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(status int, code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Description: fmt.Sprintf(format, args...), Status: status}
+}
+
+// Provider serves the OpenID Connect flows on top of the auth service.
+type Provider struct {
+	Auth  *auth.Service
+	Store Store
+
+	// codeTTL is the lifetime of authorization codes.
+	codeTTL time.Duration
+	now     func() time.Time
+}
+
+// NewProvider returns a Provider issuing tokens through svc.
+func NewProvider(svc *auth.Service, store Store) *Provider {
+	return &Provider{Auth: svc, Store: store, codeTTL: time.Minute, now: time.Now}
+}
+
+// Discovery is the OpenID Provider Metadata document.
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Discovery returns the provider metadata. Endpoint URLs are derived from
+// the token issuer, which must be the public URL of the service.
+func (p *Provider) Discovery() Discovery {
+	base := strings.TrimSuffix(p.Auth.Tokens.Issuer(), "/")
+	return Discovery{
+		Issuer:                            p.Auth.Tokens.Issuer(),
+		AuthorizationEndpoint:             base + AuthorizePath,
+		TokenEndpoint:                     base + TokenPath,
+		UserInfoEndpoint:                  base + UserInfoPath,
+		JWKSURI:                           base + JWKSPath,
+		IntrospectionEndpoint:             base + IntrospectionPath,
+		RevocationEndpoint:                base + RevocationPath,
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeOfflineAccess},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{models.GrantAuthorizationCode, models.GrantRefreshToken, models.GrantClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "name", "roles", "account_id"},
+	}
+}
+
+// LoadClients registers the clients listed in the JSON file at path,
+// replacing earlier registrations with the same client ID.
+func (p *Provider) LoadClients(ctx context.Context, path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var configs []models.ClientConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, cfg := range configs {
+		if err := p.RegisterClient(ctx, cfg); err != nil {
+			return 0, fmt.Errorf("%s: client %q: %v", path, cfg.ClientID, err)
+		}
+	}
+	return len(configs), nil
+}
+
+// RegisterClient validates cfg and stores it as a client.
+func (p *Provider) RegisterClient(ctx context.Context, cfg models.ClientConfig) error {
+	if cfg.ClientID == "" {
+		return errors.New("client_id is required")
+	}
+	if len(cfg.GrantTypes) == 0 {
+		return errors.New("at least one grant type is required")
+	}
+	client := &models.Client{
+		ID:           cfg.ClientID,
+		Name:         cfg.Name,
+		RedirectURIs: cfg.RedirectURIs,
+		GrantTypes:   cfg.GrantTypes,
+		Scopes:       cfg.Scopes,
+		CreatedAt:    p.now().UTC(),
+	}
+	if cfg.ClientSecret != "" {
+		client.SecretHash = auth.HashToken(cfg.ClientSecret)
+	}
+	for _, g := range cfg.GrantTypes {
+		switch g {
+		case models.GrantAuthorizationCode:
+			if len(cfg.RedirectURIs) == 0 {
+				return errors.New("authorization_code clients need a redirect URI")
+			}
+		case models.GrantClientCredentials:
+			if client.Public() {
+				return errors.New("client_credentials clients need a secret")
+			}
+		case models.GrantRefreshToken:
+		default:
+			return fmt.Errorf("unsupported grant type %q", g)
+		}
+	}
+	return p.Store.UpsertClient(ctx, client)
+}
+
+// AuthenticateClient resolves the client making a back-channel request.
+// Confidential clients must present their secret; public clients present
+// only their ID.
+func (p *Provider) AuthenticateClient(ctx context.Context, id, secret string) (*models.Client, *Error) {
+	invalid := oauthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	if id == "" {
+		return nil, invalid
+	}
+	client, err := p.Store.GetClient(ctx, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, invalid
+		}
+		return nil, oauthError(http.StatusInternalServerError, "server_error", "%v", err)
+	}
+	if client.Public() {
+		if secret != "" {
+			return nil, invalid
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, invalid
+	}
+	return client, nil
+}
+
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
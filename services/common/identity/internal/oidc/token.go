@@ -0,0 +1,228 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"identity/internal/auth"
+	"identity/internal/models"
+	"identity/internal/token"
+)
+
+func serverError(err error) *Error {
+	log.Printf("oidc: %v", err)
+	return oauthError(http.StatusInternalServerError, "server_error", "internal error")
+}
+
+// Exchange serves a token endpoint request from an authenticated client.
+func (p *Provider) Exchange(ctx context.Context, client *models.Client, form url.Values) (*models.TokenPair, *Error) {
+	grant := form.Get("grant_type")
+	if !client.AllowsGrant(grant) {
+		switch grant {
+		case models.GrantAuthorizationCode, models.GrantRefreshToken, models.GrantClientCredentials:
+			return nil, oauthError(http.StatusBadRequest, "unauthorized_client", "client may not use the %s grant", grant)
+		}
+		return nil, oauthError(http.StatusBadRequest, "unsupported_grant_type", "grant type %q is not supported", grant)
+	}
+	switch grant {
+	case models.GrantAuthorizationCode:
+		return p.exchangeCode(ctx, client, form)
+	case models.GrantRefreshToken:
+		pair, err := p.Auth.Refresh(ctx, form.Get("refresh_token"), client.ID)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, oauthError(http.StatusBadRequest, "invalid_grant", "refresh token is invalid or expired")
+		}
+		if err != nil {
+			return nil, serverError(err)
+		}
+		return pair, nil
+	default:
+		return p.clientCredentials(client, form)
+	}
+}
+
+func (p *Provider) exchangeCode(ctx context.Context, client *models.Client, form url.Values) (*models.TokenPair, *Error) {
+	invalid := oauthError(http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+	code, err := p.Store.ConsumeAuthorizationCode(ctx, auth.HashToken(form.Get("code")), p.now())
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, invalid
+	}
+	if err != nil {
+		return nil, serverError(err)
+	}
+	if code.ClientID != client.ID || code.RedirectURI != form.Get("redirect_uri") {
+		return nil, invalid
+	}
+	verifier := form.Get("code_verifier")
+	if code.CodeChallenge != "" || verifier != "" {
+		if subtle.ConstantTimeCompare([]byte(S256Challenge(verifier)), []byte(code.CodeChallenge)) != 1 {
+			return nil, oauthError(http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code challenge")
+		}
+	}
+
+	user, err := p.Auth.Store.GetUser(ctx, code.UserID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, invalid
+	}
+	if err != nil {
+		return nil, serverError(err)
+	}
+	pair, err := p.Auth.IssueTokens(ctx, user, auth.Grant{ClientID: client.ID, Scope: code.Scope})
+	if err != nil {
+		return nil, serverError(err)
+	}
+	if hasScope(code.Scope, ScopeOpenID) {
+		claims := token.IDClaims{Nonce: code.Nonce, AuthTime: code.AuthTime.Unix()}
+		if hasScope(code.Scope, ScopeEmail) {
+			claims.Email = user.Email
+		}
+		if hasScope(code.Scope, ScopeProfile) {
+			claims.Name = user.Name
+		}
+		if pair.IDToken, err = p.Auth.Tokens.IssueID(user.ID, client.ID, claims); err != nil {
+			return nil, serverError(err)
+		}
+	}
+	return pair, nil
+}
+
+// clientCredentials issues an access token to the client itself. Without a
+// scope parameter every scope registered for the client is granted.
+func (p *Provider) clientCredentials(client *models.Client, form url.Values) (*models.TokenPair, *Error) {
+	if client.Public() {
+		return nil, oauthError(http.StatusBadRequest, "unauthorized_client", "public clients may not use the client_credentials grant")
+	}
+	scope := form.Get("scope")
+	if scope == "" {
+		scope = strings.Join(client.Scopes, " ")
+	}
+	if !client.AllowsScope(scope) {
+		return nil, oauthError(http.StatusBadRequest, "invalid_scope", "scope is not registered for the client")
+	}
+	access, err := p.Auth.Tokens.Issue(client.ID, token.Claims{ClientID: client.ID, Scope: scope})
+	if err != nil {
+		return nil, serverError(err)
+	}
+	return &models.TokenPair{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.Auth.Tokens.TTL().Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// Introspection is a token introspection response (RFC 7662).
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Introspect reports whether raw is an active token. Only confidential
+// clients may introspect, and a refresh token is only described to the
+// client it was issued to.
+func (p *Provider) Introspect(ctx context.Context, client *models.Client, raw string) (*Introspection, *Error) {
+	if client.Public() {
+		return nil, oauthError(http.StatusUnauthorized, "invalid_client", "public clients may not introspect tokens")
+	}
+	claims, err := p.Auth.VerifyAccessToken(ctx, raw)
+	if err == nil {
+		return &Introspection{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			TokenType: "access_token",
+			Subject:   claims.Subject,
+			Audience:  claims.Audience,
+			Issuer:    claims.Issuer,
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+			ID:        claims.ID,
+		}, nil
+	}
+	if !errors.Is(err, auth.ErrInvalidToken) {
+		return nil, serverError(err)
+	}
+	rt, err := p.Auth.Store.GetRefreshToken(ctx, auth.HashToken(raw))
+	if errors.Is(err, models.ErrNotFound) {
+		return &Introspection{}, nil
+	}
+	if err != nil {
+		return nil, serverError(err)
+	}
+	if rt.ClientID != client.ID || !rt.Active(p.now()) {
+		return &Introspection{}, nil
+	}
+	return &Introspection{
+		Active:    true,
+		Scope:     rt.Scope,
+		ClientID:  rt.ClientID,
+		TokenType: "refresh_token",
+		Subject:   rt.UserID,
+		Issuer:    p.Auth.Tokens.Issuer(),
+		ExpiresAt: rt.ExpiresAt.Unix(),
+		IssuedAt:  rt.CreatedAt.Unix(),
+	}, nil
+}
+
+// Revoke revokes an access or refresh token issued to client (RFC 7009).
+// Revoking a refresh token revokes every token rotated from the same grant.
+// Unknown tokens and tokens of other clients are ignored.
+func (p *Provider) Revoke(ctx context.Context, client *models.Client, raw string) *Error {
+	if claims, err := p.Auth.Tokens.Verify(raw); err == nil {
+		if claims.ClientID != client.ID {
+			return nil
+		}
+		if err := p.Auth.RevokeAccessToken(ctx, claims); err != nil {
+			return serverError(err)
+		}
+		return nil
+	}
+	rt, err := p.Auth.Store.GetRefreshToken(ctx, auth.HashToken(raw))
+	if errors.Is(err, models.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return serverError(err)
+	}
+	if rt.ClientID != client.ID {
+		return nil
+	}
+	if err := p.Auth.Store.RevokeRefreshTokenFamily(ctx, rt.FamilyID, p.now()); err != nil {
+		return serverError(err)
+	}
+	return nil
+}
+
+// UserInfo is the response of the userinfo endpoint.
+type UserInfo struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// UserInfo returns the claims about user released by the scopes of the
+// access token. First-party tokens, which carry no scope, release all of
+// them.
+func (p *Provider) UserInfo(user *models.User, claims *token.Claims) UserInfo {
+	info := UserInfo{Subject: user.ID}
+	if claims.Scope == "" || hasScope(claims.Scope, ScopeEmail) {
+		info.Email = user.Email
+	}
+	if claims.Scope == "" || hasScope(claims.Scope, ScopeProfile) {
+		info.Name = user.Name
+	}
+	return info
+}
@@ -0,0 +1,293 @@
+// Package otp signs citizens in with one-time passwords sent by SMS to
+// their mobile number. Citizens are registered on their first login.
+package otp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"identity/internal/auth"
+	"identity/internal/lockout"
+	"identity/internal/models"
+)
+
+// Errors returned by Service.
+var (
+	ErrInvalidMobile = errors.New("mobile must be a phone number of 8 to 15 digits, optionally prefixed with +")
+	ErrInvalidCode   = errors.New("invalid or expired one-time password")
+	ErrRateLimited   = errors.New("too many one-time passwords requested")
+	// ErrNotCitizen is returned for mobiles of users who sign in with a
+	// password.
+	ErrNotCitizen = errors.New("this user must sign in with a password")
+)
+
+// RateLimitError reports when another code can be requested.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v; try again in %s", ErrRateLimited, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Unwrap() error { return ErrRateLimited }
+
+// Store is the storage used by Service.
+type Store interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByMobile(ctx context.Context, mobile string) (*models.User, error)
+
+	GetOTP(ctx context.Context, mobile string) (*models.OTP, error)
+	// PutOTP stores o, replacing the mobile's previous code.
+	PutOTP(ctx context.Context, o *models.OTP) error
+	// AttemptOTP counts an attempt at the mobile's code if it is set,
+	// unexpired at now and has had fewer than maxAttempts attempts, and
+	// returns ErrNotFound otherwise. It is atomic, so that concurrent
+	// guesses cannot exceed maxAttempts.
+	AttemptOTP(ctx context.Context, mobile string, maxAttempts int, now time.Time) error
+	// ConsumeOTP atomically clears the mobile's code if it is codeHash,
+	// unexpired at now and has had at most maxAttempts attempts, and
+	// returns ErrNotFound otherwise, so that a code works only once.
+	ConsumeOTP(ctx context.Context, mobile, codeHash string, maxAttempts int, now time.Time) error
+}
+
+// Config configures a Service.
+type Config struct {
+	// Length is the number of digits in a code. Zero means 6.
+	Length int
+	// TTL is the lifetime of a code. Zero means 5 minutes.
+	TTL time.Duration
+	// MaxAttempts is the number of wrong codes a code survives. Zero
+	// means 5.
+	MaxAttempts int
+	// ResendInterval is the minimum time between codes sent to a mobile.
+	// Zero means 30 seconds.
+	ResendInterval time.Duration
+	// MaxSends is the number of codes sent to a mobile per hour. Zero
+	// means 5.
+	MaxSends int
+	// MaxSendsPerIP is the number of codes a client IP can request per
+	// hour when the Service has a Limiter. Zero means 20.
+	MaxSendsPerIP int
+	// Sender delivers codes. It is required.
+	Sender Sender
+	// Secret keys the HMAC codes are stored as, so that a copy of the
+	// store cannot be brute-forced offline. Every replica must share it.
+	// Empty means a random key, with which only this process can verify
+	// the codes it sent.
+	Secret []byte
+}
+
+// Service implements the OTP login.
+type Service struct {
+	Store  Store
+	Auth   *auth.Service
+	Sender Sender
+	// Limiter, when set, counts the codes requested per client IP. It is
+	// normally the store of the login lockout guard.
+	Limiter lockout.Store
+
+	cfg Config
+	key []byte
+	now func() time.Time
+}
+
+// NewService returns a Service backed by store that issues tokens through
+// svc.
+func NewService(store Store, svc *auth.Service, cfg Config) *Service {
+	if cfg.Length == 0 {
+		cfg.Length = 6
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = 5 * time.Minute
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.ResendInterval == 0 {
+		cfg.ResendInterval = 30 * time.Second
+	}
+	if cfg.MaxSends == 0 {
+		cfg.MaxSends = 5
+	}
+	if cfg.MaxSendsPerIP == 0 {
+		cfg.MaxSendsPerIP = 20
+	}
+	s := &Service{Store: store, Auth: svc, Sender: cfg.Sender, cfg: cfg, key: cfg.Secret, now: time.Now}
+	if len(s.key) == 0 {
+		s.key = make([]byte, 32)
+		if _, err := rand.Read(s.key); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+var mobilePattern = regexp.MustCompile(`^\+?[0-9]{8,15}$`)
+
+// NormalizeMobile returns the canonical form used to store and look up
+// mobile numbers: digits with an optional leading +, without spaces,
+// dashes or parentheses.
+func NormalizeMobile(mobile string) (string, error) {
+	m := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" -().", r) {
+			return -1
+		}
+		return r
+	}, mobile)
+	if !mobilePattern.MatchString(m) {
+		return "", ErrInvalidMobile
+	}
+	return m, nil
+}
+
+// hash returns the stored form of a code sent to mobile.
+func (s *Service) hash(mobile, code string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(mobile + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newCode returns a random code of n digits.
+func newCode(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			panic(err)
+		}
+		b[i] = byte('0' + d.Int64())
+	}
+	return string(b)
+}
+
+// Request sends a code to mobile, replacing any code sent before. It
+// returns a *RateLimitError when codes are requested too often. Codes are
+// sent to unregistered mobiles too, so that callers cannot tell which are
+// registered.
+func (s *Service) Request(ctx context.Context, mobile string) (*models.OTPSentResponse, error) {
+	mobile, err := NormalizeMobile(mobile)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	o, err := s.Store.GetOTP(ctx, mobile)
+	if errors.Is(err, models.ErrNotFound) {
+		o = &models.OTP{Mobile: mobile, WindowStart: now}
+	} else if err != nil {
+		return nil, err
+	}
+	if wait := o.CreatedAt.Add(s.cfg.ResendInterval).Sub(now); wait > 0 {
+		return nil, &RateLimitError{RetryAfter: wait}
+	}
+	if now.Sub(o.WindowStart) >= models.OTPSendWindow {
+		o.Sends, o.WindowStart = 0, now
+	}
+	if o.Sends >= s.cfg.MaxSends {
+		return nil, &RateLimitError{RetryAfter: o.WindowStart.Add(models.OTPSendWindow).Sub(now)}
+	}
+	if ip := auth.ClientInfoFrom(ctx).IP; s.Limiter != nil && ip != "" {
+		n, err := s.Limiter.Fail(ctx, "otp-ip:"+ip, time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		if n > s.cfg.MaxSendsPerIP {
+			return nil, &RateLimitError{RetryAfter: time.Hour}
+		}
+	}
+	code := newCode(s.cfg.Length)
+	o.CodeHash = s.hash(mobile, code)
+	o.Attempts = 0
+	o.Sends++
+	o.ExpiresAt = now.Add(s.cfg.TTL)
+	o.CreatedAt = now
+	if err := s.Store.PutOTP(ctx, o); err != nil {
+		return nil, err
+	}
+	if err := s.Sender.SendOTP(ctx, mobile, code); err != nil {
+		return nil, fmt.Errorf("send OTP: %w", err)
+	}
+	return &models.OTPSentResponse{
+		ExpiresIn: int(s.cfg.TTL.Seconds()),
+		ResendIn:  int(s.cfg.ResendInterval.Seconds()),
+	}, nil
+}
+
+// Verify checks the code sent to mobile and returns a token pair for the
+// citizen with that mobile, registering them with name on first login. A
+// code is dropped after MaxAttempts wrong guesses.
+func (s *Service) Verify(ctx context.Context, req models.OTPVerifyRequest) (*models.TokenPair, error) {
+	mobile, err := NormalizeMobile(req.Mobile)
+	if err != nil {
+		return nil, err
+	}
+	// The attempt is counted before the code is checked, so that
+	// concurrent guesses cannot outnumber MaxAttempts.
+	now := s.now()
+	if err := s.Store.AttemptOTP(ctx, mobile, s.cfg.MaxAttempts, now); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, ErrInvalidCode
+		}
+		return nil, err
+	}
+	if err := s.Store.ConsumeOTP(ctx, mobile, s.hash(mobile, strings.TrimSpace(req.Code)), s.cfg.MaxAttempts, now); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, ErrInvalidCode
+		}
+		return nil, err
+	}
+
+	user, err := s.Store.GetUserByMobile(ctx, mobile)
+	if errors.Is(err, models.ErrNotFound) {
+		user, err = s.register(ctx, mobile, req.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !hasRole(user, models.RoleCitizen) {
+		return nil, ErrNotCitizen
+	}
+	return s.Auth.IssueTokens(ctx, user, auth.Grant{})
+}
+
+// register creates a citizen with mobile.
+func (s *Service) register(ctx context.Context, mobile, name string) (*models.User, error) {
+	now := s.now().UTC()
+	user := &models.User{
+		ID:        uuid.NewString(),
+		Mobile:    mobile,
+		Name:      strings.TrimSpace(name),
+		Roles:     []string{models.RoleCitizen},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := s.Store.CreateUser(ctx, user)
+	if errors.Is(err, models.ErrConflict) {
+		// Registered concurrently by another login.
+		return s.Store.GetUserByMobile(ctx, mobile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func hasRole(user *models.User, role string) bool {
+	for _, r := range user.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
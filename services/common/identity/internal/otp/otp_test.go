@@ -0,0 +1,155 @@
+package otp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"identity/internal/auth"
+	"identity/internal/memory"
+	"identity/internal/models"
+	"identity/internal/token"
+)
+
+type captureSender struct{ code string }
+
+func (s *captureSender) SendOTP(_ context.Context, _, code string) error {
+	s.code = code
+	return nil
+}
+
+func TestNormalizeMobile(t *testing.T) {
+	for in, want := range map[string]string{
+		"+91 98765 43210": "+919876543210",
+		"(080) 2222-3333": "08022223333",
+		"98765":           "",
+		"+91-98765-abcde": "",
+	} {
+		got, err := NormalizeMobile(in)
+		if got != want || (err != nil) != (want == "") {
+			t.Errorf("NormalizeMobile(%q) = %q, %v", in, got, err)
+		}
+	}
+}
+
+// newTestService returns a Service over a memory store that captures the
+// codes it sends.
+func newTestService(t *testing.T, cfg Config) (*Service, *memory.Store, *captureSender) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := memory.NewStore()
+	issuer := token.NewIssuer(token.StaticKeySet(key), token.Config{Issuer: "http://identity.test", Audience: "digit", TTL: time.Minute})
+	svc, err := auth.NewService(store, issuer, auth.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &captureSender{}
+	cfg.Sender = sender
+	return NewService(store, svc, cfg), store, sender
+}
+
+func TestRateLimitsAndAttempts(t *testing.T) {
+	ctx := context.Background()
+	s, store, sender := newTestService(t, Config{Length: 4, MaxAttempts: 2, MaxSends: 2})
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	const mobile = "+919876543210"
+
+	if _, err := s.Request(ctx, mobile); err != nil || len(sender.code) != 4 {
+		t.Fatalf("Request = %v, code %q", err, sender.code)
+	}
+	now = now.Add(time.Minute)
+	if _, err := s.Request(ctx, mobile); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	var limited *RateLimitError
+	if _, err := s.Request(ctx, mobile); !errors.As(err, &limited) || limited.RetryAfter != 58*time.Minute {
+		t.Fatalf("third Request = %v", err)
+	}
+
+	// The code is dropped after MaxAttempts wrong guesses.
+	for i := 0; i < 2; i++ {
+		if _, err := s.Verify(ctx, models.OTPVerifyRequest{Mobile: mobile, Code: "wrong"}); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("Verify(wrong) = %v", err)
+		}
+	}
+	if _, err := s.Verify(ctx, models.OTPVerifyRequest{Mobile: mobile, Code: sender.code}); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Verify after too many attempts = %v", err)
+	}
+
+	// Users who sign in with a password cannot use an OTP.
+	now = now.Add(time.Hour)
+	store.CreateUser(ctx, &models.User{ID: "u1", Email: "ravi@example.org", Mobile: mobile, Roles: []string{models.RoleUser}})
+	if _, err := s.Request(ctx, mobile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Verify(ctx, models.OTPVerifyRequest{Mobile: mobile, Code: sender.code}); !errors.Is(err, ErrNotCitizen) {
+		t.Fatalf("Verify for a password user = %v", err)
+	}
+}
+
+func TestConcurrentGuesses(t *testing.T) {
+	ctx := context.Background()
+	s, store, sender := newTestService(t, Config{Length: 4, MaxAttempts: 3, Secret: []byte("server secret")})
+	const mobile = "+919876543210"
+	if _, err := s.Request(ctx, mobile); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stored hash is keyed, so the table alone does not reveal codes.
+	o, _ := store.GetOTP(ctx, mobile)
+	if o.CodeHash == auth.HashToken(mobile+":"+sender.code) {
+		t.Error("code stored as an unkeyed hash")
+	}
+
+	// Of many concurrent guesses, only MaxAttempts are checked.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Verify(ctx, models.OTPVerifyRequest{Mobile: mobile, Code: "0000x"})
+		}()
+	}
+	wg.Wait()
+	if o, _ := store.GetOTP(ctx, mobile); o.Attempts != 3 {
+		t.Errorf("attempts = %d, want 3", o.Attempts)
+	}
+	if _, err := s.Verify(ctx, models.OTPVerifyRequest{Mobile: mobile, Code: sender.code}); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Verify after MaxAttempts concurrent guesses = %v", err)
+	}
+}
+
+func TestWebhookSender(t *testing.T) {
+	var sent map[string]string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.Error(w, "unavailable", http.StatusBadGateway)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&sent)
+	}))
+	defer gateway.Close()
+
+	ctx := context.Background()
+	if err := (&WebhookSender{URL: gateway.URL}).SendOTP(ctx, "+919876543210", "123456"); err != nil {
+		t.Fatal(err)
+	}
+	if sent["mobile"] != "+919876543210" || sent["code"] != "123456" {
+		t.Errorf("webhook got %v", sent)
+	}
+	if err := (&WebhookSender{URL: gateway.URL + "/down"}).SendOTP(ctx, "+919876543210", "123456"); err == nil {
+		t.Error("gateway failure not reported")
+	}
+}
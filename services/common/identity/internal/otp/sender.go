@@ -0,0 +1,67 @@
+package otp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Sender delivers one-time passwords by SMS.
+type Sender interface {
+	SendOTP(ctx context.Context, mobile, code string) error
+}
+
+// LogSender writes codes to the service log. It stands in for an SMS
+// gateway during development and must not be used elsewhere: anyone who
+// can read the log can sign in as any citizen.
+type LogSender struct{}
+
+// SendOTP logs code for mobile.
+func (LogSender) SendOTP(_ context.Context, mobile, code string) error {
+	log.Printf("OTP for %s: %s", mobile, code)
+	return nil
+}
+
+// WebhookSender posts codes to an SMS gateway as JSON:
+//
+//	{"mobile": "+919876543210", "code": "123456"}
+//
+// Any status other than 2xx is an error.
+type WebhookSender struct {
+	URL string
+	// Client sends the requests. Nil means a client with a 10 second
+	// timeout.
+	Client *http.Client
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// SendOTP posts code for mobile to the webhook.
+func (s *WebhookSender) SendOTP(ctx context.Context, mobile, code string) error {
+	client := s.Client
+	if client == nil {
+		client = webhookClient
+	}
+	body, err := json.Marshal(map[string]string{"mobile": mobile, "code": code})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: status %d", s.URL, resp.StatusCode)
+	}
+	return nil
+}
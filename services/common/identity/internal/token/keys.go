@@ -0,0 +1,234 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SigningKey is an RSA key used to sign tokens. Keys are published in the
+// JWKS until ExpiresAt so that tokens signed shortly before a rotation keep
+// verifying.
+type SigningKey struct {
+	ID        string
+	Key       *rsa.PrivateKey
+	CreatedAt time.Time
+	// ExpiresAt is when the key leaves the key set. The zero time keeps it
+	// forever.
+	ExpiresAt time.Time
+}
+
+// KeyStore persists signing keys so that every replica signs and verifies
+// with the same set.
+type KeyStore interface {
+	SigningKeys(ctx context.Context) ([]SigningKey, error)
+	AddSigningKey(ctx context.Context, key SigningKey) error
+	DeleteSigningKeys(ctx context.Context, expiredBefore time.Time) error
+}
+
+// ReloadInterval is how often Run reloads the key set from the store.
+const ReloadInterval = time.Minute
+
+// KeySet is the set of keys the Issuer signs and verifies with. Every key
+// in the set verifies and is published in the JWKS, but a new key only
+// signs once it is old enough for every replica to have loaded it; until
+// then the previous key keeps signing.
+type KeySet struct {
+	store KeyStore
+	// rotateEvery is the age at which a new key is generated. Zero disables
+	// rotation.
+	rotateEvery time.Duration
+	// retain is how long a key stays in the set after it stops signing. It
+	// must exceed the longest token lifetime.
+	retain time.Duration
+	// activateAfter is the age at which a key starts signing. It exceeds
+	// ReloadInterval so that other replicas verify a key before it is
+	// used.
+	activateAfter time.Duration
+	now           func() time.Time
+
+	mu   sync.RWMutex
+	keys []SigningKey // newest first
+}
+
+// StaticKeySet returns a KeySet holding only key, which never rotates.
+func StaticKeySet(key *rsa.PrivateKey) *KeySet {
+	return &KeySet{
+		now:  time.Now,
+		keys: []SigningKey{{ID: KeyID(&key.PublicKey), Key: key}},
+	}
+}
+
+// NewKeySet returns a KeySet persisted in store that generates a new key
+// every rotateEvery and drops retired keys retain after they stop signing.
+// It loads the stored keys, creating the first one if there are none.
+func NewKeySet(ctx context.Context, store KeyStore, rotateEvery, retain time.Duration) (*KeySet, error) {
+	if rotateEvery <= 0 {
+		return nil, errors.New("key rotation interval must be positive")
+	}
+	ks := &KeySet{store: store, rotateEvery: rotateEvery, retain: retain, activateAfter: 2 * ReloadInterval, now: time.Now}
+	if err := ks.Rotate(ctx); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Rotate reloads the keys from the store, generates a new signing key if
+// the newest one is older than the rotation interval and removes expired
+// keys. It is a no-op for a static key set.
+func (ks *KeySet) Rotate(ctx context.Context) error {
+	if ks.store == nil {
+		return nil
+	}
+	now := ks.now()
+	if err := ks.store.DeleteSigningKeys(ctx, now); err != nil {
+		return err
+	}
+	keys, err := ks.store.SigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	if len(keys) == 0 || now.Sub(keys[0].CreatedAt) >= ks.rotateEvery {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+		sk := SigningKey{
+			ID:        KeyID(&key.PublicKey),
+			Key:       key,
+			CreatedAt: now,
+			ExpiresAt: now.Add(ks.rotateEvery + ks.activateAfter + ks.retain),
+		}
+		if err := ks.store.AddSigningKey(ctx, sk); err != nil {
+			return err
+		}
+		log.Printf("generated signing key %s", sk.ID)
+		keys = append([]SigningKey{sk}, keys...)
+	}
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+	return nil
+}
+
+// Run calls Rotate every ReloadInterval until ctx is done. Rotate is cheap
+// when nothing is due; the interval bounds how long a replica takes to see
+// a key made by another, which is why new keys wait longer than that
+// before they sign.
+func (ks *KeySet) Run(ctx context.Context) {
+	ticker := time.NewTicker(ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Rotate(ctx); err != nil {
+				log.Printf("rotate signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// Active returns the key that signs new tokens: the newest key old enough
+// to sign, or the oldest key when none is, as when the set was just
+// created.
+func (ks *KeySet) Active() SigningKey {
+	now := ks.now()
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.keys {
+		if now.Sub(k.CreatedAt) >= ks.activateAfter {
+			return k
+		}
+	}
+	return ks.keys[len(ks.keys)-1]
+}
+
+// PublicKey returns the public key with id kid.
+func (ks *KeySet) PublicKey(kid string) (*rsa.PublicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.keys {
+		if k.ID == kid {
+			return &k.Key.PublicKey, true
+		}
+	}
+	return nil, false
+}
+
+// JWK is an RSA public key in JSON Web Key form (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every key in the set.
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	set := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		pub := k.Key.PublicKey
+		set.Keys = append(set.Keys, JWK{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: "RS256",
+			KeyID:     k.ID,
+			N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	return set
+}
+
+// EncodePrivateKey returns key as a PKCS#8 PEM block, the form signing keys
+// are stored in.
+func EncodePrivateKey(key *rsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// DecodePrivateKey parses a PEM encoded RSA private key in PKCS#1 or PKCS#8
+// form.
+func DecodePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA private key")
+	}
+	return key, nil
+}
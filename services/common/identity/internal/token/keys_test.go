@@ -0,0 +1,145 @@
+package token
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// keyStore is a KeyStore kept in a slice.
+type keyStore struct{ keys []SigningKey }
+
+func (s *keyStore) SigningKeys(context.Context) ([]SigningKey, error) {
+	return append([]SigningKey(nil), s.keys...), nil
+}
+
+func (s *keyStore) AddSigningKey(_ context.Context, k SigningKey) error {
+	s.keys = append(s.keys, k)
+	return nil
+}
+
+func (s *keyStore) DeleteSigningKeys(_ context.Context, before time.Time) error {
+	kept := s.keys[:0]
+	for _, k := range s.keys {
+		if k.ExpiresAt.After(before) {
+			kept = append(kept, k)
+		}
+	}
+	s.keys = kept
+	return nil
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &keyStore{}
+	ks, err := NewKeySet(ctx, store, time.Hour, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rebase the first key on the fake clock.
+	store.keys[0].CreatedAt, store.keys[0].ExpiresAt = now, now.Add(72*time.Minute)
+	ks.now = func() time.Time { return now }
+
+	issuer := NewIssuer(ks, Config{Issuer: "iss", Audience: "aud", TTL: 2 * time.Hour})
+	issuer.now = ks.now
+	old, err := issuer.Issue("user", Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := ks.Active().ID
+
+	now = now.Add(30 * time.Minute)
+	if err := ks.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ks.Active().ID != first || len(ks.JWKS().Keys) != 1 {
+		t.Fatal("key rotated before the interval elapsed")
+	}
+
+	// A new key is published at once but signs only once other replicas
+	// have had time to load it.
+	now = now.Add(31 * time.Minute)
+	if err := ks.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ks.Active().ID != first || len(ks.JWKS().Keys) != 2 {
+		t.Fatalf("expected the new key to be published but not active, have %d keys", len(ks.JWKS().Keys))
+	}
+	now = now.Add(2 * time.Minute)
+	if ks.Active().ID == first {
+		t.Fatal("new key not active after the activation delay")
+	}
+	// Tokens signed with the retired key still verify while it is retained.
+	if _, err := issuer.Verify(old); err != nil {
+		t.Fatalf("token signed with retired key: %v", err)
+	}
+	fresh, err := issuer.Issue("user", Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Verify(fresh); err != nil {
+		t.Fatalf("token signed with new key: %v", err)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if err := ks.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ks.PublicKey(first); ok || len(ks.JWKS().Keys) != 1 {
+		t.Fatal("expired key was not removed")
+	}
+}
+
+func TestKeyRotationAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	store := &keyStore{}
+	a, err := NewKeySet(ctx, store, time.Hour, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKeySet(ctx, store, time.Hour, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.keys) != 1 {
+		t.Fatalf("replicas created %d keys, want 1", len(store.keys))
+	}
+	now := store.keys[0].CreatedAt
+	clock := func() time.Time { return now }
+	a.now, b.now = clock, clock
+	issuerA := NewIssuer(a, Config{Issuer: "iss", Audience: "aud", TTL: time.Hour})
+	issuerB := NewIssuer(b, Config{Issuer: "iss", Audience: "aud", TTL: time.Hour})
+	issuerA.now, issuerB.now = clock, clock
+
+	// Replica a rotates; b has not reloaded yet, so a's tokens must stay
+	// signed with a key b knows.
+	now = now.Add(time.Hour)
+	if err := a.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := issuerA.Issue("user", Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuerB.Verify(raw); err != nil {
+		t.Fatalf("replica b rejects a token from a just after rotation: %v", err)
+	}
+
+	// Within ReloadInterval b has loaded the new key, before a signs with
+	// it.
+	now = now.Add(ReloadInterval)
+	if err := b.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(ReloadInterval)
+	if a.Active().ID != b.Active().ID || a.Active().ID == store.keys[0].ID {
+		t.Fatal("replicas disagree on the active key")
+	}
+	if raw, err = issuerA.Issue("user", Claims{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuerB.Verify(raw); err != nil {
+		t.Fatalf("replica b rejects a token signed with the new key: %v", err)
+	}
+}
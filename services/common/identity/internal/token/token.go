@@ -0,0 +1,167 @@
+// Package token issues and verifies the RS256-signed JWTs that the identity
+// service hands out to the rest of the platform.
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ErrInvalid is returned for tokens that fail signature, issuer, audience
+// or expiry checks.
+var ErrInvalid = errors.New("invalid token")
+
+// Claims are the claims carried by an access token.
+type Claims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+	// PhoneNumber is the mobile of citizens signing in with an OTP.
+	PhoneNumber string   `json:"phone_number,omitempty"`
+	AccountID   string   `json:"account_id,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	// Scope is the space-separated list of OAuth scopes granted.
+	Scope string `json:"scope,omitempty"`
+	// ClientID is the OAuth client the token was issued to.
+	ClientID string `json:"client_id,omitempty"`
+	// SessionID is the session the token was issued in.
+	SessionID string `json:"sid,omitempty"`
+}
+
+// IDClaims are the claims carried by an OpenID Connect ID token.
+type IDClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+}
+
+// Config configures an Issuer.
+type Config struct {
+	// Issuer is the iss claim, normally the public URL of the service.
+	Issuer string
+	// Audience is the aud claim expected by consuming services.
+	Audience string
+	// TTL is the lifetime of access and ID tokens.
+	TTL time.Duration
+}
+
+// Issuer signs and verifies tokens with a KeySet.
+type Issuer struct {
+	cfg  Config
+	keys *KeySet
+	now  func() time.Time
+}
+
+// NewIssuer returns an Issuer that signs with the active key of keys.
+func NewIssuer(keys *KeySet, cfg Config) *Issuer {
+	return &Issuer{cfg: cfg, keys: keys, now: time.Now}
+}
+
+// TTL returns the lifetime of issued tokens.
+func (i *Issuer) TTL() time.Duration { return i.cfg.TTL }
+
+// Issuer returns the iss claim of issued tokens.
+func (i *Issuer) Issuer() string { return i.cfg.Issuer }
+
+// Keys returns the key set tokens are signed with.
+func (i *Issuer) Keys() *KeySet { return i.keys }
+
+func (i *Issuer) registered(subject string, audience string) jwt.RegisteredClaims {
+	now := i.now()
+	return jwt.RegisteredClaims{
+		Issuer:    i.cfg.Issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(i.cfg.TTL)),
+		ID:        uuid.NewString(),
+	}
+}
+
+// Issue signs an access token for subject carrying claims. Registered
+// claims other than the subject are filled in by the Issuer.
+func (i *Issuer) Issue(subject string, claims Claims) (string, error) {
+	claims.RegisteredClaims = i.registered(subject, i.cfg.Audience)
+	return i.sign(claims)
+}
+
+// IssueID signs an ID token for subject addressed to clientID.
+func (i *Issuer) IssueID(subject, clientID string, claims IDClaims) (string, error) {
+	claims.RegisteredClaims = i.registered(subject, clientID)
+	return i.sign(claims)
+}
+
+func (i *Issuer) sign(claims jwt.Claims) (string, error) {
+	key := i.keys.Active()
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = key.ID
+	return t.SignedString(key.Key)
+}
+
+// Verify parses an access token and checks its signature and registered
+// claims.
+func (i *Issuer) Verify(raw string) (*Claims, error) {
+	claims := new(Claims)
+	_, err := jwt.ParseWithClaims(raw, claims, i.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(i.cfg.Issuer),
+		jwt.WithAudience(i.cfg.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(i.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return claims, nil
+}
+
+func (i *Issuer) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := i.keys.PublicKey(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// KeyID derives a stable key ID from the SHA-256 of the DER-encoded public
+// key.
+func KeyID(pub *rsa.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// LoadKey reads a PEM encoded RSA private key (PKCS#1 or PKCS#8) from path.
+// An empty path generates an ephemeral key, which is only suitable for
+// development because tokens stop verifying when the service restarts.
+func LoadKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		log.Println("JWT signing key not configured; using an ephemeral key")
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := DecodePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
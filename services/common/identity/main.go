@@ -4,57 +4,361 @@
 // @description This service handles identity and authentication related operations
 // @host localhost:8000
 // @BasePath /identity
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access token from /auth/login, as "Bearer <token>".
 
 package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/digitnxt/digit/pkg/authz"
+	"github.com/digitnxt/digit/pkg/config"
+	"github.com/digitnxt/digit/pkg/observability"
+	"github.com/digitnxt/digit/pkg/service"
+	"github.com/digitnxt/digit/pkg/svcauth"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 
-	"identity/internal/discovery"
-	"identity/internal/docs"
+	"identity/internal/auth"
+	"identity/internal/database"
 	_ "identity/internal/docs" // This is important! It imports the generated docs
-	"identity/internal/observability"
+	"identity/internal/federation"
+	"identity/internal/handlers"
+	"identity/internal/lockout"
+	"identity/internal/memory"
+	"identity/internal/mfa"
+	"identity/internal/oidc"
+	"identity/internal/otp"
+	"identity/internal/token"
 )
 
-func main() {
-	// Initialize Prometheus metrics and start the metrics server.
-	observability.RegisterPrometheusMetrics()
-	go observability.StartMetricsServer(9464)
+// getenv returns the environment variable key, or def when it is unset.
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// store is the storage needed by the auth service, the OIDC provider,
+// signing key rotation, IdP federation, MFA and citizen OTP login.
+type store interface {
+	auth.Store
+	oidc.Store
+	token.KeyStore
+	federation.Store
+	mfa.Store
+	otp.Store
 
-	// Initialize Jaeger tracer.
-	shutdownTracer := observability.InitTracer("identity", "http://jaeger:14268/api/traces")
-	defer func() {
-		if err := shutdownTracer(context.Background()); err != nil {
-			log.Fatalf("failed to shutdown tracer provider: %v", err)
+	// DeleteExpired deletes the one-time records that expired before the
+	// given time: MFA challenges, authorization codes, password reset
+	// tokens and one-time passwords.
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+// purgeInterval is how often expired one-time records are deleted.
+const purgeInterval = 10 * time.Minute
+
+// purgeExpired deletes expired one-time records from st every
+// purgeInterval until ctx is done, so that unauthenticated endpoints
+// cannot grow the store without bound.
+func purgeExpired(ctx context.Context, st store) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := st.DeleteExpired(ctx, now); err != nil {
+				log.Printf("purge expired records: %v", err)
+			}
 		}
-	}()
+	}
+}
 
-	// Create a new Gin router.
-	r := gin.Default()
-	r.Use(observability.TracingMiddleware())
+// newHandler builds the authentication service and OIDC provider from the
+// environment, or returns an error if it is misconfigured. Without
+// DATABASE_URL users are kept in memory and lost on restart; with it, the
+// database is a readiness check of the admin server and is closed on
+// shutdown.
+func newHandler(ctx context.Context, app *service.App) (*handlers.Handler, error) {
+	var st store
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		db, err := database.Open(url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		st = database.NewStore(db)
+		app.Admin.AddCheck("database", db.PingContext)
+		app.OnShutdown(func(context.Context) error { return db.Close() })
+	} else {
+		log.Println("DATABASE_URL not set; keeping users in memory.")
+		st = memory.NewStore()
+	}
+	go purgeExpired(ctx, st)
 
-	// Setup Documentation endpoints (Swagger/OpenAPI).
-	docs.SetupDocumentation(r)
+	ttl, err := time.ParseDuration(getenv("ACCESS_TOKEN_TTL", "15m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACCESS_TOKEN_TTL: %w", err)
+	}
 
-	// Use InstrumentHandler from the unified library for your handlers.
-	r.GET("/ping", observability.InstrumentHandler(PingHandler))
+	// Tokens are signed with the RSA key in JWT_PRIVATE_KEY_FILE if set.
+	// Otherwise keys are kept in the store and rotated every
+	// SIGNING_KEY_ROTATION; retired keys stay in the JWKS for an hour past
+	// the token lifetime so that outstanding tokens keep verifying.
+	var keys *token.KeySet
+	if path := os.Getenv("JWT_PRIVATE_KEY_FILE"); path != "" {
+		key, err := token.LoadKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT signing key: %w", err)
+		}
+		keys = token.StaticKeySet(key)
+	} else {
+		rotation, err := time.ParseDuration(getenv("SIGNING_KEY_ROTATION", "24h"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SIGNING_KEY_ROTATION: %w", err)
+		}
+		keys, err = token.NewKeySet(ctx, st, rotation, ttl+time.Hour)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signing keys: %w", err)
+		}
+		go keys.Run(ctx)
+	}
+	issuer := token.NewIssuer(keys, token.Config{
+		Issuer:   getenv("JWT_ISSUER", "http://identity:8080"),
+		Audience: getenv("JWT_AUDIENCE", "digit"),
+		TTL:      ttl,
+	})
 
-	// Register your service with Consul using the discovery functions.
-	err := discovery.RegisterService("identity-service", "identity", "identity", 8080, "http://identity:8080/ping")
+	// Sessions end after SESSION_IDLE_TIMEOUT without use and at most
+	// SESSION_ABSOLUTE_TIMEOUT after sign-in, unless a per-account policy
+	// set at /auth/session-policies says otherwise.
+	var cfg auth.Config
+	if cfg.IdleTimeout, err = time.ParseDuration(getenv("SESSION_IDLE_TIMEOUT", "720h")); err != nil {
+		return nil, fmt.Errorf("invalid SESSION_IDLE_TIMEOUT: %w", err)
+	}
+	if cfg.AbsoluteTimeout, err = time.ParseDuration(getenv("SESSION_ABSOLUTE_TIMEOUT", "2160h")); err != nil {
+		return nil, fmt.Errorf("invalid SESSION_ABSOLUTE_TIMEOUT: %w", err)
+	}
+
+	// PASSWORD_RESET_NOTIFIER=webhook posts reset tokens to the mail or SMS
+	// gateway at PASSWORD_RESET_WEBHOOK_URL. =log writes them to the log
+	// for development only, since the log then grants access to every
+	// account. Unset disables password reset.
+	switch n := os.Getenv("PASSWORD_RESET_NOTIFIER"); n {
+	case "webhook":
+		url := os.Getenv("PASSWORD_RESET_WEBHOOK_URL")
+		if url == "" {
+			return nil, fmt.Errorf("PASSWORD_RESET_NOTIFIER=webhook needs PASSWORD_RESET_WEBHOOK_URL")
+		}
+		cfg.Notifier = &auth.WebhookNotifier{URL: url}
+	case "log":
+		log.Println("PASSWORD_RESET_NOTIFIER=log writes live reset tokens to the log; use it in development only.")
+		cfg.Notifier = auth.LogNotifier{}
+	case "":
+		log.Println("PASSWORD_RESET_NOTIFIER not set; password reset is disabled.")
+	default:
+		return nil, fmt.Errorf("invalid PASSWORD_RESET_NOTIFIER: %q", n)
+	}
+	svc, err := auth.NewService(st, issuer, cfg)
 	if err != nil {
-		log.Fatalf("Failed to register service with Consul: %v", err)
+		return nil, fmt.Errorf("failed to create auth service: %w", err)
+	}
+	if svc.Guard, err = newGuard(ctx); err != nil {
+		return nil, err
+	}
+
+	// OAuth clients are registered from the JSON file in OIDC_CLIENTS_FILE.
+	provider := oidc.NewProvider(svc, st)
+	if path := os.Getenv("OIDC_CLIENTS_FILE"); path != "" {
+		n, err := provider.LoadClients(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load OIDC clients: %w", err)
+		}
+		log.Printf("Registered %d OIDC clients.", n)
+	}
+	h := handlers.New(svc, provider)
+
+	// POST /authorize decides with the policy in AUTHZ_POLICY_FILE, or
+	// the default policy when unset.
+	if path := os.Getenv("AUTHZ_POLICY_FILE"); path != "" {
+		policy, err := authz.LoadPolicy(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load authorization policy: %w", err)
+		}
+		h.Authz = authz.NewEngine(policy)
+		log.Printf("Loaded %d authorization rules.", len(policy.Rules))
 	}
 
-	// Start the HTTP server.
-	r.Run() // listens on 0.0.0.0:8080
+	// Users may enrol authenticators; MFA_REQUIRED_ROLES, a
+	// comma-separated list, sets the platform-wide MFA policy at startup.
+	// Per-account policies are managed at /auth/mfa/policies.
+	h.MFA = mfa.NewService(st, svc, mfa.Config{Issuer: getenv("MFA_ISSUER", "DIGIT")})
+	if roles := os.Getenv("MFA_REQUIRED_ROLES"); roles != "" {
+		if _, err := h.MFA.SetPolicy(ctx, "", strings.FieldsFunc(roles, func(r rune) bool { return r == ',' || r == ' ' })); err != nil {
+			return nil, fmt.Errorf("failed to set MFA policy: %w", err)
+		}
+	}
+
+	// Citizens sign in with an OTP_LENGTH digit code (default 6) sent to
+	// their mobile and valid for OTP_TTL (default 5m), stored keyed by
+	// OTP_SECRET, which replicas must share. OTP_SENDER=webhook posts codes
+	// to the SMS gateway at OTP_WEBHOOK_URL; =log writes them to the log for
+	// development only. Unset disables OTP login.
+	var sender otp.Sender
+	switch n := os.Getenv("OTP_SENDER"); n {
+	case "webhook":
+		url := os.Getenv("OTP_WEBHOOK_URL")
+		if url == "" {
+			return nil, fmt.Errorf("OTP_SENDER=webhook needs OTP_WEBHOOK_URL")
+		}
+		sender = &otp.WebhookSender{URL: url}
+	case "log":
+		log.Println("OTP_SENDER=log writes live login codes to the log; use it in development only.")
+		sender = otp.LogSender{}
+	case "":
+		log.Println("OTP_SENDER not set; OTP login is disabled.")
+	default:
+		return nil, fmt.Errorf("invalid OTP_SENDER: %q", n)
+	}
+	if sender != nil {
+		otpCfg := otp.Config{Sender: sender, Secret: []byte(os.Getenv("OTP_SECRET"))}
+		if len(otpCfg.Secret) == 0 {
+			log.Println("OTP_SECRET not set; codes can only be verified by the replica that sent them.")
+		}
+		if s := os.Getenv("OTP_LENGTH"); s != "" {
+			if otpCfg.Length, err = strconv.Atoi(s); err != nil || otpCfg.Length < 4 || otpCfg.Length > 10 {
+				return nil, fmt.Errorf("invalid OTP_LENGTH: %q", s)
+			}
+		}
+		if otpCfg.TTL, err = time.ParseDuration(getenv("OTP_TTL", "5m")); err != nil {
+			return nil, fmt.Errorf("invalid OTP_TTL: %w", err)
+		}
+		h.OTP = otp.NewService(st, svc, otpCfg)
+		h.OTP.Limiter = svc.Guard.Store
+	}
+
+	// Tokens from an external IdP such as Keycloak are exchanged at
+	// /auth/federated/<FEDERATION_NAME> when FEDERATION_ISSUER is set.
+	// FEDERATION_CLIENT_ID is required so that tokens the IdP issued to
+	// its other clients are refused. Federated users are held to the local
+	// MFA policy.
+	if issuer := os.Getenv("FEDERATION_ISSUER"); issuer != "" {
+		cfg := federation.Config{
+			Name:     getenv("FEDERATION_NAME", "keycloak"),
+			Issuer:   issuer,
+			ClientID: os.Getenv("FEDERATION_CLIENT_ID"),
+			JWKSURL:  os.Getenv("FEDERATION_JWKS_URL"),
+		}
+		if cfg.ClientID == "" {
+			return nil, fmt.Errorf("FEDERATION_CLIENT_ID is required with FEDERATION_ISSUER")
+		}
+		if path := os.Getenv("FEDERATION_MAPPING_FILE"); path != "" {
+			if cfg.Mapping, err = federation.LoadMapping(path); err != nil {
+				return nil, fmt.Errorf("failed to load federation mapping: %w", err)
+			}
+		}
+		fed := federation.New(cfg, st, svc)
+		fed.MFA = h.MFA
+		h.Federators = map[string]*federation.Federator{cfg.Name: fed}
+		log.Printf("Federating with %s at %s.", cfg.Name, issuer)
+	}
+	return h, nil
+}
+
+// newGuard returns the login lockout guard. Failures are counted in the
+// Redis at REDIS_URL, shared by every replica, falling back to memory while
+// Redis is unreachable, or in memory alone when unset.
+// LOCKOUT_USER_THRESHOLD and LOCKOUT_IP_THRESHOLD set the failures after
+// which a user or client IP is locked out.
+func newGuard(ctx context.Context) (*lockout.Guard, error) {
+	var store lockout.Store = lockout.NewMemoryStore()
+	if url := os.Getenv("REDIS_URL"); url != "" {
+		opts, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		client := redis.NewClient(opts)
+		if err := client.Ping(ctx).Err(); err != nil {
+			log.Printf("Redis at REDIS_URL unreachable: %v", err)
+		}
+		store = lockout.NewFallbackStore(lockout.NewRedisStore(client))
+	} else {
+		log.Println("REDIS_URL not set; counting failed logins in memory.")
+	}
+	var cfg lockout.Config
+	for key, v := range map[string]*int{
+		"LOCKOUT_USER_THRESHOLD": &cfg.UserThreshold,
+		"LOCKOUT_IP_THRESHOLD":   &cfg.IPThreshold,
+	} {
+		if s := os.Getenv(key); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid %s: %q", key, s)
+			}
+			*v = n
+		}
+	}
+	return lockout.NewGuard(store, cfg), nil
+}
+
+func main() {
+	// Ports, the OTLP trace endpoint and the Consul registration come from
+	// flags, the environment or the file in CONFIG_FILE; see
+	// config.Service.
+	cfg := config.Service{Name: "identity"}
+	config.MustLoad(&cfg)
+
+	// The runner sets up logging, metrics, tracing and the admin port,
+	// registers this instance with Consul under its own ID and deregisters
+	// it on SIGTERM before shutting down gracefully.
+	err := service.Run(context.Background(), service.Descriptor{
+		Config:   cfg,
+		Swagger:  true,
+		BasePath: "/identity",
+		Setup: func(ctx context.Context, app *service.App) error {
+			// Users call without a service token; calls from other
+			// services, such as the MCP service, must carry a valid one.
+			verifier, err := svcauth.VerifierFromEnv(app.Config.Name)
+			if err != nil {
+				return err
+			}
+			if verifier != nil {
+				app.Engine.Use(svcauth.GinOptionalMiddleware(verifier))
+			} else {
+				app.Logger.Warn("serving without service authentication", "reason", svcauth.EnvAuthDisabled)
+			}
+
+			lockout.RegisterMetrics(app.Registry, app.Config.MetricsNamespace)
+			app.Engine.GET("/ping", PingHandler)
+
+			// Registration, login, token refresh, logout, password reset
+			// and the OpenID Connect provider endpoints.
+			h, err := newHandler(ctx, app)
+			if err != nil {
+				return err
+			}
+			h.Register(app.Engine)
+			return nil
+		},
+	})
+	if err != nil {
+		log.Fatalf("identity: %v", err)
+	}
 }
 
-// PingHandler is a sample endpoint that records a business metric.
+// PingHandler is a sample endpoint that records a business event.
 // @Summary Health check endpoint
 // @Description Returns a simple pong response to verify the service is running
 // @Tags health
@@ -66,18 +370,17 @@ func PingHandler(c *gin.Context) {
 	_, span := observability.StartSpan(c.Request.Context(), "PingHandler")
 	defer span.End()
 
-	// Example business metric recording.
-	who := "User-123"
-	what := "Ping"
-	why := "HealthCheck"
-	when := time.Now().Format(time.RFC3339)
-	how := "HTTP"
-	where := "Server-1"
-	whom := "Service-Identity"
-	account := "Account-123"
-	howmuch := "100"
-
-	observability.RecordBusinessMetric(who, what, why, when, how, where, whom, account, howmuch)
+	// Example business event; only what, how and account label metrics.
+	observability.RecordBusinessEvent(c.Request.Context(), observability.BusinessEvent{
+		Who:     "User-123",
+		What:    "Ping",
+		Why:     "HealthCheck",
+		How:     "HTTP",
+		Where:   "Server-1",
+		Whom:    "Service-Identity",
+		Account: "Account-123",
+		HowMuch: 100,
+	})
 
 	c.String(http.StatusOK, "pong")
 }
@@ -1,22 +1,30 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 
+	"github.com/digitnxt/digit/pkg/config"
+	"github.com/digitnxt/digit/pkg/observability"
+	"github.com/digitnxt/digit/pkg/service"
+	"github.com/digitnxt/digit/pkg/svcauth"
 	"github.com/gin-gonic/gin"
 	"github.com/go-resty/resty/v2"
 	consulapi "github.com/hashicorp/consul/api"
 )
 
-// MCPConfig holds MCP server configuration
-type MCPConfig struct {
-	Port            int
-	ModelContextURL string
-	LlamaServerURL  string
-}
+// serviceName is the name the MCP server registers and signs calls as.
+const serviceName = "mcp-service"
+
+// client calls the model context service and discovered services. When
+// SERVICE_KEY is set, requests carry a service token naming the service
+// they are sent to.
+var client = resty.New()
 
 // Service represents a discovered service
 type Service struct {
@@ -34,68 +42,57 @@ type Endpoint struct {
 }
 
 func main() {
-	config := MCPConfig{
-		Port:            8086,
-		ModelContextURL: "http://model-context-service:8085",
-		LlamaServerURL:  "http://llama-server:8082",
-	}
-
-	r := gin.Default()
-
-	// Enable CORS
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
+	// Ports, tracing and the Consul registration are configured by the
+	// shared service settings; see config.Service.
+	settings := config.Service{Name: serviceName, Port: 8086}
+	config.MustLoad(&settings)
+
+	err := service.Run(context.Background(), service.Descriptor{
+		Config:     settings,
+		Middleware: []gin.HandlerFunc{cors},
+		Setup: func(ctx context.Context, app *service.App) error {
+			// Outgoing calls carry the trace context and, when SERVICE_KEY
+			// is set, a service token.
+			var transport http.RoundTripper = observability.NewTransport(nil)
+			signer, err := svcauth.SignerFromEnv(serviceName)
+			if err != nil {
+				return fmt.Errorf("invalid service key: %w", err)
+			}
+			if signer != nil {
+				transport = svcauth.NewTransport(signer, transport)
+				log.Printf("Signing service calls as %s with public key %s", serviceName, svcauth.EncodePublicKey(signer.Key.Public().(ed25519.PublicKey)))
+			} else {
+				log.Printf("%s not set; calling services without service tokens.", svcauth.EnvKey)
+			}
+			client.SetTransport(transport)
+
+			// MCP endpoints
+			app.Engine.GET("/services", listServices)
+			app.Engine.GET("/services/:name", getServiceDetails)
+			app.Engine.POST("/chat", handleChat)
+			app.Engine.GET("/health", healthCheck)
+			return nil
+		},
 	})
-
-	// Register with Consul
-	err := registerWithConsul(config.Port)
 	if err != nil {
-		log.Fatalf("Failed to register with Consul: %v", err)
+		log.Fatalf("%s: %v", serviceName, err)
 	}
-
-	// MCP endpoints
-	r.GET("/services", listServices)
-	r.GET("/services/:name", getServiceDetails)
-	r.POST("/chat", handleChat)
-	r.GET("/health", healthCheck)
-
-	log.Printf("MCP server starting on port %d", config.Port)
-	log.Fatal(r.Run(fmt.Sprintf(":%d", config.Port)))
 }
 
-func registerWithConsul(port int) error {
-	config := consulapi.DefaultConfig()
-	config.Address = "consul:8500"
-
-	client, err := consulapi.NewClient(config)
-	if err != nil {
-		return fmt.Errorf("failed to create consul client: %v", err)
-	}
-
-	service := &consulapi.AgentServiceRegistration{
-		ID:   "mcp-service",
-		Name: "mcp-service",
-		Port: port,
-		Check: &consulapi.AgentServiceCheck{
-			HTTP:     fmt.Sprintf("http://mcp-service:%d/health", port),
-			Interval: "10s",
-			Timeout:  "5s",
-		},
+// cors allows browsers on any origin to call the MCP endpoints.
+func cors(c *gin.Context) {
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if c.Request.Method == "OPTIONS" {
+		c.AbortWithStatus(204)
+		return
 	}
-
-	return client.Agent().ServiceRegister(service)
+	c.Next()
 }
 
 func listServices(c *gin.Context) {
-	client := resty.New()
-	resp, err := client.R().Get("http://model-context-service:8085/contexts")
+	resp, err := client.R().SetContext(c.Request.Context()).Get("http://model-context-service:8085/contexts")
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("failed to get services: %v", err)})
 		return
@@ -111,9 +108,8 @@ func listServices(c *gin.Context) {
 }
 
 func getServiceDetails(c *gin.Context) {
-	serviceName := c.Param("name")
-	client := resty.New()
-	resp, err := client.R().Get(fmt.Sprintf("http://model-context-service:8085/context/%s", serviceName))
+	name := c.Param("name")
+	resp, err := client.R().SetContext(c.Request.Context()).Get(fmt.Sprintf("http://model-context-service:8085/context/%s", name))
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("failed to get service details: %v", err)})
 		return
@@ -154,8 +150,7 @@ func handleChat(c *gin.Context) {
 	}
 
 	// Get available services
-	client := resty.New()
-	servicesResp, err := client.R().Get("http://model-context-service:8085/contexts")
+	servicesResp, err := client.R().SetContext(c.Request.Context()).Get("http://model-context-service:8085/contexts")
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("failed to get services: %v", err)})
 		return
@@ -172,7 +167,7 @@ func handleChat(c *gin.Context) {
 
 	// Get details for each service
 	for _, service := range services["available_contexts"] {
-		detailsResp, err := client.R().Get(fmt.Sprintf("http://model-context-service:8085/context/%s", service))
+		detailsResp, err := client.R().SetContext(c.Request.Context()).Get(fmt.Sprintf("http://model-context-service:8085/context/%s", service))
 		if err != nil {
 			continue
 		}
@@ -181,6 +176,7 @@ func handleChat(c *gin.Context) {
 
 	// Call llama-server to understand the request and get API call details
 	llamaResp, err := client.R().
+		SetContext(c.Request.Context()).
 		SetBody(map[string]interface{}{
 			"messages": []map[string]string{
 				{"role": "system", "content": fmt.Sprintf(`You are an API assistant. Given a user request and available services, determine:
@@ -263,11 +259,14 @@ Available services and their details:
 	var apiResp *resty.Response
 	url := fmt.Sprintf("http://%s:8080%s", serviceAddr, apiCall.Endpoint)
 
+	// The address comes from Consul, so the token's audience is named
+	// explicitly rather than taken from the host.
+	ctx := svcauth.WithAudience(c.Request.Context(), apiCall.Service)
 	switch apiCall.Method {
 	case "GET":
-		apiResp, err = client.R().SetQueryParams(queryParams).Get(url)
+		apiResp, err = client.R().SetContext(ctx).SetQueryParams(queryParams).Get(url)
 	case "POST":
-		apiResp, err = client.R().SetBody(apiCall.Parameters).Post(url)
+		apiResp, err = client.R().SetContext(ctx).SetBody(apiCall.Parameters).Post(url)
 	default:
 		c.JSON(400, gin.H{"error": "unsupported HTTP method"})
 		return
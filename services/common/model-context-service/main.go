@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 
+	"github.com/digitnxt/digit/pkg/config"
+	"github.com/digitnxt/digit/pkg/observability"
+	"github.com/digitnxt/digit/pkg/service"
+	"github.com/digitnxt/digit/pkg/svcauth"
 	"github.com/gin-gonic/gin"
 	"github.com/go-resty/resty/v2"
 	consulapi "github.com/hashicorp/consul/api"
@@ -19,9 +26,17 @@ type ServiceConfig struct {
 
 var serviceConfigs = map[string]ServiceConfig{
 	"identity": {SwaggerPath: "/swagger/doc.json", Port: 8080},
+	"account":  {SwaggerPath: "/openapi.json", Port: 8080},
 	// Add more services here as they become available
 }
 
+// serviceName is the name callers address their service tokens to.
+const serviceName = "model-context-service"
+
+// client fetches API documentation. When SERVICE_KEY is set, requests
+// carry a service token naming the service they are sent to.
+var client = resty.New()
+
 // ModelContext represents the structured format for LLM consumption
 type ModelContext struct {
 	Name        string                 `json:"name"`
@@ -64,32 +79,65 @@ type SchemaInfo struct {
 }
 
 func main() {
-	r := gin.Default()
-
-	// Enable CORS
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
-	})
+	// Ports, tracing and the Consul registration are configured by the
+	// shared service settings; see config.Service.
+	settings := config.Service{Name: serviceName, Port: 8085}
+	config.MustLoad(&settings)
+
+	err := service.Run(context.Background(), service.Descriptor{
+		Config:     settings,
+		Middleware: []gin.HandlerFunc{cors},
+		Setup: func(ctx context.Context, app *service.App) error {
+			// Outgoing calls carry the trace context and, when SERVICE_KEY
+			// is set, a service token.
+			var transport http.RoundTripper = observability.NewTransport(nil)
+			signer, err := svcauth.SignerFromEnv(serviceName)
+			if err != nil {
+				return fmt.Errorf("invalid service key: %w", err)
+			}
+			if signer != nil {
+				transport = svcauth.NewTransport(signer, transport)
+				log.Printf("Signing service calls as %s with public key %s", serviceName, svcauth.EncodePublicKey(signer.Key.Public().(ed25519.PublicKey)))
+			}
+			client.SetTransport(transport)
+			verifier, err := svcauth.VerifierFromEnv(serviceName)
+			if err != nil {
+				return fmt.Errorf("invalid trusted service keys: %w", err)
+			}
 
-	// Endpoint to get model context for a specific service
-	r.GET("/context/:service", getModelContext)
+			// Contexts are served only to trusted services. Without trusted
+			// keys the service does not start, unless SERVICE_AUTH_DISABLED
+			// opens the endpoints for local use.
+			contexts := app.Engine.Group("/")
+			if verifier != nil {
+				contexts.Use(svcauth.GinMiddleware(verifier))
+			} else {
+				app.Logger.Warn("serving contexts without service authentication", "reason", svcauth.EnvAuthDisabled)
+			}
 
-	// Endpoint to list all available service contexts
-	r.GET("/contexts", listAvailableContexts)
+			// Endpoint to get model context for a specific service
+			contexts.GET("/context/:service", getModelContext)
 
-	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy"})
+			// Endpoint to list all available service contexts
+			contexts.GET("/contexts", listAvailableContexts)
+			return nil
+		},
 	})
+	if err != nil {
+		log.Fatalf("%s: %v", serviceName, err)
+	}
+}
 
-	log.Fatal(r.Run(":8085"))
+// cors allows browsers on any origin to call the context endpoints.
+func cors(c *gin.Context) {
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if c.Request.Method == "OPTIONS" {
+		c.AbortWithStatus(204)
+		return
+	}
+	c.Next()
 }
 
 func getModelContext(c *gin.Context) {
@@ -112,9 +160,9 @@ func getModelContext(c *gin.Context) {
 	// Build Swagger doc URL
 	swaggerURL := fmt.Sprintf("http://%s:%d%s", serviceAddr, config.Port, config.SwaggerPath)
 
-	// Fetch Swagger documentation
-	client := resty.New()
-	resp, err := client.R().Get(swaggerURL)
+	// Fetch Swagger documentation. The address comes from Consul, so the
+	// token's audience is named explicitly.
+	resp, err := client.R().SetContext(svcauth.WithAudience(c.Request.Context(), service)).Get(swaggerURL)
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("failed to fetch swagger doc: %v", err)})
 		return
@@ -219,6 +267,20 @@ func convertSwaggerToModelContext(swagger map[string]interface{}) ModelContext {
 		}
 	}
 
+	// OpenAPI 3 documents keep schemas under components and list servers
+	// instead of host and basePath.
+	if components, ok := swagger["components"].(map[string]interface{}); ok {
+		if schemas, ok := components["schemas"].(map[string]interface{}); ok {
+			for name, schema := range schemas {
+				mc.Schemas[name] = convertToSchema(schema.(map[string]interface{}))
+			}
+		}
+	}
+	if version, ok := swagger["openapi"]; ok {
+		mc.Metadata["openapi"] = version
+		mc.Metadata["servers"] = swagger["servers"]
+	}
+
 	return mc
 }
 
@@ -250,6 +312,11 @@ func convertToEndpoint(path, method string, details map[string]interface{}) Endp
 		}
 	}
 
+	// Convert the OpenAPI 3 request body
+	if requestBody, ok := details["requestBody"].(map[string]interface{}); ok {
+		endpoint.RequestBody = requestBody
+	}
+
 	// Convert responses
 	if responses, ok := details["responses"].(map[string]interface{}); ok {
 		endpoint.Responses = responses